@@ -0,0 +1,96 @@
+// Package admin provides the admin-only HTTP listener used for profiling,
+// runtime control, health probes, and metrics scrapes. It is bound to a
+// separate address from the public API, so pprof and the admin API are never
+// exposed through the public router. The admin routes and their middleware
+// stack are declared in the routes package.
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"strings"
+	"time"
+
+	"app/config"
+	"app/middleware"
+)
+
+// Registrar is where admin routes are registered, such as a routes.Router.
+type Registrar interface {
+	HandleFunc(pattern string, h http.HandlerFunc)
+}
+
+// Config configures the admin listener.
+type Config struct {
+	Addr string
+	// Token, if set, must be sent as a bearer token; it also enables the /admin API.
+	Token string
+	// Filter admits clients by CIDR.
+	Filter *middleware.IPFilter
+}
+
+// NewConfig builds the listener's configuration from the admin section. An
+// allowed CIDR of "*" admits every client not denied. It reports false when
+// the address is "off".
+func NewConfig(cfg config.Admin) (Config, bool) {
+	if cfg.Addr == config.AdminOff {
+		return Config{}, false
+	}
+	allowed := cfg.AllowedCIDRs
+	if slices.Contains(allowed, "*") {
+		allowed = nil
+	}
+	return Config{
+		Addr:   cfg.Addr,
+		Token:  cfg.Token,
+		Filter: middleware.NewIPFilter(allowed, cfg.DeniedCIDRs),
+	}, true
+}
+
+// NewServer returns the admin server for handler.
+func NewServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// RegisterPprof registers the pprof endpoints under /debug/pprof/ (heap,
+// profile, goroutine, trace, and the other runtime profiles).
+func RegisterPprof(r Registrar) {
+	r.HandleFunc("/debug/pprof/", pprof.Index)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// RegisterAPI registers the /admin API for runtime chaos, maintenance,
+// feature flag, sampling, and instrumentation A/B control, and request
+// recording.
+func RegisterAPI(r Registrar) {
+	registerChaosAPI(r)
+	registerMaintenanceAPI(r)
+	registerFlagsAPI(r)
+	registerSamplingAPI(r)
+	registerInstrumentationAPI(r)
+	registerRecordingAPI(r)
+}
+
+// RequireToken rejects requests without the admin bearer token with 401.
+func RequireToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"app/chaos"
+	"app/logging"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ChaosResponse is the JSON payload of the chaos admin endpoints.
+type ChaosResponse struct {
+	// Knobs are the configured knobs; Effective adds any active outages.
+	Knobs     chaos.Knobs    `json:"knobs"`
+	Effective chaos.Knobs    `json:"effective"`
+	Outages   []chaos.Outage `json:"outages"`
+	Scenarios []string       `json:"scenarios"`
+}
+
+// ChaosUpdate is the body of PUT /admin/chaos. Scenario, if set, is applied
+// first; any knob fields then override it and mark the knobs as custom.
+type ChaosUpdate struct {
+	Scenario           *string  `json:"scenario"`
+	DBFailureRate      *float64 `json:"db_failure_rate"`
+	DBLatencyFactor    *float64 `json:"db_latency_factor"`
+	PaymentFailureRate *float64 `json:"payment_failure_rate"`
+	OutOfStockRate     *float64 `json:"out_of_stock_rate"`
+	LatencyFactor      *float64 `json:"latency_factor"`
+}
+
+// OutageRequest is the body of POST /admin/chaos/outages. Start defaults to now.
+type OutageRequest struct {
+	Target   string     `json:"target"`
+	Start    *time.Time `json:"start"`
+	Duration string     `json:"duration"`
+}
+
+// registerChaosAPI registers the chaos control endpoints.
+func registerChaosAPI(r Registrar) {
+	r.HandleFunc("GET /admin/chaos", getChaos)
+	r.HandleFunc("PUT /admin/chaos", updateChaos)
+	r.HandleFunc("POST /admin/chaos/outages", scheduleOutage)
+	r.HandleFunc("DELETE /admin/chaos/outages/{id}", cancelOutage)
+}
+
+func getChaos(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, chaosState())
+}
+
+func updateChaos(w http.ResponseWriter, r *http.Request) {
+	var req ChaosUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The chaos update is not valid JSON.")
+		return
+	}
+
+	before := chaos.Base()
+	k := before
+	if req.Scenario != nil {
+		scenario, ok := chaos.Scenarios[*req.Scenario]
+		if !ok {
+			problem.Write(w, r, problem.InvalidRequest, fmt.Sprintf("Unknown chaos scenario %q.", *req.Scenario))
+			return
+		}
+		k = scenario
+		k.Scenario = *req.Scenario
+	}
+	custom := false
+	for _, f := range []struct {
+		value *float64
+		dst   *float64
+		name  string
+		rate  bool
+	}{
+		{req.DBFailureRate, &k.DBFailureRate, "db_failure_rate", true},
+		{req.DBLatencyFactor, &k.DBLatencyFactor, "db_latency_factor", false},
+		{req.PaymentFailureRate, &k.PaymentFailureRate, "payment_failure_rate", true},
+		{req.OutOfStockRate, &k.OutOfStockRate, "out_of_stock_rate", true},
+		{req.LatencyFactor, &k.LatencyFactor, "latency_factor", false},
+	} {
+		if f.value == nil {
+			continue
+		}
+		if f.rate && (*f.value < 0 || *f.value > 1) {
+			problem.Write(w, r, problem.InvalidRequest, f.name+" must be between 0 and 1.")
+			return
+		}
+		if !f.rate && *f.value <= 0 {
+			problem.Write(w, r, problem.InvalidRequest, f.name+" must be positive.")
+			return
+		}
+		*f.dst = *f.value
+		custom = true
+	}
+	if custom {
+		k.Scenario = chaos.CustomScenario
+	}
+
+	chaos.Set(k)
+	audit(r, "chaos.update", before, k)
+	writeJSON(w, http.StatusOK, chaosState())
+}
+
+func scheduleOutage(w http.ResponseWriter, r *http.Request) {
+	var req OutageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The outage request is not valid JSON.")
+		return
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "duration must be a Go duration such as 30s or 5m.")
+		return
+	}
+	start := time.Now()
+	if req.Start != nil {
+		start = *req.Start
+	}
+	outage, err := chaos.ScheduleOutage(req.Target, start, d)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	audit(r, "chaos.outage.schedule", nil, outage)
+	w.Header().Set("Location", "/admin/chaos/outages/"+strconv.Itoa(outage.ID))
+	writeJSON(w, http.StatusCreated, outage)
+}
+
+func cancelOutage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The outage id must be an integer.")
+		return
+	}
+	outage, ok := chaos.CancelOutage(id)
+	if !ok {
+		problem.Write(w, r, problem.NotFound, "The outage does not exist or has ended.")
+		return
+	}
+
+	audit(r, "chaos.outage.cancel", outage, nil)
+	writeJSON(w, http.StatusOK, outage)
+}
+
+func chaosState() ChaosResponse {
+	return ChaosResponse{
+		Knobs:     chaos.Base(),
+		Effective: chaos.Current(),
+		Outages:   chaos.Outages(),
+		Scenarios: chaos.ScenarioNames(),
+	}
+}
+
+// audit records an admin change as an "admin.audit" event on the request span
+// and as an audit entry (log.type=audit) in the JSON log.
+func audit(r *http.Request, action string, before, after any) {
+	ctx := r.Context()
+	attrs := []attribute.KeyValue{
+		attribute.String("log.type", "audit"),
+		attribute.String("admin.action", action),
+		attribute.String("admin.client", clientAddr(r)),
+	}
+	if before != nil {
+		attrs = append(attrs, attribute.String("admin.before", toJSON(before)))
+	}
+	if after != nil {
+		attrs = append(attrs, attribute.String("admin.after", toJSON(after)))
+	}
+	trace.SpanFromContext(ctx).AddEvent("admin.audit", trace.WithAttributes(attrs...))
+	logging.JSONLogger.Info(ctx, "Admin change: "+action, attrs...)
+}
+
+func clientAddr(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func toJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
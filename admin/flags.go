@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"app/featureflags"
+	"app/problem"
+)
+
+// FlagUpdate is the body of PUT /admin/flags/{name}. Omitted fields keep their
+// current value; a new flag defaults to enabled with a 100% rollout.
+type FlagUpdate struct {
+	Enabled *bool `json:"enabled"`
+	Rollout *int  `json:"rollout"`
+}
+
+// registerFlagsAPI registers the feature flag endpoints.
+func registerFlagsAPI(r Registrar) {
+	r.HandleFunc("GET /admin/flags", listFlags)
+	r.HandleFunc("PUT /admin/flags/{name}", updateFlag)
+}
+
+func listFlags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, featureflags.All())
+}
+
+func updateFlag(w http.ResponseWriter, r *http.Request) {
+	var req FlagUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The flag update is not valid JSON.")
+		return
+	}
+
+	name := r.PathValue("name")
+	before, ok := featureflags.Get(name)
+	f := before
+	if !ok {
+		f = featureflags.Flag{Name: name, Enabled: true, Rollout: 100}
+	}
+	if req.Enabled != nil {
+		f.Enabled = *req.Enabled
+	}
+	if req.Rollout != nil {
+		f.Rollout = *req.Rollout
+	}
+	after, err := featureflags.Set(f)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidRequest, err.Error())
+		return
+	}
+
+	if ok {
+		audit(r, "flags.update", before, after)
+	} else {
+		audit(r, "flags.update", nil, after)
+	}
+	writeJSON(w, http.StatusOK, after)
+}
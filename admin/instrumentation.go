@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"app/instrumentation"
+	"app/problem"
+)
+
+// Instrumentation is the payload of the instrumentation A/B admin endpoints.
+type Instrumentation struct {
+	// NoopPercent is the percentage (0-100) of requests served with no-op
+	// telemetry.
+	NoopPercent int `json:"noop_percent"`
+}
+
+// registerInstrumentationAPI registers the instrumentation A/B endpoints. A
+// change lasts until the next one or the next config reload.
+func registerInstrumentationAPI(r Registrar) {
+	r.HandleFunc("GET /admin/instrumentation", getInstrumentation)
+	r.HandleFunc("PUT /admin/instrumentation", updateInstrumentation)
+}
+
+func getInstrumentation(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Instrumentation{NoopPercent: instrumentation.NoopPercent()})
+}
+
+func updateInstrumentation(w http.ResponseWriter, r *http.Request) {
+	var req Instrumentation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The instrumentation update is not valid JSON.")
+		return
+	}
+	if req.NoopPercent < 0 || req.NoopPercent > 100 {
+		problem.Write(w, r, problem.InvalidRequest, "noop_percent must be between 0 and 100.")
+		return
+	}
+
+	before := Instrumentation{NoopPercent: instrumentation.NoopPercent()}
+	instrumentation.SetNoopPercent(req.NoopPercent)
+	audit(r, "instrumentation.update", before, req)
+	writeJSON(w, http.StatusOK, req)
+}
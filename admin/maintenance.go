@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"app/middleware"
+	"app/problem"
+)
+
+// MaintenanceResponse is the JSON payload of the maintenance admin endpoints.
+type MaintenanceResponse struct {
+	Enabled    bool       `json:"enabled"`
+	RetryAfter string     `json:"retry_after"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// MaintenanceUpdate is the body of PUT /admin/maintenance.
+type MaintenanceUpdate struct {
+	Enabled    bool   `json:"enabled"`
+	RetryAfter string `json:"retry_after"`
+}
+
+// registerMaintenanceAPI registers the maintenance mode endpoints.
+func registerMaintenanceAPI(r Registrar) {
+	r.HandleFunc("GET /admin/maintenance", getMaintenance)
+	r.HandleFunc("PUT /admin/maintenance", updateMaintenance)
+}
+
+func getMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, maintenanceResponse(middleware.Maintenance()))
+}
+
+func updateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The maintenance update is not valid JSON.")
+		return
+	}
+	var retryAfter time.Duration
+	if req.RetryAfter != "" {
+		d, err := time.ParseDuration(req.RetryAfter)
+		if err != nil || d < time.Second {
+			problem.Write(w, r, problem.InvalidRequest, "retry_after must be a Go duration of at least 1s.")
+			return
+		}
+		retryAfter = d
+	}
+
+	before := maintenanceResponse(middleware.Maintenance())
+	after := maintenanceResponse(middleware.SetMaintenance(req.Enabled, retryAfter))
+	audit(r, "maintenance.update", before, after)
+	writeJSON(w, http.StatusOK, after)
+}
+
+func maintenanceResponse(s middleware.MaintenanceState) MaintenanceResponse {
+	resp := MaintenanceResponse{Enabled: s.Enabled, Since: s.Since}
+	if s.RetryAfter > 0 {
+		resp.RetryAfter = s.RetryAfter.String()
+	}
+	return resp
+}
@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"app/problem"
+	"app/recording"
+)
+
+// RecordingUpdate is the body of PUT /admin/recording.
+type RecordingUpdate struct {
+	Enabled bool `json:"enabled"`
+	// File is the recording's file name in the recording directory; it
+	// defaults to one named after the time.
+	File string `json:"file"`
+	// Limit stops recording after that many requests; 0 is no limit.
+	Limit int `json:"limit"`
+}
+
+// registerRecordingAPI registers the request recording endpoints.
+func registerRecordingAPI(r Registrar) {
+	r.HandleFunc("GET /admin/recording", getRecording)
+	r.HandleFunc("PUT /admin/recording", updateRecording)
+}
+
+func getRecording(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, recording.Current())
+}
+
+func updateRecording(w http.ResponseWriter, r *http.Request) {
+	var req RecordingUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The recording update is not valid JSON.")
+		return
+	}
+	if req.Limit < 0 {
+		problem.Write(w, r, problem.InvalidRequest, "limit must not be negative.")
+		return
+	}
+
+	before := recording.Current()
+	after := recording.Stop()
+	if req.Enabled {
+		if req.File == "" {
+			req.File = "requests-" + time.Now().UTC().Format("20060102T150405Z") + ".jsonl"
+		}
+		var err error
+		if after, err = recording.Start(req.File, req.Limit); err != nil {
+			problem.Write(w, r, problem.InvalidRequest, "The recording could not be started: "+err.Error())
+			return
+		}
+	}
+	audit(r, "recording.update", before, after)
+	writeJSON(w, http.StatusOK, after)
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"app/problem"
+	"app/tracing"
+)
+
+// Sampling is the payload of the sampling admin endpoints.
+type Sampling struct {
+	// Ratio is the fraction (0-1) of new traces sampled.
+	Ratio float64 `json:"ratio"`
+}
+
+// registerSamplingAPI registers the trace sampling endpoints. A change lasts
+// until the next one or the next config reload.
+func registerSamplingAPI(r Registrar) {
+	r.HandleFunc("GET /admin/sampling", getSampling)
+	r.HandleFunc("PUT /admin/sampling", updateSampling)
+}
+
+func getSampling(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Sampling{Ratio: tracing.SampleRatio()})
+}
+
+func updateSampling(w http.ResponseWriter, r *http.Request) {
+	var req Sampling
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The sampling update is not valid JSON.")
+		return
+	}
+	if req.Ratio < 0 || req.Ratio > 1 {
+		problem.Write(w, r, problem.InvalidRequest, "ratio must be between 0 and 1.")
+		return
+	}
+
+	before := Sampling{Ratio: tracing.SampleRatio()}
+	tracing.SetSampleRatio(req.Ratio)
+	audit(r, "sampling.update", before, req)
+	writeJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,154 @@
+// Package anomaly flags requests whose latency is far above their route's
+// recent norm, as a lightweight in-process anomaly signal.
+//
+// Each route keeps an exponentially weighted moving average of its latency and
+// of the latency's variance. Once the route has served enough requests for the
+// baseline to be trusted, a request slower than the mean by more than the
+// configured number of standard deviations (and by at least a minimum
+// deviation) is anomalous: a "latency.anomaly" event is added to its span, a
+// WARN log correlated with it is written, and latency_anomalies_total is
+// incremented. Every request, anomalous or not, then updates the baseline, so
+// a lasting shift in latency becomes the new norm instead of flagging every
+// request from then on.
+package anomaly
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"app/config"
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/anomaly"
+
+// EventName is the span event added to anomalous requests.
+const EventName = "latency.anomaly"
+
+// minStdDev is the least standard deviation, in seconds, scores divide by.
+const minStdDev = 1e-6
+
+// Detector holds the latency baselines of the routes.
+type Detector struct {
+	cfg   config.Anomaly
+	alpha float64
+
+	anomalies metric.Int64Counter
+
+	mu        sync.Mutex
+	baselines map[string]*baseline
+}
+
+// baseline is a route's moving latency statistics, in seconds.
+type baseline struct {
+	// count is the number of requests observed.
+	count                  int
+	mean, variance, stdDev float64
+}
+
+// Anomaly describes an anomalous request.
+type Anomaly struct {
+	Route   string
+	Latency time.Duration
+	// Mean and StdDev are the route's baseline before the request.
+	Mean, StdDev time.Duration
+	// Score is the number of standard deviations the latency is above the
+	// mean.
+	Score float64
+}
+
+// New returns a detector configured by cfg, or nil when detection is
+// disabled.
+func New(cfg config.Anomaly) *Detector {
+	if cfg.Threshold <= 0 {
+		return nil
+	}
+	d := &Detector{
+		cfg:       cfg,
+		alpha:     2 / float64(cfg.Window+1),
+		baselines: make(map[string]*baseline),
+	}
+	var err error
+	d.anomalies, err = otel.Meter(instrumentationName).Int64Counter(
+		"latency_anomalies_total",
+		metric.WithDescription("The number of requests much slower than their route's rolling latency baseline"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create latency_anomalies_total counter: %v", err)
+	}
+	return d
+}
+
+// Observe updates route's baseline with a request's latency, and reports and
+// returns the anomaly if the request was anomalous. ctx is the request's, so
+// the event lands on its span and the log is correlated with it.
+func (d *Detector) Observe(ctx context.Context, route string, latency time.Duration) (Anomaly, bool) {
+	a, ok := d.update(route, latency)
+	if !ok {
+		return a, false
+	}
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRoute(route),
+		attribute.Float64("anomaly.latency_ms", ms(a.Latency)),
+		attribute.Float64("anomaly.baseline_mean_ms", ms(a.Mean)),
+		attribute.Float64("anomaly.baseline_stddev_ms", ms(a.StdDev)),
+		attribute.Float64("anomaly.score", math.Round(a.Score*100)/100),
+	}
+	trace.SpanFromContext(ctx).AddEvent(EventName, trace.WithAttributes(attrs...))
+	d.anomalies.Add(ctx, 1, metric.WithAttributes(semconv.HTTPRoute(route)))
+	logging.JSONLogger.Warn(ctx, "Latency anomaly detected", attrs...)
+	return a, true
+}
+
+// update checks latency against route's baseline, then folds it in.
+func (d *Detector) update(route string, latency time.Duration) (Anomaly, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.baselines[route]
+	if !ok {
+		b = &baseline{}
+		d.baselines[route] = b
+	}
+
+	x := latency.Seconds()
+	a := Anomaly{Route: route, Latency: latency, Mean: seconds(b.mean), StdDev: seconds(b.stdDev)}
+	excess := x - b.mean
+	anomalous := false
+	if b.count >= d.cfg.MinSamples && excess >= d.cfg.MinDeviation.Seconds() {
+		// The floor keeps the score finite on a route with perfectly steady
+		// latency, where any excess beyond the minimum deviation is anomalous.
+		a.Score = excess / max(b.stdDev, minStdDev)
+		anomalous = a.Score > d.cfg.Threshold
+	}
+
+	// Exponentially weighted mean and variance; the first request seeds the
+	// mean.
+	if b.count == 0 {
+		b.mean = x
+	} else {
+		incr := d.alpha * excess
+		b.mean += incr
+		b.variance = (1 - d.alpha) * (b.variance + excess*incr)
+		b.stdDev = math.Sqrt(b.variance)
+	}
+	b.count++
+	return a, anomalous
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
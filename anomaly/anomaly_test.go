@@ -0,0 +1,92 @@
+package anomaly
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"app/config"
+	"app/logging"
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestObserve(t *testing.T) {
+	rec := tracetest.Install(t)
+	metrics := tracetest.StartMetrics(t)
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	logging.JSONLogger.SetFile(logFile)
+	d := New(config.Anomaly{Threshold: 4, Window: 50, MinSamples: 20, MinDeviation: 10 * time.Millisecond})
+	ctx := context.Background()
+	observe := func(route string, latency time.Duration) bool {
+		t.Helper()
+		ctx, span := otel.Tracer("test").Start(ctx, "request")
+		defer span.End()
+		_, anomalous := d.Observe(ctx, route, latency)
+		return anomalous
+	}
+
+	// Baselines are untrusted until a route has served enough requests.
+	if observe("/orders", time.Second) {
+		t.Error("first request flagged")
+	}
+	// The slow first request inflates the variance until enough requests
+	// within the norm have been folded in.
+	for i := range 200 {
+		if observe("/orders", time.Duration(95+i%10)*time.Millisecond) {
+			t.Fatalf("request %d within the norm flagged", i)
+		}
+	}
+	// Slow, but less than the minimum deviation above the norm.
+	if observe("/orders", 108*time.Millisecond) {
+		t.Error("request within the minimum deviation flagged")
+	}
+	// Each route has its own baseline.
+	if observe("/inventory", time.Second) {
+		t.Error("request on a route without a baseline flagged")
+	}
+	if !observe("/orders", 400*time.Millisecond) {
+		t.Fatal("request four times slower than the norm not flagged")
+	}
+
+	flagged := rec.Named("request")
+	span := flagged[len(flagged)-1]
+	events := span.Events()
+	if len(events) != 1 || events[0].Name != EventName {
+		t.Fatalf("span events = %v, want one %s", events, EventName)
+	}
+	got := map[attribute.Key]attribute.Value{}
+	for _, kv := range events[0].Attributes {
+		got[kv.Key] = kv.Value
+	}
+	if got["http.route"].AsString() != "/orders" || got["anomaly.latency_ms"].AsFloat64() != 400 {
+		t.Errorf("event attributes = %v, want /orders at 400ms", events[0].Attributes)
+	}
+	if mean := got["anomaly.baseline_mean_ms"].AsFloat64(); mean < 95 || mean > 110 {
+		t.Errorf("baseline mean = %gms, want about 100ms", mean)
+	}
+	if score := got["anomaly.score"].AsFloat64(); score <= 4 {
+		t.Errorf("score = %g, want above the threshold", score)
+	}
+	metrics.AssertCounter(t, "latency_anomalies_total", 1, semconv.HTTPRoute("/orders"))
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "Latency anomaly detected"); n != 1 {
+		t.Errorf("%d anomaly log entries, want 1", n)
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	if d := New(config.Anomaly{}); d != nil {
+		t.Error("detector created with a threshold of 0")
+	}
+}
@@ -0,0 +1,404 @@
+// Package apiclient is the Go client for the order API and the chaos admin
+// API. Other services call the API through it, as do the load generator and
+// the command-line client. It is a module of its own,
+// github.com/ShrutiC-git/go-otel-e2e/apiclient, that depends only on the
+// OpenTelemetry API and otelhttp. Calls go through an otelhttp transport, so
+// each one is a client span that propagates the trace context in ctx to the
+// service with the global propagator, and failed calls return a *StatusError
+// that matches the Err sentinels with errors.Is.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// peerName identifies the API as peer.service on client spans.
+const peerName = "app-api"
+
+// DefaultTimeout bounds a single attempt.
+const DefaultTimeout = 5 * time.Second
+
+// backoff is the delay before the first retry; it doubles for each further
+// retry.
+const backoff = 100 * time.Millisecond
+
+// outOfStockType is the problem type of an out-of-stock order.
+const outOfStockType = "/problems/out-of-stock"
+
+// Item is an order line for CreateOrderV2.
+type Item struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+// Inventory is the result of an inventory check.
+type Inventory struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	DelayMS int    `json:"delay_ms"`
+}
+
+// Order is an order returned by GetOrder.
+type Order struct {
+	ID         int       `json:"id"`
+	CustomerID string    `json:"customer_id"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	// TraceID and SpanID identify the request span that created the order.
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+	// SettlementID is the settlement batch that included the order, if any.
+	SettlementID string `json:"settlement_id,omitempty"`
+}
+
+// Errors that a *StatusError matches with errors.Is, by its status and
+// problem type.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrOutOfStock   = errors.New("out of stock")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrUnavailable  = errors.New("service unavailable")
+)
+
+// StatusError is returned for a response with a non-2xx status.
+type StatusError struct {
+	Status int
+	// Detail is the problem detail or title, or the body if it is not a
+	// problem document.
+	Detail string
+	// Type is the problem type, such as "/problems/out-of-stock", or empty if
+	// the body is not a problem document.
+	Type string
+	// TraceID is the trace the service recorded the request in, if it said.
+	TraceID string
+	// RetryAfter is how long the service asked the client to wait before
+	// trying again, if it did.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Detail)
+}
+
+// Is reports whether the error matches one of the Err sentinels. A 409
+// without a problem type is the inventory check's out-of-stock answer.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrOutOfStock:
+		return e.Status == http.StatusConflict && (e.Type == outOfStockType || e.Type == "")
+	case ErrUnauthorized:
+		return e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.Status == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	attempts int
+	timeout  time.Duration
+}
+
+// WithRetries makes up to attempts attempts at each idempotent call (GETs),
+// retrying transport errors and 429, 502, 503, and 504 responses with
+// exponential backoff. Orders are never retried, so one is not created twice.
+func WithRetries(attempts int) Option {
+	return func(o *options) { o.attempts = attempts }
+}
+
+// WithTimeout bounds each attempt, instead of DefaultTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// Client calls the API at a base URL.
+type Client struct {
+	baseURL string
+	apiKey  string
+	// token, if set, is sent as a bearer token to the admin API.
+	token    string
+	attempts int
+	http     *http.Client
+}
+
+// New returns a client for the API at baseURL, such as
+// "http://localhost:8080". apiKey, if set, is sent as X-API-Key. Unless
+// WithRetries is given, calls are not retried, so each one reaches the service
+// once.
+func New(baseURL, apiKey string, opts ...Option) *Client {
+	o := options{attempts: 1, timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		apiKey:   apiKey,
+		attempts: max(o.attempts, 1),
+		http: &http.Client{
+			Timeout: o.timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithSpanOptions(trace.WithAttributes(semconv.PeerService(peerName))),
+			),
+		},
+	}
+}
+
+// retryable reports whether an attempt at an idempotent request should be
+// retried: after a transport error, unless ctx is done, or a 429, 502, 503,
+// or 504 response.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// NewAdmin returns a client for the admin API at baseURL, such as
+// "http://localhost:6060", authenticating with the ADMIN_TOKEN bearer token.
+func NewAdmin(baseURL, token string, opts ...Option) *Client {
+	c := New(baseURL, "", opts...)
+	c.token = token
+	return c
+}
+
+// CreateOrder creates an order with POST /createOrder and returns its ID. An
+// empty customerID lets the service pick one.
+func (c *Client) CreateOrder(ctx context.Context, customerID string) (int, error) {
+	var resp struct {
+		OrderID int `json:"order_id"`
+	}
+	body := map[string]string{}
+	if customerID != "" {
+		body["customer_id"] = customerID
+	}
+	err := c.do(ctx, http.MethodPost, "/createOrder", body, &resp)
+	return resp.OrderID, err
+}
+
+// CreateOrderV2 creates an order for the items with POST /v2/createOrder and
+// returns its ID.
+func (c *Client) CreateOrderV2(ctx context.Context, customerID string, items []Item) (int, error) {
+	var resp struct {
+		Order struct {
+			ID int `json:"id"`
+		} `json:"order"`
+	}
+	body := map[string]any{"customer_id": customerID, "items": items}
+	err := c.do(ctx, http.MethodPost, "/v2/createOrder", body, &resp)
+	return resp.Order.ID, err
+}
+
+// CheckInventory checks the inventory with GET /checkInventory. An item out
+// of stock is an error matching ErrOutOfStock.
+func (c *Client) CheckInventory(ctx context.Context) (Inventory, error) {
+	var resp Inventory
+	err := c.do(ctx, http.MethodGet, "/checkInventory", nil, &resp)
+	return resp, err
+}
+
+// GetOrder returns the order with GET /orders/{id}. An unknown order is an
+// error matching ErrNotFound.
+func (c *Client) GetOrder(ctx context.Context, id int) (Order, error) {
+	var resp Order
+	err := c.do(ctx, http.MethodGet, "/orders/"+strconv.Itoa(id), nil, &resp)
+	return resp, err
+}
+
+// Tracking returns the order's shipment tracking with GET
+// /orders/{id}/tracking.
+func (c *Client) Tracking(ctx context.Context, id int) (json.RawMessage, error) {
+	var resp json.RawMessage
+	err := c.do(ctx, http.MethodGet, "/orders/"+strconv.Itoa(id)+"/tracking", nil, &resp)
+	return resp, err
+}
+
+// ChaosUpdate changes the chaos knobs with PUT /admin/chaos. Scenario, if
+// set, is applied first, and the knob fields then override it.
+type ChaosUpdate struct {
+	Scenario           *string  `json:"scenario,omitempty" yaml:"scenario"`
+	DBFailureRate      *float64 `json:"db_failure_rate,omitempty" yaml:"db_failure_rate"`
+	DBLatencyFactor    *float64 `json:"db_latency_factor,omitempty" yaml:"db_latency_factor"`
+	PaymentFailureRate *float64 `json:"payment_failure_rate,omitempty" yaml:"payment_failure_rate"`
+	OutOfStockRate     *float64 `json:"out_of_stock_rate,omitempty" yaml:"out_of_stock_rate"`
+	LatencyFactor      *float64 `json:"latency_factor,omitempty" yaml:"latency_factor"`
+}
+
+// ChaosState is the chaos configuration returned by the admin API.
+type ChaosState struct {
+	Knobs struct {
+		Scenario           string  `json:"scenario"`
+		DBFailureRate      float64 `json:"db_failure_rate"`
+		DBLatencyFactor    float64 `json:"db_latency_factor"`
+		PaymentFailureRate float64 `json:"payment_failure_rate"`
+		OutOfStockRate     float64 `json:"out_of_stock_rate"`
+		LatencyFactor      float64 `json:"latency_factor"`
+	} `json:"knobs"`
+}
+
+// Chaos returns the chaos configuration with GET /admin/chaos.
+func (c *Client) Chaos(ctx context.Context) (ChaosState, error) {
+	var resp ChaosState
+	err := c.do(ctx, http.MethodGet, "/admin/chaos", nil, &resp)
+	return resp, err
+}
+
+// UpdateChaos changes the chaos knobs with PUT /admin/chaos.
+func (c *Client) UpdateChaos(ctx context.Context, update ChaosUpdate) error {
+	return c.do(ctx, http.MethodPut, "/admin/chaos", update, nil)
+}
+
+// ScheduleOutage starts an outage of the target ("database" or "payment") for
+// d with POST /admin/chaos/outages and returns its ID.
+func (c *Client) ScheduleOutage(ctx context.Context, target string, d time.Duration) (int, error) {
+	var resp struct {
+		ID int `json:"id"`
+	}
+	body := map[string]string{"target": target, "duration": d.String()}
+	err := c.do(ctx, http.MethodPost, "/admin/chaos/outages", body, &resp)
+	return resp.ID, err
+}
+
+// CancelOutage ends an outage early with DELETE /admin/chaos/outages/{id}.
+func (c *Client) CancelOutage(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/admin/chaos/outages/"+strconv.Itoa(id), nil, nil)
+}
+
+// SampleRatio returns the service's trace sampling ratio with GET
+// /admin/sampling.
+func (c *Client) SampleRatio(ctx context.Context) (float64, error) {
+	var resp struct {
+		Ratio float64 `json:"ratio"`
+	}
+	err := c.do(ctx, http.MethodGet, "/admin/sampling", nil, &resp)
+	return resp.Ratio, err
+}
+
+// SetSampleRatio changes the service's trace sampling ratio with PUT
+// /admin/sampling.
+func (c *Client) SetSampleRatio(ctx context.Context, ratio float64) error {
+	return c.do(ctx, http.MethodPut, "/admin/sampling", map[string]float64{"ratio": ratio}, nil)
+}
+
+// do sends a request with an optional JSON body and decodes a 2xx JSON
+// response into out.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	resp, err := c.send(ctx, method, path, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		statusErr := parseProblem(resp.StatusCode, data)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			statusErr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return statusErr
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// send sends the request, retrying a GET up to the client's attempts. Other
+// methods are sent once, so an order is not created twice.
+func (c *Client) send(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	attempts := 1
+	if method == http.MethodGet {
+		attempts = c.attempts
+	}
+	for attempt := 1; ; attempt++ {
+		var reader io.Reader
+		if payload != nil {
+			reader = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		if attempt >= attempts || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		trace.SpanFromContext(ctx).AddEvent("http.retry", trace.WithAttributes(
+			semconv.PeerService(peerName),
+			attribute.Int("http.retry.attempt", attempt),
+		))
+		select {
+		case <-time.After(backoff << (attempt - 1)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// parseProblem returns the error for a response with the status and body,
+// taking the detail or title, type, and trace ID of a problem document, or
+// else the body itself as the detail.
+func parseProblem(status int, data []byte) *StatusError {
+	var p struct {
+		Type    string `json:"type"`
+		Title   string `json:"title"`
+		Detail  string `json:"detail"`
+		TraceID string `json:"trace_id"`
+	}
+	if json.Unmarshal(data, &p) == nil && (p.Detail != "" || p.Title != "") {
+		detail := p.Detail
+		if detail == "" {
+			detail = p.Title
+		}
+		return &StatusError{Status: status, Detail: detail, Type: p.Type, TraceID: p.TraceID}
+	}
+	return &StatusError{Status: status, Detail: strings.TrimSpace(string(data))}
+}
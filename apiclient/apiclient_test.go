@@ -0,0 +1,101 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	var inventoryCalls, orderCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /checkInventory", func(w http.ResponseWriter, r *http.Request) {
+		if inventoryCalls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success","message":"Inventory checked successfully","delay_ms":250}`))
+	})
+	mux.HandleFunc("POST /createOrder", func(w http.ResponseWriter, r *http.Request) {
+		orderCalls.Add(1)
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"type":"/problems/overloaded","title":"Server overloaded","status":503}`))
+	})
+	mux.HandleFunc("GET /orders/1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":1,"customer_id":"c-1","status":"created","created_at":"2026-01-02T03:04:05Z"}`))
+	})
+	mux.HandleFunc("GET /orders/2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"type":"/problems/not-found","title":"Resource not found","status":404,"detail":"Order 2 not found.","trace_id":"0af7651916cd43dd8448eb211c80319c"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c := New(server.URL, "", WithRetries(3))
+	ctx := context.Background()
+
+	inv, err := c.CheckInventory(ctx)
+	if err != nil {
+		t.Fatalf("CheckInventory() error = %v", err)
+	}
+	if inv.Status != "success" || inv.DelayMS != 250 {
+		t.Errorf("CheckInventory() = %+v", inv)
+	}
+	if n := inventoryCalls.Load(); n != 3 {
+		t.Errorf("inventory was checked %d times, want 3", n)
+	}
+
+	// Orders are not retried.
+	_, err = c.CreateOrder(ctx, "")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("CreateOrder() error = %v, want a StatusError matching ErrUnavailable", err)
+	}
+	if statusErr.Type != "/problems/overloaded" || statusErr.RetryAfter != time.Second {
+		t.Errorf("CreateOrder() error = %+v", statusErr)
+	}
+	if n := orderCalls.Load(); n != 1 {
+		t.Errorf("order was created %d times, want 1", n)
+	}
+
+	order, err := c.GetOrder(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetOrder() error = %v", err)
+	}
+	if order.ID != 1 || order.CustomerID != "c-1" || !order.CreatedAt.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("GetOrder() = %+v", order)
+	}
+
+	_, err = c.GetOrder(ctx, 2)
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("GetOrder() of an unknown order error = %v, want ErrNotFound", err)
+	}
+	errors.As(err, &statusErr)
+	if statusErr.Detail != "Order 2 not found." || statusErr.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("GetOrder() error = %+v", statusErr)
+	}
+}
+
+func TestStatusErrorOutOfStock(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  *StatusError
+		want bool
+	}{
+		{name: "inventory check", err: &StatusError{Status: http.StatusConflict}, want: true},
+		{name: "order", err: &StatusError{Status: http.StatusConflict, Type: outOfStockType}, want: true},
+		{name: "other conflict", err: &StatusError{Status: http.StatusConflict, Type: "/problems/order-not-refundable"}, want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, ErrOutOfStock); got != tt.want {
+				t.Errorf("errors.Is(%+v, ErrOutOfStock) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
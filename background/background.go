@@ -0,0 +1,108 @@
+// Package background launches the service's goroutines. A panic outside a
+// request handler would otherwise kill the process at once, losing the spans,
+// metrics, and logs that explain it; goroutines started with Go report the
+// panic, flush telemetry, and only then exit.
+package background
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/background"
+
+// exitCode is the status the process exits with after a panic, as for an
+// unrecovered one.
+const exitCode = 2
+
+var (
+	panicCounter metric.Int64Counter
+
+	mu     sync.Mutex
+	onExit func()
+	// exiting ensures only the first panicking goroutine reports and exits;
+	// any others block until the process ends.
+	exiting sync.Once
+)
+
+func init() {
+	var err error
+	panicCounter, err = otel.Meter(instrumentationName).Int64Counter(
+		"goroutine_panics_total",
+		metric.WithDescription("The total number of panics in background goroutines"),
+		metric.WithUnit("{panic}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create goroutine_panics_total counter: %v", err)
+	}
+}
+
+// OnExit registers the function that flushes telemetry and closes logs before
+// a panic exits the process. It should bound its own duration.
+func OnExit(f func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	onExit = f
+}
+
+// Go runs fn in a new goroutine. name identifies the goroutine in telemetry,
+// and ctx carries the span the panic is reported under, if any.
+func Go(ctx context.Context, name string, fn func()) {
+	go func() {
+		defer report(ctx, name)
+		fn()
+	}()
+}
+
+// report recovers a panic, records it as an exception on a "goroutine.panic"
+// span, logs it with its stack, counts it in goroutine_panics_total, runs the
+// OnExit function, and exits.
+func report(ctx context.Context, name string) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	message := fmt.Sprint(rec)
+	stack := string(debug.Stack())
+
+	exiting.Do(func() {
+		log.Printf("[ERROR] panic in goroutine %s: %s\n%s", name, message, stack)
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, "goroutine.panic",
+			trace.WithAttributes(attribute.String("goroutine.name", name)))
+		span.AddEvent("exception", trace.WithAttributes(
+			attribute.String("exception.type", fmt.Sprintf("%T", rec)),
+			attribute.String("exception.message", message),
+			attribute.String("exception.stacktrace", stack),
+			attribute.Bool("exception.escaped", true),
+		))
+		span.SetStatus(codes.Error, "panic: "+message)
+		span.End()
+		panicCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("goroutine.name", name)))
+		logging.JSONLogger.Error(ctx, "Panic in background goroutine",
+			attribute.String("goroutine.name", name),
+			attribute.String("error.reason", message),
+			attribute.String("exception.stacktrace", stack),
+		)
+
+		mu.Lock()
+		exit := onExit
+		mu.Unlock()
+		if exit != nil {
+			exit()
+		}
+		os.Exit(exitCode)
+	})
+	select {}
+}
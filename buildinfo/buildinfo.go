@@ -0,0 +1,122 @@
+// Package buildinfo holds the version, git commit, and build time of the
+// binary, so deployed versions can be identified in every signal. They are set
+// at build time with -ldflags, for example:
+//
+//	go build -ldflags "-X app/buildinfo.Version=1.4.0 \
+//	  -X app/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X app/buildinfo.Time=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them, the commit and time fall back to the VCS information the Go
+// toolchain embeds when building inside a git checkout.
+package buildinfo
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const instrumentationName = "app/buildinfo"
+
+// Set with -ldflags "-X app/buildinfo.<name>=<value>".
+var (
+	// Version is the release version. It is the default service.version,
+	// which the configuration can override.
+	Version string
+	// Commit is the git SHA the binary was built from.
+	Commit string
+	// Time is when the binary was built, in RFC 3339.
+	Time string
+)
+
+// Info describes the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	mu      sync.RWMutex
+	current Info
+)
+
+func init() {
+	current = Info{Version: Version, Commit: Commit, BuildTime: Time, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if current.Commit == "" {
+					current.Commit = s.Value
+				}
+			case "vcs.time":
+				if current.BuildTime == "" {
+					current.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if Commit == "" && current.Commit != "" && modified {
+			current.Commit += "-dirty"
+		}
+	}
+	if current.Commit == "" {
+		current.Commit = "unknown"
+	}
+	if current.BuildTime == "" {
+		current.BuildTime = "unknown"
+	}
+
+	meter := otel.Meter(instrumentationName)
+	gauge, err := meter.Int64ObservableGauge(
+		"build_info",
+		metric.WithDescription("Always 1; the attributes identify the running build"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create build_info gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(gauge, 1, metric.WithAttributes(Get().Attributes()...))
+		return nil
+	}, gauge)
+	if err != nil {
+		log.Fatalf("failed to register build_info gauge: %v", err)
+	}
+}
+
+// SetVersion sets the reported version to the configured service.version.
+func SetVersion(version string) {
+	mu.Lock()
+	defer mu.Unlock()
+	current.Version = version
+}
+
+// Get returns the build information.
+func Get() Info {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Attributes returns the build information as attributes, for the telemetry
+// resource and the build_info gauge.
+func (i Info) Attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.ServiceVersion(i.Version),
+		attribute.String("build.commit", i.Commit),
+		attribute.String("build.time", i.BuildTime),
+		attribute.String("build.go_version", i.GoVersion),
+	}
+}
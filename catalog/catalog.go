@@ -0,0 +1,176 @@
+// Package catalog holds the price and stock caches used to validate and price
+// orders. The caches are warmed once at startup; until then Ready reports
+// false so order endpoints can refuse traffic instead of serving cold.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"app/background"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/catalog"
+
+// skuCount is the number of SKUs in the simulated catalog.
+const skuCount = 20
+
+var (
+	mu     sync.RWMutex
+	prices = make(map[string]int64)
+	stock  = make(map[string]int)
+
+	ready atomic.Bool
+)
+
+// Ready reports whether the caches have been warmed.
+func Ready() bool {
+	return ready.Load()
+}
+
+// Price returns the cached unit price of a SKU in cents.
+func Price(sku string) (int64, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := prices[sku]
+	return p, ok
+}
+
+// Stock returns the cached stock level of a SKU.
+func Stock(sku string) (int, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := stock[sku]
+	return s, ok
+}
+
+// Warm loads the price and stock caches concurrently, each inside its own child
+// span of ctx, and opens the readiness gate once both have loaded.
+func Warm(ctx context.Context) error {
+	tasks := []struct {
+		name string
+		load func(context.Context) (int, error)
+	}{
+		{name: "prices", load: warmPrices},
+		{name: "inventory", load: warmStock},
+	}
+
+	errs := make([]error, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		background.Go(ctx, "catalog.warm."+task.name, func() {
+			defer wg.Done()
+			errs[i] = runWarmTask(ctx, task.name, task.load)
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	ready.Store(true)
+	return nil
+}
+
+// runWarmTask runs a single warm task inside a "cache.warm.<name>" span.
+func runWarmTask(ctx context.Context, name string, load func(context.Context) (int, error)) error {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "cache.warm."+name)
+	defer span.End()
+
+	start := time.Now()
+	entries, err := load(ctx)
+	span.SetAttributes(
+		attribute.Int("cache.entries", entries),
+		attribute.Int64("cache.warm.duration_ms", time.Since(start).Milliseconds()),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "cache warm failed")
+		return fmt.Errorf("warming %s cache: %w", name, err)
+	}
+	span.SetStatus(codes.Ok, "cache warmed")
+	return nil
+}
+
+// warmPrices simulates loading the price list from a pricing service.
+func warmPrices(ctx context.Context) (int, error) {
+	if err := simulateLoad(ctx, 300, 700); err != nil {
+		return 0, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i <= skuCount; i++ {
+		prices[SKU(i)] = 499 + int64(i)*250
+	}
+	return len(prices), nil
+}
+
+// warmStock simulates loading stock levels from the inventory database.
+func warmStock(ctx context.Context) (int, error) {
+	if err := simulateLoad(ctx, 500, 1200); err != nil {
+		return 0, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i <= skuCount; i++ {
+		stock[SKU(i)] = rand.IntN(196) + 5
+	}
+	return len(stock), nil
+}
+
+// reorderPoint is the stock level at or below which a SKU is replenished, and
+// restockQuantity how much is added.
+const (
+	reorderPoint    = 20
+	restockQuantity = 100
+)
+
+// Replenish restocks the SKUs at or below the reorder point, simulating a
+// delivery recorded in the inventory database, and returns how many were
+// restocked. The run is recorded on the span in ctx.
+func Replenish(ctx context.Context) (int, error) {
+	if !Ready() {
+		return 0, nil
+	}
+	if err := simulateLoad(ctx, 50, 150); err != nil {
+		return 0, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var restocked []string
+	for sku, level := range stock {
+		if level <= reorderPoint {
+			stock[sku] = level + restockQuantity
+			restocked = append(restocked, sku)
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.StringSlice("catalog.restocked_skus", restocked))
+	return len(restocked), nil
+}
+
+// simulateLoad sleeps for a random duration between minMS and maxMS, or until ctx is done.
+func simulateLoad(ctx context.Context, minMS, maxMS int) error {
+	select {
+	case <-time.After(time.Duration(rand.IntN(maxMS-minMS+1)+minMS) * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SKU returns the name of the i-th SKU in the catalog (1-based).
+func SKU(i int) string {
+	return fmt.Sprintf("sku-%d", i)
+}
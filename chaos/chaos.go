@@ -0,0 +1,234 @@
+// Package chaos holds the failure and latency knobs used by the simulated
+// workflow steps, and named scenarios that set them as a bundle so demos can
+// reproduce specific incident shapes on demand.
+package chaos
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BaselineScenario is the name of the default, healthy scenario.
+const BaselineScenario = "baseline"
+
+// CustomScenario names knobs that were adjusted individually rather than taken
+// from a scenario.
+const CustomScenario = "custom"
+
+// Outage targets. While an outage is active, every call to the target fails.
+const (
+	OutageDatabase = "database"
+	OutagePayment  = "payment"
+)
+
+// Knobs are the failure and latency settings read by the simulated steps.
+type Knobs struct {
+	// Scenario is the name of the scenario the knobs came from.
+	Scenario string `json:"scenario"`
+	// DBFailureRate is the probability (0-1) that the DB insert fails.
+	DBFailureRate float64 `json:"db_failure_rate"`
+	// DBLatencyFactor multiplies the simulated DB latency.
+	DBLatencyFactor float64 `json:"db_latency_factor"`
+	// PaymentFailureRate is added to each payment provider's own failure rate; 1 is a full outage.
+	PaymentFailureRate float64 `json:"payment_failure_rate"`
+	// OutOfStockRate is the probability (0-1) that the inventory check reports out of stock.
+	OutOfStockRate float64 `json:"out_of_stock_rate"`
+	// LatencyFactor multiplies the latency of every simulated step.
+	LatencyFactor float64 `json:"latency_factor"`
+}
+
+// Latency scales a simulated step's base latency by LatencyFactor.
+func (k Knobs) Latency(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * k.LatencyFactor)
+}
+
+// DBLatency scales a simulated DB step's base latency by DBLatencyFactor and LatencyFactor.
+func (k Knobs) DBLatency(d time.Duration) time.Duration {
+	return k.Latency(time.Duration(float64(d) * k.DBLatencyFactor))
+}
+
+// Scenarios are the named knob bundles that can be selected.
+var Scenarios = map[string]Knobs{
+	BaselineScenario: {
+		DBFailureRate:   0.05,
+		DBLatencyFactor: 1,
+		OutOfStockRate:  0.05,
+		LatencyFactor:   1,
+	},
+	// The database slows down and starts rejecting inserts.
+	"db-degradation": {
+		DBFailureRate:   0.25,
+		DBLatencyFactor: 5,
+		OutOfStockRate:  0.05,
+		LatencyFactor:   1,
+	},
+	// Every payment provider fails.
+	"payment-outage": {
+		DBFailureRate:      0.05,
+		DBLatencyFactor:    1,
+		PaymentFailureRate: 1,
+		OutOfStockRate:     0.05,
+		LatencyFactor:      1,
+	},
+	// Every step is several times slower, but nothing fails more than usual.
+	"latency-spike": {
+		DBFailureRate:   0.05,
+		DBLatencyFactor: 1,
+		OutOfStockRate:  0.05,
+		LatencyFactor:   4,
+	},
+	// Every step fails far more often.
+	"error-storm": {
+		DBFailureRate:      0.3,
+		DBLatencyFactor:    1,
+		PaymentFailureRate: 0.3,
+		OutOfStockRate:     0.2,
+		LatencyFactor:      1,
+	},
+}
+
+var current atomic.Pointer[Knobs]
+
+func init() {
+	k := Scenarios[BaselineScenario]
+	k.Scenario = BaselineScenario
+	Set(k)
+}
+
+// Outage is a scheduled window during which a target always fails.
+type Outage struct {
+	ID     int       `json:"id"`
+	Target string    `json:"target"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// Active reports whether the outage window contains t.
+func (o Outage) Active(t time.Time) bool {
+	return !t.Before(o.Start) && t.Before(o.End)
+}
+
+var (
+	outagesMu    sync.Mutex
+	outages      []Outage
+	nextOutageID = 1
+)
+
+// Current returns the active knobs, with the failure rate of any target in an
+// active outage raised to 1.
+func Current() Knobs {
+	k := *current.Load()
+	now := time.Now()
+	for _, o := range Outages() {
+		if !o.Active(now) {
+			continue
+		}
+		switch o.Target {
+		case OutageDatabase:
+			k.DBFailureRate = 1
+		case OutagePayment:
+			k.PaymentFailureRate = 1
+		}
+	}
+	return k
+}
+
+// Base returns the active knobs without scheduled outages applied.
+func Base() Knobs {
+	return *current.Load()
+}
+
+// Set replaces the active knobs.
+func Set(k Knobs) {
+	current.Store(&k)
+}
+
+// Overrides are knob values set individually over a scenario's. Nil fields
+// keep the scenario's value.
+type Overrides struct {
+	DBFailureRate      *float64 `yaml:"db_failure_rate"`
+	PaymentFailureRate *float64 `yaml:"payment_failure_rate"`
+	OutOfStockRate     *float64 `yaml:"out_of_stock_rate"`
+}
+
+// Configure makes the named scenario active with the overrides applied, as
+// set in the service configuration. Overridden knobs are marked custom.
+func Configure(scenario string, o Overrides) error {
+	k, ok := Scenarios[scenario]
+	if !ok {
+		return fmt.Errorf("unknown chaos scenario %q (available: %v)", scenario, ScenarioNames())
+	}
+	k.Scenario = scenario
+	for _, f := range []struct{ value, dst *float64 }{
+		{o.DBFailureRate, &k.DBFailureRate},
+		{o.PaymentFailureRate, &k.PaymentFailureRate},
+		{o.OutOfStockRate, &k.OutOfStockRate},
+	} {
+		if f.value != nil {
+			*f.dst = *f.value
+			k.Scenario = CustomScenario
+		}
+	}
+	Set(k)
+	log.Printf("Chaos scenario %q active", k.Scenario)
+	return nil
+}
+
+// ScheduleOutage schedules an outage of target from start for d.
+func ScheduleOutage(target string, start time.Time, d time.Duration) (Outage, error) {
+	if target != OutageDatabase && target != OutagePayment {
+		return Outage{}, fmt.Errorf("unknown outage target %q (available: %s, %s)", target, OutageDatabase, OutagePayment)
+	}
+	if d <= 0 {
+		return Outage{}, fmt.Errorf("outage duration must be positive, got %s", d)
+	}
+	outagesMu.Lock()
+	defer outagesMu.Unlock()
+	o := Outage{ID: nextOutageID, Target: target, Start: start, End: start.Add(d)}
+	nextOutageID++
+	outages = append(outages, o)
+	return o, nil
+}
+
+// CancelOutage removes the outage with the given ID. It reports whether the
+// outage was found.
+func CancelOutage(id int) (Outage, bool) {
+	outagesMu.Lock()
+	defer outagesMu.Unlock()
+	for i, o := range outages {
+		if o.ID == id {
+			outages = append(outages[:i], outages[i+1:]...)
+			return o, true
+		}
+	}
+	return Outage{}, false
+}
+
+// Outages returns the scheduled and active outages, dropping ones that have ended.
+func Outages() []Outage {
+	outagesMu.Lock()
+	defer outagesMu.Unlock()
+	now := time.Now()
+	kept := outages[:0]
+	for _, o := range outages {
+		if now.Before(o.End) {
+			kept = append(kept, o)
+		}
+	}
+	outages = kept
+	return append([]Outage{}, outages...)
+}
+
+// ScenarioNames returns the names of all scenarios, sorted.
+func ScenarioNames() []string {
+	names := make([]string, 0, len(Scenarios))
+	for name := range Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
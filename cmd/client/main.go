@@ -0,0 +1,172 @@
+// Command client calls the API from the command line, for demos and smoke
+// tests. Each call is a "client.<command>" root span whose client span carries
+// the trace context into the service, and the client prints the trace ID next
+// to the result so the trace can be looked up in the backend.
+//
+//	go run ./cmd/client create-order cust-042
+//	go run ./cmd/client -repeat 5 check-inventory
+//	go run ./cmd/client get-order 17
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/config"
+	"app/tracing"
+
+	"github.com/ShrutiC-git/go-otel-e2e/apiclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/client"
+
+// command is a subcommand: its usage arguments and the call it makes.
+type command struct {
+	args string
+	run  func(ctx context.Context, c *apiclient.Client, args []string) (any, error)
+}
+
+var commands = map[string]command{
+	"create-order": {
+		args: "[customer-id]",
+		run: func(ctx context.Context, c *apiclient.Client, args []string) (any, error) {
+			var customerID string
+			if len(args) > 0 {
+				customerID = args[0]
+			}
+			id, err := c.CreateOrder(ctx, customerID)
+			return map[string]int{"order_id": id}, err
+		},
+	},
+	"check-inventory": {
+		run: func(ctx context.Context, c *apiclient.Client, args []string) (any, error) {
+			return c.CheckInventory(ctx)
+		},
+	},
+	"get-order": {
+		args: "<order-id>",
+		run: func(ctx context.Context, c *apiclient.Client, args []string) (any, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("missing order ID")
+			}
+			id, err := strconv.Atoi(args[0])
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("invalid order ID %q", args[0])
+			}
+			return c.GetOrder(ctx, id)
+		},
+	},
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [args]\n\nCommands:\n", os.Args[0])
+	for _, name := range commandNames() {
+		fmt.Fprintf(out, "  %s %s\n", name, commands[name].args)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// call runs the command once inside a "client.<name>" root span, prints the
+// result and trace ID, and reports whether it succeeded.
+func call(c *apiclient.Client, name string, args []string) bool {
+	ctx, span := otel.Tracer(instrumentationName).Start(context.Background(), "client."+name,
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("client.command", name)),
+	)
+	defer span.End()
+	traceID := span.SpanContext().TraceID()
+
+	start := time.Now()
+	result, err := commands[name].run(ctx, c, args)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Printf("trace_id=%s elapsed=%s error: %v\n", traceID, elapsed, err)
+		return false
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		body = []byte(fmt.Sprint(result))
+	}
+	fmt.Printf("trace_id=%s elapsed=%s %s\n", traceID, elapsed, body)
+	return true
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL of the API")
+	apiKey := flag.String("api-key", os.Getenv("API_KEY"), "API key sent as X-API-Key (or API_KEY)")
+	repeat := flag.Int("repeat", 1, "number of times to make the call")
+	interval := flag.Duration("interval", 0, "pause between repeated calls")
+	attempts := flag.Int("attempts", 1, "attempts at each idempotent call, retrying transient failures")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	name, args := flag.Arg(0), flag.Args()[1:]
+	if _, ok := commands[name]; !ok {
+		log.Fatalf("unknown command %q (available: %s)", name, strings.Join(commandNames(), ", "))
+	}
+	if *repeat <= 0 {
+		log.Fatal("-repeat must be positive")
+	}
+	if *attempts <= 0 {
+		log.Fatal("-attempts must be positive")
+	}
+
+	// The client shares the app's telemetry configuration but has its own
+	// service name, so its client spans appear as a separate service.
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.Service.Name = "sc-go-client"
+	shutdown := tracing.InitTracer(cfg.Service, cfg.Telemetry)
+
+	client := apiclient.New(*target, *apiKey, apiclient.WithRetries(*attempts))
+	failed := 0
+	for i := 0; i < *repeat; i++ {
+		if i > 0 && *interval > 0 {
+			time.Sleep(*interval)
+		}
+		if !call(client, name, args) {
+			failed++
+		}
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+	shutdown(flushCtx)
+	cancel()
+	if failed > 0 {
+		if *repeat > 1 {
+			log.Printf("%d of %d calls failed", failed, *repeat)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+// Command inventory-service is a standalone inventory simulation. The main
+// app calls its /checkInventory endpoint over HTTP when INVENTORY_SERVICE_URL is
+// set, so order traces attribute inventory latency to this service.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"app/background"
+	"app/chaos"
+	"app/config"
+	"app/handlers"
+	"app/logging"
+	"app/middleware"
+	"app/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+func main() {
+	// The service shares the app's configuration (telemetry, logging) but has
+	// its own resource attributes.
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.Service.Name = "sc-go-inventory-service"
+	logging.JSONLogger.SetFile(cfg.Logging.File)
+	if err := chaos.Configure(cfg.Chaos.Scenario, cfg.Chaos.Overrides); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	shutdown := tracing.InitTracer(cfg.Service, cfg.Telemetry)
+	if err := handlers.ConfigureInventoryLock(cfg.InventoryLock); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	background.OnExit(func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+		defer cancel()
+		shutdown(flushCtx)
+		_ = logging.JSONLogger.Close()
+	})
+
+	addr := os.Getenv("INVENTORY_SERVICE_ADDR")
+	if addr == "" {
+		addr = ":8082"
+	}
+
+	router := http.NewServeMux()
+	router.Handle("GET /checkInventory", otelhttp.NewHandler(middleware.ServerMetrics(middleware.Route(middleware.TraceResponse(http.HandlerFunc(handlers.CheckInventoryHandler)))), "", tracing.HTTPOptions(otelhttp.WithSpanNameFormatter(middleware.RouteSpanName))...))
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: router,
+	}
+
+	background.Go(context.Background(), "server", func() {
+		log.Printf("Inventory service is running on %s", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	})
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down inventory service...")
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelDrain()
+	if err := server.Shutdown(drainCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	// Flush telemetry with its own budget once requests have drained.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+	defer cancelFlush()
+	shutdown(flushCtx)
+	_ = logging.JSONLogger.Close()
+}
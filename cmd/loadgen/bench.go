@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ShrutiC-git/go-otel-e2e/apiclient"
+)
+
+// benchPhase is the latencies measured at one sampling ratio.
+type benchPhase struct {
+	ratio     float64
+	latencies []time.Duration
+	errors    int
+}
+
+// parseRatios parses a comma-separated list of sampling ratios.
+func parseRatios(s string) ([]float64, error) {
+	var ratios []float64
+	for _, entry := range strings.Split(s, ",") {
+		r, err := strconv.ParseFloat(strings.TrimSpace(entry), 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("%q: ratio must be between 0 and 1", entry)
+		}
+		ratios = append(ratios, r)
+	}
+	return ratios, nil
+}
+
+// runBench measures the service's request latency at each sampling ratio,
+// set in turn through the admin API, and reports each ratio's overhead over
+// the lowest. Each phase sends warmup unmeasured requests, then requests
+// measured ones from every worker as fast as they are answered. The service's
+// ratio is restored at the end.
+func runBench(ctx context.Context, g *generator, admin *apiclient.Client, ratios []float64, requests, warmup, concurrency int) error {
+	original, err := admin.SampleRatio(ctx)
+	if err != nil {
+		return fmt.Errorf("reading the sampling ratio: %w", err)
+	}
+	defer func() {
+		// Restore with a fresh deadline, since ctx may have ended by now.
+		restoreCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := admin.SetSampleRatio(restoreCtx, original); err != nil {
+			log.Printf("[WARN] restoring the sampling ratio %g: %v", original, err)
+		}
+	}()
+
+	var phases []benchPhase
+	for _, ratio := range ratios {
+		if err := admin.SetSampleRatio(ctx, ratio); err != nil {
+			return fmt.Errorf("setting the sampling ratio: %w", err)
+		}
+		log.Printf("Sampling ratio %g: %d warm-up and %d measured requests with %d workers", ratio, warmup, requests, concurrency)
+		g.measure(ctx, warmup, concurrency)
+		phase := g.measure(ctx, requests, concurrency)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		phase.ratio = ratio
+		phases = append(phases, phase)
+	}
+	reportBench(phases)
+	return nil
+}
+
+// measure sends n requests from the mix with concurrency workers, each
+// sending its next request once the last is answered, and returns their
+// latencies.
+func (g *generator) measure(ctx context.Context, n, concurrency int) benchPhase {
+	work := make(chan string)
+	var mu sync.Mutex
+	var phase benchPhase
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for endpoint := range work {
+				start := time.Now()
+				err := endpoints[endpoint](ctx, g)
+				elapsed := time.Since(start)
+				mu.Lock()
+				phase.latencies = append(phase.latencies, elapsed)
+				if err != nil {
+					phase.errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for range n {
+		select {
+		case work <- g.pick():
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+	return phase
+}
+
+// reportBench prints each phase's latencies and its overhead over the phase
+// with the lowest ratio.
+func reportBench(phases []benchPhase) {
+	if len(phases) == 0 {
+		return
+	}
+	base := slices.MinFunc(phases, func(a, b benchPhase) int {
+		switch {
+		case a.ratio < b.ratio:
+			return -1
+		case a.ratio > b.ratio:
+			return 1
+		}
+		return 0
+	})
+	baseMean, baseP50 := mean(base.latencies), percentile(base.latencies, 0.5)
+	log.Printf("  %-6s %8s %6s %9s %9s %9s %9s %14s %14s", "ratio", "requests", "errors", "mean", "p50", "p90", "p99", "overhead(mean)", "overhead(p50)")
+	for _, p := range phases {
+		m, p50 := mean(p.latencies), percentile(p.latencies, 0.5)
+		log.Printf("  %-6g %8d %6d %9s %9s %9s %9s %14s %14s", p.ratio, len(p.latencies), p.errors,
+			round(m), round(p50), round(percentile(p.latencies, 0.9)), round(percentile(p.latencies, 0.99)),
+			round(m-baseMean), round(p50-baseP50))
+	}
+}
+
+func mean(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return sum / time.Duration(len(ds))
+}
+
+// percentile returns the q-quantile (0-1) of ds, by the nearest-rank method.
+func percentile(ds []time.Duration, q float64) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(ds)
+	slices.Sort(sorted)
+	i := int(q*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// round rounds d to a precision that suits request latencies.
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
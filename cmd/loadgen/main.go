@@ -0,0 +1,452 @@
+// Command loadgen generates traffic against the API so the demo produces
+// traces, metrics, and logs without external tooling. Requests are paced at a
+// target rate, ramped up linearly, spread across an endpoint mix, and sent by
+// a pool of workers. The generator is itself instrumented: each request is a
+// "loadgen.request" root span whose client span carries the trace context into
+// the service, and requests are counted and timed by endpoint and outcome.
+// With -scenario, the rate follows a YAML script that also drives the chaos
+// admin API, to replay an incident timeline. With -bench, it measures the
+// service's latency at several trace sampling ratios instead, to show what
+// tracing costs per request.
+//
+//	go run ./cmd/loadgen -rps 20 -duration 2m -ramp-up 30s \
+//	  -mix create-order=5,create-order-v2=2,check-inventory=2,get-order=1
+//	go run ./cmd/loadgen -scenario cmd/loadgen/scenarios/payment-outage.yaml
+//	go run ./cmd/loadgen -bench -bench-ratios 0,0.1,1 -bench-requests 1000
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"app/catalog"
+	"app/config"
+	"app/tracing"
+
+	"github.com/ShrutiC-git/go-otel-e2e/apiclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/loadgen"
+
+// endpoints are the calls the generator can make, by mix name.
+var endpoints = map[string]func(ctx context.Context, g *generator) error{
+	"create-order": func(ctx context.Context, g *generator) error {
+		id, err := g.client.CreateOrder(ctx, "")
+		g.remember(id)
+		return err
+	},
+	"create-order-v2": func(ctx context.Context, g *generator) error {
+		items := []apiclient.Item{{SKU: catalog.SKU(rand.IntN(20) + 1), Quantity: rand.IntN(3) + 1}}
+		id, err := g.client.CreateOrderV2(ctx, fmt.Sprintf("cust-%03d", rand.IntN(50)+1), items)
+		g.remember(id)
+		return err
+	},
+	"check-inventory": func(ctx context.Context, g *generator) error {
+		_, err := g.client.CheckInventory(ctx)
+		return err
+	},
+	"get-order": func(ctx context.Context, g *generator) error {
+		_, err := g.client.GetOrder(ctx, g.recentOrder())
+		return err
+	},
+	"tracking": func(ctx context.Context, g *generator) error {
+		_, err := g.client.Tracking(ctx, g.recentOrder())
+		return err
+	},
+}
+
+// weighted is an endpoint and its share of the mix.
+type weighted struct {
+	name   string
+	weight int
+}
+
+// parseMix parses a comma-separated list of endpoint=weight entries, whose
+// weights must not all be zero.
+func parseMix(s string) ([]weighted, error) {
+	var mix []weighted
+	var total int
+	for _, entry := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			value = "1"
+		}
+		if _, known := endpoints[name]; !known {
+			return nil, fmt.Errorf("unknown endpoint %q (available: %s)", name, strings.Join(endpointNames(), ", "))
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%q: weight must be a non-negative integer", entry)
+		}
+		mix = append(mix, weighted{name: name, weight: weight})
+		total += weight
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("%q: at least one endpoint needs a positive weight", s)
+	}
+	return mix, nil
+}
+
+func endpointNames() []string {
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generator sends the requests and keeps the results.
+type generator struct {
+	client *apiclient.Client
+	mix    []weighted
+	total  int
+
+	// orders are recently created order IDs, for the order lookups.
+	mu     sync.Mutex
+	orders []int
+	counts map[string]map[string]int
+
+	dropped atomic.Int64
+
+	requestCounter  metric.Int64Counter
+	requestDuration metric.Float64Histogram
+	droppedCounter  metric.Int64Counter
+}
+
+func newGenerator(client *apiclient.Client, mix []weighted) *generator {
+	g := &generator{client: client, mix: mix, counts: make(map[string]map[string]int)}
+	for _, w := range mix {
+		g.total += w.weight
+	}
+	meter := otel.Meter(instrumentationName)
+	var err error
+	g.requestCounter, err = meter.Int64Counter(
+		"loadgen_requests_total",
+		metric.WithDescription("The total number of generated requests, by endpoint and outcome"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create loadgen_requests_total counter: %v", err)
+	}
+	g.requestDuration, err = meter.Float64Histogram(
+		"loadgen_request_duration_ms",
+		metric.WithDescription("The latency of generated requests, by endpoint"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create loadgen_request_duration_ms histogram: %v", err)
+	}
+	g.droppedCounter, err = meter.Int64Counter(
+		"loadgen_dropped_total",
+		metric.WithDescription("The total number of requests skipped because every worker was busy"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create loadgen_dropped_total counter: %v", err)
+	}
+	return g
+}
+
+// pick chooses an endpoint by weight.
+func (g *generator) pick() string {
+	n := rand.IntN(g.total)
+	for _, w := range g.mix {
+		if n < w.weight {
+			return w.name
+		}
+		n -= w.weight
+	}
+	return g.mix[len(g.mix)-1].name
+}
+
+// remember keeps a created order for the lookups.
+func (g *generator) remember(id int) {
+	if id == 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.orders = append(g.orders, id)
+	if len(g.orders) > 100 {
+		g.orders = g.orders[1:]
+	}
+}
+
+// recentOrder returns a recently created order, or order 1 before any.
+func (g *generator) recentOrder() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.orders) == 0 {
+		return 1
+	}
+	return g.orders[rand.IntN(len(g.orders))]
+}
+
+// send makes one request to the endpoint inside a "loadgen.request" root span.
+func (g *generator) send(endpoint string) {
+	ctx, span := otel.Tracer(instrumentationName).Start(context.Background(), "loadgen.request",
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("loadgen.endpoint", endpoint)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := endpoints[endpoint](ctx, g)
+	elapsed := time.Since(start)
+
+	outcome := "ok"
+	var statusErr *apiclient.StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		outcome = strconv.Itoa(statusErr.Status)
+	case err != nil:
+		outcome = "error"
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, outcome)
+	}
+	span.SetAttributes(attribute.String("loadgen.outcome", outcome))
+	attrs := attribute.String("loadgen.endpoint", endpoint)
+	g.requestCounter.Add(ctx, 1, metric.WithAttributes(attrs, attribute.String("outcome", outcome)))
+	g.requestDuration.Record(ctx, float64(elapsed.Microseconds())/1000, metric.WithAttributes(attrs))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.counts[endpoint] == nil {
+		g.counts[endpoint] = make(map[string]int)
+	}
+	g.counts[endpoint][outcome]++
+}
+
+// run sends requests at the rate returned for the time since it started, until
+// ctx is done. At a rate of 0 it sends nothing. Requests that find every
+// worker busy are dropped rather than queued, so a slow service does not build
+// an unbounded backlog.
+func (g *generator) run(ctx context.Context, rate func(time.Duration) float64, concurrency int) {
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for endpoint := range work {
+				g.send(endpoint)
+			}
+		}()
+	}
+
+	start := time.Now()
+	for {
+		r := rate(time.Since(start))
+		wait := idlePoll
+		if r > 0 {
+			wait = time.Duration(float64(time.Second) / r)
+		}
+		select {
+		case <-ctx.Done():
+			close(work)
+			wg.Wait()
+			return
+		case <-time.After(wait):
+		}
+		if r <= 0 {
+			continue
+		}
+		select {
+		case work <- g.pick():
+		default:
+			g.dropped.Add(1)
+			g.droppedCounter.Add(ctx, 1)
+		}
+	}
+}
+
+// idlePoll is how often the rate is checked again while it is 0.
+const idlePoll = 100 * time.Millisecond
+
+// rampRate returns a rate that ramps up linearly to rps over rampUp, starting
+// at 1 request per second.
+func rampRate(rps float64, rampUp time.Duration) func(time.Duration) float64 {
+	return func(elapsed time.Duration) float64 {
+		if elapsed < rampUp {
+			return max(rps*float64(elapsed)/float64(rampUp), 1)
+		}
+		return rps
+	}
+}
+
+// summary prints the outcomes by endpoint.
+func (g *generator) summary(elapsed time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var total int
+	for _, endpoint := range endpointNames() {
+		outcomes := g.counts[endpoint]
+		if len(outcomes) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(outcomes))
+		for k, n := range outcomes {
+			keys = append(keys, k)
+			total += n
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = fmt.Sprintf("%s=%d", k, outcomes[k])
+		}
+		log.Printf("  %-16s %s", endpoint, strings.Join(parts, " "))
+	}
+	log.Printf("Sent %d requests in %s (%.1f/s), dropped %d", total, elapsed.Round(time.Second), float64(total)/elapsed.Seconds(), g.dropped.Load())
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL of the API")
+	rps := flag.Float64("rps", 10, "target requests per second")
+	concurrency := flag.Int("concurrency", 8, "number of concurrent workers")
+	duration := flag.Duration("duration", time.Minute, "how long to run (0 runs until interrupted)")
+	rampUp := flag.Duration("ramp-up", 10*time.Second, "time to ramp up linearly to the target rate")
+	mixFlag := flag.String("mix", "create-order=5,check-inventory=3,get-order=2", "comma-separated endpoint=weight entries ("+strings.Join(endpointNames(), ", ")+")")
+	apiKey := flag.String("api-key", os.Getenv("API_KEY"), "API key sent as X-API-Key (or API_KEY)")
+	scenarioFile := flag.String("scenario", "", "YAML scenario to replay instead of a steady rate; sets the duration")
+	adminTarget := flag.String("admin-target", "http://localhost:6060", "base URL of the admin API, for scenario chaos steps")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "admin API bearer token (or ADMIN_TOKEN)")
+	bench := flag.Bool("bench", false, "measure latency at each of -bench-ratios instead of generating load")
+	benchRatios := flag.String("bench-ratios", "0,0.1,1", "comma-separated trace sampling ratios set on the service in -bench mode")
+	benchRequests := flag.Int("bench-requests", 500, "measured requests per ratio in -bench mode")
+	benchWarmup := flag.Int("bench-warmup", 50, "unmeasured warm-up requests per ratio in -bench mode")
+	flag.Parse()
+
+	var sc *scenario
+	if *scenarioFile != "" {
+		var err error
+		if sc, err = loadScenario(*scenarioFile); err != nil {
+			log.Fatalf("invalid -scenario: %v", err)
+		}
+		*duration = sc.Duration
+		if sc.Mix != "" {
+			*mixFlag = sc.Mix
+		}
+		if sc.Concurrency > 0 {
+			*concurrency = sc.Concurrency
+		}
+	}
+	mix, err := parseMix(*mixFlag)
+	if err != nil {
+		log.Fatalf("invalid -mix: %v", err)
+	}
+	if *rps <= 0 || *concurrency <= 0 {
+		log.Fatal("-rps and -concurrency must be positive")
+	}
+	if *bench {
+		// Each ratio runs until its requests are answered.
+		*duration = 0
+	}
+	ratios, err := parseRatios(*benchRatios)
+	if err != nil {
+		log.Fatalf("invalid -bench-ratios: %v", err)
+	}
+	if *benchRequests <= 0 || *benchWarmup < 0 {
+		log.Fatal("-bench-requests must be positive and -bench-warmup not negative")
+	}
+
+	// The generator shares the app's telemetry configuration but has its own
+	// service name, so its client spans appear as a separate service.
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.Service.Name = "sc-go-loadgen"
+	if *bench {
+		// A propagated sampling decision would override the service's ratio,
+		// so benchmark requests carry no trace context.
+		cfg.Telemetry.Propagators = []string{config.PropagatorNone}
+	}
+	shutdown := tracing.InitTracer(cfg.Service, cfg.Telemetry)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	g := newGenerator(apiclient.New(*target, *apiKey), mix)
+	start := time.Now()
+	switch {
+	case *bench:
+		if err := runBench(ctx, g, apiclient.NewAdmin(*adminTarget, *adminToken), ratios, *benchRequests, *benchWarmup, *concurrency); err != nil {
+			log.Printf("[ERROR] benchmark: %v", err)
+		}
+	case sc == nil:
+		log.Printf("Sending %.1f requests/s to %s with %d workers (mix %s)", *rps, *target, *concurrency, *mixFlag)
+		g.run(ctx, rampRate(*rps, *rampUp), *concurrency)
+	default:
+		runScenario(ctx, g, sc, apiclient.NewAdmin(*adminTarget, *adminToken), *concurrency)
+	}
+	if !*bench {
+		g.summary(time.Since(start))
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+	defer cancel()
+	shutdown(flushCtx)
+}
+
+// runScenario replays the scenario inside a "loadgen.scenario" root span,
+// sending its traffic and applying its chaos steps side by side, and restores
+// the chaos configuration when it ends.
+func runScenario(ctx context.Context, g *generator, sc *scenario, admin *apiclient.Client, concurrency int) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "loadgen.scenario",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("loadgen.scenario", sc.Name),
+			attribute.String("loadgen.scenario.duration", sc.Duration.String()),
+		),
+	)
+	defer span.End()
+
+	r := &runner{s: sc, admin: admin}
+	if err := r.prepare(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "scenario setup failed")
+		log.Printf("[ERROR] %v", err)
+		return
+	}
+	log.Printf("Replaying scenario %q for %s with %d workers", sc.Name, sc.Duration, concurrency)
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.play(ctx, start)
+	}()
+	g.run(ctx, sc.rate, concurrency)
+	wg.Wait()
+
+	// Restore with a fresh deadline, since ctx has ended by now.
+	restoreCtx, cancel := context.WithTimeout(trace.ContextWithSpan(context.Background(), span), 10*time.Second)
+	defer cancel()
+	r.restore(restoreCtx)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"app/chaos"
+
+	"github.com/ShrutiC-git/go-otel-e2e/apiclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// scenario is a scripted traffic pattern read from YAML: a timeline of steps
+// that change the request rate and inject or clear failures through the chaos
+// admin API, so an incident can be replayed the same way every time.
+//
+//	name: payment-outage
+//	duration: 8m
+//	mix: create-order=5,check-inventory=3,get-order=2
+//	steps:
+//	  - {at: 0s, rps: 50, ramp: 2m}
+//	  - {at: 2m, chaos: {scenario: payment-outage}}
+//	  - {at: 5m, chaos: {scenario: baseline}}
+//	  - {at: 6m, outage: {target: database, duration: 30s}}
+type scenario struct {
+	Name string `yaml:"name"`
+	// Duration is how long the scenario runs; it defaults to the end of the
+	// last step.
+	Duration time.Duration `yaml:"duration"`
+	// Mix and Concurrency, if set, override -mix and -concurrency.
+	Mix         string `yaml:"mix"`
+	Concurrency int    `yaml:"concurrency"`
+	Steps       []step `yaml:"steps"`
+}
+
+// step is one point on the timeline. It sets the rate, ramping linearly from
+// the previous rate over Ramp, and applies any chaos update and outage.
+type step struct {
+	At     time.Duration          `yaml:"at"`
+	RPS    *float64               `yaml:"rps"`
+	Ramp   time.Duration          `yaml:"ramp"`
+	Chaos  *apiclient.ChaosUpdate `yaml:"chaos"`
+	Outage *outage                `yaml:"outage"`
+}
+
+// outage is a failure window of a target ("database" or "payment").
+type outage struct {
+	Target   string        `yaml:"target"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+// loadScenario reads and validates a scenario file. Steps are sorted by time,
+// keeping the file's order for steps at the same time.
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = path
+	}
+	if len(s.Steps) == 0 {
+		return nil, errors.New("no steps")
+	}
+	var errs []error
+	for i, st := range s.Steps {
+		switch {
+		case st.At < 0 || st.Ramp < 0:
+			errs = append(errs, fmt.Errorf("steps[%d]: at and ramp must not be negative", i))
+		case st.RPS == nil && st.Chaos == nil && st.Outage == nil:
+			errs = append(errs, fmt.Errorf("steps[%d]: must set rps, chaos, or outage", i))
+		case st.RPS != nil && *st.RPS < 0:
+			errs = append(errs, fmt.Errorf("steps[%d]: rps must not be negative", i))
+		case st.Outage != nil && st.Outage.Duration <= 0:
+			errs = append(errs, fmt.Errorf("steps[%d]: outage duration must be positive", i))
+		}
+		s.Duration = max(s.Duration, st.At+st.Ramp)
+	}
+	sort.SliceStable(s.Steps, func(i, j int) bool { return s.Steps[i].At < s.Steps[j].At })
+	return &s, errors.Join(errs...)
+}
+
+// usesChaos reports whether any step calls the admin API.
+func (s *scenario) usesChaos() bool {
+	for _, st := range s.Steps {
+		if st.Chaos != nil || st.Outage != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rate returns the scripted request rate at elapsed. Between steps the rate
+// holds; during a ramp it is at least 1 request per second so the pacing
+// keeps up with it.
+func (s *scenario) rate(elapsed time.Duration) float64 {
+	var rate float64
+	for _, st := range s.Steps {
+		if st.RPS == nil {
+			continue
+		}
+		if elapsed < st.At {
+			break
+		}
+		if end := st.At + st.Ramp; elapsed < end {
+			r := rate + (*st.RPS-rate)*float64(elapsed-st.At)/float64(st.Ramp)
+			return max(r, 1)
+		}
+		rate = *st.RPS
+	}
+	return rate
+}
+
+// runner applies a scenario's chaos steps and undoes them afterwards.
+type runner struct {
+	s     *scenario
+	admin *apiclient.Client
+
+	// initial is the chaos configuration before the first step, and outages
+	// the outages the scenario started.
+	initial apiclient.ChaosState
+	outages []int
+}
+
+// prepare records the chaos configuration to restore after the scenario.
+func (r *runner) prepare(ctx context.Context) error {
+	if !r.s.usesChaos() {
+		return nil
+	}
+	var err error
+	r.initial, err = r.admin.Chaos(ctx)
+	if err != nil {
+		return fmt.Errorf("reading chaos configuration (check -admin-target and -admin-token): %w", err)
+	}
+	return nil
+}
+
+// play applies the chaos steps on schedule, relative to start, until they are
+// done or ctx is. ctx carries the scenario span.
+func (r *runner) play(ctx context.Context, start time.Time) {
+	for _, st := range r.s.Steps {
+		if st.Chaos == nil && st.Outage == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(start.Add(st.At))):
+		}
+		r.apply(ctx, st)
+	}
+}
+
+// apply makes the admin calls of a step inside a "loadgen.scenario.step" span.
+// Failures are logged and the scenario carries on.
+func (r *runner) apply(ctx context.Context, st step) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "loadgen.scenario.step",
+		trace.WithAttributes(attribute.String("loadgen.scenario.at", st.At.String())),
+	)
+	defer span.End()
+
+	var errs []error
+	if st.Chaos != nil {
+		if st.Chaos.Scenario != nil {
+			span.SetAttributes(attribute.String("chaos.scenario", *st.Chaos.Scenario))
+		}
+		if err := r.admin.UpdateChaos(ctx, *st.Chaos); err != nil {
+			errs = append(errs, fmt.Errorf("updating chaos: %w", err))
+		} else {
+			log.Printf("[t+%s] chaos updated", st.At)
+		}
+	}
+	if o := st.Outage; o != nil {
+		span.SetAttributes(
+			attribute.String("chaos.outage.target", o.Target),
+			attribute.String("chaos.outage.duration", o.Duration.String()),
+		)
+		id, err := r.admin.ScheduleOutage(ctx, o.Target, o.Duration)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("starting %s outage: %w", o.Target, err))
+		} else {
+			r.outages = append(r.outages, id)
+			log.Printf("[t+%s] %s outage started for %s", st.At, o.Target, o.Duration)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "scenario step failed")
+		log.Printf("[WARN] [t+%s] %v", st.At, err)
+	}
+}
+
+// restore cancels the outages the scenario started and puts back the chaos
+// configuration it found, so an interrupted run leaves the service healthy.
+func (r *runner) restore(ctx context.Context) {
+	if !r.s.usesChaos() {
+		return
+	}
+	for _, id := range r.outages {
+		// Outages that already ended are gone, which is fine.
+		_ = r.admin.CancelOutage(ctx, id)
+	}
+	k := r.initial.Knobs
+	update := apiclient.ChaosUpdate{Scenario: &k.Scenario}
+	if k.Scenario == chaos.CustomScenario {
+		update = apiclient.ChaosUpdate{
+			DBFailureRate:      &k.DBFailureRate,
+			DBLatencyFactor:    &k.DBLatencyFactor,
+			PaymentFailureRate: &k.PaymentFailureRate,
+			OutOfStockRate:     &k.OutOfStockRate,
+			LatencyFactor:      &k.LatencyFactor,
+		}
+	}
+	if err := r.admin.UpdateChaos(ctx, update); err != nil {
+		log.Printf("[WARN] restoring chaos configuration: %v", err)
+		return
+	}
+	log.Printf("Restored chaos scenario %q", k.Scenario)
+}
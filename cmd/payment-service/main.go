@@ -0,0 +1,82 @@
+// Command payment-service is a standalone payment provider simulation. The main
+// app calls its /charge endpoint over HTTP when PAYMENT_SERVICE_URL is set, so a
+// single order trace spans both services.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"app/background"
+	"app/chaos"
+	"app/config"
+	"app/handlers"
+	"app/logging"
+	"app/middleware"
+	"app/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+func main() {
+	// The service shares the app's configuration (telemetry, logging) but has
+	// its own resource attributes.
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.Service.Name = "sc-go-payment-service"
+	logging.JSONLogger.SetFile(cfg.Logging.File)
+	if err := chaos.Configure(cfg.Chaos.Scenario, cfg.Chaos.Overrides); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	shutdown := tracing.InitTracer(cfg.Service, cfg.Telemetry)
+	background.OnExit(func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+		defer cancel()
+		shutdown(flushCtx)
+		_ = logging.JSONLogger.Close()
+	})
+
+	addr := os.Getenv("PAYMENT_SERVICE_ADDR")
+	if addr == "" {
+		addr = ":8081"
+	}
+
+	router := http.NewServeMux()
+	router.Handle("POST /charge", otelhttp.NewHandler(middleware.ServerMetrics(middleware.Route(middleware.TraceResponse(http.HandlerFunc(handlers.ChargeHandler)))), "", tracing.HTTPOptions(otelhttp.WithSpanNameFormatter(middleware.RouteSpanName))...))
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: router,
+	}
+
+	background.Go(context.Background(), "server", func() {
+		log.Printf("Payment service is running on %s", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	})
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down payment service...")
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelDrain()
+	if err := server.Shutdown(drainCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	// Flush telemetry with its own budget once requests have drained.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+	defer cancelFlush()
+	shutdown(flushCtx)
+	_ = logging.JSONLogger.Close()
+}
@@ -0,0 +1,164 @@
+// Command replay sends the requests of a recording (see the recording package
+// and PUT /admin/recording) to the API again, in order, to reproduce a traced
+// incident locally. Each request is a "replay.request" root span in a fresh
+// trace, linked to the span of the request it replays, and the command prints
+// both trace IDs with the response status.
+//
+//	go run ./cmd/replay recordings/incident.jsonl
+//	go run ./cmd/replay -speed 0 -target http://localhost:8080 recordings/incident.jsonl
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/config"
+	"app/httpclient"
+	"app/recording"
+	"app/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/replay"
+
+// replay sends one recorded request inside a "replay.request" root span and
+// returns the response status, or an error if there was no response.
+func replay(ctx context.Context, client *httpclient.Client, target, apiKey string, rec recording.Request) (int, trace.TraceID, error) {
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(rec.Method),
+			attribute.String("replay.target", rec.Target),
+			attribute.String("replay.recorded_at", rec.Time.Format(time.RFC3339Nano)),
+		),
+	}
+	if original, ok := originalSpan(rec); ok {
+		opts = append(opts,
+			trace.WithLinks(trace.Link{SpanContext: original, Attributes: []attribute.KeyValue{attribute.String("link.type", "replay.original")}}),
+			trace.WithAttributes(attribute.String("replay.original_trace_id", rec.TraceID)),
+		)
+	}
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "replay.request", opts...)
+	defer span.End()
+	traceID := span.SpanContext().TraceID()
+
+	var body io.Reader
+	if rec.Body != "" {
+		body = strings.NewReader(rec.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, rec.Method, target+rec.Target, body)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid recorded request")
+		return 0, traceID, err
+	}
+	for name, values := range rec.Header {
+		req.Header[name] = values
+	}
+	// Credentials are never recorded, so the replay brings its own.
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "request failed")
+		return 0, traceID, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp.StatusCode, traceID, nil
+}
+
+// originalSpan returns the span context of the recorded request's server span.
+func originalSpan(rec recording.Request) (trace.SpanContext, bool) {
+	traceID, err := trace.TraceIDFromHex(rec.TraceID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(rec.SpanID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, Remote: true}), true
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL of the API")
+	apiKey := flag.String("api-key", os.Getenv("API_KEY"), "API key sent as X-API-Key (or API_KEY), since recordings hold no credentials")
+	speed := flag.Float64("speed", 1, "pace relative to the recording: 2 replays twice as fast, 0 sends each request as soon as the last is answered")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <recording>\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *speed < 0 {
+		log.Fatal("-speed must not be negative")
+	}
+	reqs, err := recording.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("reading the recording: %v", err)
+	}
+
+	// The replay shares the app's telemetry configuration but has its own
+	// service name, so its client spans appear as a separate service.
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	cfg.Service.Name = "sc-go-replay"
+	shutdown := tracing.InitTracer(cfg.Service, cfg.Telemetry)
+
+	// Each recorded request is sent once, as it was.
+	client := httpclient.New("app-api", httpclient.WithRetryPolicy(httpclient.RetryPolicy{MaxAttempts: 1}))
+	base := strings.TrimSuffix(*target, "/")
+	log.Printf("Replaying %d requests to %s", len(reqs), base)
+	statuses := make(map[string]int)
+	start := time.Now()
+	for i, rec := range reqs {
+		// Keep the recording's pacing, scaled by -speed.
+		if *speed > 0 && i > 0 {
+			due := start.Add(time.Duration(float64(rec.Time.Sub(reqs[0].Time)) / *speed))
+			time.Sleep(time.Until(due))
+		}
+		status, traceID, err := replay(context.Background(), client, base, *apiKey, rec)
+		outcome := strconv.Itoa(status)
+		if err != nil {
+			outcome = "error"
+			fmt.Printf("trace_id=%s original_trace_id=%s %s %s error: %v\n", traceID, rec.TraceID, rec.Method, rec.Target, err)
+		} else {
+			fmt.Printf("trace_id=%s original_trace_id=%s %s %s %d\n", traceID, rec.TraceID, rec.Method, rec.Target, status)
+		}
+		statuses[outcome]++
+	}
+	log.Printf("Replayed %d requests in %s: %v", len(reqs), time.Since(start).Round(time.Millisecond), statuses)
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+	shutdown(flushCtx)
+	cancel()
+	if statuses["error"] > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,1235 @@
+// Package config loads the service configuration: defaults, overridden by a
+// YAML file, overridden in turn by environment variables. The result is
+// validated at startup and passed to the packages that need it; a Watcher
+// reloads it at runtime and applies the settings that are safe to change.
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/buildinfo"
+	"app/chaos"
+	"app/featureflags"
+	"app/logging"
+	"app/store"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the configuration file read when APP_CONFIG is unset. It is
+// optional; config.yaml is the collector's configuration, not the app's.
+const DefaultPath = "app.yaml"
+
+// Config is the service configuration.
+type Config struct {
+	Service       Service       `yaml:"service"`
+	Server        Server        `yaml:"server"`
+	Telemetry     Telemetry     `yaml:"telemetry"`
+	Logging       Logging       `yaml:"logging"`
+	RateLimit     RateLimit     `yaml:"rate_limit"`
+	Downstream    Downstream    `yaml:"downstream"`
+	Chaos         Chaos         `yaml:"chaos"`
+	Jobs          Jobs          `yaml:"jobs"`
+	Seed          Seed          `yaml:"seed"`
+	Runtime       Runtime       `yaml:"runtime"`
+	SLO           SLO           `yaml:"slo"`
+	Synthetic     Synthetic     `yaml:"synthetic"`
+	Anomaly       Anomaly       `yaml:"anomaly"`
+	InventoryLock InventoryLock `yaml:"inventory_lock"`
+	Recording     Recording     `yaml:"recording"`
+	Heatmap       Heatmap       `yaml:"latency_heatmap"`
+	FeatureFlags  FeatureFlags  `yaml:"feature_flags"`
+	Auth          Auth          `yaml:"auth"`
+	Admin         Admin         `yaml:"admin"`
+
+	// File is the configuration file read, or looked for, by Load.
+	File string `yaml:"-"`
+}
+
+// Service identifies the service in its telemetry resource.
+type Service struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	Environment string `yaml:"environment"`
+}
+
+// Server configures the public HTTP listener.
+type Server struct {
+	Addr string `yaml:"addr"`
+	// ShutdownTimeout bounds the graceful drain of in-flight requests.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// RequestTimeout is the default per-request deadline; RouteTimeouts
+	// overrides it per route.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// RouteTimeouts are per-route deadlines keyed by ServeMux pattern, such
+	// as "POST /createOrder". A timeout of 0 disables it.
+	RouteTimeouts map[string]time.Duration `yaml:"route_timeouts"`
+	// ReadHeaderTimeout bounds how long a client may take to send request
+	// headers.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// ReadTimeout bounds reading a whole request, body included, and
+	// WriteTimeout writing its response. Both must cover the longest request
+	// timeout. IdleTimeout is how long a keep-alive connection is kept open
+	// between requests. Zero means no limit.
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// MaxHeaderBytes limits the size of the request line and headers.
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+	// PreStopDelay is how long /readyz fails before the listener stops
+	// accepting connections, so load balancers can stop routing to the
+	// instance first.
+	PreStopDelay time.Duration `yaml:"pre_stop_delay"`
+	TLS          TLS           `yaml:"tls"`
+	// H2C accepts cleartext HTTP/2 (prior knowledge or Upgrade: h2c) when TLS
+	// is off. With TLS, HTTP/2 is always negotiated.
+	H2C bool `yaml:"h2c"`
+	// PublicProbes also serves the health probes and /metrics on this
+	// listener. They are always served on the admin listener.
+	PublicProbes bool `yaml:"public_probes"`
+	// StateFile keeps the restart count across restarts; empty counts from
+	// zero on every start.
+	StateFile string `yaml:"state_file"`
+	// HandoffTimeout bounds how long a SIGUSR2 restart waits for the new
+	// process to be ready before giving up and serving on.
+	HandoffTimeout time.Duration `yaml:"handoff_timeout"`
+	// MaxBodyBytes limits request bodies, except on routes with a built-in
+	// limit of their own; 0 disables the limit.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// TrustedProxies are the CIDRs whose X-Forwarded-For is honored when
+	// resolving the client address; with none, it is ignored.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// RouteAliases map alternative paths to their canonical ones before
+	// routing. An alias ending in "/*" maps a whole prefix, and its target
+	// must end in "/*" too.
+	RouteAliases map[string]string `yaml:"route_aliases"`
+	// SessionTTL is how long an idle simulated session lasts; 0 disables
+	// sessions.
+	SessionTTL time.Duration `yaml:"session_ttl"`
+	// ValidateResponses also validates responses against the OpenAPI
+	// document; requests always are.
+	ValidateResponses bool        `yaml:"validate_responses"`
+	Concurrency       Concurrency `yaml:"concurrency"`
+	CORS              CORS        `yaml:"cors"`
+}
+
+// Concurrency bounds the requests in flight on the public listener. Requests
+// over a limit wait in its queue, and are shed with 503 when the queue is full
+// or they have waited QueueTimeout.
+type Concurrency struct {
+	// Limit and Queue are shared by the routes without a limit of their own.
+	// A Limit of 0 disables it.
+	Limit        int           `yaml:"limit"`
+	Queue        int           `yaml:"queue"`
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+	// Routes are per-route limits keyed by ServeMux pattern.
+	Routes map[string]ConcurrencyLimit `yaml:"routes"`
+}
+
+// ConcurrencyLimit is the number of requests a route runs at once and how
+// many more may wait.
+type ConcurrencyLimit struct {
+	Limit int `yaml:"limit"`
+	Queue int `yaml:"queue"`
+}
+
+// CORS configures cross-origin requests from browsers.
+type CORS struct {
+	// AllowedOrigins are the origins allowed, or "*" for any; with none, CORS
+	// is disabled.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+// TLS configures HTTPS on the public listener. It is enabled when both files
+// are set.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Enabled reports whether HTTPS is configured.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// Telemetry exporters.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterMemory = "memory"
+)
+
+// Propagators.
+const (
+	PropagatorTraceContext  = "tracecontext"
+	PropagatorBaggage       = "baggage"
+	PropagatorTraceResponse = "traceresponse"
+	PropagatorNone          = "none"
+)
+
+// UnsupportedPropagators are the other OTEL_PROPAGATORS values of the OTel
+// specification. They are accepted, so a setting shared across a deployment
+// does not stop the service from starting, but propagate nothing; a warning
+// is logged for each at startup.
+var UnsupportedPropagators = []string{"b3", "b3multi", "jaeger", "xray", "ottrace"}
+
+// Telemetry configures the exporters.
+type Telemetry struct {
+	// Exporter is "otlp", to send to a collector, "stdout", to print spans
+	// and metrics for local development, or "memory", to keep them in memory
+	// for integration tests.
+	Exporter string `yaml:"exporter"`
+	// OTLPEndpoint is the collector's OTLP/HTTP host:port.
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// Insecure sends OTLP over plain HTTP.
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio is the fraction (0-1) of new traces sampled; requests that
+	// carry a sampling decision keep it.
+	SampleRatio float64 `yaml:"sample_ratio"`
+	// ShutdownTimeout bounds the final flush of spans and metrics at shutdown.
+	// It starts after the HTTP drain, so a slow drain cannot use it up.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// RecentSpans is the number of finished spans kept in memory for the
+	// /debug/traces viewer, or 0 to keep none.
+	RecentSpans int `yaml:"recent_spans"`
+	// ProfilingEndpoint is the base URL of a Pyroscope server to push
+	// continuous CPU and goroutine profiles to, or empty to push none.
+	ProfilingEndpoint string `yaml:"profiling_endpoint"`
+	// ProfilingInterval is how long each pushed profile covers.
+	ProfilingInterval time.Duration `yaml:"profiling_interval"`
+	// Propagators are the context propagation formats: "tracecontext" and
+	// "baggage" on requests, and "traceresponse", which returns the server
+	// span's context on responses and reads it from downstream ones. "none"
+	// alone propagates nothing.
+	Propagators []string `yaml:"propagators"`
+	// NoopPercent is the percentage (0-100) of requests served with no-op
+	// tracing, metrics, and logs, to measure instrumentation overhead against
+	// the rest in the same process.
+	NoopPercent int `yaml:"noop_percent"`
+	// CollectorCheckInterval is how often the collector is checked when
+	// exporting over OTLP; 0 disables the checks.
+	CollectorCheckInterval time.Duration `yaml:"collector_check_interval"`
+	// CollectorHealthURL is the URL of the collector's health_check
+	// extension, or empty to check with an empty OTLP export.
+	CollectorHealthURL string `yaml:"collector_health_url"`
+	// RuntimeTraceTasks mirrors spans as runtime/trace tasks named after
+	// their trace ID, while a runtime trace is captured.
+	RuntimeTraceTasks bool `yaml:"runtime_trace_tasks"`
+	// TraceExclude are the requests kept out of traces and HTTP server
+	// metrics, each "[METHOD ]/path" with an optional trailing "*" for a
+	// prefix match.
+	TraceExclude []string `yaml:"trace_exclude"`
+}
+
+// Logging configures the structured JSON log.
+type Logging struct {
+	File string `yaml:"file"`
+	// Level is the minimum level logged: debug, info, warn, or error.
+	Level string `yaml:"level"`
+}
+
+// RateLimit configures the per-client rate limiter.
+type RateLimit struct {
+	// RPS is the per-client request rate; 0 disables limiting.
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+	// RedisURL, if set, shares the buckets through Redis.
+	RedisURL     string        `yaml:"redis_url"`
+	RedisTimeout time.Duration `yaml:"redis_timeout"`
+}
+
+// Downstream holds the base URLs of the services the order workflow calls.
+// Empty URLs are served in-process.
+type Downstream struct {
+	PaymentServiceURL   string `yaml:"payment_service_url"`
+	InventoryServiceURL string `yaml:"inventory_service_url"`
+	PartnerURL          string `yaml:"partner_url"`
+}
+
+// Chaos selects the failure injection applied at startup. The admin chaos API
+// can change it at runtime.
+type Chaos struct {
+	// Scenario is one of chaos.Scenarios.
+	Scenario        string `yaml:"scenario"`
+	chaos.Overrides `yaml:",inline"`
+}
+
+// Jobs sets how often the background jobs run; 0 disables a job.
+type Jobs struct {
+	// ReplenishInterval is how often low-stock SKUs are restocked.
+	ReplenishInterval time.Duration `yaml:"replenish_interval"`
+	// ProbeInterval is how often the dependencies are probed synthetically.
+	ProbeInterval time.Duration `yaml:"probe_interval"`
+	// SettlementInterval is how often created orders are settled in a batch.
+	SettlementInterval time.Duration `yaml:"settlement_interval"`
+}
+
+// Seed populates the order store with generated history at startup, so the
+// list endpoints and dashboards are not empty on a fresh start.
+type Seed struct {
+	Enabled bool `yaml:"enabled"`
+	// Orders is the number of historical orders generated.
+	Orders int `yaml:"orders"`
+	// Window is how far back the orders are spread.
+	Window time.Duration `yaml:"window"`
+	// Telemetry also records a back-dated span for each order.
+	Telemetry bool `yaml:"telemetry"`
+}
+
+// Runtime fits the Go runtime to the container's CPU and memory limits.
+type Runtime struct {
+	// AutoTune sets GOMAXPROCS to the CPU quota and GOMEMLIMIT to a share of
+	// the memory limit, unless those environment variables are set.
+	AutoTune bool `yaml:"auto_tune"`
+	// MemoryLimitRatio is the share (0-1] of the memory limit given to
+	// GOMEMLIMIT, leaving headroom for memory the Go runtime does not manage.
+	MemoryLimitRatio float64 `yaml:"memory_limit_ratio"`
+}
+
+// SLO declares the service level objectives, whose error-budget burn rates
+// are computed from the service's own HTTP server metrics.
+type SLO struct {
+	// Interval is how often the burn rates are computed; 0 disables them.
+	Interval time.Duration `yaml:"interval"`
+	// ShortWindow and LongWindow are the rolling windows burn rates are
+	// computed over.
+	ShortWindow time.Duration `yaml:"short_window"`
+	LongWindow  time.Duration `yaml:"long_window"`
+	// BurnRateThreshold is the burn rate which, exceeded over both windows,
+	// logs a warning. At 14.4 a 30-day budget would be spent in about 2 days.
+	BurnRateThreshold float64     `yaml:"burn_rate_threshold"`
+	Objectives        []Objective `yaml:"objectives"`
+}
+
+// Objective is one service level objective: the share of a route's requests
+// that must be good.
+type Objective struct {
+	Name string `yaml:"name"`
+	// Route is a ServeMux pattern such as "POST /createOrder", or a path,
+	// which covers every method.
+	Route string `yaml:"route"`
+	// Latency, if set, counts the requests that take longer as bad;
+	// otherwise 5xx responses are bad.
+	Latency time.Duration `yaml:"latency"`
+	// Target is the share (0-1) of good requests, such as 0.99.
+	Target float64 `yaml:"target"`
+}
+
+// Synthetic configures the synthetic monitor, which calls the service's own
+// endpoints on a schedule to measure availability without real traffic.
+type Synthetic struct {
+	// Interval is the time between rounds of checks; 0 disables them.
+	Interval time.Duration `yaml:"interval"`
+	// Target is the base URL relative check URLs resolve against; empty
+	// derives it from server.addr.
+	Target string `yaml:"target"`
+	// Timeout bounds each check.
+	Timeout time.Duration `yaml:"timeout"`
+	// APIKey, from SYNTHETIC_API_KEY only, is sent as X-API-Key when the
+	// business routes require one.
+	APIKey string           `yaml:"-"`
+	Checks []SyntheticCheck `yaml:"checks"`
+}
+
+// SyntheticCheck is one request the synthetic monitor makes.
+type SyntheticCheck struct {
+	Name string `yaml:"name"`
+	// Method defaults to GET.
+	Method string `yaml:"method"`
+	// URL is a path and query relative to the target, or an absolute URL
+	// such as a downstream service's.
+	URL string `yaml:"url"`
+	// Expect lists the status codes that pass; by default any 2xx does.
+	Expect []int `yaml:"expect"`
+}
+
+// Anomaly configures latency anomaly detection, which compares each request's
+// latency with a rolling baseline of its route's.
+type Anomaly struct {
+	// Threshold is how many standard deviations above the baseline mean a
+	// request's latency must be to be anomalous; 0 disables detection.
+	Threshold float64 `yaml:"threshold"`
+	// Window is the number of recent requests the baseline mostly reflects:
+	// each request is weighted 2/(window+1) in the moving averages.
+	Window int `yaml:"window"`
+	// MinSamples is the number of requests a route must have served before
+	// its baseline is trusted.
+	MinSamples int `yaml:"min_samples"`
+	// MinDeviation is the least excess over the baseline mean that counts, so
+	// very steady fast routes do not flag small jitter.
+	MinDeviation time.Duration `yaml:"min_deviation"`
+}
+
+// InventoryLock configures the lock the inventory check holds while it
+// reserves stock, which makes contention on hot SKUs visible under load.
+type InventoryLock struct {
+	// Enabled turns the lock on; without it reservations never wait.
+	Enabled bool `yaml:"enabled"`
+	// Keys is the number of SKUs reservations are spread over at random; the
+	// fewer, the more contention.
+	Keys int `yaml:"keys"`
+	// Hold is how long a reservation holds the lock.
+	Hold time.Duration `yaml:"hold"`
+	// Timeout bounds the wait for the lock; a reservation that waits longer
+	// fails.
+	Timeout time.Duration `yaml:"timeout"`
+	// RedisURL, if set, holds the lock in Redis so that every replica
+	// contends for it.
+	RedisURL string `yaml:"redis_url"`
+	// TTL is how long a lock held in Redis lasts if its holder never releases
+	// it.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Recording configures the request recorder, which the admin API turns on to
+// capture incoming requests for replay.
+type Recording struct {
+	// Dir is where recordings are written.
+	Dir string `yaml:"dir"`
+	// MaxBodyBytes is the largest request body recorded; larger bodies are
+	// left out of the recording.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+}
+
+// Heatmap configures the in-process latency heatmap served at GET
+// /debug/latency.
+type Heatmap struct {
+	// Resolution is the time each column of the heatmap covers; 0 disables
+	// the heatmap.
+	Resolution time.Duration `yaml:"resolution"`
+	// Window is how much history is kept.
+	Window time.Duration `yaml:"window"`
+}
+
+// FeatureFlags sets the feature flags the service starts with, over the
+// built-in ones. The admin API changes them at runtime.
+type FeatureFlags struct {
+	// File is a YAML list of flags; see featureflags.ReadFile.
+	File string `yaml:"file"`
+	// Overrides are name=on, name=off, or name=<percent> entries applied
+	// after the file.
+	Overrides []string `yaml:"overrides"`
+}
+
+// Auth configures authentication on the business routes. With neither API
+// keys nor a JWT key source, every request is accepted.
+type Auth struct {
+	// APIKeys, from API_KEYS only, are the keys accepted in X-API-Key.
+	APIKeys []APIKey `yaml:"-"`
+	JWT     JWT      `yaml:"jwt"`
+}
+
+// APIKey is one accepted API key, named for logs and spans. EndUser is
+// recorded as enduser.id on its requests.
+type APIKey struct {
+	Name    string
+	Key     string
+	EndUser string
+}
+
+// JWT configures bearer token validation: HS256 tokens with HMACSecret, RS256
+// tokens with keys from JWKSURL, or both.
+type JWT struct {
+	// HMACSecret is from JWT_HMAC_SECRET only.
+	HMACSecret string `yaml:"-"`
+	JWKSURL    string `yaml:"jwks_url"`
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Required rejects requests without a bearer token.
+	Required bool `yaml:"required"`
+}
+
+// AdminOff is the admin address that turns the admin listener off.
+const AdminOff = "off"
+
+// Admin configures the admin listener, which serves pprof, the admin API, the
+// health probes, and /metrics.
+type Admin struct {
+	// Addr is the listener's host:port, or "off".
+	Addr string `yaml:"addr"`
+	// Token, from ADMIN_TOKEN only, must be sent as a bearer token; it also
+	// enables the /admin API.
+	Token string `yaml:"-"`
+	// AllowedCIDRs are the client ranges admitted, or "*" for every client
+	// not in DeniedCIDRs.
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+	DeniedCIDRs  []string `yaml:"denied_cidrs"`
+}
+
+// Default returns the built-in configuration.
+func Default() Config {
+	return Config{
+		Service: Service{
+			Name:        "sc-go-app-backend",
+			Version:     cmp.Or(buildinfo.Version, "1.0.0"),
+			Environment: "development",
+		},
+		Server: Server{
+			Addr:              ":8080",
+			ShutdownTimeout:   5 * time.Second,
+			RequestTimeout:    10 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       90 * time.Second,
+			WriteTimeout:      90 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			TLS:               TLS{ReloadInterval: 30 * time.Second},
+			H2C:               true,
+			StateFile:         "app.state.json",
+			HandoffTimeout:    30 * time.Second,
+			// Bulk imports may legitimately take longer than a single order,
+			// and stream many rows in one body.
+			RouteTimeouts: map[string]time.Duration{"POST /orders/import": time.Minute},
+			MaxBodyBytes:  1 << 20,
+			// The /api/ prefix some clients use is dropped.
+			RouteAliases: map[string]string{"/api/*": "/*"},
+			SessionTTL:   30 * time.Minute,
+			Concurrency: Concurrency{
+				Limit:        64,
+				Queue:        128,
+				QueueTimeout: 2 * time.Second,
+				// Bulk imports are heavy, so only a few run at a time.
+				Routes: map[string]ConcurrencyLimit{"POST /orders/import": {Limit: 2, Queue: 4}},
+			},
+			// The default headers include the W3C trace context and baggage
+			// headers so browser RUM agents can continue traces into the
+			// backend.
+			CORS: CORS{
+				AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+				AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID", "traceparent", "tracestate", "baggage"},
+			},
+		},
+		Telemetry: Telemetry{
+			Exporter:               ExporterOTLP,
+			OTLPEndpoint:           "localhost:4318",
+			Insecure:               true,
+			SampleRatio:            1,
+			ShutdownTimeout:        5 * time.Second,
+			RecentSpans:            2000,
+			ProfilingInterval:      15 * time.Second,
+			Propagators:            []string{PropagatorTraceContext, PropagatorBaggage, PropagatorTraceResponse},
+			CollectorCheckInterval: 30 * time.Second,
+			// Health probes, scrapes, favicons, and admin polling.
+			TraceExclude: []string{"/healthz", "/readyz", "/livez", "/metrics", "/favicon.ico", "GET /admin/*"},
+		},
+		Logging: Logging{File: "app.log", Level: "info"},
+		RateLimit: RateLimit{
+			RPS:          20,
+			Burst:        40,
+			RedisTimeout: 50 * time.Millisecond,
+		},
+		Chaos:   Chaos{Scenario: chaos.BaselineScenario},
+		Jobs:    Jobs{ReplenishInterval: time.Minute, ProbeInterval: 30 * time.Second, SettlementInterval: 5 * time.Minute},
+		Seed:    Seed{Orders: 500, Window: 7 * 24 * time.Hour},
+		Runtime: Runtime{AutoTune: true, MemoryLimitRatio: 0.9},
+		SLO: SLO{
+			Interval:          30 * time.Second,
+			ShortWindow:       5 * time.Minute,
+			LongWindow:        time.Hour,
+			BurnRateThreshold: 14.4,
+			Objectives: []Objective{
+				{Name: "create-order-latency", Route: "POST /createOrder", Latency: 500 * time.Millisecond, Target: 0.99},
+				{Name: "create-order-availability", Route: "POST /createOrder", Target: 0.995},
+			},
+		},
+		Synthetic: Synthetic{
+			Interval: time.Minute,
+			Timeout:  5 * time.Second,
+			Checks: []SyntheticCheck{
+				{Name: "status", URL: "/status"},
+				{Name: "version", URL: "/version"},
+				{Name: "check-inventory", URL: "/checkInventory", Expect: []int{200, 409}},
+				{Name: "partner-fx", URL: "/stub/partner/fx?from=USD&to=EUR"},
+			},
+		},
+		Anomaly: Anomaly{Threshold: 4, Window: 200, MinSamples: 50, MinDeviation: 25 * time.Millisecond},
+		InventoryLock: InventoryLock{
+			Keys:    5,
+			Hold:    20 * time.Millisecond,
+			Timeout: 2 * time.Second,
+			TTL:     10 * time.Second,
+		},
+		Recording: Recording{Dir: "recordings", MaxBodyBytes: 64 << 10},
+		Heatmap:   Heatmap{Resolution: 10 * time.Second, Window: 10 * time.Minute},
+		Admin:     Admin{Addr: "localhost:6060", AllowedCIDRs: []string{"127.0.0.0/8", "::1/128"}},
+	}
+}
+
+// Load builds the configuration from the defaults, the APP_ENV profile's
+// defaults, the configuration file, the environment, and finally the
+// command-line flags in args (which excludes the program name), each
+// overriding the last. The file is the one named by
+// -config or APP_CONFIG; otherwise DefaultPath is read if it exists. The result
+// is validated, and all errors are reported together.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	if name := os.Getenv("APP_ENV"); name != "" {
+		profile, ok := profiles[name]
+		if !ok {
+			return Config{}, fmt.Errorf("APP_ENV: unknown profile %q (want %s)", name, strings.Join(ProfileNames(), ", "))
+		}
+		profile(&cfg)
+	}
+	f := parseFlags("app", args)
+
+	path, explicit := os.LookupEnv("APP_CONFIG")
+	if f.path != "" {
+		path, explicit = f.path, true
+	}
+	if !explicit {
+		path = DefaultPath
+	}
+	cfg.File = path
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case explicit || !errors.Is(err, os.ErrNotExist):
+		return Config{}, fmt.Errorf("reading config: %w", err)
+	}
+
+	envErr := cfg.applyEnv()
+	f.apply(&cfg)
+	if err := errors.Join(envErr, cfg.Validate()); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the configuration with the environment variables that
+// are set.
+func (c *Config) applyEnv() error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	parse := func(key string, set func(string) error) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			if err := set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+	duration := func(key string, dst *time.Duration) {
+		parse(key, func(v string) (err error) { *dst, err = time.ParseDuration(v); return })
+	}
+	list := func(key string, dst *[]string) {
+		parse(key, func(v string) error { *dst = splitList(v); return nil })
+	}
+
+	str("OTEL_SERVICE_NAME", &c.Service.Name)
+	str("SERVICE_VERSION", &c.Service.Version)
+	str("DEPLOYMENT_ENVIRONMENT", &c.Service.Environment)
+	str("APP_ADDR", &c.Server.Addr)
+	duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	duration("REQUEST_TIMEOUT", &c.Server.RequestTimeout)
+	duration("READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	duration("READ_TIMEOUT", &c.Server.ReadTimeout)
+	duration("WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	duration("IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	parse("MAX_HEADER_BYTES", func(v string) (err error) { c.Server.MaxHeaderBytes, err = strconv.Atoi(v); return })
+	duration("PRE_STOP_DELAY", &c.Server.PreStopDelay)
+	str("TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	str("TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+	duration("TLS_RELOAD_INTERVAL", &c.Server.TLS.ReloadInterval)
+	parse("H2C_ENABLED", func(v string) (err error) { c.Server.H2C, err = strconv.ParseBool(v); return })
+	parse("PUBLIC_PROBES", func(v string) (err error) { c.Server.PublicProbes, err = strconv.ParseBool(v); return })
+	str("STATE_FILE", &c.Server.StateFile)
+	duration("HANDOFF_TIMEOUT", &c.Server.HandoffTimeout)
+	str("TELEMETRY_EXPORTER", &c.Telemetry.Exporter)
+	str("OTLP_ENDPOINT", &c.Telemetry.OTLPEndpoint)
+	parse("OTLP_INSECURE", func(v string) (err error) { c.Telemetry.Insecure, err = strconv.ParseBool(v); return })
+	duration("TELEMETRY_SHUTDOWN_TIMEOUT", &c.Telemetry.ShutdownTimeout)
+	parse("TRACE_SAMPLE_RATIO", func(v string) (err error) { c.Telemetry.SampleRatio, err = strconv.ParseFloat(v, 64); return })
+	parse("RECENT_SPANS", func(v string) (err error) { c.Telemetry.RecentSpans, err = strconv.Atoi(v); return })
+	str("PROFILING_ENDPOINT", &c.Telemetry.ProfilingEndpoint)
+	duration("PROFILING_INTERVAL", &c.Telemetry.ProfilingInterval)
+	list("OTEL_PROPAGATORS", &c.Telemetry.Propagators)
+	duration("COLLECTOR_CHECK_INTERVAL", &c.Telemetry.CollectorCheckInterval)
+	str("COLLECTOR_HEALTH_URL", &c.Telemetry.CollectorHealthURL)
+	parse("RUNTIME_TRACE_TASKS", func(v string) (err error) { c.Telemetry.RuntimeTraceTasks, err = strconv.ParseBool(v); return })
+	parse("INSTRUMENTATION_NOOP_PERCENT", func(v string) (err error) { c.Telemetry.NoopPercent, err = strconv.Atoi(v); return })
+	str("APP_LOG_FILE", &c.Logging.File)
+	str("LOG_LEVEL", &c.Logging.Level)
+	parse("RATE_LIMIT_RPS", func(v string) (err error) { c.RateLimit.RPS, err = strconv.ParseFloat(v, 64); return })
+	parse("RATE_LIMIT_BURST", func(v string) (err error) { c.RateLimit.Burst, err = strconv.Atoi(v); return })
+	str("RATE_LIMIT_REDIS_URL", &c.RateLimit.RedisURL)
+	duration("RATE_LIMIT_REDIS_TIMEOUT", &c.RateLimit.RedisTimeout)
+	str("PAYMENT_SERVICE_URL", &c.Downstream.PaymentServiceURL)
+	str("INVENTORY_SERVICE_URL", &c.Downstream.InventoryServiceURL)
+	str("PARTNER_STUB_URL", &c.Downstream.PartnerURL)
+	str("CHAOS_SCENARIO", &c.Chaos.Scenario)
+	duration("JOB_REPLENISH_INTERVAL", &c.Jobs.ReplenishInterval)
+	duration("JOB_PROBE_INTERVAL", &c.Jobs.ProbeInterval)
+	duration("JOB_SETTLEMENT_INTERVAL", &c.Jobs.SettlementInterval)
+	parse("SEED_DATA", func(v string) (err error) { c.Seed.Enabled, err = strconv.ParseBool(v); return })
+	parse("SEED_ORDERS", func(v string) (err error) { c.Seed.Orders, err = strconv.Atoi(v); return })
+	duration("SEED_WINDOW", &c.Seed.Window)
+	parse("SEED_TELEMETRY", func(v string) (err error) { c.Seed.Telemetry, err = strconv.ParseBool(v); return })
+	parse("RUNTIME_AUTO_TUNE", func(v string) (err error) { c.Runtime.AutoTune, err = strconv.ParseBool(v); return })
+	parse("RUNTIME_MEMORY_LIMIT_RATIO", func(v string) (err error) { c.Runtime.MemoryLimitRatio, err = strconv.ParseFloat(v, 64); return })
+	duration("SLO_INTERVAL", &c.SLO.Interval)
+	parse("SLO_BURN_RATE_THRESHOLD", func(v string) (err error) { c.SLO.BurnRateThreshold, err = strconv.ParseFloat(v, 64); return })
+	duration("SYNTHETIC_INTERVAL", &c.Synthetic.Interval)
+	str("SYNTHETIC_TARGET", &c.Synthetic.Target)
+	str("SYNTHETIC_API_KEY", &c.Synthetic.APIKey)
+	parse("ANOMALY_THRESHOLD", func(v string) (err error) { c.Anomaly.Threshold, err = strconv.ParseFloat(v, 64); return })
+	parse("ANOMALY_WINDOW", func(v string) (err error) { c.Anomaly.Window, err = strconv.Atoi(v); return })
+	parse("ANOMALY_MIN_SAMPLES", func(v string) (err error) { c.Anomaly.MinSamples, err = strconv.Atoi(v); return })
+	duration("ANOMALY_MIN_DEVIATION", &c.Anomaly.MinDeviation)
+	parse("INVENTORY_LOCK_ENABLED", func(v string) (err error) { c.InventoryLock.Enabled, err = strconv.ParseBool(v); return })
+	parse("INVENTORY_LOCK_KEYS", func(v string) (err error) { c.InventoryLock.Keys, err = strconv.Atoi(v); return })
+	duration("INVENTORY_LOCK_HOLD", &c.InventoryLock.Hold)
+	duration("INVENTORY_LOCK_TIMEOUT", &c.InventoryLock.Timeout)
+	str("INVENTORY_LOCK_REDIS_URL", &c.InventoryLock.RedisURL)
+	duration("INVENTORY_LOCK_TTL", &c.InventoryLock.TTL)
+	str("RECORDING_DIR", &c.Recording.Dir)
+	parse("RECORDING_MAX_BODY_BYTES", func(v string) (err error) { c.Recording.MaxBodyBytes, err = strconv.ParseInt(v, 10, 64); return })
+	duration("LATENCY_HEATMAP_RESOLUTION", &c.Heatmap.Resolution)
+	duration("LATENCY_HEATMAP_WINDOW", &c.Heatmap.Window)
+	str("FEATURE_FLAGS_FILE", &c.FeatureFlags.File)
+	list("FEATURE_FLAGS", &c.FeatureFlags.Overrides)
+	parse("ROUTE_TIMEOUTS", func(v string) error {
+		return parseEntries(v, "pattern=duration", func(pattern, value string) error {
+			d, err := time.ParseDuration(value)
+			if err == nil {
+				c.Server.RouteTimeouts = setEntry(c.Server.RouteTimeouts, pattern, d)
+			}
+			return err
+		})
+	})
+	parse("MAX_BODY_BYTES", func(v string) (err error) { c.Server.MaxBodyBytes, err = strconv.ParseInt(v, 10, 64); return })
+	list("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+	parse("ROUTE_ALIASES", func(v string) error {
+		return parseEntries(v, "alias=path", func(alias, path string) error {
+			c.Server.RouteAliases = setEntry(c.Server.RouteAliases, alias, path)
+			return nil
+		})
+	})
+	duration("SESSION_TTL", &c.Server.SessionTTL)
+	parse("OPENAPI_VALIDATE_RESPONSES", func(v string) (err error) { c.Server.ValidateResponses, err = strconv.ParseBool(v); return })
+	parse("CONCURRENCY_LIMIT", func(v string) (err error) { c.Server.Concurrency.Limit, err = strconv.Atoi(v); return })
+	parse("CONCURRENCY_QUEUE", func(v string) (err error) { c.Server.Concurrency.Queue, err = strconv.Atoi(v); return })
+	duration("CONCURRENCY_QUEUE_TIMEOUT", &c.Server.Concurrency.QueueTimeout)
+	parse("ROUTE_CONCURRENCY", func(v string) error {
+		return parseEntries(v, "pattern=limit:queue", func(pattern, value string) error {
+			limitStr, queueStr, _ := strings.Cut(value, ":")
+			var limit ConcurrencyLimit
+			var err error
+			limit.Limit, err = strconv.Atoi(limitStr)
+			if err == nil && queueStr != "" {
+				limit.Queue, err = strconv.Atoi(queueStr)
+			}
+			if err == nil {
+				c.Server.Concurrency.Routes = setEntry(c.Server.Concurrency.Routes, pattern, limit)
+			}
+			return err
+		})
+	})
+	list("CORS_ALLOWED_ORIGINS", &c.Server.CORS.AllowedOrigins)
+	list("CORS_ALLOWED_METHODS", &c.Server.CORS.AllowedMethods)
+	list("CORS_ALLOWED_HEADERS", &c.Server.CORS.AllowedHeaders)
+	parse("TRACE_EXCLUDE", func(v string) error {
+		c.Telemetry.TraceExclude = nil
+		if v != "none" {
+			c.Telemetry.TraceExclude = splitList(v)
+		}
+		return nil
+	})
+	parse("API_KEYS", func(v string) (err error) { c.Auth.APIKeys, err = parseAPIKeys(v); return })
+	str("JWT_HMAC_SECRET", &c.Auth.JWT.HMACSecret)
+	str("JWT_JWKS_URL", &c.Auth.JWT.JWKSURL)
+	str("JWT_ISSUER", &c.Auth.JWT.Issuer)
+	str("JWT_AUDIENCE", &c.Auth.JWT.Audience)
+	parse("JWT_REQUIRED", func(v string) (err error) { c.Auth.JWT.Required, err = strconv.ParseBool(v); return })
+	parse("ADMIN_ADDR", func(v string) error { c.Admin.Addr = v; return nil })
+	str("ADMIN_TOKEN", &c.Admin.Token)
+	list("ADMIN_ALLOWED_CIDRS", &c.Admin.AllowedCIDRs)
+	list("ADMIN_DENIED_CIDRS", &c.Admin.DeniedCIDRs)
+	return errors.Join(errs...)
+}
+
+// Validate checks addresses, URLs, CIDRs, routes, rates, intervals, the chaos
+// scenario, and the seed size.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+		}
+	}
+
+	if c.Service.Name == "" {
+		check("service.name", errors.New("must be set"))
+	}
+	check("server.addr", validateAddr(c.Server.Addr))
+	if c.Server.ShutdownTimeout <= 0 {
+		check("server.shutdown_timeout", errors.New("must be positive"))
+	}
+	if c.Server.PreStopDelay < 0 {
+		check("server.pre_stop_delay", errors.New("must not be negative"))
+	}
+	if c.Server.RequestTimeout < 0 {
+		check("server.request_timeout", errors.New("must not be negative"))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 {
+		check("server.read_header_timeout", errors.New("must be positive"))
+	}
+	if c.Server.ReadTimeout < 0 {
+		check("server.read_timeout", errors.New("must not be negative"))
+	}
+	if c.Server.WriteTimeout < 0 {
+		check("server.write_timeout", errors.New("must not be negative"))
+	}
+	if c.Server.IdleTimeout < 0 {
+		check("server.idle_timeout", errors.New("must not be negative"))
+	}
+	if c.Server.MaxHeaderBytes <= 0 {
+		check("server.max_header_bytes", errors.New("must be positive"))
+	}
+	if c.Server.HandoffTimeout <= 0 {
+		check("server.handoff_timeout", errors.New("must be positive"))
+	}
+	for _, pattern := range slices.Sorted(maps.Keys(c.Server.RouteTimeouts)) {
+		field := fmt.Sprintf("server.route_timeouts[%s]", pattern)
+		check(field, validateRoute(pattern))
+		if c.Server.RouteTimeouts[pattern] < 0 {
+			check(field, errors.New("must not be negative"))
+		}
+	}
+	if c.Server.MaxBodyBytes < 0 {
+		check("server.max_body_bytes", errors.New("must not be negative"))
+	}
+	for i, cidr := range c.Server.TrustedProxies {
+		_, err := netip.ParsePrefix(cidr)
+		check(fmt.Sprintf("server.trusted_proxies[%d]", i), err)
+	}
+	for _, alias := range slices.Sorted(maps.Keys(c.Server.RouteAliases)) {
+		target := c.Server.RouteAliases[alias]
+		field := fmt.Sprintf("server.route_aliases[%s]", alias)
+		switch {
+		case !strings.HasPrefix(alias, "/") || !strings.HasPrefix(target, "/"):
+			check(field, fmt.Errorf("%q=%q: both must be paths", alias, target))
+		case strings.HasSuffix(alias, "/*") != strings.HasSuffix(target, "/*"):
+			check(field, fmt.Errorf("%q=%q: both or neither must end in /*", alias, target))
+		}
+	}
+	if c.Server.SessionTTL < 0 {
+		check("server.session_ttl", errors.New("must not be negative"))
+	}
+	if cc := c.Server.Concurrency; cc.Limit < 0 || cc.Queue < 0 || cc.QueueTimeout < 0 {
+		check("server.concurrency", errors.New("limit, queue, and queue_timeout must not be negative"))
+	}
+	for _, pattern := range slices.Sorted(maps.Keys(c.Server.Concurrency.Routes)) {
+		field := fmt.Sprintf("server.concurrency.routes[%s]", pattern)
+		check(field, validateRoute(pattern))
+		if limit := c.Server.Concurrency.Routes[pattern]; limit.Limit < 0 || limit.Queue < 0 {
+			check(field, errors.New("limit and queue must not be negative"))
+		}
+	}
+	for i, origin := range c.Server.CORS.AllowedOrigins {
+		if origin != "*" {
+			check(fmt.Sprintf("server.cors.allowed_origins[%d]", i), validateURL(origin, "http", "https"))
+		}
+	}
+	if tls := c.Server.TLS; (tls.CertFile == "") != (tls.KeyFile == "") {
+		check("server.tls", errors.New("cert_file and key_file must be set together"))
+	} else if tls.Enabled() && tls.ReloadInterval <= 0 {
+		check("server.tls.reload_interval", errors.New("must be positive"))
+	}
+	switch c.Telemetry.Exporter {
+	case ExporterOTLP:
+		check("telemetry.otlp_endpoint", validateAddr(c.Telemetry.OTLPEndpoint))
+	case ExporterStdout, ExporterMemory:
+	default:
+		check("telemetry.exporter", fmt.Errorf("unknown exporter %q (want %s, %s, or %s)", c.Telemetry.Exporter, ExporterOTLP, ExporterStdout, ExporterMemory))
+	}
+	if c.Telemetry.ShutdownTimeout <= 0 {
+		check("telemetry.shutdown_timeout", errors.New("must be positive"))
+	}
+	if c.Telemetry.SampleRatio < 0 || c.Telemetry.SampleRatio > 1 {
+		check("telemetry.sample_ratio", errors.New("must be between 0 and 1"))
+	}
+	if c.Telemetry.CollectorCheckInterval < 0 {
+		check("telemetry.collector_check_interval", errors.New("must not be negative"))
+	}
+	if c.Telemetry.CollectorHealthURL != "" {
+		check("telemetry.collector_health_url", validateURL(c.Telemetry.CollectorHealthURL, "http", "https"))
+	}
+	if c.Telemetry.NoopPercent < 0 || c.Telemetry.NoopPercent > 100 {
+		check("telemetry.noop_percent", errors.New("must be between 0 and 100"))
+	}
+	if c.Telemetry.RecentSpans < 0 {
+		check("telemetry.recent_spans", errors.New("must not be negative"))
+	}
+	if c.Telemetry.ProfilingEndpoint != "" {
+		check("telemetry.profiling_endpoint", validateURL(c.Telemetry.ProfilingEndpoint, "http", "https"))
+		if c.Telemetry.ProfilingInterval < time.Second {
+			check("telemetry.profiling_interval", errors.New("must be at least 1s"))
+		}
+	}
+	for _, name := range c.Telemetry.Propagators {
+		switch name {
+		case PropagatorTraceContext, PropagatorBaggage, PropagatorTraceResponse:
+		case PropagatorNone:
+			if len(c.Telemetry.Propagators) > 1 {
+				check("telemetry.propagators", fmt.Errorf("%s cannot be combined with other propagators", PropagatorNone))
+			}
+		default:
+			if !slices.Contains(UnsupportedPropagators, name) {
+				check("telemetry.propagators", fmt.Errorf("unknown propagator %q (want %s, %s, %s, or %s)", name,
+					PropagatorTraceContext, PropagatorBaggage, PropagatorTraceResponse, PropagatorNone))
+			}
+		}
+	}
+	for i, rule := range c.Telemetry.TraceExclude {
+		check(fmt.Sprintf("telemetry.trace_exclude[%d]", i), validateRoute(rule))
+	}
+	if c.Logging.File == "" {
+		check("logging.file", errors.New("must be set"))
+	}
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		check("logging.level", err)
+	}
+	if c.RateLimit.RPS < 0 {
+		check("rate_limit.rps", errors.New("must not be negative"))
+	}
+	if c.RateLimit.RPS > 0 && c.RateLimit.Burst < 1 {
+		check("rate_limit.burst", errors.New("must be at least 1"))
+	}
+	if c.RateLimit.RedisURL != "" {
+		check("rate_limit.redis_url", validateURL(c.RateLimit.RedisURL, "redis", "rediss"))
+		if c.RateLimit.RedisTimeout <= 0 {
+			check("rate_limit.redis_timeout", errors.New("must be positive"))
+		}
+	}
+	for _, d := range []struct{ field, url string }{
+		{"downstream.payment_service_url", c.Downstream.PaymentServiceURL},
+		{"downstream.inventory_service_url", c.Downstream.InventoryServiceURL},
+		{"downstream.partner_url", c.Downstream.PartnerURL},
+	} {
+		if d.url != "" {
+			check(d.field, validateURL(d.url, "http", "https"))
+		}
+	}
+	if _, ok := chaos.Scenarios[c.Chaos.Scenario]; !ok {
+		check("chaos.scenario", fmt.Errorf("unknown scenario %q (available: %v)", c.Chaos.Scenario, chaos.ScenarioNames()))
+	}
+	for _, r := range []struct {
+		field string
+		rate  *float64
+	}{
+		{"chaos.db_failure_rate", c.Chaos.DBFailureRate},
+		{"chaos.payment_failure_rate", c.Chaos.PaymentFailureRate},
+		{"chaos.out_of_stock_rate", c.Chaos.OutOfStockRate},
+	} {
+		if r.rate != nil && (*r.rate < 0 || *r.rate > 1) {
+			check(r.field, errors.New("must be between 0 and 1"))
+		}
+	}
+	if c.Jobs.ReplenishInterval < 0 {
+		check("jobs.replenish_interval", errors.New("must not be negative"))
+	}
+	if c.Jobs.ProbeInterval < 0 {
+		check("jobs.probe_interval", errors.New("must not be negative"))
+	}
+	if c.Jobs.SettlementInterval < 0 {
+		check("jobs.settlement_interval", errors.New("must not be negative"))
+	}
+	if c.Runtime.MemoryLimitRatio <= 0 || c.Runtime.MemoryLimitRatio > 1 {
+		check("runtime.memory_limit_ratio", errors.New("must be above 0 and at most 1"))
+	}
+	if c.SLO.Interval < 0 {
+		check("slo.interval", errors.New("must not be negative"))
+	}
+	if c.SLO.Interval > 0 {
+		if c.SLO.ShortWindow <= 0 || c.SLO.LongWindow <= c.SLO.ShortWindow {
+			check("slo.long_window", errors.New("must be longer than slo.short_window, and both positive"))
+		}
+		if c.SLO.BurnRateThreshold <= 0 {
+			check("slo.burn_rate_threshold", errors.New("must be positive"))
+		}
+	}
+	names := make(map[string]bool)
+	for i, o := range c.SLO.Objectives {
+		field := fmt.Sprintf("slo.objectives[%d]", i)
+		switch {
+		case o.Name == "":
+			check(field+".name", errors.New("must be set"))
+		case names[o.Name]:
+			check(field+".name", fmt.Errorf("duplicate objective %q", o.Name))
+		}
+		names[o.Name] = true
+		check(field+".route", validateRoute(o.Route))
+		if o.Latency < 0 {
+			check(field+".latency", errors.New("must not be negative"))
+		}
+		if o.Target <= 0 || o.Target >= 1 {
+			check(field+".target", errors.New("must be between 0 and 1, exclusive"))
+		}
+	}
+	if c.Synthetic.Interval < 0 {
+		check("synthetic.interval", errors.New("must not be negative"))
+	}
+	if c.Synthetic.Target != "" {
+		check("synthetic.target", validateURL(c.Synthetic.Target, "http", "https"))
+	}
+	if c.Synthetic.Interval > 0 && c.Synthetic.Timeout <= 0 {
+		check("synthetic.timeout", errors.New("must be positive"))
+	}
+	names = make(map[string]bool)
+	for i, sc := range c.Synthetic.Checks {
+		field := fmt.Sprintf("synthetic.checks[%d]", i)
+		switch {
+		case sc.Name == "":
+			check(field+".name", errors.New("must be set"))
+		case names[sc.Name]:
+			check(field+".name", fmt.Errorf("duplicate check %q", sc.Name))
+		}
+		names[sc.Name] = true
+		if !strings.HasPrefix(sc.URL, "/") {
+			check(field+".url", validateURL(sc.URL, "http", "https"))
+		}
+		for _, code := range sc.Expect {
+			if code < 100 || code > 599 {
+				check(field+".expect", fmt.Errorf("invalid status code %d", code))
+			}
+		}
+	}
+	if c.Anomaly.Threshold < 0 {
+		check("anomaly.threshold", errors.New("must not be negative"))
+	}
+	if c.Anomaly.Threshold > 0 {
+		if c.Anomaly.Window < 2 {
+			check("anomaly.window", errors.New("must be at least 2"))
+		}
+		if c.Anomaly.MinSamples < 2 {
+			check("anomaly.min_samples", errors.New("must be at least 2"))
+		}
+		if c.Anomaly.MinDeviation < 0 {
+			check("anomaly.min_deviation", errors.New("must not be negative"))
+		}
+	}
+	if c.InventoryLock.Enabled {
+		if c.InventoryLock.Keys < 1 {
+			check("inventory_lock.keys", errors.New("must be at least 1"))
+		}
+		if c.InventoryLock.Hold < 0 {
+			check("inventory_lock.hold", errors.New("must not be negative"))
+		}
+		if c.InventoryLock.Timeout <= 0 {
+			check("inventory_lock.timeout", errors.New("must be positive"))
+		}
+		if c.InventoryLock.RedisURL != "" {
+			check("inventory_lock.redis_url", validateURL(c.InventoryLock.RedisURL, "redis", "rediss"))
+			if c.InventoryLock.TTL <= c.InventoryLock.Hold {
+				check("inventory_lock.ttl", errors.New("must be longer than inventory_lock.hold"))
+			}
+		}
+	}
+	if c.Recording.Dir == "" {
+		check("recording.dir", errors.New("must be set"))
+	}
+	if c.Recording.MaxBodyBytes < 0 {
+		check("recording.max_body_bytes", errors.New("must not be negative"))
+	}
+	if c.Heatmap.Resolution < 0 {
+		check("latency_heatmap.resolution", errors.New("must not be negative"))
+	}
+	if c.Heatmap.Resolution > 0 {
+		if c.Heatmap.Window < c.Heatmap.Resolution {
+			check("latency_heatmap.window", errors.New("must be at least latency_heatmap.resolution"))
+		} else if c.Heatmap.Window/c.Heatmap.Resolution > 1440 {
+			check("latency_heatmap.window", errors.New("must be at most 1440 times latency_heatmap.resolution"))
+		}
+	}
+	if c.FeatureFlags.File != "" {
+		_, err := featureflags.ReadFile(c.FeatureFlags.File)
+		check("feature_flags.file", err)
+	}
+	for i, entry := range c.FeatureFlags.Overrides {
+		_, err := featureflags.ParseEntry(entry)
+		check(fmt.Sprintf("feature_flags.overrides[%d]", i), err)
+	}
+	if c.Auth.JWT.JWKSURL != "" {
+		check("auth.jwt.jwks_url", validateURL(c.Auth.JWT.JWKSURL, "http", "https"))
+	}
+	if c.Admin.Addr != AdminOff {
+		check("admin.addr", validateAddr(c.Admin.Addr))
+		if len(c.Admin.AllowedCIDRs) == 0 {
+			check("admin.allowed_cidrs", errors.New(`must be set; use "*" to admit every client`))
+		}
+		for i, cidr := range c.Admin.AllowedCIDRs {
+			if cidr != "*" {
+				_, err := netip.ParsePrefix(cidr)
+				check(fmt.Sprintf("admin.allowed_cidrs[%d]", i), err)
+			}
+		}
+		for i, cidr := range c.Admin.DeniedCIDRs {
+			_, err := netip.ParsePrefix(cidr)
+			check(fmt.Sprintf("admin.denied_cidrs[%d]", i), err)
+		}
+	}
+	if c.Seed.Enabled {
+		if c.Seed.Orders < 1 || c.Seed.Orders > store.MaxOrders {
+			check("seed.orders", fmt.Errorf("must be between 1 and %d", store.MaxOrders))
+		}
+		if c.Seed.Window <= 0 {
+			check("seed.window", errors.New("must be positive"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Warnings returns settings that are valid but probably unintended, for the
+// startup self-check.
+func (c Config) Warnings() []string {
+	var warnings []string
+	if c.Telemetry.SampleRatio == 0 {
+		warnings = append(warnings, "telemetry.sample_ratio is 0, so no new traces are sampled")
+	}
+	if c.RateLimit.RPS == 0 {
+		warnings = append(warnings, "rate_limit.rps is 0, so rate limiting is disabled")
+	}
+	if c.Server.WriteTimeout > 0 && c.Server.WriteTimeout < c.Server.RequestTimeout {
+		warnings = append(warnings, "server.write_timeout is shorter than server.request_timeout, so slow responses are cut off instead of timing out with 504")
+	}
+	if c.Service.Environment == "production" {
+		if c.Telemetry.Exporter == ExporterOTLP && c.Telemetry.Insecure {
+			warnings = append(warnings, "telemetry.insecure sends OTLP unencrypted in production")
+		}
+		if !c.Server.TLS.Enabled() {
+			warnings = append(warnings, "server.tls is not configured in production")
+		}
+		if c.Server.PreStopDelay == 0 {
+			warnings = append(warnings, "server.pre_stop_delay is 0, so requests may be routed to a stopping instance")
+		}
+	}
+	return warnings
+}
+
+// validateAddr checks a host:port address with a valid port. The host may be
+// empty, meaning all interfaces.
+func validateAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// validateRoute checks a ServeMux-style route: a path, or a method and a
+// path.
+func validateRoute(route string) error {
+	path := route
+	if _, p, ok := strings.Cut(route, " "); ok {
+		path = strings.TrimSpace(p)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%q is not a path or a method and path", route)
+	}
+	return nil
+}
+
+// validateURL checks an absolute URL with one of the given schemes.
+func validateURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
+	for _, s := range schemes {
+		if u.Scheme == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q must use %v", raw, schemes)
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseEntries parses a comma-separated list of key=value entries, such as
+// ROUTE_TIMEOUTS, calling set for each. want describes an entry's format for
+// errors.
+func parseEntries(s, want string, set func(key, value string) error) error {
+	var errs []error
+	for _, entry := range splitList(s) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("invalid entry %q (want %s)", entry, want))
+			continue
+		}
+		if err := set(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid entry %q (want %s): %w", entry, want, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setEntry sets m[key], allocating m if the file left it nil.
+func setEntry[V any](m map[string]V, key string, v V) map[string]V {
+	if m == nil {
+		m = make(map[string]V)
+	}
+	m[key] = v
+	return m
+}
+
+// parseAPIKeys parses API_KEYS, a comma-separated list of name:key or
+// name:key:enduser entries; EndUser defaults to the name. Malformed entries
+// are reported by position only, since they are likely to hold a secret.
+func parseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	var errs []error
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			errs = append(errs, fmt.Errorf("malformed entry %d (want name:key or name:key:enduser)", i+1))
+			continue
+		}
+		key := APIKey{Name: parts[0], Key: parts[1], EndUser: parts[0]}
+		if len(parts) == 3 && parts[2] != "" {
+			key.EndUser = parts[2]
+		}
+		keys = append(keys, key)
+	}
+	return keys, errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"flag"
+	"net"
+	"strconv"
+)
+
+// flags are the command-line overrides. They are applied last, over the file
+// and the environment, and only when given.
+type flags struct {
+	set *flag.FlagSet
+
+	path         string
+	port         int
+	otlpEndpoint string
+	env          string
+	sampleRatio  float64
+	logLevel     string
+	seed         bool
+}
+
+// parseFlags parses the command-line arguments (without the program name).
+// -h prints the usage and exits; invalid flags exit with status 2.
+func parseFlags(name string, args []string) *flags {
+	f := &flags{set: flag.NewFlagSet(name, flag.ExitOnError)}
+	f.set.StringVar(&f.path, "config", "", "configuration file (default "+DefaultPath+", or APP_CONFIG)")
+	f.set.IntVar(&f.port, "port", 0, "port to listen on, keeping the configured host")
+	f.set.StringVar(&f.otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector host:port")
+	f.set.StringVar(&f.env, "env", "", "deployment environment recorded on telemetry")
+	f.set.Float64Var(&f.sampleRatio, "sample-ratio", 0, "fraction (0-1) of new traces to sample")
+	f.set.StringVar(&f.logLevel, "log-level", "", "minimum log level: debug, info, warn, or error")
+	f.set.BoolVar(&f.seed, "seed", false, "populate the order store with generated history at startup")
+	_ = f.set.Parse(args)
+	return f
+}
+
+// apply overrides the configuration with the flags that were given.
+func (f *flags) apply(c *Config) {
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "port":
+			host, _, err := net.SplitHostPort(c.Server.Addr)
+			if err != nil {
+				host = ""
+			}
+			c.Server.Addr = net.JoinHostPort(host, strconv.Itoa(f.port))
+		case "otlp-endpoint":
+			c.Telemetry.OTLPEndpoint = f.otlpEndpoint
+		case "env":
+			c.Service.Environment = f.env
+		case "sample-ratio":
+			c.Telemetry.SampleRatio = f.sampleRatio
+		case "log-level":
+			c.Logging.Level = f.logLevel
+		case "seed":
+			c.Seed.Enabled = f.seed
+		}
+	})
+}
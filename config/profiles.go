@@ -0,0 +1,49 @@
+package config
+
+import (
+	"sort"
+	"time"
+
+	"app/logging"
+)
+
+// profiles are the bundled defaults selected by APP_ENV. Each adjusts the
+// built-in defaults; the file, the environment, and flags still override it.
+var profiles = map[string]func(*Config){
+	// Local development: no collector needed, everything sampled and logged.
+	"dev": func(c *Config) {
+		c.Service.Environment = "development"
+		c.Telemetry.Exporter = ExporterStdout
+		c.Telemetry.SampleRatio = 1
+		c.Logging.Level = "debug"
+		c.Server.RequestTimeout = 30 * time.Second
+	},
+	// Shared pre-production: production-like, sampling more traces.
+	"staging": func(c *Config) {
+		c.Service.Environment = "staging"
+		c.Telemetry.SampleRatio = 0.5
+		c.Logging.File = logging.Stdout
+		c.Server.PreStopDelay = 5 * time.Second
+	},
+	// Production: sampled traces, JSON logs on stdout for the platform's log
+	// collection, and tighter timeouts.
+	"prod": func(c *Config) {
+		c.Service.Environment = "production"
+		c.Telemetry.SampleRatio = 0.1
+		c.Logging.File = logging.Stdout
+		c.Logging.Level = "info"
+		c.Server.RequestTimeout = 5 * time.Second
+		c.Server.ReadHeaderTimeout = 5 * time.Second
+		c.Server.PreStopDelay = 5 * time.Second
+	},
+}
+
+// ProfileNames returns the names of the APP_ENV profiles, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/config"
+
+// pollInterval is how often the configuration file is checked for changes.
+const pollInterval = 2 * time.Second
+
+var meter = otel.Meter(instrumentationName)
+
+// reloadable are the fields, or field prefixes ending in ".", that are applied
+// while the service runs. Changes to any other field take effect on restart.
+var reloadable = []string{
+	"logging.level",
+	"telemetry.sample_ratio",
+	"telemetry.noop_percent",
+	"telemetry.runtime_trace_tasks",
+	"rate_limit.rps",
+	"rate_limit.burst",
+	"chaos.",
+}
+
+// Change is a configuration field whose value changed.
+type Change struct {
+	// Field is the field's YAML path, such as "rate_limit.rps".
+	Field    string
+	Old, New string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Reloadable reports whether the change is applied without a restart.
+func (c Change) Reloadable() bool {
+	for _, r := range reloadable {
+		if c.Field == r || strings.HasSuffix(r, ".") && strings.HasPrefix(c.Field, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the fields that differ between old and new, in declaration
+// order. Credentials in URLs are redacted.
+func Diff(old, new Config) []Change {
+	var changes []Change
+	diff("", reflect.ValueOf(old), reflect.ValueOf(new), &changes)
+	return changes
+}
+
+func diff(prefix string, a, b reflect.Value, changes *[]Change) {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		field := prefix
+		if opts != "inline" {
+			field = strings.TrimPrefix(prefix+"."+name, ".")
+		}
+		av, bv := a.Field(i), b.Field(i)
+		if f.Type.Kind() == reflect.Struct {
+			diff(field, av, bv, changes)
+			continue
+		}
+		if old, new := format(av), format(bv); old != new {
+			*changes = append(*changes, Change{Field: field, Old: old, New: new})
+		}
+	}
+}
+
+// format formats a field value for a Change.
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "unset"
+		}
+		v = v.Elem()
+	}
+	s := fmt.Sprint(v.Interface())
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+// Watcher reloads the configuration on SIGHUP or when its file changes, and
+// applies the reloadable fields through a callback. Each reload is traced as
+// a "config.reload" span, logged with the diff, and counted in
+// config_reloads_total.
+type Watcher struct {
+	args  []string
+	apply func(ctx context.Context, old, new Config)
+
+	mu      sync.Mutex
+	current Config
+	modTime time.Time
+
+	reloadCounter metric.Int64Counter
+}
+
+// NewWatcher watches cfg, which was loaded from args. apply is called with the
+// previous and the reloaded configuration when a reloadable field changes; it
+// should only read the reloadable fields.
+func NewWatcher(cfg Config, args []string, apply func(ctx context.Context, old, new Config)) *Watcher {
+	w := &Watcher{args: args, apply: apply, current: cfg, modTime: modTime(cfg.File)}
+
+	var err error
+	w.reloadCounter, err = meter.Int64Counter(
+		"config_reloads_total",
+		metric.WithDescription("The total number of configuration reloads, by outcome"),
+		metric.WithUnit("{reload}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create config_reloads_total counter: %v", err)
+	}
+	return w
+}
+
+// Watch reloads the configuration on SIGHUP, and when the file's modification
+// time changes, until ctx is done.
+func (w *Watcher) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			_ = w.Reload(ctx, "signal")
+		case <-ticker.C:
+			w.mu.Lock()
+			changed := modTime(w.current.File) != w.modTime
+			w.mu.Unlock()
+			if changed {
+				_ = w.Reload(ctx, "file")
+			}
+		}
+	}
+}
+
+// Reload loads the configuration again and applies the reloadable changes.
+// An invalid configuration is rejected as a whole and the current one kept.
+// Changes that need a restart are logged but not applied.
+func (w *Watcher) Reload(ctx context.Context, trigger string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "config.reload",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("config.reload.trigger", trigger),
+			attribute.String("config.file", w.current.File),
+		),
+	)
+	defer span.End()
+
+	w.modTime = modTime(w.current.File)
+	next, err := Load(w.args)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid configuration")
+		w.reloadCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "error")))
+		logging.JSONLogger.Error(ctx, "Config reload failed; keeping the current configuration",
+			attribute.String("config.reload.trigger", trigger),
+			attribute.String("error.reason", err.Error()),
+		)
+		return err
+	}
+
+	var applied, pending []string
+	for _, c := range Diff(w.current, next) {
+		if c.Reloadable() {
+			applied = append(applied, c.String())
+		} else {
+			pending = append(pending, c.String())
+		}
+	}
+	span.SetAttributes(
+		attribute.StringSlice("config.changes", applied),
+		attribute.StringSlice("config.restart_required", pending),
+	)
+	// Log before applying, so the diff is kept even if the log level is raised.
+	logging.JSONLogger.Info(ctx, "Config reloaded",
+		attribute.String("config.reload.trigger", trigger),
+		attribute.StringSlice("config.changes", applied),
+	)
+	if len(pending) > 0 {
+		logging.JSONLogger.Warn(ctx, "Config changes need a restart to take effect",
+			attribute.StringSlice("config.restart_required", pending),
+		)
+	}
+	if len(applied) > 0 {
+		w.apply(ctx, w.current, next)
+	}
+	w.current = next
+	w.reloadCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "ok")))
+	return nil
+}
+
+// modTime returns the file's modification time, or the zero time if it cannot
+// be read.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,281 @@
+// Package featureflags holds the runtime feature flags that gate routes and
+// workflow stages. Flags can be switched on and off, or rolled out to a
+// percentage of clients, while the service is running, so demos can show a
+// progressive rollout. Flags are resolved by a Provider modelled on
+// OpenFeature's, and every evaluation is traced and counted.
+package featureflags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+const instrumentationName = "app/featureflags"
+
+// ProviderName identifies the built-in flag provider in feature_flag span
+// events.
+const ProviderName = "app"
+
+// Flag names.
+const (
+	OrdersV2      = "orders-v2"
+	OrderImport   = "order-import"
+	OrderTracking = "order-tracking"
+	// FraudScreening adds a fraud screening stage to the order workflow.
+	FraudScreening = "fraud-screening"
+)
+
+// Flag is a feature flag's setting.
+type Flag struct {
+	Name string `json:"name"`
+	// Enabled turns the feature on for the clients in the rollout.
+	Enabled bool `json:"enabled"`
+	// Rollout is the percentage (0-100) of clients the feature is on for.
+	Rollout int `json:"rollout"`
+}
+
+// Evaluation is the result of evaluating a flag for one client.
+type Evaluation struct {
+	Flag     string
+	Provider string
+	Enabled  bool
+	Variant  string
+	// Reason is why the flag evaluated as it did, such as ReasonStatic or
+	// ReasonSplit.
+	Reason string
+	// ErrorCode is set when the flag could not be resolved, such as
+	// ErrorFlagNotFound; Enabled is then the default value.
+	ErrorCode string
+}
+
+// defaultFlags are the flags the service starts with: the routes on, and new
+// workflow stages off.
+var defaultFlags = []Flag{
+	{Name: OrdersV2, Enabled: true, Rollout: 100},
+	{Name: OrderImport, Enabled: true, Rollout: 100},
+	{Name: OrderTracking, Enabled: true, Rollout: 100},
+	{Name: FraudScreening, Enabled: false, Rollout: 100},
+}
+
+var (
+	mu    sync.RWMutex
+	flags = make(map[string]Flag)
+
+	meter             = otel.Meter(instrumentationName)
+	evaluationCounter metric.Int64Counter
+)
+
+func init() {
+	for _, f := range defaultFlags {
+		flags[f.Name] = f
+	}
+
+	var err error
+	evaluationCounter, err = meter.Int64Counter(
+		"feature_flag_evaluations_total",
+		metric.WithDescription("The total number of feature flag evaluations"),
+		metric.WithUnit("{evaluation}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create feature_flag_evaluations_total counter: %v", err)
+	}
+}
+
+// Configure applies the flags in file, if it is set, and then the overrides,
+// over the defaults. It is called at startup with feature_flags.file
+// (FEATURE_FLAGS_FILE) and feature_flags.overrides (FEATURE_FLAGS), which
+// config.Load has validated with ReadFile and ParseEntry.
+func Configure(file string, overrides []string) error {
+	var fs []Flag
+	if file != "" {
+		var err error
+		if fs, err = ReadFile(file); err != nil {
+			return err
+		}
+	}
+	for _, entry := range overrides {
+		f, err := ParseEntry(entry)
+		if err != nil {
+			return err
+		}
+		fs = append(fs, f)
+	}
+	for _, f := range fs {
+		if _, err := Set(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFile reads and validates a YAML list of flags, such as:
+//
+//	# flags.yaml
+//	- name: orders-v2
+//	  enabled: true
+//	  rollout: 25
+//
+// The rollout defaults to 100.
+func ReadFile(path string) ([]Flag, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file []struct {
+		Name    string `yaml:"name"`
+		Enabled bool   `yaml:"enabled"`
+		Rollout *int   `yaml:"rollout"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	fs := make([]Flag, 0, len(file))
+	var errs []error
+	for _, entry := range file {
+		f := Flag{Name: entry.Name, Enabled: entry.Enabled, Rollout: 100}
+		if entry.Rollout != nil {
+			f.Rollout = *entry.Rollout
+		}
+		if err := validate(f); err != nil {
+			errs = append(errs, err)
+		}
+		fs = append(fs, f)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fs, nil
+}
+
+// ParseEntry parses and validates a name=on, name=off, or name=<percent>
+// override.
+func ParseEntry(entry string) (Flag, error) {
+	name, value, ok := strings.Cut(entry, "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !ok || name == "" {
+		return Flag{}, fmt.Errorf("%q is not name=value", entry)
+	}
+	f := Flag{Name: name, Enabled: true, Rollout: 100}
+	switch value {
+	case "on", "true":
+	case "off", "false":
+		f.Enabled = false
+	default:
+		pct, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil {
+			return Flag{}, fmt.Errorf("%q: value must be on, off, or a percentage", entry)
+		}
+		f.Rollout = pct
+	}
+	return f, validate(f)
+}
+
+// Get returns the named flag.
+func Get(name string) (Flag, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := flags[name]
+	return f, ok
+}
+
+// All returns every flag, sorted by name.
+func All() []Flag {
+	mu.RLock()
+	defer mu.RUnlock()
+	all := make([]Flag, 0, len(flags))
+	for _, f := range flags {
+		all = append(all, f)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Set creates or replaces a flag and returns it.
+func Set(f Flag) (Flag, error) {
+	if err := validate(f); err != nil {
+		return Flag{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	flags[f.Name] = f
+	return f, nil
+}
+
+// validate checks a flag's name and rollout.
+func validate(f Flag) error {
+	if f.Name == "" {
+		return fmt.Errorf("flag name is required")
+	}
+	if f.Rollout < 0 || f.Rollout > 100 {
+		return fmt.Errorf("rollout for %q must be between 0 and 100, got %d", f.Name, f.Rollout)
+	}
+	return nil
+}
+
+// Evaluate evaluates the named boolean flag for the client identified by key.
+// Unknown flags are off.
+func Evaluate(ctx context.Context, name, key string) Evaluation {
+	return BooleanValueDetails(ctx, name, false, EvaluationContext{TargetingKey: key})
+}
+
+// BooleanValue evaluates a boolean flag, returning defaultValue if it cannot
+// be resolved.
+func BooleanValue(ctx context.Context, name string, defaultValue bool, evalCtx EvaluationContext) bool {
+	return BooleanValueDetails(ctx, name, defaultValue, evalCtx).Enabled
+}
+
+// BooleanValueDetails evaluates a boolean flag with the current provider. The
+// evaluation is recorded as a "feature_flag" event on the span in ctx, with
+// the OpenTelemetry feature flag attributes, and counted in
+// feature_flag_evaluations_total.
+func BooleanValueDetails(ctx context.Context, name string, defaultValue bool, evalCtx EvaluationContext) Evaluation {
+	p := currentProvider()
+	res := p.BooleanEvaluation(ctx, name, defaultValue, evalCtx)
+	e := Evaluation{
+		Flag:      name,
+		Provider:  p.Metadata().Name,
+		Enabled:   res.Value,
+		Variant:   res.Variant,
+		Reason:    res.Reason,
+		ErrorCode: res.ErrorCode,
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.FeatureFlagKey(name),
+		semconv.FeatureFlagProviderName(e.Provider),
+		semconv.FeatureFlagVariant(e.Variant),
+		attribute.String("feature_flag.reason", e.Reason),
+	}
+	if e.ErrorCode != "" {
+		attrs = append(attrs, attribute.String("error.type", e.ErrorCode))
+	}
+	trace.SpanFromContext(ctx).AddEvent("feature_flag", trace.WithAttributes(attrs...))
+	evaluationCounter.Add(ctx, 1, metric.WithAttributes(
+		semconv.FeatureFlagKey(name),
+		semconv.FeatureFlagVariant(e.Variant),
+		attribute.String("feature_flag.reason", e.Reason),
+	))
+	return e
+}
+
+// bucket maps a client key to a stable bucket in [0, 100) for the flag.
+func bucket(name, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + key))
+	return int(h.Sum32() % 100)
+}
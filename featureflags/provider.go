@@ -0,0 +1,102 @@
+package featureflags
+
+import (
+	"context"
+	"sync"
+)
+
+// Provider resolves flag values. It follows the OpenFeature provider model
+// (https://openfeature.dev/specification/sections/providers), so an OpenFeature
+// provider such as flagd can be adapted to it; the evaluation telemetry is
+// recorded by BooleanValueDetails regardless of the provider.
+type Provider interface {
+	Metadata() ProviderMetadata
+	// BooleanEvaluation resolves a boolean flag. It returns defaultValue, with
+	// an error code, when the flag cannot be resolved.
+	BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx EvaluationContext) BoolResolutionDetail
+}
+
+// ProviderMetadata describes a provider.
+type ProviderMetadata struct {
+	Name string
+}
+
+// EvaluationContext is what a flag is evaluated for.
+type EvaluationContext struct {
+	// TargetingKey identifies the subject, such as a session or customer, so
+	// percentage rollouts are sticky.
+	TargetingKey string
+	Attributes   map[string]any
+}
+
+// Resolution reasons, as defined by OpenFeature.
+const (
+	ReasonStatic   = "STATIC"
+	ReasonSplit    = "SPLIT"
+	ReasonDisabled = "DISABLED"
+	ReasonError    = "ERROR"
+)
+
+// ErrorFlagNotFound is the error code for a flag the provider does not know.
+const ErrorFlagNotFound = "FLAG_NOT_FOUND"
+
+// BoolResolutionDetail is a provider's resolution of a boolean flag.
+type BoolResolutionDetail struct {
+	Value   bool
+	Variant string
+	Reason  string
+	// ErrorCode is set when the flag could not be resolved; Value is then
+	// the default.
+	ErrorCode string
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   Provider = memoryProvider{}
+)
+
+// SetProvider replaces the provider flags are resolved with. The default
+// provider serves the flags set by Configure and the admin API.
+func SetProvider(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+func currentProvider() Provider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider
+}
+
+// memoryProvider resolves the flags held in this package.
+type memoryProvider struct{}
+
+func (memoryProvider) Metadata() ProviderMetadata {
+	return ProviderMetadata{Name: ProviderName}
+}
+
+// BooleanEvaluation serves a flag that is on for the clients in its rollout.
+// A partial rollout puts each targeting key in a stable bucket, so a client
+// sees the same variant on every evaluation.
+func (memoryProvider) BooleanEvaluation(_ context.Context, flag string, defaultValue bool, evalCtx EvaluationContext) BoolResolutionDetail {
+	f, ok := Get(flag)
+	switch {
+	case !ok:
+		return BoolResolutionDetail{Value: defaultValue, Variant: variant(defaultValue), Reason: ReasonError, ErrorCode: ErrorFlagNotFound}
+	case !f.Enabled:
+		return BoolResolutionDetail{Variant: "off", Reason: ReasonDisabled}
+	case f.Rollout < 100:
+		on := bucket(flag, evalCtx.TargetingKey) < f.Rollout
+		return BoolResolutionDetail{Value: on, Variant: variant(on), Reason: ReasonSplit}
+	default:
+		return BoolResolutionDetail{Value: true, Variant: "on", Reason: ReasonStatic}
+	}
+}
+
+func variant(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// API versions of the order contract.
+const (
+	apiV1 = "v1"
+	apiV2 = "v2"
+)
+
+type apiVersionKey struct{}
+
+// withAPIVersion records the API version serving the request, so the order
+// workflow can tag its spans, metrics, and logs with api.version.
+func withAPIVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, apiVersionKey{}, version)
+}
+
+// apiVersionAttr returns the api.version attribute for the request. Requests
+// outside a versioned handler default to v1.
+func apiVersionAttr(ctx context.Context) attribute.KeyValue {
+	version, ok := ctx.Value(apiVersionKey{}).(string)
+	if !ok {
+		version = apiV1
+	}
+	return attribute.String("api.version", version)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BaggageRequest is the JSON request payload for POST /debug/baggage.
+type BaggageRequest struct {
+	// Entries are the members to set, by key; they replace received members
+	// with the same key.
+	Entries map[string]string `json:"entries"`
+}
+
+// BaggageResponse is the JSON response payload for the /debug/baggage
+// endpoints.
+type BaggageResponse struct {
+	// Baggage holds the members, by key.
+	Baggage []BaggageEntry `json:"baggage"`
+	// Header is the baggage header that propagates them to the next hop.
+	Header string `json:"header"`
+}
+
+// BaggageHandler serves GET /debug/baggage: the baggage the request carries,
+// as the service sees it, including members added by the middlewares such as
+// the request ID.
+func BaggageHandler(w http.ResponseWriter, r *http.Request) {
+	writeBaggage(w, baggage.FromContext(r.Context()))
+}
+
+// SetBaggageHandler serves POST /debug/baggage: it sets the entries in the
+// body on the received baggage and returns the result, also as the response's
+// baggage header, so a demo client can pass it on to the next hop.
+func SetBaggageHandler(w http.ResponseWriter, r *http.Request) {
+	var req BaggageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, problem.InvalidRequest, "The body is not valid JSON.")
+		return
+	}
+
+	bag := baggage.FromContext(r.Context())
+	var invalid []problem.InvalidParam
+	keys := make([]string, 0, len(req.Entries))
+	for k := range req.Entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !validBaggageKey(k) {
+			invalid = append(invalid, problem.InvalidParam{Name: "entries." + k, In: "body", Reason: "the key is not a W3C baggage token"})
+			continue
+		}
+		// NewMember expects a percent-encoded value.
+		m, err := baggage.NewMember(k, url.PathEscape(req.Entries[k]))
+		if err == nil {
+			bag, err = bag.SetMember(m)
+		}
+		if err != nil {
+			invalid = append(invalid, problem.InvalidParam{Name: "entries." + k, In: "body", Reason: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		problem.WriteInvalidParams(w, r, "Some baggage entries are invalid.", invalid)
+		return
+	}
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.StringSlice("baggage.set", keys))
+
+	resp := BaggageResponse{Baggage: baggageEntries(bag), Header: bag.String()}
+	w.Header().Set("Baggage", resp.Header)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// validBaggageKey reports whether k is an RFC 7230 token, as baggage keys must
+// be to appear in the header; the SDK accepts other keys but drops them when
+// propagating.
+func validBaggageKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for _, c := range k {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func writeBaggage(w http.ResponseWriter, bag baggage.Baggage) {
+	resp := BaggageResponse{Baggage: baggageEntries(bag), Header: bag.String()}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// baggageEntries returns the members of bag, sorted by key.
+func baggageEntries(bag baggage.Baggage) []BaggageEntry {
+	entries := []BaggageEntry{}
+	for _, m := range bag.Members() {
+		entry := BaggageEntry{Key: m.Key(), Value: m.Value()}
+		for _, p := range m.Properties() {
+			entry.Properties = append(entry.Properties, p.String())
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
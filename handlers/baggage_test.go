@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetBaggage(t *testing.T) {
+	rec := tracetest.Install(t)
+	r := httptest.NewRequest(http.MethodPost, "/debug/baggage", strings.NewReader(`{"entries":{"user.id":"42","plan":"gold tier"}}`))
+	r.Header.Set("baggage", "tenant=acme,user.id=7")
+
+	w, _ := serve(t, SetBaggageHandler, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", w.Code, w.Body)
+	}
+	want := []BaggageEntry{
+		{Key: "plan", Value: "gold tier"},
+		{Key: "tenant", Value: "acme"},
+		{Key: "user.id", Value: "42"},
+	}
+	var resp BaggageResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.Baggage, want) {
+		t.Errorf("baggage = %+v, want %+v", resp.Baggage, want)
+	}
+	// The next hop extracts the same members from the response header.
+	next := baggage.FromContext(propagation.Baggage{}.Extract(context.Background(), propagation.HeaderCarrier(w.Header())))
+	if got := baggageEntries(next); !reflect.DeepEqual(got, want) {
+		t.Errorf("baggage header %q carries %+v, want %+v", w.Header().Get("Baggage"), got, want)
+	}
+	tracetest.AssertAttributes(t, rec.Span(t, "POST /debug/baggage"), attribute.StringSlice("baggage.set", []string{"plan", "user.id"}))
+}
+
+func TestSetBaggageInvalid(t *testing.T) {
+	tracetest.Install(t)
+	r := httptest.NewRequest(http.MethodPost, "/debug/baggage", strings.NewReader(`{"entries":{"bad key":"x"}}`))
+
+	w, _ := serve(t, SetBaggageHandler, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400; body: %s", w.Code, w.Body)
+	}
+	if w.Header().Get("Baggage") != "" {
+		t.Errorf("baggage header = %q, want none", w.Header().Get("Baggage"))
+	}
+}
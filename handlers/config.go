@@ -0,0 +1,16 @@
+package handlers
+
+import "app/config"
+
+// Configure points the order workflow at the downstream services. It must be
+// called before the routes are served; empty URLs keep the in-process
+// simulations.
+func Configure(d config.Downstream) {
+	paymentServiceURL = d.PaymentServiceURL
+	inventoryServiceURL = d.InventoryServiceURL
+	partnerURL = partnerInProcessURL
+	if d.PartnerURL != "" {
+		partnerURL = d.PartnerURL
+	}
+	partnerClient = newPartnerClient()
+}
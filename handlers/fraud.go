@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// fraudReviewThreshold is the risk score above which an order is flagged for
+// manual review.
+const fraudReviewThreshold = 0.9
+
+// screenOrder simulates scoring the order with a fraud screening service
+// inside a "fraud.screen" span. High-risk orders are flagged for review, not
+// rejected.
+func screenOrder(ctx context.Context, customerID string) error {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "fraud.screen")
+	defer span.End()
+
+	if err := simulateWork(ctx, time.Duration(rand.IntN(30)+10)*time.Millisecond); err != nil {
+		return err
+	}
+	score := rand.Float64()
+	span.SetAttributes(
+		attribute.String("customer.id", customerID),
+		attribute.Float64("fraud.score", score),
+		attribute.Bool("fraud.review", score > fraudReviewThreshold),
+	)
+	span.SetStatus(codes.Ok, "order screened")
+	return nil
+}
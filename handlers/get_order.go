@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"app/logging"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Counter for conditional GETs, by result (hit or miss).
+var conditionalRequestsCounter metric.Int64Counter
+
+func init() {
+	var err error
+	conditionalRequestsCounter, err = meter.Int64Counter(
+		"conditional_requests_total",
+		metric.WithDescription("The total number of conditional GET requests, by cache result"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create conditional_requests_total counter: %v", err)
+	}
+}
+
+// GetOrderHandler serves GET /orders/{id}. Responses carry an ETag, and a
+// request whose If-None-Match matches it is answered with 304 Not Modified.
+func GetOrderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := json.Marshal(order)
+	if err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding order", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding order", attribute.String("error.reason", err.Error()))
+		problem.Write(w, r, problem.InternalError, "")
+		return
+	}
+	etag := orderETag(body)
+	w.Header().Set("ETag", etag)
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		hit := etagMatches(inm, etag)
+		result := "miss"
+		if hit {
+			result = "hit"
+		}
+		span.SetAttributes(attribute.Bool("http.conditional.not_modified", hit))
+		conditionalRequestsCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
+		if hit {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error writing order response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error writing order response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// orderETag returns a strong ETag for the encoded order.
+func orderETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using the
+// weak comparison that RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
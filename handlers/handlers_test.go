@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"app/catalog"
+	"app/chaos"
+	"app/config"
+	"app/logging"
+	"app/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the JSON log out of the source tree.
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.JSONLogger.SetFile(filepath.Join(dir, "app.log"))
+	if err := catalog.Warm(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	code := m.Run()
+	_ = logging.JSONLogger.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setKnobs sets chaos knobs with no random failures and a fraction of the
+// usual latency, so the workflow is deterministic and quick, and applies
+// change to them. The baseline knobs are restored after the test.
+func setKnobs(t *testing.T, change func(*chaos.Knobs)) {
+	t.Helper()
+	k := chaos.Knobs{Scenario: "test", DBLatencyFactor: 1, LatencyFactor: 0.01}
+	if change != nil {
+		change(&k)
+	}
+	chaos.Set(k)
+	t.Cleanup(func() { _ = chaos.Configure(chaos.BaselineScenario, chaos.Overrides{}) })
+}
+
+// stubPayments points the payment step at a payment service that answers with
+// status, and restores the in-process simulation after the test.
+func stubPayments(t *testing.T, status int) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	Configure(config.Downstream{PaymentServiceURL: srv.URL})
+	t.Cleanup(func() { Configure(config.Downstream{}) })
+}
+
+// serve calls handler through otelhttp, as the server does, with the server
+// span named after the method and path. It returns the response and the
+// server span's context.
+func serve(t *testing.T, handler http.HandlerFunc, r *http.Request) (*httptest.ResponseRecorder, trace.SpanContext) {
+	t.Helper()
+	var sc trace.SpanContext
+	h := otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc = trace.SpanContextFromContext(r.Context())
+		handler(w, r)
+	}), "", tracing.HTTPOptions(otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + r.URL.Path
+	}))...)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w, sc
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"app/catalog"
+	"app/middleware"
+	"app/store"
+	"app/tracing"
+)
+
+// healthCheckTimeout bounds the store check behind the probe endpoints.
+const healthCheckTimeout = time.Second
+
+// draining is set once graceful shutdown has started.
+var draining atomic.Bool
+
+// HealthResponse is the JSON response payload for the probe endpoints.
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+	// SelfCheck holds the startup self-check results, on /readyz.
+	SelfCheck map[string]string `json:"self_check,omitempty"`
+	// Collector is the OTel Collector's last checked state, on /readyz. It
+	// does not affect readiness: a telemetry outage should not take the
+	// service out of rotation.
+	Collector *tracing.CollectorStatus `json:"collector,omitempty"`
+}
+
+// StartDraining marks the server as shutting down, so /readyz fails while
+// in-flight requests finish.
+func StartDraining() {
+	draining.Store(true)
+}
+
+// LivezHandler serves GET /livez. It answers 200 as long as the process can
+// serve requests; it has no dependency checks, so a dependency outage never
+// gets the process restarted.
+func LivezHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, HealthResponse{Status: "ok"})
+}
+
+// HealthzHandler serves GET /healthz. It checks that the order store is
+// reachable and that the telemetry exporters are initialized.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, runHealthChecks(r.Context(), false))
+}
+
+// ReadyzHandler serves GET /readyz. On top of the /healthz checks it requires
+// the catalog caches to be warm, the startup self-check to have run, the
+// server not to be draining, and maintenance mode to be off. It also lists the
+// self-check results and the OTel Collector's state.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, runHealthChecks(r.Context(), true))
+}
+
+// runHealthChecks runs the probe checks; readiness adds the catalog,
+// self-check, draining, and maintenance checks.
+func runHealthChecks(ctx context.Context, readiness bool) HealthResponse {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]bool{
+		"store":     store.DefaultStore.Ping(ctx) == nil,
+		"exporters": tracing.Initialized(),
+	}
+	var startup map[string]string
+	var collector *tracing.CollectorStatus
+	if readiness {
+		checks["catalog"] = catalog.Ready()
+		checks["shutdown"] = !draining.Load()
+		checks["maintenance"] = !middleware.Maintenance().Enabled
+		startup, checks["self_check"] = selfCheckResults()
+		if status, ok := tracing.Collector(); ok {
+			collector = &status
+		}
+	}
+
+	resp := HealthResponse{Status: "ok", Checks: make(map[string]string, len(checks)), SelfCheck: startup, Collector: collector}
+	for name, ok := range checks {
+		if ok {
+			resp.Checks[name] = "ok"
+			continue
+		}
+		resp.Checks[name] = "failing"
+		resp.Status = "unavailable"
+	}
+	return resp
+}
+
+// writeHealth writes the probe response, with 503 unless the status is ok.
+func writeHealth(w http.ResponseWriter, resp HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
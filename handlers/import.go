@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"app/chaos"
+	"app/logging"
+	"app/problem"
+	"app/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// importChunkSize is the number of rows written per chunk span.
+	importChunkSize = 100
+	// importMaxLineBytes bounds a single NDJSON line.
+	importMaxLineBytes = 64 * 1024
+	// importMaxReportedErrors bounds the row errors returned to the client.
+	importMaxReportedErrors = 100
+)
+
+// ImportRow is a single NDJSON line accepted by the import endpoint.
+type ImportRow struct {
+	CustomerID string `json:"customer_id"`
+	// Status defaults to "created"; "failed" is also accepted.
+	Status string `json:"status"`
+}
+
+// ImportRowError reports why a line was rejected.
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportResponse is the JSON response payload for a bulk import.
+type ImportResponse struct {
+	Imported int              `json:"imported"`
+	Rejected int              `json:"rejected"`
+	Chunks   int              `json:"chunks"`
+	Errors   []ImportRowError `json:"errors"`
+	// Truncated is set when more errors occurred than are reported.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+var (
+	// Counter for imported rows, by result.
+	importRowsCounter metric.Int64Counter
+	// Histogram for per-request import throughput.
+	importThroughputHistogram metric.Float64Histogram
+)
+
+func init() {
+	var err error
+	importRowsCounter, err = meter.Int64Counter(
+		"order_import_rows_total",
+		metric.WithDescription("The total number of rows processed by bulk imports"),
+		metric.WithUnit("{row}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create order_import_rows_total counter: %v", err)
+	}
+	importThroughputHistogram, err = meter.Float64Histogram(
+		"order_import_throughput",
+		metric.WithDescription("The throughput of bulk imports"),
+		metric.WithUnit("{row}/s"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create order_import_throughput histogram: %v", err)
+	}
+}
+
+// ImportOrdersHandler serves POST /orders/import. The body is newline-delimited
+// JSON (one ImportRow per line), read as a stream and written in chunks of
+// importChunkSize rows, each inside its own "import.chunk" span. Invalid lines
+// are rejected individually and reported in the response. When the request is
+// canceled, usually by its timeout, the import stops before the next chunk, and
+// the chunks written so far stay imported.
+func ImportOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+	span := trace.SpanFromContext(ctx)
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 4096), importMaxLineBytes)
+
+	resp := ImportResponse{Errors: []ImportRowError{}}
+	reject := func(line int, err error) {
+		resp.Rejected++
+		if len(resp.Errors) < importMaxReportedErrors {
+			resp.Errors = append(resp.Errors, ImportRowError{Line: line, Error: err.Error()})
+		} else {
+			resp.Truncated = true
+		}
+	}
+
+	chunk := make([]ImportRow, 0, importChunkSize)
+	// flush writes the pending chunk, unless the request has been canceled.
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := importChunk(ctx, resp.Chunks, chunk); err != nil {
+			return err
+		}
+		resp.Imported += len(chunk)
+		resp.Chunks++
+		chunk = chunk[:0]
+		return nil
+	}
+	var canceled error
+	line := 0
+	for canceled == nil && scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		row, err := parseImportRow(scanner.Bytes())
+		if err != nil {
+			reject(line, err)
+			continue
+		}
+		chunk = append(chunk, row)
+		if len(chunk) == importChunkSize {
+			canceled = flush()
+		}
+	}
+	if canceled == nil && len(chunk) > 0 {
+		canceled = flush()
+	}
+	if err := scanner.Err(); err != nil && canceled == nil {
+		// The stream cannot be resumed past an oversized or unreadable line.
+		reject(line+1, fmt.Errorf("reading body: %w", err))
+	}
+
+	elapsed := time.Since(start)
+	importRowsCounter.Add(ctx, int64(resp.Imported), metric.WithAttributes(attribute.String("result", "imported")))
+	importRowsCounter.Add(ctx, int64(resp.Rejected), metric.WithAttributes(attribute.String("result", "rejected")))
+	if elapsed > 0 {
+		importThroughputHistogram.Record(ctx, float64(resp.Imported)/elapsed.Seconds())
+	}
+
+	span.SetAttributes(
+		attribute.Int("import.rows.imported", resp.Imported),
+		attribute.Int("import.rows.rejected", resp.Rejected),
+		attribute.Int("import.chunks", resp.Chunks),
+	)
+	logAttrs := []attribute.KeyValue{
+		attribute.Int("import.rows.imported", resp.Imported),
+		attribute.Int("import.rows.rejected", resp.Rejected),
+	}
+	if canceled != nil {
+		span.RecordError(canceled)
+		span.SetStatus(codes.Error, "import canceled")
+		logAttrs = append(logAttrs, attribute.String("error.reason", canceled.Error()))
+		logging.DefaultLogger.Error(ctx, "Order import canceled", logAttrs...)
+		logging.JSONLogger.Error(ctx, "Order import canceled", logAttrs...)
+		problem.Write(w, r, problem.GatewayTimeout, fmt.Sprintf("The import was canceled after %d rows in %d chunks were imported.", resp.Imported, resp.Chunks))
+		return
+	}
+	if resp.Rejected > 0 {
+		logging.DefaultLogger.Error(ctx, "Order import completed with rejected rows", logAttrs...)
+		logging.JSONLogger.Error(ctx, "Order import completed with rejected rows", logAttrs...)
+	} else {
+		logging.DefaultLogger.Info(ctx, "Order import completed", logAttrs...)
+		logging.JSONLogger.Info(ctx, "Order import completed", logAttrs...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding import response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding import response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// parseImportRow decodes and validates a single NDJSON line.
+func parseImportRow(data []byte) (ImportRow, error) {
+	var row ImportRow
+	if err := json.Unmarshal(data, &row); err != nil {
+		return row, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if row.CustomerID == "" {
+		return row, errors.New("customer_id is required")
+	}
+	switch row.Status {
+	case "":
+		row.Status = store.StatusCreated
+	case store.StatusCreated, store.StatusFailed:
+	default:
+		return row, fmt.Errorf("unsupported status %q", row.Status)
+	}
+	return row, nil
+}
+
+// importChunk writes one chunk of rows inside an "import.chunk" span. If ctx is
+// canceled first, none of the rows are stored and it returns the context's
+// error.
+func importChunk(ctx context.Context, index int, rows []ImportRow) error {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "import.chunk",
+		trace.WithAttributes(
+			attribute.Int("import.chunk.index", index),
+			attribute.Int("import.chunk.rows", len(rows)),
+		),
+	)
+	defer span.End()
+
+	// Simulate a batched DB write.
+	if err := simulateWork(ctx, chaos.Current().DBLatency(time.Duration(rand.IntN(10)+5)*time.Millisecond)); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "chunk interrupted")
+		return err
+	}
+
+	sc := span.SpanContext()
+	for _, row := range rows {
+		order := store.DefaultStore.Create(row.CustomerID, sc.TraceID().String(), sc.SpanID().String())
+		store.DefaultStore.SetStatus(order.ID, row.Status)
+	}
+	span.SetStatus(codes.Ok, "chunk imported")
+	return nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/store"
+)
+
+func TestImportOrdersCanceled(t *testing.T) {
+	setKnobs(t, nil)
+	body := strings.Repeat(`{"customer_id":"import-canceled"}`+"\n", importChunkSize+1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodPost, "/orders/import", strings.NewReader(body)).WithContext(ctx)
+
+	w, _ := serve(t, ImportOrdersHandler, r)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+	if orders := store.DefaultStore.Search(store.Query{CustomerID: "import-canceled"}); len(orders) != 0 {
+		t.Errorf("%d orders imported after the request was canceled, want 0", len(orders))
+	}
+}
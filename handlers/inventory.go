@@ -1,16 +1,69 @@
 package handlers
 
 import (
+    "context"
     "encoding/json"
+    "errors"
+    "fmt"
     "math/rand/v2"
     "net/http"
+    "sync/atomic"
     "time"
 
+    "go.opentelemetry.io/otel"
     "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
 
+    "app/catalog"
+    "app/chaos"
+    "app/config"
+    "app/httpclient"
+    "app/lock"
     "app/logging"
+    "app/problem"
 )
 
+// errOutOfStock is returned by checkInventory when the requested item is unavailable.
+var errOutOfStock = errors.New("simulated item out of stock")
+
+// stockBusyDetail is the detail of the StockBusy problem, answered when the
+// stock could not be reserved in time.
+const stockBusyDetail = "The stock could not be reserved in time; retry shortly."
+
+var (
+    // inventoryServiceURL is the base URL of cmd/inventory-service (e.g.
+    // http://localhost:8082), set by Configure. When empty, the order
+    // workflow checks inventory in-process.
+    inventoryServiceURL string
+    // inventoryClient propagates the trace context to the inventory service.
+    inventoryClient = httpclient.New("inventory-service")
+    // inventoryLock is held while stock is reserved; nil while the lock is disabled.
+    inventoryLock atomic.Pointer[stockLock]
+)
+
+// stockLock is the inventory lock and how reservations use it.
+type stockLock struct {
+    lock *lock.Lock
+    keys int
+    hold time.Duration
+}
+
+// ConfigureInventoryLock makes the inventory check reserve stock under a lock
+// per SKU when cfg enables it. It fails if the lock's Redis URL is invalid.
+func ConfigureInventoryLock(cfg config.InventoryLock) error {
+    if !cfg.Enabled {
+        inventoryLock.Store(nil)
+        return nil
+    }
+    l, err := lock.New("inventory", cfg)
+    if err != nil {
+        return err
+    }
+    inventoryLock.Store(&stockLock{lock: l, keys: cfg.Keys, hold: cfg.Hold})
+    return nil
+}
+
 // InventoryResponse is the JSON response payload for the inventory check.
 type InventoryResponse struct {
     Status  string `json:"status"`
@@ -19,13 +72,29 @@ type InventoryResponse struct {
 }
 
 // CheckInventoryHandler responds with a success message and a simulated delay.
+// It returns HTTP 409 when the simulated item is out of stock, and a StockBusy
+// problem (HTTP 503) when the stock could not be reserved in time.
 func CheckInventoryHandler(w http.ResponseWriter, r *http.Request) {
     ctx := r.Context()
 
-    delay := rand.IntN(601) + 200
+    delay, err := checkInventory(ctx)
+    if err != nil {
+        logging.DefaultLogger.Error(ctx, "Inventory check failed", attribute.String("error.reason", err.Error()))
+        logging.JSONLogger.Error(ctx, "Inventory check failed", attribute.String("error.reason", err.Error()))
 
-    // Simulate downstream latency (e.g., a database call).
-    time.Sleep(time.Duration(delay) * time.Millisecond)
+        if errors.Is(err, lock.ErrTimeout) {
+            problem.Write(w, r, problem.StockBusy, stockBusyDetail)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusConflict)
+        _ = json.NewEncoder(w).Encode(InventoryResponse{
+            Status:  "out_of_stock",
+            Message: "Item is out of stock",
+            DelayMS: delay,
+        })
+        return
+    }
 
     resp := InventoryResponse{
         Status:  "success",
@@ -44,3 +113,94 @@ func CheckInventoryHandler(w http.ResponseWriter, r *http.Request) {
     }
 
 }
+
+// checkInventory simulates a stock lookup inside an "inventory.check" span and
+// returns the simulated delay. The chaos knobs set the latency and how often the
+// item is reported out of stock (5% at baseline). An item in stock is then
+// reserved, under the inventory lock when it is enabled.
+// It is shared by CheckInventoryHandler and the order workflow so both show up in
+// the same trace when an order is created.
+func checkInventory(ctx context.Context) (int, error) {
+    ctx, span := otel.Tracer(instrumentationName).Start(ctx, "inventory.check")
+    defer span.End()
+
+    knobs := chaos.Current()
+    delay := int(knobs.Latency(time.Duration(rand.IntN(601)+200) * time.Millisecond).Milliseconds())
+
+    // Simulate downstream latency (e.g., a database call).
+    if err := simulateWork(ctx, time.Duration(delay)*time.Millisecond); err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, "inventory check canceled")
+        return delay, err
+    }
+    span.SetAttributes(attribute.Int("inventory.check.delay_ms", delay))
+
+    if rand.Float64() < knobs.OutOfStockRate {
+        span.RecordError(errOutOfStock)
+        span.SetStatus(codes.Error, "item out of stock")
+        return delay, errOutOfStock
+    }
+
+    if err := reserveStock(ctx); err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, "stock reservation failed")
+        return delay, err
+    }
+
+    span.SetStatus(codes.Ok, "item in stock")
+    return delay, nil
+}
+
+// reserveStock holds the inventory lock of a SKU picked at random while the
+// reservation is simulated, so concurrent orders for the same SKU queue up.
+// Without the lock it does nothing.
+func reserveStock(ctx context.Context) error {
+    sl := inventoryLock.Load()
+    if sl == nil {
+        return nil
+    }
+    sku := catalog.SKU(rand.IntN(sl.keys) + 1)
+    trace.SpanFromContext(ctx).SetAttributes(attribute.String("inventory.sku", sku))
+    lease, err := sl.lock.Acquire(ctx, sku)
+    if err != nil {
+        return err
+    }
+    defer lease.Release(ctx)
+    return simulateWork(ctx, sl.hold)
+}
+
+// lookupInventory runs the order workflow's inventory step, calling the remote
+// inventory service when INVENTORY_SERVICE_URL is set and checking in-process
+// otherwise. A 409 from the inventory service is reported as errOutOfStock.
+func lookupInventory(ctx context.Context) error {
+    if inventoryServiceURL == "" {
+        _, err := checkInventory(ctx)
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, inventoryServiceURL+"/checkInventory", nil)
+    if err != nil {
+        return fmt.Errorf("building inventory request: %w", err)
+    }
+    resp, err := inventoryClient.Do(req)
+    if err != nil {
+        return fmt.Errorf("calling inventory service: %w", err)
+    }
+    defer resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+        return nil
+    case http.StatusConflict:
+        return errOutOfStock
+    case http.StatusServiceUnavailable:
+        // The service could not reserve the stock in time, or is unavailable.
+        var p problem.Details
+        if json.NewDecoder(resp.Body).Decode(&p) == nil && p.Type == problem.StockBusy.URI {
+            return fmt.Errorf("inventory service: %w", lock.ErrTimeout)
+        }
+        return fmt.Errorf("inventory service returned %s", resp.Status)
+    default:
+        return fmt.Errorf("inventory service returned %s", resp.Status)
+    }
+}
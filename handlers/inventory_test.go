@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"app/chaos"
+	"app/config"
+	"app/lock"
+	"app/problem"
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestCheckInventory(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		outOfStock float64
+		wantCode   int
+		wantStatus codes.Code
+	}{
+		{name: "in stock", outOfStock: 0, wantCode: http.StatusOK, wantStatus: codes.Ok},
+		{name: "out of stock", outOfStock: 1, wantCode: http.StatusConflict, wantStatus: codes.Error},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tracetest.Install(t)
+			setKnobs(t, func(k *chaos.Knobs) { k.OutOfStockRate = tt.outOfStock })
+
+			w, _ := serve(t, CheckInventoryHandler, httptest.NewRequest(http.MethodGet, "/checkInventory", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", w.Code, tt.wantCode, w.Body)
+			}
+			span := rec.Span(t, "inventory.check")
+			tracetest.AssertChildOf(t, span, rec.Span(t, "GET /checkInventory"))
+			tracetest.AssertStatus(t, span, tt.wantStatus)
+			if tt.wantStatus == codes.Error {
+				tracetest.AssertError(t, span)
+			}
+		})
+	}
+}
+
+func TestCheckInventoryLock(t *testing.T) {
+	rec := tracetest.Install(t)
+	setKnobs(t, func(k *chaos.Knobs) { k.OutOfStockRate = 0 })
+	if err := ConfigureInventoryLock(config.InventoryLock{Enabled: true, Keys: 1, Timeout: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ConfigureInventoryLock(config.InventoryLock{}) })
+
+	// While another reservation holds the only SKU's lock, the check gives up.
+	ctx := context.Background()
+	held, err := inventoryLock.Load().lock.Acquire(ctx, "sku-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := serve(t, CheckInventoryHandler, httptest.NewRequest(http.MethodGet, "/checkInventory", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Type") != problem.ContentType {
+		t.Fatalf("status with the lock held = %d, want a %d problem; body: %s", w.Code, http.StatusServiceUnavailable, w.Body)
+	}
+	var p problem.Details
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil || p.Type != problem.StockBusy.URI {
+		t.Errorf("problem = %+v, want %s", p, problem.StockBusy.URI)
+	}
+
+	// A remote inventory service's StockBusy problem is the same lock timeout.
+	remote := httptest.NewServer(http.HandlerFunc(CheckInventoryHandler))
+	defer remote.Close()
+	Configure(config.Downstream{InventoryServiceURL: remote.URL})
+	t.Cleanup(func() { Configure(config.Downstream{}) })
+	if err := lookupInventory(ctx); !errors.Is(err, lock.ErrTimeout) {
+		t.Errorf("lookupInventory() of a busy service error = %v, want lock.ErrTimeout", err)
+	}
+	Configure(config.Downstream{})
+	held.Release(ctx)
+
+	w, _ = serve(t, CheckInventoryHandler, httptest.NewRequest(http.MethodGet, "/checkInventory", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body)
+	}
+	checks := rec.Named("inventory.check")
+	check := checks[len(checks)-1]
+	tracetest.AssertAttributes(t, check, attribute.String("inventory.sku", "sku-1"))
+	acquires := rec.Named("lock.acquire")
+	tracetest.AssertChildOf(t, acquires[len(acquires)-1], check)
+	releases := rec.Named("lock.release")
+	tracetest.AssertChildOf(t, releases[len(releases)-1], check)
+}
@@ -4,12 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"time"
 
+	"app/catalog"
+	"app/chaos"
+	"app/featureflags"
+	"app/lock"
 	"app/logging"
+	"app/middleware"
+	"app/problem"
+	"app/store"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -18,9 +28,16 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// CreateOrderRequest is the optional JSON request body for order creation. A
+// customer is picked at random when CustomerID is empty.
+type CreateOrderRequest struct {
+	CustomerID string `json:"customer_id,omitempty"`
+}
+
 type OrderResponse struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
+	OrderID int    `json:"order_id,omitempty"`
 }
 
 const (
@@ -49,70 +66,187 @@ func init() {
 	}
 }
 
-// CreateOrderHandler simulates a 10% failure rate.
+// CreateOrderHandler serves the v1 createOrder contract (/createOrder and
+// /v1/createOrder). The body is optional and the response is a status message.
 func CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(withAPIVersion(r.Context(), apiV1))
+	ctx := r.Context()
+	if !requireCatalog(w, r) {
+		return
+	}
+
+	var req CreateOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, r, err)
+		return
+	}
+	if req.CustomerID == "" {
+		// Simulate a returning customer from a small pool.
+		req.CustomerID = fmt.Sprintf("cust-%03d", rand.IntN(50)+1)
+	}
+
+	order, ok := createOrder(w, r, req.CustomerID)
+	if !ok {
+		return
+	}
+
+	// Prepare and send the response.
+	resp := OrderResponse{
+		Status:  "success",
+		Message: "Order created successfully",
+		OrderID: order.ID,
+	}
+
+	logging.DefaultLogger.Info(ctx, "Order created successfully", attribute.Int("order.id", order.ID), apiVersionAttr(ctx))
+	logging.JSONLogger.Info(ctx, "Order created successfully", attribute.Int("order.id", order.ID), apiVersionAttr(ctx))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// createOrder stores a pending order for the customer and runs the order
+// workflow for it, marking the order created or failed when it finishes. On
+// failure the error response has already been written and ok is false.
+func createOrder(w http.ResponseWriter, r *http.Request, customerID string) (order store.Order, ok bool) {
 
-	// Get the current context and a tracer.
+	// Get the current context.
 	// The context contains the parent span from the otelhttp middleware.
+	ctx := r.Context()
+	knobs := chaos.Current()
+
+	sc := trace.SpanContextFromContext(ctx)
+	order = store.DefaultStore.Create(customerID, sc.TraceID().String(), sc.SpanID().String())
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("order.id", order.ID),
+		attribute.String("chaos.scenario", knobs.Scenario),
+		apiVersionAttr(ctx),
+	)
+
+	if !runOrderWorkflow(w, r, customerID, knobs) {
+		order.Status = store.StatusFailed
+		store.DefaultStore.SetStatus(order.ID, order.Status)
+		return order, false
+	}
+	order.Status = store.StatusCreated
+	store.DefaultStore.SetStatus(order.ID, order.Status)
+
+	// Increment the counter with a "success" status attribute after the workflow.
+	ordersProcessedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("status", statusSuccess), apiVersionAttr(ctx)))
+
+	// Parent trace POST /createOder
+	trace.SpanFromContext(ctx).SetStatus(codes.Ok, "order created successfully")
+	return order, true
+}
+
+// runOrderWorkflow simulates a 10% failure rate split between the database
+// and payment steps, on top of out-of-stock failures from the inventory check.
+// The rates and latencies follow the active chaos scenario. Each stage is
+// reported to the timeout middleware and stops early if the request is
+// canceled. On failure it writes the error response and returns false.
+func runOrderWorkflow(w http.ResponseWriter, r *http.Request, customerID string, knobs chaos.Knobs) bool {
 	ctx := r.Context()
 	tracer := otel.Tracer(instrumentationName)
 
 	// Simulate initial processing latency (e.g., validation, business logic).
-	time.Sleep(time.Duration(rand.IntN(50)+30) * time.Millisecond)
-
-	// Decide if this request should fail (10% chance).
-	if rand.IntN(10) == 0 {
-		// Half of failures occur during the database step.
-		if rand.IntN(2) == 0 {
-			handleDBError(w, r, tracer)
-			return
+	middleware.SetStage(ctx, "validation")
+	if err := simulateWork(ctx, knobs.Latency(time.Duration(rand.IntN(50)+30)*time.Millisecond)); err != nil {
+		handleCanceled(w, r, trace.SpanFromContext(ctx), err, "validation")
+		return false
+	}
+
+	// Check stock before the DB step; an out-of-stock item fails the order.
+	middleware.SetStage(ctx, "inventory")
+	if err := lookupInventory(ctx); err != nil {
+		if ctx.Err() != nil {
+			handleCanceled(w, r, trace.SpanFromContext(ctx), ctx.Err(), "inventory")
+			return false
 		}
+		handleInventoryError(w, r, err)
+		return false
+	}
 
-		// Otherwise, the DB step succeeds but payment fails next.
-		_, dbSpan := tracer.Start(ctx, "db.insert_order")
-		time.Sleep(time.Duration(rand.IntN(100)+50) * time.Millisecond)
-		dbSpan.SetStatus(codes.Ok, "order record inserted")
-		dbSpan.End()
+	// Fraud screening is a new stage, rolled out per customer behind the
+	// fraud-screening flag.
+	evalCtx := featureflags.EvaluationContext{TargetingKey: customerID}
+	if featureflags.BooleanValue(ctx, featureflags.FraudScreening, false, evalCtx) {
+		middleware.SetStage(ctx, "fraud")
+		if err := screenOrder(ctx, customerID); err != nil {
+			handleCanceled(w, r, trace.SpanFromContext(ctx), err, "fraud")
+			return false
+		}
+	}
 
-		// Now fail during payment.
-		handlePaymentError(w, r, tracer)
-		return
+	// Half of the simulated failures occur during the database step (5% chance at baseline).
+	middleware.SetStage(ctx, "database")
+	if rand.Float64() < knobs.DBFailureRate {
+		handleDBError(w, r, tracer)
+		return false
 	}
 
 	// --- Success Path ---
 
 	// Database step
 	_, dbSpan := tracer.Start(ctx, "db.insert_order")
-	time.Sleep(time.Duration(rand.IntN(100)+50) * time.Millisecond) // Simulate DB work
+	if err := simulateWork(ctx, knobs.DBLatency(time.Duration(rand.IntN(100)+50)*time.Millisecond)); err != nil { // Simulate DB work
+		handleCanceled(w, r, dbSpan, err, "database")
+		dbSpan.End()
+		return false
+	}
 	dbSpan.SetStatus(codes.Ok, "order record inserted")
 	dbSpan.End()
 
-	// Payment step
-	_, paySpan := tracer.Start(ctx, "payment.process")
-	time.Sleep(time.Duration(rand.IntN(80)+40) * time.Millisecond) // Simulate payment work
+	// Payment step. The other half of the failures come from the payment
+	// provider, either simulated in-process or returned by the payment service.
+	middleware.SetStage(ctx, "payment")
+	payCtx, paySpan := tracer.Start(ctx, "payment.process")
+	provider := selectPaymentProvider(payCtx)
+	paySpan.SetAttributes(attribute.String("payment.provider", provider.name))
+	if err := chargePayment(payCtx, provider); err != nil {
+		if ctx.Err() != nil {
+			handleCanceled(w, r, paySpan, ctx.Err(), "payment")
+			paySpan.End()
+			return false
+		}
+		handlePaymentError(w, r, paySpan, err)
+		return false
+	}
 	paySpan.SetStatus(codes.Ok, "payment processed successfully")
 	paySpan.End()
+	return true
+}
 
-	// Increment the counter with a "success" status attribute after the workflow.
-	ordersProcessedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("status", statusSuccess)))
-
-	// Prepare and send the response.
-	orderID := rand.IntN(1000)
-	resp := OrderResponse{
-		Status:  "success",
-		Message: "Order created successfully",
+// requireCatalog is the readiness gate for order endpoints. Until the catalog
+// caches have been warmed at startup it answers 503 with Retry-After and
+// returns false.
+func requireCatalog(w http.ResponseWriter, r *http.Request) bool {
+	if catalog.Ready() {
+		return true
 	}
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Bool("catalog.ready", false))
+	w.Header().Set("Retry-After", "1")
+	problem.Write(w, r, problem.WarmingUp, "The catalog caches are still warming up.")
+	return false
+}
 
-	// Parent trace POST /createOder
-	trace.SpanFromContext(ctx).SetStatus(codes.Ok, "order created successfully")
-	logging.DefaultLogger.Info(ctx, "Order created successfully", attribute.Int("order.id", orderID))
-	logging.JSONLogger.Info(ctx, "Order created successfully", attribute.Int("order.id", orderID))
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		logging.DefaultLogger.Error(ctx, "Error encoding response", attribute.String("error.reason", err.Error()))
-		logging.JSONLogger.Error(ctx, "Error encoding response", attribute.String("error.reason", err.Error()))
+// handleInventoryError handles a failed inventory step. The inventory span is
+// already marked as failed, so the error is recorded on the request span. An
+// out-of-stock item returns HTTP 409, stock that could not be reserved in time
+// HTTP 503 as the inventory check does, and any other failure HTTP 502.
+func handleInventoryError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	handleRequestError(ctx, trace.SpanFromContext(ctx), "inventory check failed", err, "inventory")
+	if errors.Is(err, errOutOfStock) {
+		problem.Write(w, r, problem.OutOfStock, "The requested item is out of stock.")
+		return
+	}
+	if errors.Is(err, lock.ErrTimeout) {
+		problem.Write(w, r, problem.StockBusy, stockBusyDetail)
+		return
 	}
+	problem.Write(w, r, problem.UpstreamFailed, "The inventory check failed.")
 }
 
 // handleDBError simulates a database-related failure. It creates a span for the
@@ -121,23 +255,43 @@ func handleDBError(w http.ResponseWriter, r *http.Request, tracer trace.Tracer)
 	ctx := r.Context()
 	dbCtx, dbSpan := tracer.Start(ctx, "db.insert_order")
 	// Simulate a short delay for the failed DB attempt.
-	time.Sleep(time.Duration(rand.IntN(40)+10) * time.Millisecond)
+	time.Sleep(chaos.Current().DBLatency(time.Duration(rand.IntN(40)+10) * time.Millisecond))
 
 	err := errors.New("simulated database constraint violation")
 	handleRequestError(dbCtx, dbSpan, "database operation failed", err, "database")
 	dbSpan.End()
-	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	problem.Write(w, r, problem.DatabaseError, "The order record could not be inserted.")
 }
 
-// handlePaymentError simulates a payment processing failure. It creates a span for
-// the payment operation, marks it as an error, and returns HTTP 500.
-func handlePaymentError(w http.ResponseWriter, r *http.Request, tracer trace.Tracer) {
-	ctx := r.Context()
-	paymentCtx, paymentSpan := tracer.Start(ctx, "payment.process")
-	err := errors.New("simulated payment provider error")
+// handlePaymentError handles a failed payment step. It marks the payment span
+// as an error, ends it, and returns HTTP 500.
+func handlePaymentError(w http.ResponseWriter, r *http.Request, paymentSpan trace.Span, err error) {
+	paymentCtx := trace.ContextWithSpan(r.Context(), paymentSpan)
 	handleRequestError(paymentCtx, paymentSpan, "payment processing failed", err, "payment")
 	paymentSpan.End()
-	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	problem.Write(w, r, problem.PaymentFailed, "The payment provider rejected the charge.")
+}
+
+// handleCanceled handles a workflow stage cut short by the request's context
+// being canceled, usually by the timeout middleware. It marks the stage span as
+// failed and returns HTTP 504; after a timeout that response is discarded in
+// favor of the middleware's own.
+func handleCanceled(w http.ResponseWriter, r *http.Request, span trace.Span, err error, stage string) {
+	handleRequestError(trace.ContextWithSpan(r.Context(), span), span, "request canceled", err, stage)
+	problem.Write(w, r, problem.GatewayTimeout, "The request was canceled during "+stage+".")
+}
+
+// simulateWork sleeps for d, returning early with the context's error if it
+// is canceled first.
+func simulateWork(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // handleRequestError centralizes error instrumentation: logs, metric, and span status.
@@ -145,14 +299,44 @@ func handleRequestError(ctx context.Context, span trace.Span, message string, er
 	logging.DefaultLogger.Error(ctx, message,
 		attribute.String("error.stage", stage),
 		attribute.String("error.reason", err.Error()),
+		apiVersionAttr(ctx),
 	)
 	logging.JSONLogger.Error(ctx, message,
 		attribute.String("error.stage", stage),
 		attribute.String("error.reason", err.Error()),
+		apiVersionAttr(ctx),
 	)
-	ordersProcessedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("status", statusFailure)))
+	ordersProcessedCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("status", statusFailure), apiVersionAttr(ctx)))
 	span.RecordError(err)
 	span.SetStatus(codes.Error, message)
 	// Mark the request span (from otelhttp) as failed.
 	trace.SpanFromContext(ctx).SetStatus(codes.Error, message)
 }
+
+// writeBodyError answers a request body that could not be decoded: 413 when
+// it exceeded the body size limit, 400 otherwise.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		problem.Write(w, r, problem.PayloadTooLarge, "The request body exceeds the "+strconv.FormatInt(tooLarge.Limit, 10)+"-byte limit.")
+		return
+	}
+	problem.Write(w, r, problem.InvalidRequest, "The order body is not valid JSON.")
+}
+
+// orderFromPath looks up the order named by the {id} path value. It writes a
+// 400 or 404 response and returns false if the order cannot be found.
+func orderFromPath(w http.ResponseWriter, r *http.Request) (store.Order, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		problem.Write(w, r, problem.InvalidRequest, "The order id must be an integer.")
+		return store.Order{}, false
+	}
+	order, ok := store.DefaultStore.Get(id)
+	if !ok {
+		problem.Write(w, r, problem.NotFound, "The order does not exist.")
+		return store.Order{}, false
+	}
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("order.id", order.ID))
+	return order, true
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/chaos"
+	"app/store"
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestCreateOrderSuccess(t *testing.T) {
+	rec := tracetest.Install(t)
+	setKnobs(t, nil)
+	stubPayments(t, http.StatusOK)
+	metrics := tracetest.StartMetrics(t)
+
+	w, _ := serve(t, CreateOrderHandler, httptest.NewRequest(http.MethodPost, "/createOrder", strings.NewReader(`{"customer_id":"cust-007"}`)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", w.Code, w.Body)
+	}
+	var resp OrderResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	root := rec.Span(t, "POST /createOrder")
+	tracetest.AssertStatus(t, root, codes.Ok)
+	tracetest.AssertAttributes(t, root,
+		attribute.Int("order.id", resp.OrderID),
+		attribute.String("chaos.scenario", "test"),
+	)
+	for _, name := range []string{"inventory.check", "db.insert_order", "payment.process"} {
+		span := rec.Span(t, name)
+		tracetest.AssertChildOf(t, span, root)
+		tracetest.AssertStatus(t, span, codes.Ok)
+	}
+	tracetest.AssertChildOf(t, rec.Span(t, "payment.select_provider"), rec.Span(t, "payment.process"))
+
+	metrics.AssertCounter(t, "orders_processed_total", 1, attribute.String("status", statusSuccess))
+	metrics.AssertCounter(t, "orders_processed_total", 0, attribute.String("status", statusFailure))
+	// The stubbed payment service answers within a quarter of a second.
+	metrics.AssertHistogramBucket(t, "payment_duration_ms", 250, 1, attribute.String("status", statusSuccess))
+	order, ok := store.DefaultStore.Get(resp.OrderID)
+	if !ok {
+		t.Fatalf("order %d was not stored", resp.OrderID)
+	}
+	if order.Status != store.StatusCreated || order.CustomerID != "cust-007" {
+		t.Errorf("stored order = %+v, want created for cust-007", order)
+	}
+	if order.TraceID != root.SpanContext().TraceID().String() {
+		t.Errorf("order trace ID = %s, want the request's %s", order.TraceID, root.SpanContext().TraceID())
+	}
+}
+
+func TestCreateOrderFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		knobs        func(*chaos.Knobs)
+		paymentCode  int
+		wantCode     int
+		failedSpan   string
+		skippedSpans []string
+	}{
+		{
+			name:         "out of stock",
+			knobs:        func(k *chaos.Knobs) { k.OutOfStockRate = 1 },
+			paymentCode:  http.StatusOK,
+			wantCode:     http.StatusConflict,
+			failedSpan:   "inventory.check",
+			skippedSpans: []string{"db.insert_order", "payment.process"},
+		},
+		{
+			name:         "database",
+			knobs:        func(k *chaos.Knobs) { k.DBFailureRate = 1 },
+			paymentCode:  http.StatusOK,
+			wantCode:     http.StatusInternalServerError,
+			failedSpan:   "db.insert_order",
+			skippedSpans: []string{"payment.process"},
+		},
+		{
+			name:        "payment",
+			paymentCode: http.StatusBadGateway,
+			wantCode:    http.StatusInternalServerError,
+			failedSpan:  "payment.process",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tracetest.Install(t)
+			setKnobs(t, tt.knobs)
+			stubPayments(t, tt.paymentCode)
+			metrics := tracetest.StartMetrics(t)
+
+			w, sc := serve(t, CreateOrderHandler, httptest.NewRequest(http.MethodPost, "/createOrder", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d; body: %s", w.Code, tt.wantCode, w.Body)
+			}
+			var body struct {
+				TraceID string `json:"trace_id"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.TraceID != sc.TraceID().String() {
+				t.Errorf("problem trace_id = %q, want %s", body.TraceID, sc.TraceID())
+			}
+			root := rec.Span(t, "POST /createOrder")
+			tracetest.AssertStatus(t, root, codes.Error)
+			failed := rec.Span(t, tt.failedSpan)
+			tracetest.AssertChildOf(t, failed, root)
+			tracetest.AssertError(t, failed)
+			for _, name := range tt.skippedSpans {
+				rec.NoSpan(t, name)
+			}
+			metrics.AssertCounter(t, "orders_processed_total", 1, attribute.String("status", statusFailure))
+			metrics.AssertCounter(t, "orders_processed_total", 0, attribute.String("status", statusSuccess))
+		})
+	}
+}
+
+func TestCreateOrderGolden(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		knobs       func(*chaos.Knobs)
+		paymentCode int
+	}{
+		{name: "create_order", paymentCode: http.StatusOK},
+		{name: "create_order_db_failure", knobs: func(k *chaos.Knobs) { k.DBFailureRate = 1 }, paymentCode: http.StatusOK},
+		{name: "create_order_payment_failure", paymentCode: http.StatusBadGateway},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tracetest.Install(t)
+			setKnobs(t, tt.knobs)
+			stubPayments(t, tt.paymentCode)
+
+			serve(t, CreateOrderHandler, httptest.NewRequest(http.MethodPost, "/createOrder", strings.NewReader(`{"customer_id":"cust-007"}`)))
+
+			tracetest.AssertGolden(t, tt.name, rec.Ended(), tracetest.Mask("order.id", "inventory.check.delay_ms", "payment.provider"))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"app/catalog"
+	"app/logging"
+	"app/middleware"
+	"app/problem"
+	"app/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OrderItem is a line item in a v2 order.
+type OrderItem struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+// CreateOrderV2Request is the required JSON request body for v2 order creation.
+type CreateOrderV2Request struct {
+	CustomerID string      `json:"customer_id"`
+	Items      []OrderItem `json:"items"`
+	// Currency is the optional display currency for the total; prices are in USD.
+	Currency string `json:"currency,omitempty"`
+}
+
+// OrderV2Response is the JSON response payload for v2 order creation.
+type OrderV2Response struct {
+	Order      store.Order `json:"order"`
+	Items      []OrderItem `json:"items"`
+	TotalCents int64       `json:"total_cents"`
+	// Currency and Total are set when a non-USD currency was requested.
+	Currency string  `json:"currency,omitempty"`
+	Total    float64 `json:"total,omitempty"`
+}
+
+// errInsufficientStock is returned when a v2 item asks for more than the cached stock.
+var errInsufficientStock = errors.New("insufficient stock")
+
+// validate checks the v2 contract: a customer and at least one item with a
+// positive quantity are required.
+func (req CreateOrderV2Request) validate() error {
+	if req.CustomerID == "" {
+		return errors.New("customer_id is required")
+	}
+	if len(req.Items) == 0 {
+		return errors.New("items must not be empty")
+	}
+	for i, item := range req.Items {
+		if item.SKU == "" {
+			return fmt.Errorf("items[%d].sku is required", i)
+		}
+		if item.Quantity <= 0 {
+			return fmt.Errorf("items[%d].quantity must be positive", i)
+		}
+	}
+	return nil
+}
+
+// total prices the items from the catalog cache. It fails for unknown SKUs and
+// with errInsufficientStock when an item exceeds the cached stock level.
+func (req CreateOrderV2Request) total() (int64, error) {
+	var total int64
+	for i, item := range req.Items {
+		price, ok := catalog.Price(item.SKU)
+		if !ok {
+			return 0, fmt.Errorf("items[%d].sku %q is unknown", i, item.SKU)
+		}
+		if stock, _ := catalog.Stock(item.SKU); item.Quantity > stock {
+			return 0, fmt.Errorf("items[%d]: %w for %q", i, errInsufficientStock, item.SKU)
+		}
+		total += price * int64(item.Quantity)
+	}
+	return total, nil
+}
+
+// CreateOrderV2Handler serves POST /v2/createOrder. Unlike v1, the body is
+// required and validated, and a successful order returns 201 Created with the
+// stored order, its total from the catalog price cache, and a Location header.
+func CreateOrderV2Handler(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(withAPIVersion(r.Context(), apiV2))
+	ctx := r.Context()
+	if !requireCatalog(w, r) {
+		return
+	}
+
+	var req CreateOrderV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		logging.DefaultLogger.Error(ctx, "Invalid order request", attribute.String("error.reason", err.Error()), apiVersionAttr(ctx))
+		logging.JSONLogger.Error(ctx, "Invalid order request", attribute.String("error.reason", err.Error()), apiVersionAttr(ctx))
+		problem.Write(w, r, problem.InvalidRequest, err.Error())
+		return
+	}
+	total, err := req.total()
+	if err != nil {
+		logging.DefaultLogger.Error(ctx, "Order cannot be priced", attribute.String("error.reason", err.Error()), apiVersionAttr(ctx))
+		logging.JSONLogger.Error(ctx, "Order cannot be priced", attribute.String("error.reason", err.Error()), apiVersionAttr(ctx))
+		if errors.Is(err, errInsufficientStock) {
+			problem.Write(w, r, problem.OutOfStock, err.Error())
+			return
+		}
+		problem.Write(w, r, problem.InvalidRequest, err.Error())
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("order.items", len(req.Items)),
+		attribute.Int64("order.total_cents", total),
+	)
+
+	resp := OrderV2Response{Items: req.Items, TotalCents: total}
+	if req.Currency != "" && req.Currency != "USD" {
+		converted, err := convertTotal(ctx, total, req.Currency)
+		if err != nil {
+			logging.DefaultLogger.Error(ctx, "Currency conversion failed", attribute.String("error.reason", err.Error()), apiVersionAttr(ctx))
+			logging.JSONLogger.Error(ctx, "Currency conversion failed", attribute.String("error.reason", err.Error()), apiVersionAttr(ctx))
+			var perr *partnerError
+			if errors.As(err, &perr) && perr.StatusCode == http.StatusBadRequest {
+				problem.Write(w, r, problem.UnsupportedCurrency, "The currency "+req.Currency+" is not supported.")
+				return
+			}
+			problem.Write(w, r, problem.UpstreamFailed, "The currency conversion failed.")
+			return
+		}
+		resp.Currency, resp.Total = req.Currency, converted
+	}
+
+	order, ok := createOrder(w, r, req.CustomerID)
+	if !ok {
+		return
+	}
+	resp.Order = order
+
+	logging.DefaultLogger.Info(ctx, "Order created successfully", attribute.Int("order.id", order.ID), apiVersionAttr(ctx))
+	logging.JSONLogger.Info(ctx, "Order created successfully", attribute.Int("order.id", order.ID), apiVersionAttr(ctx))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/orders/"+strconv.Itoa(order.ID))
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// convertTotal converts a USD total in cents into the given currency using the
+// partner FX API, inside an "fx.convert" span. The result is rounded to two
+// decimals.
+func convertTotal(ctx context.Context, totalCents int64, currency string) (float64, error) {
+	middleware.SetStage(ctx, "fx")
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "fx.convert",
+		trace.WithAttributes(attribute.String("fx.currency", currency)),
+	)
+	defer span.End()
+
+	var fx FXResponse
+	if err := callPartner(ctx, http.MethodGet, "fx", url.Values{"from": {"USD"}, "to": {currency}}, &fx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "fx conversion failed")
+		return 0, err
+	}
+	span.SetAttributes(attribute.Float64("fx.rate", fx.Rate))
+	span.SetStatus(codes.Ok, "converted")
+	return math.Round(float64(totalCents)*fx.Rate) / 100, nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"app/httpclient"
+)
+
+// The partner stub's published service level objectives, returned as response headers.
+const (
+	partnerSLOAvailability = "99.5%"
+	partnerSLOLatencyP99   = "300ms"
+	partnerSLOWindow       = "30d"
+)
+
+// partnerInProcessURL is the base URL used when no partner URL is configured;
+// requests to it are served in-process by the stub handler.
+const partnerInProcessURL = "http://partner.sim/stub/partner"
+
+// fxRates are the stub's exchange rates from USD.
+var fxRates = map[string]float64{
+	"USD": 1,
+	"EUR": 0.92,
+	"GBP": 0.79,
+	"JPY": 149.5,
+	"INR": 83.1,
+}
+
+// FXResponse is the partner stub's JSON payload for an exchange-rate lookup.
+type FXResponse struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Rate float64 `json:"rate"`
+}
+
+var (
+	// partnerURL is the base URL of the partner stub, set by Configure. It can
+	// point at another instance's /stub/partner (e.g.
+	// http://localhost:8080/stub/partner).
+	partnerURL = partnerInProcessURL
+	// partnerLatencyMS and partnerErrorRate are the stub's default behavior;
+	// callers can override them per request with latency_ms and error_rate.
+	partnerLatencyMS = envFloat("PARTNER_STUB_LATENCY_MS", 50)
+	partnerErrorRate = envFloat("PARTNER_STUB_ERROR_RATE", 0)
+
+	partnerClient = newPartnerClient()
+)
+
+// newPartnerClient serves partner calls in-process unless a partner URL is configured.
+func newPartnerClient() *httpclient.Client {
+	if partnerURL != partnerInProcessURL {
+		return httpclient.New("partner-api")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stub/partner/{operation}", PartnerStubHandler)
+	return httpclient.New("partner-api", httpclient.WithTransport(httpclient.HandlerTransport{Handler: mux}))
+}
+
+// PartnerStubHandler serves /stub/partner/{operation}, a stand-in for a
+// third-party API. It supports the "charge" and "fx" operations, sleeps for
+// latency_ms (plus jitter), fails with 503 at error_rate, and advertises its
+// SLO in X-SLO-* response headers.
+func PartnerStubHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	latencyMS := queryFloat(q, "latency_ms", partnerLatencyMS)
+	errorRate := queryFloat(q, "error_rate", partnerErrorRate)
+
+	w.Header().Set("X-SLO-Availability", partnerSLOAvailability)
+	w.Header().Set("X-SLO-Latency-P99", partnerSLOLatencyP99)
+	w.Header().Set("X-SLO-Window", partnerSLOWindow)
+
+	jitter := rand.Float64() * latencyMS / 2
+	select {
+	case <-time.After(time.Duration((latencyMS + jitter) * float64(time.Millisecond))):
+	case <-r.Context().Done():
+		return
+	}
+	if rand.Float64() < errorRate {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.PathValue("operation") {
+	case "charge":
+		_ = json.NewEncoder(w).Encode(ChargeResponse{Status: "success", Message: "Charge accepted", Provider: q.Get("provider")})
+	case "fx":
+		from, to := q.Get("from"), q.Get("to")
+		fromRate, okFrom := fxRates[from]
+		toRate, okTo := fxRates[to]
+		if !okFrom || !okTo {
+			http.Error(w, "Bad Request: unsupported currency", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(FXResponse{From: from, To: to, Rate: toRate / fromRate})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// partnerError is returned by callPartner for a non-200 response.
+type partnerError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *partnerError) Error() string {
+	return "partner API returned " + e.Status
+}
+
+// callPartner calls a partner stub operation and decodes the JSON response into out.
+func callPartner(ctx context.Context, method, operation string, query url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, partnerURL+"/"+operation+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("building partner request: %w", err)
+	}
+	resp, err := partnerClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling partner API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &partnerError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding partner response: %w", err)
+	}
+	return nil
+}
+
+// envFloat parses a float environment variable, returning def if it is unset or invalid.
+func envFloat(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// queryFloat parses a float query parameter, returning def if it is missing or invalid.
+func queryFloat(q url.Values, key string, def float64) float64 {
+	v, err := strconv.ParseFloat(q.Get(key), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"app/chaos"
+	"app/httpclient"
+	"app/logging"
+	"app/problem"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ChargeResponse is the JSON response payload for a payment charge.
+type ChargeResponse struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	Provider string `json:"provider"`
+}
+
+// errPaymentFailed is returned when the simulated payment provider rejects a charge.
+var errPaymentFailed = errors.New("simulated payment provider error")
+
+// paymentProvider is a simulated payment provider with its own latency and failure profile.
+type paymentProvider struct {
+	name         string
+	minLatencyMS int
+	maxLatencyMS int
+	// failureRate is the probability (0-1) that a charge fails.
+	failureRate float64
+}
+
+// paymentProviders are the providers the order workflow chooses between.
+var paymentProviders = []paymentProvider{
+	{name: "stripe-sim", minLatencyMS: 40, maxLatencyMS: 120, failureRate: 0.03},
+	{name: "adyen-sim", minLatencyMS: 80, maxLatencyMS: 250, failureRate: 0.07},
+}
+
+var (
+	// paymentServiceURL is the base URL of cmd/payment-service (e.g.
+	// http://localhost:8081), set by Configure. When empty, payments are
+	// simulated in-process.
+	paymentServiceURL string
+	// paymentClient propagates the trace context to the payment service.
+	paymentClient = httpclient.New("payment-service")
+
+	// Counter for payment attempts, by provider and status.
+	paymentsCounter metric.Int64Counter
+	// Histogram for payment latency, by provider and status.
+	paymentDurationHistogram metric.Float64Histogram
+)
+
+func init() {
+	var err error
+	paymentsCounter, err = meter.Int64Counter(
+		"payments_total",
+		metric.WithDescription("The total number of payment attempts"),
+		metric.WithUnit("{payment}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create payments_total counter: %v", err)
+	}
+	paymentDurationHistogram, err = meter.Float64Histogram(
+		"payment_duration_ms",
+		metric.WithDescription("The latency of payment attempts"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create payment_duration_ms histogram: %v", err)
+	}
+}
+
+// ChargeHandler simulates a payment provider charge. It is served by
+// cmd/payment-service; the ?provider= query parameter selects the provider and
+// a failed charge returns HTTP 502.
+func ChargeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	provider, ok := lookupPaymentProvider(r.URL.Query().Get("provider"))
+	if !ok {
+		provider = selectPaymentProvider(ctx)
+	}
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("payment.provider", provider.name))
+
+	if err := simulateCharge(ctx, provider); err != nil {
+		logging.DefaultLogger.Error(ctx, "Payment charge failed",
+			attribute.String("payment.provider", provider.name),
+			attribute.String("error.reason", err.Error()),
+		)
+		logging.JSONLogger.Error(ctx, "Payment charge failed",
+			attribute.String("payment.provider", provider.name),
+			attribute.String("error.reason", err.Error()),
+		)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "payment charge failed")
+		problem.Write(w, r, problem.UpstreamFailed, "The payment provider rejected the charge.")
+		return
+	}
+
+	logging.DefaultLogger.Info(ctx, "Payment charged successfully", attribute.String("payment.provider", provider.name))
+	logging.JSONLogger.Info(ctx, "Payment charged successfully", attribute.String("payment.provider", provider.name))
+
+	resp := ChargeResponse{Status: "success", Message: "Payment charged successfully", Provider: provider.name}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding charge response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding charge response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// lookupPaymentProvider returns the provider with the given name.
+func lookupPaymentProvider(name string) (paymentProvider, bool) {
+	for _, p := range paymentProviders {
+		if p.name == name {
+			return p, true
+		}
+	}
+	return paymentProvider{}, false
+}
+
+// selectPaymentProvider picks a provider at random inside a "payment.select_provider" span.
+func selectPaymentProvider(ctx context.Context) paymentProvider {
+	_, span := otel.Tracer(instrumentationName).Start(ctx, "payment.select_provider")
+	defer span.End()
+
+	provider := paymentProviders[rand.IntN(len(paymentProviders))]
+	span.SetAttributes(attribute.String("payment.provider", provider.name))
+	return provider
+}
+
+// simulateCharge charges the provider through the partner stub, passing the
+// provider's latency and failure rate (adjusted by the chaos knobs) as the
+// stub's behavior for the call.
+func simulateCharge(ctx context.Context, provider paymentProvider) error {
+	knobs := chaos.Current()
+	latency := provider.minLatencyMS + rand.IntN(provider.maxLatencyMS-provider.minLatencyMS+1)
+	query := url.Values{
+		"provider":   {provider.name},
+		"latency_ms": {strconv.FormatInt(knobs.Latency(time.Duration(latency)*time.Millisecond).Milliseconds(), 10)},
+		"error_rate": {strconv.FormatFloat(provider.failureRate+knobs.PaymentFailureRate, 'f', -1, 64)},
+	}
+	if err := callPartner(ctx, http.MethodPost, "charge", query, nil); err != nil {
+		return fmt.Errorf("%w: %v", errPaymentFailed, err)
+	}
+	return nil
+}
+
+// chargePayment runs the payment step against the given provider, calling the
+// remote payment service when PAYMENT_SERVICE_URL is set and simulating it
+// in-process otherwise. Attempts are counted and timed per provider.
+func chargePayment(ctx context.Context, provider paymentProvider) error {
+	start := time.Now()
+	err := doChargePayment(ctx, provider)
+
+	status := statusSuccess
+	if err != nil {
+		status = statusFailure
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("payment.provider", provider.name),
+		attribute.String("status", status),
+	)
+	paymentsCounter.Add(ctx, 1, attrs)
+	paymentDurationHistogram.Record(ctx, float64(time.Since(start).Milliseconds()), attrs)
+	return err
+}
+
+func doChargePayment(ctx context.Context, provider paymentProvider) error {
+	if paymentServiceURL == "" {
+		return simulateCharge(ctx, provider)
+	}
+
+	target := paymentServiceURL + "/charge?provider=" + url.QueryEscape(provider.name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+	if err != nil {
+		return fmt.Errorf("building payment request: %w", err)
+	}
+	resp, err := paymentClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling payment service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment service returned %s", resp.Status)
+	}
+	return nil
+}
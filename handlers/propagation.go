@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanContextInfo describes a span context.
+type SpanContextInfo struct {
+	Valid      bool   `json:"valid"`
+	TraceID    string `json:"trace_id,omitempty"`
+	SpanID     string `json:"span_id,omitempty"`
+	TraceFlags string `json:"trace_flags,omitempty"`
+	Sampled    bool   `json:"sampled"`
+	Remote     bool   `json:"remote"`
+	TraceState string `json:"trace_state,omitempty"`
+}
+
+// BaggageEntry is a baggage member and its properties.
+type BaggageEntry struct {
+	Key        string   `json:"key"`
+	Value      string   `json:"value"`
+	Properties []string `json:"properties,omitempty"`
+}
+
+// PropagationResponse is the JSON response payload for GET /debug/propagation.
+type PropagationResponse struct {
+	// Traceparent, Tracestate, and BaggageHeader are the headers as received.
+	Traceparent   string `json:"traceparent,omitempty"`
+	Tracestate    string `json:"tracestate,omitempty"`
+	BaggageHeader string `json:"baggage_header,omitempty"`
+	// Extracted is the caller's span context, as extracted from the headers.
+	Extracted SpanContextInfo `json:"extracted"`
+	// Current is the server span handling the request.
+	Current SpanContextInfo `json:"current"`
+	// Continued reports whether the server span joined the caller's trace.
+	Continued bool `json:"continued"`
+	// Baggage holds the extracted baggage members, by key.
+	Baggage []BaggageEntry `json:"baggage"`
+	// Notes explain what is missing or was ignored.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// PropagationHandler serves GET /debug/propagation: it echoes the trace
+// context headers the request arrived with, the span context and baggage this
+// service extracted from them, and the server span's context, so integrators
+// can check that their clients propagate context to the service.
+func PropagationHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract again from the headers alone, so the result is what the caller
+	// sent rather than what the middlewares added, such as the request ID.
+	extracted := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(r.Header))
+	remote := trace.SpanContextFromContext(extracted)
+	current := trace.SpanContextFromContext(r.Context())
+
+	resp := PropagationResponse{
+		Traceparent:   r.Header.Get("traceparent"),
+		Tracestate:    r.Header.Get("tracestate"),
+		BaggageHeader: r.Header.Get("baggage"),
+		Extracted:     spanContextInfo(remote),
+		Current:       spanContextInfo(current),
+		Continued:     remote.IsValid() && current.TraceID() == remote.TraceID(),
+		Baggage:       baggageEntries(baggage.FromContext(extracted)),
+	}
+
+	switch {
+	case resp.Traceparent == "":
+		resp.Notes = append(resp.Notes, "No traceparent header; the request started a new trace.")
+		if resp.Tracestate != "" {
+			resp.Notes = append(resp.Notes, "The tracestate header was ignored without a traceparent header.")
+		}
+	case !resp.Extracted.Valid:
+		resp.Notes = append(resp.Notes, "The traceparent header is malformed and was ignored; the request started a new trace.")
+	case !current.IsValid():
+		resp.Notes = append(resp.Notes, "The request was not traced; see telemetry.trace_exclude.")
+	case !resp.Continued:
+		resp.Notes = append(resp.Notes, "The server span did not join the caller's trace.")
+	case !remote.IsSampled():
+		resp.Notes = append(resp.Notes, "The caller's trace is not sampled, so the server span is not recorded.")
+	}
+	if resp.BaggageHeader != "" && len(resp.Baggage) == 0 {
+		resp.Notes = append(resp.Notes, "The baggage header is malformed and was ignored.")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func spanContextInfo(sc trace.SpanContext) SpanContextInfo {
+	if !sc.IsValid() {
+		return SpanContextInfo{}
+	}
+	return SpanContextInfo{
+		Valid:      true,
+		TraceID:    sc.TraceID().String(),
+		SpanID:     sc.SpanID().String(),
+		TraceFlags: sc.TraceFlags().String(),
+		Sampled:    sc.IsSampled(),
+		Remote:     sc.IsRemote(),
+		TraceState: sc.TraceState().String(),
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"app/tracing/tracetest"
+)
+
+func TestPropagation(t *testing.T) {
+	tracetest.Install(t)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, tt := range []struct {
+		name          string
+		headers       map[string]string
+		wantContinued bool
+		wantBaggage   []BaggageEntry
+		wantNotes     int
+	}{
+		{
+			name: "propagated",
+			headers: map[string]string{
+				"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01",
+				"tracestate":  "vendor=abc",
+				"baggage":     "user.id=42;plan=gold,tenant=acme",
+			},
+			wantContinued: true,
+			wantBaggage: []BaggageEntry{
+				{Key: "tenant", Value: "acme"},
+				{Key: "user.id", Value: "42", Properties: []string{"plan=gold"}},
+			},
+		},
+		{name: "missing", wantBaggage: []BaggageEntry{}, wantNotes: 1},
+		{name: "malformed", headers: map[string]string{"traceparent": "00-xyz", "baggage": "=;"}, wantBaggage: []BaggageEntry{}, wantNotes: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/debug/propagation", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w, sc := serve(t, PropagationHandler, r)
+
+			var resp PropagationResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Continued != tt.wantContinued {
+				t.Errorf("continued = %t, want %t", resp.Continued, tt.wantContinued)
+			}
+			if resp.Current.SpanID != sc.SpanID().String() {
+				t.Errorf("current span = %s, want the server span %s", resp.Current.SpanID, sc.SpanID())
+			}
+			if tt.wantContinued {
+				if resp.Extracted.TraceID != traceID || !resp.Extracted.Remote || resp.Extracted.TraceState != "vendor=abc" {
+					t.Errorf("extracted = %+v, want remote span of trace %s with its trace state", resp.Extracted, traceID)
+				}
+				if resp.Current.TraceID != traceID {
+					t.Errorf("current trace = %s, want %s", resp.Current.TraceID, traceID)
+				}
+			} else if resp.Extracted.Valid {
+				t.Errorf("extracted = %+v, want invalid", resp.Extracted)
+			}
+			if !reflect.DeepEqual(resp.Baggage, tt.wantBaggage) {
+				t.Errorf("baggage = %+v, want %+v", resp.Baggage, tt.wantBaggage)
+			}
+			if len(resp.Notes) != tt.wantNotes {
+				t.Errorf("notes = %q, want %d", resp.Notes, tt.wantNotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"app/logging"
+	"app/problem"
+	"app/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RefundResponse is the JSON response payload for a refund.
+type RefundResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	OrderID int    `json:"order_id"`
+}
+
+// errRefundFailed is returned when the simulated payment provider rejects a refund.
+var errRefundFailed = errors.New("simulated refund provider error")
+
+var (
+	// Counter for refunds, by status.
+	refundsCounter metric.Int64Counter
+	// Histogram for refund latency, by status.
+	refundDurationHistogram metric.Float64Histogram
+)
+
+func init() {
+	var err error
+	refundsCounter, err = meter.Int64Counter(
+		"refunds_total",
+		metric.WithDescription("The total number of refunds processed"),
+		metric.WithUnit("{refund}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create refunds_total counter: %v", err)
+	}
+	refundDurationHistogram, err = meter.Float64Histogram(
+		"refund_duration_ms",
+		metric.WithDescription("The latency of refund processing"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create refund_duration_ms histogram: %v", err)
+	}
+}
+
+// RefundOrderHandler serves POST /orders/{id}/refund. The request span is
+// linked to the trace that created the order, so the refund can be followed
+// back to the original purchase. Only created orders can be refunded, and a
+// refund cut short by its timeout leaves the order as it was.
+func RefundOrderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if link, ok := orderLink(order, "original_order"); ok {
+		span.AddLink(link)
+	}
+
+	// Claim the order so concurrent refunds cannot both succeed.
+	if !store.DefaultStore.CompareAndSetStatus(order.ID, store.StatusCreated, store.StatusRefunded) {
+		logging.DefaultLogger.Error(ctx, "Order cannot be refunded",
+			attribute.Int("order.id", order.ID),
+			attribute.String("order.status", order.Status),
+		)
+		logging.JSONLogger.Error(ctx, "Order cannot be refunded",
+			attribute.Int("order.id", order.ID),
+			attribute.String("order.status", order.Status),
+		)
+		problem.Write(w, r, problem.OrderNotRefundable, "Only created orders can be refunded; this order is "+order.Status+".")
+		return
+	}
+
+	refundCtx, refundSpan := otel.Tracer(instrumentationName).Start(ctx, "payment.refund")
+	if err := simulateWork(refundCtx, time.Duration(rand.IntN(100)+50)*time.Millisecond); err != nil { // Simulate provider work
+		// Release the claim so the refund can be retried.
+		store.DefaultStore.CompareAndSetStatus(order.ID, store.StatusRefunded, store.StatusCreated)
+		refundSpan.RecordError(err)
+		refundSpan.SetStatus(codes.Error, "refund interrupted")
+		refundSpan.End()
+		recordRefund(r, start, statusFailure)
+
+		logging.DefaultLogger.Error(ctx, "Refund canceled", attribute.Int("order.id", order.ID), attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Refund canceled", attribute.Int("order.id", order.ID), attribute.String("error.reason", err.Error()))
+		span.SetStatus(codes.Error, "refund canceled")
+		problem.Write(w, r, problem.GatewayTimeout, "The request was canceled during the refund; the order was not refunded.")
+		return
+	}
+	if rand.IntN(50) == 0 {
+		// Release the claim so the refund can be retried.
+		store.DefaultStore.CompareAndSetStatus(order.ID, store.StatusRefunded, store.StatusCreated)
+		refundSpan.RecordError(errRefundFailed)
+		refundSpan.SetStatus(codes.Error, "refund failed")
+		refundSpan.End()
+		recordRefund(r, start, statusFailure)
+
+		logging.DefaultLogger.Error(ctx, "Refund failed", attribute.Int("order.id", order.ID), attribute.String("error.reason", errRefundFailed.Error()))
+		logging.JSONLogger.Error(ctx, "Refund failed", attribute.Int("order.id", order.ID), attribute.String("error.reason", errRefundFailed.Error()))
+		span.SetStatus(codes.Error, "refund failed")
+		problem.Write(w, r, problem.RefundFailed, "The payment provider rejected the refund.")
+		return
+	}
+	refundSpan.SetStatus(codes.Ok, "refund processed")
+	refundSpan.End()
+	recordRefund(r, start, statusSuccess)
+
+	logging.DefaultLogger.Info(ctx, "Order refunded successfully", attribute.Int("order.id", order.ID))
+	logging.JSONLogger.Info(ctx, "Order refunded successfully", attribute.Int("order.id", order.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(RefundResponse{Status: "success", Message: "Order refunded successfully", OrderID: order.ID}); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding refund response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding refund response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// recordRefund records the refund counter and latency histogram.
+func recordRefund(r *http.Request, start time.Time, status string) {
+	attrs := metric.WithAttributes(attribute.String("status", status))
+	refundsCounter.Add(r.Context(), 1, attrs)
+	refundDurationHistogram.Record(r.Context(), float64(time.Since(start).Milliseconds()), attrs)
+}
+
+// orderLink builds a span link to the request span that created the order,
+// with the reason for the link.
+func orderLink(order store.Order, reason string) (trace.Link, bool) {
+	traceID, err := trace.TraceIDFromHex(order.TraceID)
+	if err != nil {
+		return trace.Link{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(order.SpanID)
+	if err != nil {
+		return trace.Link{}, false
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return trace.Link{
+		SpanContext: sc,
+		Attributes:  []attribute.KeyValue{attribute.String("link.reason", reason), attribute.Int("order.id", order.ID)},
+	}, true
+}
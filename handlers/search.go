@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"app/logging"
+	"app/problem"
+	"app/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OrderSearchResponse is the JSON response payload for an order search.
+type OrderSearchResponse struct {
+	Orders []store.Order `json:"orders"`
+	Count  int           `json:"count"`
+}
+
+// Histogram for order search latency.
+var orderSearchHistogram metric.Float64Histogram
+
+func init() {
+	var err error
+	orderSearchHistogram, err = meter.Float64Histogram(
+		"order_search_duration_ms",
+		metric.WithDescription("The latency of order searches"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create order_search_duration_ms histogram: %v", err)
+	}
+}
+
+// SearchOrdersHandler serves GET /orders/search?customer=&status=&since=.
+// since accepts an RFC 3339 timestamp or a duration relative to now (e.g. 1h).
+// Filter values are recorded on the span only in sanitized, low-cardinality form.
+func SearchOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	start := time.Now()
+	q := r.URL.Query()
+
+	query := store.Query{
+		CustomerID: q.Get("customer"),
+		Status:     q.Get("status"),
+	}
+	if raw := q.Get("since"); raw != "" {
+		since, err := parseSince(raw, start)
+		if err != nil {
+			logging.DefaultLogger.Error(ctx, "Invalid order search parameter", attribute.String("error.reason", err.Error()))
+			logging.JSONLogger.Error(ctx, "Invalid order search parameter", attribute.String("error.reason", err.Error()))
+			problem.Write(w, r, problem.InvalidRequest, "since must be an RFC 3339 timestamp or a duration.")
+			return
+		}
+		query.Since = since
+	}
+
+	filterAttrs := []attribute.KeyValue{
+		attribute.Bool("search.filter.customer", query.CustomerID != ""),
+		attribute.String("search.filter.status", statusBucket(query.Status)),
+		attribute.String("search.filter.since", sinceBucket(query.Since, start)),
+	}
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(filterAttrs...)
+
+	// Simulate the database query.
+	dbCtx, dbSpan := otel.Tracer(instrumentationName).Start(ctx, "db.search_orders")
+	if err := simulateWork(dbCtx, time.Duration(rand.IntN(30)+10)*time.Millisecond); err != nil {
+		dbSpan.RecordError(err)
+		dbSpan.SetStatus(codes.Error, "search interrupted")
+		dbSpan.End()
+		logging.DefaultLogger.Error(ctx, "Order search canceled", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Order search canceled", attribute.String("error.reason", err.Error()))
+		span.SetStatus(codes.Error, "search canceled")
+		problem.Write(w, r, problem.GatewayTimeout, "The request was canceled during the search.")
+		return
+	}
+	orders := store.DefaultStore.Search(query)
+	dbSpan.SetAttributes(attribute.Int("db.rows_returned", len(orders)))
+	dbSpan.SetStatus(codes.Ok, "orders searched")
+	dbSpan.End()
+
+	span.SetAttributes(attribute.Int("search.results", len(orders)))
+	orderSearchHistogram.Record(ctx, float64(time.Since(start).Milliseconds()), metric.WithAttributes(filterAttrs...))
+	logging.DefaultLogger.Info(ctx, "Orders searched", attribute.Int("search.results", len(orders)))
+	logging.JSONLogger.Info(ctx, "Orders searched", attribute.Int("search.results", len(orders)))
+
+	if orders == nil {
+		orders = []store.Order{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(OrderSearchResponse{Orders: orders, Count: len(orders)}); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding search response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding search response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// parseSince parses an RFC 3339 timestamp or a duration before now.
+func parseSince(raw string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// statusBucket maps a status filter to a known status, "any", or "other".
+func statusBucket(status string) string {
+	switch status {
+	case "":
+		return "any"
+	case store.StatusPending, store.StatusCreated, store.StatusFailed, store.StatusRefunded:
+		return status
+	default:
+		return "other"
+	}
+}
+
+// sinceBucket maps a since filter to a coarse age bucket.
+func sinceBucket(since, now time.Time) string {
+	if since.IsZero() {
+		return "none"
+	}
+	switch age := now.Sub(since); {
+	case age <= time.Hour:
+		return "1h"
+	case age <= 24*time.Hour:
+		return "24h"
+	case age <= 7*24*time.Hour:
+		return "7d"
+	default:
+		return "older"
+	}
+}
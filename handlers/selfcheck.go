@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// selfCheck holds the startup self-check results reported on /readyz.
+var selfCheck struct {
+	mu      sync.RWMutex
+	done    bool
+	results map[string]string
+}
+
+// RunSelfCheck checks at startup that the service is wired up correctly, so
+// misconfiguration surfaces at once instead of as silent export failures. It
+// runs every /status dependency probe (the store, the OTel Collector's OTLP
+// endpoint, the partner API, and any standalone services) inside a
+// "startup.self_check" span, and reports configWarnings alongside them.
+// Problems are logged and recorded on the span, and the results are listed on
+// /readyz, which fails until the check has run. Failures do not stop the
+// service; /status keeps probing the dependencies.
+func RunSelfCheck(ctx context.Context, configWarnings []string) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "startup.self_check")
+	defer span.End()
+
+	results := make(map[string]string)
+	var unreachable []string
+	for _, dep := range probeAll(ctx, dependencyProbes()) {
+		if dep.Healthy {
+			results[dep.Name] = "ok"
+			continue
+		}
+		unreachable = append(unreachable, dep.Name)
+		results[dep.Name] = "failing: " + dep.LastError
+		log.Printf("[WARN] self-check: %s is unreachable: %s", dep.Name, dep.LastError)
+		logging.JSONLogger.Warn(ctx, "Startup self-check failed",
+			attribute.String("dependency.name", dep.Name),
+			attribute.String("error.reason", dep.LastError),
+		)
+	}
+	results["config"] = "ok"
+	if len(configWarnings) > 0 {
+		results["config"] = "warning: " + strings.Join(configWarnings, "; ")
+		for _, w := range configWarnings {
+			log.Printf("[WARN] self-check: %s", w)
+			logging.JSONLogger.Warn(ctx, "Startup configuration warning", attribute.String("config.warning", w))
+		}
+	}
+
+	span.SetAttributes(
+		attribute.StringSlice("self_check.unreachable", unreachable),
+		attribute.StringSlice("self_check.config_warnings", configWarnings),
+	)
+	if len(unreachable) > 0 {
+		span.SetStatus(codes.Error, "dependencies unreachable")
+		log.Printf("[WARN] Startup self-check finished; unreachable: %s", strings.Join(unreachable, ", "))
+	} else {
+		span.SetStatus(codes.Ok, "self-check passed")
+		log.Println("Startup self-check passed")
+	}
+
+	selfCheck.mu.Lock()
+	defer selfCheck.mu.Unlock()
+	selfCheck.done = true
+	selfCheck.results = results
+}
+
+// selfCheckResults returns the self-check results and whether it has run.
+func selfCheckResults() (map[string]string, bool) {
+	selfCheck.mu.RLock()
+	defer selfCheck.mu.RUnlock()
+	return selfCheck.results, selfCheck.done
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"app/logging"
+	"app/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxSettlementBatch bounds the orders in one settlement batch, and so its
+// span links, under the SDK's default limit of 128 links per span.
+const maxSettlementBatch = 100
+
+var (
+	// Counter for settled orders.
+	settledOrdersCounter metric.Int64Counter
+	// Histogram of settlement batch sizes.
+	settlementBatchHistogram metric.Int64Histogram
+)
+
+func init() {
+	var err error
+	settledOrdersCounter, err = meter.Int64Counter(
+		"orders_settled_total",
+		metric.WithDescription("The total number of orders settled in batches"),
+		metric.WithUnit("{order}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create orders_settled_total counter: %v", err)
+	}
+	settlementBatchHistogram, err = meter.Int64Histogram(
+		"settlement_batch_size",
+		metric.WithDescription("The number of orders in each settlement batch"),
+		metric.WithUnit("{order}"),
+		metric.WithExplicitBucketBoundaries(1, 5, 10, 25, 50, 75, 100),
+	)
+	if err != nil {
+		log.Fatalf("failed to create settlement_batch_size histogram: %v", err)
+	}
+}
+
+// SettleOrders settles the created orders not yet settled, up to
+// maxSettlementBatch of them, in one batch posted to a simulated ledger. Each
+// order was created in its own request trace, so the batch cannot be their
+// child: instead the span in ctx, the job's root span, is linked to each
+// order's request span, and the fan-in can be followed from the batch to every
+// purchase it settled. Orders created without a trace context are settled but
+// not linked.
+func SettleOrders(ctx context.Context) error {
+	batchID := fmt.Sprintf("%016x", rand.Uint64())
+	orders := store.DefaultStore.ClaimForSettlement(batchID, maxSettlementBatch)
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("settlement.id", batchID),
+		attribute.Int("settlement.order_count", len(orders)),
+	)
+	if len(orders) == 0 {
+		return nil
+	}
+	linked := 0
+	for _, order := range orders {
+		if link, ok := orderLink(order, "settled_order"); ok {
+			span.AddLink(link)
+			linked++
+		}
+	}
+	span.SetAttributes(attribute.Int("settlement.linked_orders", linked))
+
+	if err := postSettlement(ctx, batchID, len(orders)); err != nil {
+		// The orders go into the next batch.
+		store.DefaultStore.ReleaseSettlement(batchID)
+		return err
+	}
+	settledOrdersCounter.Add(ctx, int64(len(orders)))
+	settlementBatchHistogram.Record(ctx, int64(len(orders)))
+	logging.JSONLogger.Info(ctx, "Settlement batch posted",
+		attribute.String("settlement.id", batchID),
+		attribute.Int("settlement.order_count", len(orders)),
+	)
+	return nil
+}
+
+// postSettlement simulates posting the batch to the ledger in a
+// "settlement.post" span, taking longer for larger batches.
+func postSettlement(ctx context.Context, batchID string, count int) error {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "settlement.post",
+		trace.WithAttributes(
+			attribute.String("settlement.id", batchID),
+			attribute.Int("settlement.order_count", count),
+		),
+	)
+	defer span.End()
+	d := time.Duration(20+rand.IntN(30)+count) * time.Millisecond
+	if err := simulateWork(ctx, d); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "settlement interrupted")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"app/logging"
+	"app/store"
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestSettleOrders(t *testing.T) {
+	logging.JSONLogger.SetFile(filepath.Join(t.TempDir(), "app.log"))
+	ctx := context.Background()
+	// Settle what earlier tests created, so the batch holds only these orders.
+	store.DefaultStore.ClaimForSettlement("earlier", math.MaxInt)
+
+	rec := tracetest.Install(t)
+	metrics := tracetest.StartMetrics(t)
+	var orders []store.Order
+	for _, customer := range []string{"cust-001", "cust-002"} {
+		_, span := otel.Tracer("test").Start(ctx, "POST /createOrder")
+		sc := span.SpanContext()
+		span.End()
+		o := store.DefaultStore.Create(customer, sc.TraceID().String(), sc.SpanID().String())
+		store.DefaultStore.SetStatus(o.ID, store.StatusCreated)
+		orders = append(orders, o)
+	}
+	untraced := store.DefaultStore.Create("cust-003", "", "")
+	store.DefaultStore.SetStatus(untraced.ID, store.StatusCreated)
+	failed := store.DefaultStore.Create("cust-004", "", "")
+	store.DefaultStore.SetStatus(failed.ID, store.StatusFailed)
+
+	jobCtx, root := otel.Tracer("test").Start(ctx, "job.run")
+	if err := SettleOrders(jobCtx); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	span := rec.Span(t, "job.run")
+	tracetest.AssertAttributes(t, span,
+		attribute.Int("settlement.order_count", 3),
+		attribute.Int("settlement.linked_orders", 2),
+	)
+	links := span.Links()
+	if len(links) != len(orders) {
+		t.Fatalf("%d links, want one per traced order", len(links))
+	}
+	for i, link := range links {
+		if got, want := link.SpanContext.SpanID().String(), orders[i].SpanID; got != want {
+			t.Errorf("link %d to span %s, want order %d's %s", i, got, orders[i].ID, want)
+		}
+		want := []attribute.KeyValue{attribute.String("link.reason", "settled_order"), attribute.Int("order.id", orders[i].ID)}
+		if got := link.Attributes; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("link %d attributes = %v, want %v", i, got, want)
+		}
+	}
+	tracetest.AssertChildOf(t, rec.Span(t, "settlement.post"), span)
+	metrics.AssertCounter(t, "orders_settled_total", 3)
+
+	var batch string
+	for _, a := range span.Attributes() {
+		if a.Key == "settlement.id" {
+			batch = a.Value.AsString()
+		}
+	}
+	for _, o := range append(orders, untraced) {
+		if got, _ := store.DefaultStore.Get(o.ID); batch == "" || got.SettlementID != batch {
+			t.Errorf("order %d settlement ID = %q, want batch %q", o.ID, got.SettlementID, batch)
+		}
+	}
+	if got, _ := store.DefaultStore.Get(failed.ID); got.SettlementID != "" {
+		t.Errorf("failed order settled in %q", got.SettlementID)
+	}
+}
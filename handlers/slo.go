@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"app/problem"
+	"app/slo"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sloTracker computes the objectives GET /slo reports; nil while SLOs are
+// disabled.
+var sloTracker atomic.Pointer[slo.Tracker]
+
+// ConfigureSLO sets the tracker whose objectives GET /slo reports.
+func ConfigureSLO(t *slo.Tracker) {
+	sloTracker.Store(t)
+}
+
+// ObjectiveStatus is one objective's compliance and error budget.
+type ObjectiveStatus struct {
+	Name  string `json:"name"`
+	Route string `json:"route"`
+	// LatencyMS is the latency objective's threshold; availability objectives
+	// omit it.
+	LatencyMS int64   `json:"latency_ms,omitempty"`
+	Target    float64 `json:"target"`
+	// Status is "ok", "burning" while both burn-rate windows exceed the
+	// threshold, or "exhausted" once the error budget is spent.
+	Status string `json:"status"`
+	// Requests and BadRequests count the route's requests since Since.
+	Requests    uint64    `json:"requests"`
+	BadRequests uint64    `json:"bad_requests"`
+	Since       time.Time `json:"since"`
+	// Compliance is the share of good requests, or null without requests.
+	Compliance *float64 `json:"compliance"`
+	// ErrorBudgetRemaining is the share of the error budget left: 1 with no
+	// bad requests, negative once the objective is missed.
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+	// BurnRates are keyed by window, such as "5m" and "1h".
+	BurnRates map[string]float64 `json:"burn_rates"`
+}
+
+// SLOResponse is the JSON response payload for GET /slo.
+type SLOResponse struct {
+	EvaluatedAt time.Time         `json:"evaluated_at"`
+	Objectives  []ObjectiveStatus `json:"objectives"`
+}
+
+// SLOHandler serves GET /slo: each objective's compliance, remaining error
+// budget, and burn rates as of the last evaluation, so the budget spent by a
+// chaos scenario can be watched without a dashboard. It answers 503 when SLOs
+// are disabled.
+func SLOHandler(w http.ResponseWriter, r *http.Request) {
+	tracker := sloTracker.Load()
+	if tracker == nil {
+		problem.Write(w, r, problem.FeatureDisabled, "SLO tracking is disabled; set slo.interval and declare objectives.")
+		return
+	}
+	short, long := tracker.Windows()
+	resp := SLOResponse{Objectives: []ObjectiveStatus{}}
+	atRisk := 0
+	for _, s := range tracker.Statuses() {
+		o := ObjectiveStatus{
+			Name:                 s.Objective.Name,
+			Route:                s.Objective.Route,
+			LatencyMS:            s.Objective.Latency.Milliseconds(),
+			Target:               s.Objective.Target,
+			Status:               "ok",
+			Requests:             s.Total,
+			BadRequests:          s.Total - s.Good,
+			Since:                s.Since,
+			ErrorBudgetRemaining: s.BudgetRemaining(),
+			BurnRates: map[string]float64{
+				slo.WindowLabel(short): s.Short,
+				slo.WindowLabel(long):  s.Long,
+			},
+		}
+		if c, ok := s.Compliance(); ok {
+			o.Compliance = &c
+		}
+		switch {
+		case o.ErrorBudgetRemaining <= 0:
+			o.Status = "exhausted"
+		case s.Burning:
+			o.Status = "burning"
+		}
+		if o.Status != "ok" {
+			atRisk++
+		}
+		if s.Evaluated.After(resp.EvaluatedAt) {
+			resp.EvaluatedAt = s.Evaluated
+		}
+		resp.Objectives = append(resp.Objectives, o)
+	}
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("slo.at_risk", atRisk))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"app/config"
+	"app/slo"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestSLO(t *testing.T) {
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		SLOHandler(w, httptest.NewRequest(http.MethodGet, "/slo", nil))
+		return w
+	}
+	if w := get(); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a tracker: status %d, want 503", w.Code)
+	}
+
+	reader := sdkmetric.NewManualReader()
+	hist, _ := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test").Float64Histogram(
+		"http.server.request.duration", metric.WithExplicitBucketBoundaries(0.5))
+	tracker := slo.New(config.SLO{
+		ShortWindow:       5 * time.Minute,
+		LongWindow:        time.Hour,
+		BurnRateThreshold: 14.4,
+		Objectives: []config.Objective{
+			{Name: "availability", Route: "POST /createOrder", Target: 0.9},
+			{Name: "latency", Route: "POST /createOrder", Latency: 500 * time.Millisecond, Target: 0.99},
+		},
+	}, reader.Collect)
+	ConfigureSLO(tracker)
+	t.Cleanup(func() { ConfigureSLO(nil) })
+
+	ctx := context.Background()
+	if err := tracker.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		status := http.StatusOK
+		if i < 4 {
+			status = http.StatusInternalServerError
+		}
+		hist.Record(ctx, 0.1, metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String("POST"),
+			semconv.HTTPRoute("/createOrder"),
+			semconv.HTTPResponseStatusCode(status),
+		))
+	}
+	if err := tracker.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	w := get()
+	var resp SLOResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", w.Code, w.Body)
+	}
+	if len(resp.Objectives) != 2 {
+		t.Fatalf("got %d objectives, want 2", len(resp.Objectives))
+	}
+	// 4 of 20 requests failed against a budget of 2: twice the budget is spent.
+	if o := resp.Objectives[0]; o.Status != "exhausted" || o.Requests != 20 || o.BadRequests != 4 ||
+		o.Compliance == nil || *o.Compliance != 0.8 || o.ErrorBudgetRemaining > -0.99 || o.BurnRates["5m"] < 1.99 || o.BurnRates["1h"] < 1.99 {
+		t.Errorf("availability = %+v, want exhausted with 4 of 20 bad and burn rates of 2", o)
+	}
+	if o := resp.Objectives[1]; o.Status != "ok" || o.LatencyMS != 500 || o.BadRequests != 0 || o.ErrorBudgetRemaining != 1 || o.BurnRates["5m"] != 0 {
+		t.Errorf("latency = %+v, want ok with its budget intact", o)
+	}
+}
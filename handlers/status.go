@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"app/background"
+	"app/logging"
+	"app/store"
+	"app/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// statusProbeTimeout bounds each dependency probe.
+const statusProbeTimeout = 2 * time.Second
+
+// DependencyStatus is the health of a single dependency.
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	Healthy   bool   `json:"healthy"`
+	LatencyMS int64  `json:"latency_ms"`
+	// LastError is the most recent probe error, even if the dependency has since recovered.
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// StatusResponse is the JSON response payload for GET /status.
+type StatusResponse struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// dependencyProbe checks a single dependency.
+type dependencyProbe struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type probeError struct {
+	message string
+	at      time.Time
+}
+
+var (
+	lastProbeErrorsMu sync.Mutex
+	lastProbeErrors   = make(map[string]probeError)
+)
+
+// StatusHandler serves GET /status. It probes every configured dependency
+// concurrently, each inside a "status.probe" span, and answers 200 when all
+// are healthy or 503 when any is not, so it can back uptime checks.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	results := probeAll(ctx, dependencyProbes())
+
+	resp := StatusResponse{Status: "ok", Dependencies: results}
+	code := http.StatusOK
+	for _, dep := range results {
+		if !dep.Healthy {
+			resp.Status = "degraded"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("status.overall", resp.Status))
+	if code != http.StatusOK {
+		logging.DefaultLogger.Error(ctx, "Dependency status degraded")
+		logging.JSONLogger.Error(ctx, "Dependency status degraded")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding status response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding status response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// dependencyProbes returns the probes for the configured dependencies. The
+// collector is only probed when exporting over OTLP, and the standalone
+// services when their URLs are set.
+func dependencyProbes() []dependencyProbe {
+	probes := []dependencyProbe{
+		{name: "database", check: store.DefaultStore.Ping},
+		{name: "partner-api", check: func(ctx context.Context) error {
+			return callPartner(ctx, http.MethodGet, "fx", url.Values{"from": {"USD"}, "to": {"USD"}}, nil)
+		}},
+	}
+	if endpoint := tracing.Endpoint(); endpoint != "" {
+		probes = append(probes, dependencyProbe{name: "otel-collector", check: dialProbe(endpoint)})
+	}
+	if paymentServiceURL != "" {
+		probes = append(probes, dependencyProbe{name: "payment-service", check: dialURLProbe(paymentServiceURL)})
+	}
+	if inventoryServiceURL != "" {
+		probes = append(probes, dependencyProbe{name: "inventory-service", check: dialURLProbe(inventoryServiceURL)})
+	}
+	return probes
+}
+
+// probeAll runs the probes concurrently.
+func probeAll(ctx context.Context, probes []dependencyProbe) []DependencyStatus {
+	results := make([]DependencyStatus, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		background.Go(ctx, "status.probe."+probe.name, func() {
+			defer wg.Done()
+			results[i] = runProbe(ctx, probe)
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// ProbeDependencies runs the /status dependency probes as a synthetic check,
+// so dependency health and the last errors on /status stay current without
+// traffic. It fails if any dependency is unhealthy.
+func ProbeDependencies(ctx context.Context) error {
+	var errs []error
+	for _, dep := range probeAll(ctx, dependencyProbes()) {
+		if !dep.Healthy {
+			errs = append(errs, fmt.Errorf("%s: %s", dep.Name, dep.LastError))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runProbe runs a probe inside a "status.probe" span and records its last error.
+func runProbe(ctx context.Context, probe dependencyProbe) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, statusProbeTimeout)
+	defer cancel()
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "status.probe",
+		trace.WithAttributes(attribute.String("dependency.name", probe.name)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := probe.check(ctx)
+	status := DependencyStatus{
+		Name:      probe.name,
+		Healthy:   err == nil,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	span.SetAttributes(attribute.Bool("dependency.healthy", status.Healthy))
+	logging.DefaultLogger.Debug(ctx, "Dependency probed",
+		attribute.String("dependency.name", probe.name),
+		attribute.Bool("dependency.healthy", status.Healthy),
+		attribute.Int64("dependency.latency_ms", status.LatencyMS),
+	)
+
+	lastProbeErrorsMu.Lock()
+	defer lastProbeErrorsMu.Unlock()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "dependency unhealthy")
+		lastProbeErrors[probe.name] = probeError{message: err.Error(), at: time.Now().UTC()}
+	}
+	if last, ok := lastProbeErrors[probe.name]; ok {
+		status.LastError = last.message
+		status.LastErrorAt = &last.at
+	}
+	return status
+}
+
+// dialProbe checks that a TCP connection can be opened to addr.
+func dialProbe(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// dialURLProbe checks that a TCP connection can be opened to the host of rawURL.
+func dialURLProbe(rawURL string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %w", rawURL, err)
+		}
+		host := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+		return dialProbe(host)(ctx)
+	}
+}
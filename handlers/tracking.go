@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"app/background"
+	"app/httpclient"
+	"app/logging"
+	"app/middleware"
+	"app/problem"
+	"app/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// trackingCacheTTL is how long a carrier answer is reused before polling again.
+const trackingCacheTTL = 30 * time.Second
+
+// trackingCacheMax is the most carrier answers cached at once.
+const trackingCacheMax = 1000
+
+// carrierBaseURL is the base URL of the simulated carrier API. Requests to it are
+// served in-process by httpclient.HandlerTransport.
+const carrierBaseURL = "http://carrier.sim"
+
+// carriers are the simulated carriers polled for each shipment.
+var carriers = []string{"ups-sim", "fedex-sim", "dhl-sim"}
+
+// TrackingEvent is a single carrier scan event.
+type TrackingEvent struct {
+	Time     time.Time `json:"time"`
+	Location string    `json:"location"`
+	Status   string    `json:"status"`
+}
+
+// TrackingResponse is the JSON response payload for shipment tracking.
+type TrackingResponse struct {
+	OrderID int             `json:"order_id"`
+	Carrier string          `json:"carrier"`
+	Status  string          `json:"status"`
+	Events  []TrackingEvent `json:"events"`
+	Cached  bool            `json:"cached"`
+}
+
+type trackingCacheEntry struct {
+	resp    TrackingResponse
+	expires time.Time
+}
+
+var (
+	// carrierClient calls the simulated carrier API. Its transport serves the
+	// requests in-process, so no external carrier is needed while the calls still
+	// produce real client spans with propagated context.
+	carrierClient = httpclient.New("carrier-api", httpclient.WithTransport(httpclient.HandlerTransport{Handler: newCarrierStub()}))
+
+	trackingCacheMu sync.Mutex
+	trackingCache   = make(map[int]trackingCacheEntry)
+
+	// Histogram for carrier API latency, by carrier and outcome.
+	carrierLatencyHistogram metric.Float64Histogram
+)
+
+func init() {
+	var err error
+	carrierLatencyHistogram, err = meter.Float64Histogram(
+		"carrier_request_duration_ms",
+		metric.WithDescription("The latency of simulated carrier API calls"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create carrier_request_duration_ms histogram: %v", err)
+	}
+}
+
+// TrackingHandler serves GET /orders/{id}/tracking. On a cache miss it polls all
+// carriers concurrently, since the order does not record which one holds the
+// parcel, and caches the answer for trackingCacheTTL.
+func TrackingHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	order, ok := orderFromPath(w, r)
+	if !ok {
+		return
+	}
+	if order.Status != store.StatusCreated {
+		problem.Write(w, r, problem.NotFound, "The order has no shipment.")
+		return
+	}
+
+	resp, hit := cachedTracking(order.ID)
+	span.SetAttributes(attribute.Bool("tracking.cache_hit", hit))
+
+	if hit {
+		resp.Cached = true
+	} else {
+		var err error
+		resp, err = pollCarriers(ctx, order.ID)
+		if err != nil {
+			logging.DefaultLogger.Error(ctx, "Shipment tracking failed", attribute.Int("order.id", order.ID), attribute.String("error.reason", err.Error()))
+			logging.JSONLogger.Error(ctx, "Shipment tracking failed", attribute.Int("order.id", order.ID), attribute.String("error.reason", err.Error()))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "shipment tracking failed")
+			problem.Write(w, r, problem.UpstreamFailed, "No carrier could be reached for the shipment.")
+			return
+		}
+		cacheTracking(order.ID, resp)
+	}
+
+	span.SetAttributes(attribute.String("tracking.carrier", resp.Carrier))
+	logging.DefaultLogger.Info(ctx, "Shipment tracked", attribute.Int("order.id", order.ID), attribute.String("tracking.carrier", resp.Carrier))
+	logging.JSONLogger.Info(ctx, "Shipment tracked", attribute.Int("order.id", order.ID), attribute.String("tracking.carrier", resp.Carrier))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logging.DefaultLogger.Error(ctx, "Error encoding tracking response", attribute.String("error.reason", err.Error()))
+		logging.JSONLogger.Error(ctx, "Error encoding tracking response", attribute.String("error.reason", err.Error()))
+	}
+}
+
+// cachedTracking returns the cached carrier answer for the order, if it has
+// not expired. An expired answer is dropped.
+func cachedTracking(orderID int) (TrackingResponse, bool) {
+	trackingCacheMu.Lock()
+	defer trackingCacheMu.Unlock()
+	entry, ok := trackingCache[orderID]
+	if !ok {
+		return TrackingResponse{}, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(trackingCache, orderID)
+		return TrackingResponse{}, false
+	}
+	return entry.resp, true
+}
+
+// cacheTracking caches the carrier answer for the order for trackingCacheTTL.
+// When the cache is full, expired answers are dropped first, and then the
+// answer closest to expiring.
+func cacheTracking(orderID int, resp TrackingResponse) {
+	now := time.Now()
+	trackingCacheMu.Lock()
+	defer trackingCacheMu.Unlock()
+	if _, ok := trackingCache[orderID]; !ok && len(trackingCache) >= trackingCacheMax {
+		var oldest int
+		var oldestExpires time.Time
+		for id, entry := range trackingCache {
+			if !now.Before(entry.expires) {
+				delete(trackingCache, id)
+			} else if oldestExpires.IsZero() || entry.expires.Before(oldestExpires) {
+				oldest, oldestExpires = id, entry.expires
+			}
+		}
+		if len(trackingCache) >= trackingCacheMax {
+			delete(trackingCache, oldest)
+		}
+	}
+	trackingCache[orderID] = trackingCacheEntry{resp: resp, expires: now.Add(trackingCacheTTL)}
+}
+
+// pollCarriers fans out to every carrier inside a "tracking.fan_out" span and
+// returns the answer from the carrier that knows the shipment.
+func pollCarriers(ctx context.Context, orderID int) (TrackingResponse, error) {
+	middleware.SetStage(ctx, "carriers")
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "tracking.fan_out")
+	defer span.End()
+
+	type result struct {
+		resp  TrackingResponse
+		found bool
+		err   error
+	}
+	results := make([]result, len(carriers))
+
+	var wg sync.WaitGroup
+	for i, carrier := range carriers {
+		wg.Add(1)
+		background.Go(ctx, "tracking.carrier."+carrier, func() {
+			defer wg.Done()
+			resp, found, err := queryCarrier(ctx, carrier, orderID)
+			results[i] = result{resp: resp, found: found, err: err}
+		})
+	}
+	wg.Wait()
+
+	var firstErr error
+	for _, res := range results {
+		if res.found {
+			span.SetStatus(codes.Ok, "shipment found")
+			return res.resp, nil
+		}
+		if res.err != nil && firstErr == nil {
+			firstErr = res.err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no carrier knows the shipment for order %d", orderID)
+	}
+	span.RecordError(firstErr)
+	span.SetStatus(codes.Error, "shipment not found")
+	return TrackingResponse{}, firstErr
+}
+
+// queryCarrier asks a single carrier for the shipment inside a
+// "carrier.track" span. found is false when the carrier does not hold the
+// parcel.
+func queryCarrier(ctx context.Context, carrier string, orderID int) (resp TrackingResponse, found bool, err error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "carrier.track",
+		trace.WithAttributes(attribute.String("tracking.carrier", carrier)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	outcome := "error"
+	defer func() {
+		carrierLatencyHistogram.Record(ctx, float64(time.Since(start).Milliseconds()), metric.WithAttributes(
+			attribute.String("tracking.carrier", carrier),
+			attribute.String("outcome", outcome),
+		))
+	}()
+
+	url := fmt.Sprintf("%s/%s/shipments/%d", carrierBaseURL, carrier, orderID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return resp, false, err
+	}
+	httpResp, err := carrierClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "carrier request failed")
+		return resp, false, err
+	}
+	defer httpResp.Body.Close()
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		outcome = "found"
+	case http.StatusNotFound:
+		outcome = "not_found"
+		return resp, false, nil
+	default:
+		err = fmt.Errorf("carrier %s returned %s", carrier, httpResp.Status)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "carrier request failed")
+		return resp, false, err
+	}
+
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		outcome = "error"
+		return resp, false, fmt.Errorf("decoding carrier %s response: %w", carrier, err)
+	}
+	return resp, true, nil
+}
+
+// newCarrierStub builds the simulated carrier API. Each order's parcel belongs to
+// one carrier; the others answer 404. About 5% of calls fail with 503.
+func newCarrierStub() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{carrier}/shipments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if simulateWork(r.Context(), time.Duration(rand.IntN(170)+30)*time.Millisecond) != nil {
+			return
+		}
+		if rand.IntN(20) == 0 {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		carrier := r.PathValue("carrier")
+		if err != nil || carriers[id%len(carriers)] != carrier {
+			http.NotFound(w, r)
+			return
+		}
+
+		created := time.Now().Add(-time.Duration(id%48) * time.Hour).UTC().Truncate(time.Minute)
+		resp := TrackingResponse{
+			OrderID: id,
+			Carrier: carrier,
+			Status:  "in_transit",
+			Events: []TrackingEvent{
+				{Time: created, Location: "Warehouse", Status: "label_created"},
+				{Time: created.Add(2 * time.Hour), Location: "Sorting Center", Status: "in_transit"},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	return mux
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackingCacheBounded(t *testing.T) {
+	t.Cleanup(func() { clear(trackingCache) })
+	now := time.Now()
+	for id := range trackingCacheMax {
+		trackingCache[id] = trackingCacheEntry{expires: now.Add(time.Duration(id) * time.Second)}
+	}
+	trackingCache[0] = trackingCacheEntry{expires: now.Add(-time.Second)}
+
+	if _, hit := cachedTracking(0); hit {
+		t.Error("cachedTracking() hit an expired answer")
+	}
+	if _, ok := trackingCache[0]; ok {
+		t.Error("the expired answer was not dropped")
+	}
+
+	// The cache is one short of full, then full: the answer closest to
+	// expiring makes room.
+	cacheTracking(trackingCacheMax, TrackingResponse{OrderID: trackingCacheMax})
+	cacheTracking(trackingCacheMax+1, TrackingResponse{OrderID: trackingCacheMax + 1})
+	if n := len(trackingCache); n != trackingCacheMax {
+		t.Errorf("%d cached answers, want %d", n, trackingCacheMax)
+	}
+	if _, ok := trackingCache[1]; ok {
+		t.Error("the answer closest to expiring was kept")
+	}
+	if resp, hit := cachedTracking(trackingCacheMax + 1); !hit || resp.OrderID != trackingCacheMax+1 {
+		t.Errorf("cachedTracking() = %+v, %v, want the new answer", resp, hit)
+	}
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"app/buildinfo"
+)
+
+// VersionHandler serves GET /version: the version, git commit, build time,
+// and Go version of the running binary.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(buildinfo.Get())
+}
@@ -0,0 +1,229 @@
+// Package handoff restarts the service without dropping connections. On
+// SIGUSR2 the running process starts a new copy of its binary, which may have
+// been replaced on disk, and passes it the listening sockets as inherited file
+// descriptors. The new process serves on them alongside the old one and
+// reports ready over a pipe; only then does the old process drain and exit. If
+// the new process fails to start or is not ready in time, it is killed and the
+// old one carries on serving.
+//
+// The handoff is a "restart.handoff" span whose context is passed to the new
+// process, so its startup span joins the same trace.
+package handoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/handoff"
+
+// Environment passed to the new process. The listeners start at descriptor 3
+// in the order of HANDOFF_FDNAMES, followed by the readiness pipe.
+const (
+	envNames       = "HANDOFF_FDNAMES"
+	envReadyFD     = "HANDOFF_READY_FD"
+	envTraceparent = "TRACEPARENT"
+)
+
+// firstFD is the first descriptor passed in exec.Cmd.ExtraFiles.
+const firstFD = 3
+
+var handoffCounter metric.Int64Counter
+
+func init() {
+	var err error
+	handoffCounter, err = otel.Meter(instrumentationName).Int64Counter(
+		"restart_handoffs_total",
+		metric.WithDescription("The total number of listener handoffs to a new process, by outcome"),
+		metric.WithUnit("{handoff}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create restart_handoffs_total counter: %v", err)
+	}
+}
+
+// Inherited reports whether the process was started by a handoff.
+func Inherited() bool {
+	return os.Getenv(envNames) != ""
+}
+
+// Listeners returns the listeners handed over by the previous process, keyed
+// by name, or nil if the process was not started by a handoff.
+func Listeners() (map[string]net.Listener, error) {
+	if !Inherited() {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv(envNames), ":")
+	listeners := make(map[string]net.Listener, len(names))
+	for i, name := range names {
+		f := os.NewFile(uintptr(firstFD+i), name)
+		// FileListener duplicates the descriptor, so the original is closed.
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("handoff: descriptor %d (%s): %w", firstFD+i, name, err)
+		}
+		listeners[name] = ln
+	}
+	return listeners, nil
+}
+
+// Context returns ctx carrying the previous process's handoff span, so spans
+// started from it join the handoff trace. Outside a handoff it returns ctx.
+func Context(ctx context.Context) context.Context {
+	if !Inherited() {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier{"traceparent": os.Getenv(envTraceparent)})
+}
+
+// Ready tells the previous process that this one is serving, so it can drain
+// and exit. Outside a handoff it does nothing.
+func Ready() error {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFD))
+	if err != nil {
+		return nil
+	}
+	f := os.NewFile(uintptr(fd), "handoff-ready")
+	defer f.Close()
+	if _, err := f.Write([]byte("ready\n")); err != nil {
+		return fmt.Errorf("handoff: signaling ready: %w", err)
+	}
+	return nil
+}
+
+// fileListener is a listener whose socket can be duplicated as a file.
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// Start starts a new process of the same binary and arguments with the
+// listeners, and waits up to timeout for it to report ready. It returns the
+// new process's ID. On failure the new process is killed, and the listeners
+// are unaffected.
+func Start(listeners map[string]net.Listener, timeout time.Duration) (pid int, err error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(context.Background(), "restart.handoff",
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("handoff.timeout", timeout.String())),
+	)
+	defer span.End()
+	start := time.Now()
+	defer func() {
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "handoff failed")
+			logging.JSONLogger.Error(ctx, "Restart handoff failed; the current process keeps serving",
+				attribute.String("error.reason", err.Error()),
+			)
+		} else {
+			logging.JSONLogger.Info(ctx, "Restart handoff complete; draining the current process",
+				attribute.Int("handoff.pid", pid),
+				attribute.Float64("handoff.duration_ms", float64(time.Since(start).Microseconds())/1000),
+			)
+		}
+		span.SetAttributes(attribute.String("handoff.outcome", outcome))
+		handoffCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+	}()
+
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	span.SetAttributes(attribute.StringSlice("handoff.listeners", names))
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range names {
+		ln, ok := listeners[name].(fileListener)
+		if !ok {
+			return 0, fmt.Errorf("listener %s cannot be handed off", name)
+		}
+		f, err := ln.File()
+		if err != nil {
+			return 0, fmt.Errorf("listener %s: %w", name, err)
+		}
+		files = append(files, f)
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+	files = append(files, readyW)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		envNames+"="+strings.Join(names, ":"),
+		envReadyFD+"="+strconv.Itoa(firstFD+len(names)),
+		envTraceparent+"="+carrier.Get("traceparent"),
+	)
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("starting %s: %w", exe, err)
+	}
+	pid = cmd.Process.Pid
+	span.SetAttributes(attribute.Int("handoff.pid", pid))
+	log.Printf("Handing off listeners to process %d", pid)
+	// Close the parent's copy of the write end, so a child that exits without
+	// signaling ends the read.
+	readyW.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		line := make([]byte, 16)
+		if n, err := ready.Read(line); n == 0 {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = errors.New("exited before it was ready")
+			}
+			result <- fmt.Errorf("process %d: %w", pid, err)
+			return
+		}
+		result <- nil
+	}()
+	select {
+	case err = <-result:
+	case <-time.After(timeout):
+		err = fmt.Errorf("process %d was not ready within %s", pid, timeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, err
+	}
+	// The new process outlives this one, so it is not waited for.
+	_ = cmd.Process.Release()
+	return pid, nil
+}
@@ -0,0 +1,234 @@
+package heatmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// shades are the characters of the text heatmap, from no requests to the
+// most requests of any cell.
+const shades = " .:-=+*#%@"
+
+// maxTextRows is the largest number of latency rows of the text heatmap;
+// adjacent buckets are merged to fit.
+const maxTextRows = 20
+
+// Snapshot is the JSON response payload for GET /debug/latency.
+type Snapshot struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Resolution  string    `json:"resolution"`
+	Window      string    `json:"window"`
+	Routes      []Route   `json:"routes"`
+}
+
+// Route is one route's heatmap. BucketsLeMS are the upper bounds, in
+// milliseconds, of the latency buckets from the fastest to the slowest
+// request observed in the window, and each column counts the requests in each
+// of them. The percentiles and the maximum are bucket upper bounds, so they
+// overstate the latency by at most 12.5%.
+type Route struct {
+	Route       string    `json:"route"`
+	Count       uint64    `json:"count"`
+	P50MS       float64   `json:"p50_ms"`
+	P90MS       float64   `json:"p90_ms"`
+	P99MS       float64   `json:"p99_ms"`
+	MaxMS       float64   `json:"max_ms"`
+	BucketsLeMS []float64 `json:"buckets_le_ms"`
+	Columns     []Column  `json:"columns"`
+}
+
+// Column counts the requests of one period of the resolution, starting at
+// Start. Columns are oldest first.
+type Column struct {
+	Start  time.Time `json:"start"`
+	Counts []uint32  `json:"counts"`
+}
+
+// Handler serves GET /debug/latency: the configured heatmap of every route
+// with requests in the window, as JSON or, with format=text, drawn in ASCII.
+// The route parameter selects one route by its path pattern, such as
+// /orders/{id}, and window (a duration up to the configured window) shortens
+// the window.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := current.Load()
+		if h == nil {
+			http.Error(w, "the latency heatmap is disabled (latency_heatmap.resolution is 0)", http.StatusNotFound)
+			return
+		}
+		window := h.window()
+		if s := r.URL.Query().Get("window"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				http.Error(w, "invalid window", http.StatusBadRequest)
+				return
+			}
+			window = min(d, window)
+		}
+		snap := h.Snapshot(r.URL.Query().Get("route"), window)
+		if r.URL.Query().Get("format") == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writeText(w, snap)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(snap)
+	})
+}
+
+// window returns the configured window, a whole number of periods.
+func (h *Heatmap) window() time.Duration {
+	return time.Duration(h.columns) * h.resolution
+}
+
+// Snapshot returns the heatmaps of the routes with requests in the last
+// window, or of route alone if it is not empty, sorted by route.
+func (h *Heatmap) Snapshot(route string, window time.Duration) Snapshot {
+	n := int((window + h.resolution - 1) / h.resolution)
+	n = min(max(n, 1), h.columns)
+	last := h.period(h.now())
+	snap := Snapshot{
+		GeneratedAt: h.now().UTC(),
+		Resolution:  h.resolution.String(),
+		Window:      (time.Duration(n) * h.resolution).String(),
+		Routes:      []Route{},
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, cols := range h.routes {
+		if route != "" && name != route {
+			continue
+		}
+		// The route's counts over the window, one row per period.
+		rows := make([][]uint32, n)
+		total := make([]uint64, numBuckets)
+		for i := range n {
+			period := last - int64(n-1-i)
+			c := cols[int(period%int64(h.columns))]
+			if c.counts == nil || c.period != period {
+				continue
+			}
+			rows[i] = c.counts
+			for b, count := range c.counts {
+				total[b] += uint64(count)
+			}
+		}
+		lo := slices.IndexFunc(total, func(c uint64) bool { return c > 0 })
+		if lo < 0 {
+			continue
+		}
+		hi := len(total) - 1
+		for total[hi] == 0 {
+			hi--
+		}
+
+		rt := Route{Route: name, BucketsLeMS: make([]float64, 0, hi-lo+1)}
+		for b := lo; b <= hi; b++ {
+			rt.Count += total[b]
+			rt.BucketsLeMS = append(rt.BucketsLeMS, upperMS(b))
+		}
+		rt.P50MS = upperMS(quantileBucket(total, rt.Count, 0.50))
+		rt.P90MS = upperMS(quantileBucket(total, rt.Count, 0.90))
+		rt.P99MS = upperMS(quantileBucket(total, rt.Count, 0.99))
+		rt.MaxMS = upperMS(hi)
+		for i, counts := range rows {
+			col := Column{
+				Start:  time.Unix(0, (last-int64(n-1-i))*int64(h.resolution)).UTC(),
+				Counts: make([]uint32, hi-lo+1),
+			}
+			if counts != nil {
+				copy(col.Counts, counts[lo:hi+1])
+			}
+			rt.Columns = append(rt.Columns, col)
+		}
+		snap.Routes = append(snap.Routes, rt)
+	}
+	slices.SortFunc(snap.Routes, func(a, b Route) int { return strings.Compare(a.Route, b.Route) })
+	return snap
+}
+
+// quantileBucket returns the bucket holding the q quantile of the count
+// requests in total.
+func quantileBucket(total []uint64, count uint64, q float64) int {
+	rank := uint64(q*float64(count-1)) + 1
+	var seen uint64
+	for b, c := range total {
+		seen += c
+		if seen >= rank {
+			return b
+		}
+	}
+	return len(total) - 1
+}
+
+// upperMS returns the upper bound of bucket b in milliseconds.
+func upperMS(b int) float64 {
+	_, upper := bucketBounds(b)
+	return float64(upper) / 1000
+}
+
+// writeText draws each route's heatmap: one column per period, oldest on the
+// left, and one row per latency range, slowest on top, shaded by how many
+// requests the cell counts relative to the busiest cell of the route.
+func writeText(w io.Writer, snap Snapshot) {
+	fmt.Fprintf(w, "Latency heatmap, %s window at %s resolution, generated at %s\n", snap.Window, snap.Resolution, snap.GeneratedAt.Format(time.RFC3339))
+	if len(snap.Routes) == 0 {
+		fmt.Fprintln(w, "\nNo requests in the window.")
+		return
+	}
+	for _, rt := range snap.Routes {
+		fmt.Fprintf(w, "\n%s  count=%d p50=%sms p90=%sms p99=%sms max=%sms\n",
+			rt.Route, rt.Count, formatMS(rt.P50MS), formatMS(rt.P90MS), formatMS(rt.P99MS), formatMS(rt.MaxMS))
+
+		// Merge adjacent buckets into at most maxTextRows rows.
+		per := (len(rt.BucketsLeMS) + maxTextRows - 1) / maxTextRows
+		rows := (len(rt.BucketsLeMS) + per - 1) / per
+		cells := make([][]uint64, rows)
+		var busiest uint64
+		for r := range cells {
+			cells[r] = make([]uint64, len(rt.Columns))
+			for c, col := range rt.Columns {
+				for _, count := range col.Counts[r*per : min((r+1)*per, len(col.Counts))] {
+					cells[r][c] += uint64(count)
+				}
+				busiest = max(busiest, cells[r][c])
+			}
+		}
+		for r := rows - 1; r >= 0; r-- {
+			le := rt.BucketsLeMS[min((r+1)*per, len(rt.BucketsLeMS))-1]
+			var line strings.Builder
+			for _, count := range cells[r] {
+				shade := 0
+				if count > 0 {
+					// Any request shows; the busiest cell is darkest.
+					shade = 1 + int(count*uint64(len(shades)-2)/busiest)
+				}
+				line.WriteByte(shades[shade])
+			}
+			fmt.Fprintf(w, "%10sms |%s|\n", "<="+formatMS(le), line.String())
+		}
+		first, last := rt.Columns[0].Start, rt.Columns[len(rt.Columns)-1].Start
+		fmt.Fprintf(w, "%13s%s .. %s\n", "", first.Format(time.TimeOnly), last.Format(time.TimeOnly))
+	}
+}
+
+// formatMS formats a latency in milliseconds with about 3 significant digits.
+func formatMS(ms float64) string {
+	switch {
+	case ms >= 100:
+		return fmt.Sprintf("%.0f", ms)
+	case ms >= 10:
+		return fmt.Sprintf("%.1f", ms)
+	case ms >= 1:
+		return fmt.Sprintf("%.2f", ms)
+	}
+	return fmt.Sprintf("%.3f", ms)
+}
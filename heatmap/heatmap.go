@@ -0,0 +1,132 @@
+// Package heatmap keeps per-route latency histograms in process and serves
+// them as a heatmap at GET /debug/latency, so the latency distribution can be
+// inspected without a metrics backend.
+//
+// Each route keeps a ring of histograms, one per column of the heatmap, each
+// covering the configured resolution, over the configured window. The
+// histograms are HDR-style: latencies are counted in microseconds, exactly
+// below 8µs and above that in 8 buckets per doubling, so a bucket is never
+// wider than 12.5% of its lower bound.
+package heatmap
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"app/config"
+)
+
+// subBuckets is the number of buckets per doubling of latency; subBits is its
+// base-2 logarithm.
+const (
+	subBits    = 3
+	subBuckets = 1 << subBits
+)
+
+// maxMicros is the largest latency counted; longer ones are counted as it.
+const maxMicros = 1<<32 - 1
+
+// numBuckets is the number of buckets of a histogram.
+var numBuckets = bucketIndex(maxMicros) + 1
+
+// current is the configured heatmap, or nil while it is disabled.
+var current atomic.Pointer[Heatmap]
+
+// Heatmap holds the latency histograms of the routes.
+type Heatmap struct {
+	resolution time.Duration
+	columns    int
+	// now is the clock, replaced in tests.
+	now func() time.Time
+
+	mu     sync.Mutex
+	routes map[string][]column
+}
+
+// column is a route's histogram for one period of the resolution.
+type column struct {
+	// period is the start of the period in units of the resolution since the
+	// Unix epoch; a column whose period has passed out of the window is
+	// reused.
+	period int64
+	counts []uint32
+}
+
+// Configure enables the heatmap as cfg describes, or disables it when the
+// resolution is 0. Configuring it again starts it afresh.
+func Configure(cfg config.Heatmap) {
+	if cfg.Resolution <= 0 {
+		current.Store(nil)
+		return
+	}
+	current.Store(New(cfg))
+}
+
+// New returns an empty heatmap configured by cfg, whose resolution must be
+// positive.
+func New(cfg config.Heatmap) *Heatmap {
+	return &Heatmap{
+		resolution: cfg.Resolution,
+		columns:    max(int(cfg.Window/cfg.Resolution), 1),
+		now:        time.Now,
+		routes:     make(map[string][]column),
+	}
+}
+
+// Observe adds a request's latency to the route's column of the configured
+// heatmap, if any.
+func Observe(route string, latency time.Duration) {
+	if h := current.Load(); h != nil {
+		h.Observe(route, latency)
+	}
+}
+
+// Observe adds a request's latency to the route's current column.
+func (h *Heatmap) Observe(route string, latency time.Duration) {
+	period := h.period(h.now())
+	i := bucketIndex(latency.Microseconds())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cols, ok := h.routes[route]
+	if !ok {
+		cols = make([]column, h.columns)
+		h.routes[route] = cols
+	}
+	c := &cols[int(period%int64(h.columns))]
+	if c.counts == nil {
+		c.counts = make([]uint32, numBuckets)
+	}
+	if c.period != period {
+		c.period = period
+		clear(c.counts)
+	}
+	c.counts[i]++
+}
+
+// period returns the period t falls in.
+func (h *Heatmap) period(t time.Time) int64 {
+	return t.UnixNano() / int64(h.resolution)
+}
+
+// bucketIndex returns the bucket counting a latency of us microseconds.
+func bucketIndex(us int64) int {
+	us = min(max(us, 0), maxMicros)
+	if us < subBuckets {
+		return int(us)
+	}
+	exp := bits.Len64(uint64(us)) - subBits - 1
+	return (exp+1)*subBuckets + int(us>>exp) - subBuckets
+}
+
+// bucketBounds returns the latencies, in microseconds, that bucket i counts:
+// from lower up to but excluding upper.
+func bucketBounds(i int) (lower, upper int64) {
+	if i < subBuckets {
+		return int64(i), int64(i) + 1
+	}
+	exp := i/subBuckets - 1
+	sub := int64(i%subBuckets + subBuckets)
+	return sub << exp, (sub + 1) << exp
+}
@@ -0,0 +1,144 @@
+package heatmap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"app/config"
+)
+
+func TestBuckets(t *testing.T) {
+	if numBuckets != 240 {
+		t.Errorf("numBuckets = %d, want 240", numBuckets)
+	}
+	// Every latency falls in its bucket's bounds, and the buckets are
+	// contiguous.
+	for _, us := range []int64{0, 1, 7, 8, 9, 15, 16, 17, 100, 1000, 12345, 999999, maxMicros} {
+		lower, upper := bucketBounds(bucketIndex(us))
+		if us < lower || us >= upper {
+			t.Errorf("%dµs is in bucket [%d, %d)", us, lower, upper)
+		}
+	}
+	for i := 1; i < numBuckets; i++ {
+		_, prev := bucketBounds(i - 1)
+		lower, upper := bucketBounds(i)
+		if lower != prev {
+			t.Fatalf("bucket %d starts at %d, want %d", i, lower, prev)
+		}
+		if i >= subBuckets && float64(upper-lower) > 0.125*float64(lower) {
+			t.Errorf("bucket %d [%d, %d) is wider than 12.5%%", i, lower, upper)
+		}
+	}
+	if got := bucketIndex(-5); got != 0 {
+		t.Errorf("bucketIndex(-5) = %d, want 0", got)
+	}
+	if got := bucketIndex(1 << 40); got != numBuckets-1 {
+		t.Errorf("bucketIndex(1<<40) = %d, want the last bucket", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+	h := New(config.Heatmap{Resolution: 10 * time.Second, Window: time.Minute})
+	h.now = func() time.Time { return now }
+
+	// 98 fast requests and 2 slow ones, then a minute later one more, which
+	// reuses the first column.
+	for range 98 {
+		h.Observe("/checkInventory", 3*time.Millisecond)
+	}
+	h.Observe("/checkInventory", 200*time.Millisecond)
+	now = now.Add(10 * time.Second)
+	h.Observe("/checkInventory", 200*time.Millisecond)
+	h.Observe("/orders/{id}", time.Millisecond)
+
+	snap := h.Snapshot("/checkInventory", time.Minute)
+	if len(snap.Routes) != 1 || snap.Window != "1m0s" {
+		t.Fatalf("Snapshot() = %+v, want one route over 1m0s", snap)
+	}
+	rt := snap.Routes[0]
+	if rt.Count != 100 || rt.P50MS != 3.072 || rt.P90MS != 3.072 || rt.P99MS != 212.992 || rt.MaxMS != 212.992 {
+		t.Errorf("route = count %d p50 %v p90 %v p99 %v max %v", rt.Count, rt.P50MS, rt.P90MS, rt.P99MS, rt.MaxMS)
+	}
+	if len(rt.Columns) != 6 || !rt.Columns[5].Start.Equal(now) || !rt.Columns[4].Start.Equal(now.Add(-10*time.Second)) {
+		t.Fatalf("columns = %+v", rt.Columns)
+	}
+	if first, last := rt.Columns[4].Counts, rt.Columns[5].Counts; first[0] != 98 || first[len(first)-1] != 1 || last[len(last)-1] != 1 {
+		t.Errorf("counts = %v, %v", first, last)
+	}
+	if len(rt.BucketsLeMS) != len(rt.Columns[0].Counts) {
+		t.Errorf("%d buckets, %d counts per column", len(rt.BucketsLeMS), len(rt.Columns[0].Counts))
+	}
+
+	// A minute later, the first column is reused.
+	now = now.Add(50 * time.Second)
+	h.Observe("/checkInventory", 3*time.Millisecond)
+	rt = h.Snapshot("/checkInventory", time.Minute).Routes[0]
+	if rt.Count != 2 {
+		t.Errorf("count a minute later = %d, want 2", rt.Count)
+	}
+	// A shorter window holds the last column only.
+	rt = h.Snapshot("/checkInventory", time.Second).Routes[0]
+	if rt.Count != 1 || len(rt.Columns) != 1 {
+		t.Errorf("count over 1s = %d in %d columns, want 1 in 1", rt.Count, len(rt.Columns))
+	}
+	if routes := h.Snapshot("", time.Minute).Routes; len(routes) != 2 || routes[0].Route != "/checkInventory" {
+		t.Errorf("routes = %+v", routes)
+	}
+	if routes := h.Snapshot("", time.Second).Routes; len(routes) != 1 {
+		t.Errorf("routes with requests in the last second = %+v, want one", routes)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	Configure(config.Heatmap{})
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/latency", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status while disabled = %d, want 404", w.Code)
+	}
+
+	Configure(config.Heatmap{Resolution: time.Second, Window: 30 * time.Second})
+	t.Cleanup(func() { Configure(config.Heatmap{}) })
+	for _, d := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 40 * time.Millisecond} {
+		Observe("/checkInventory", d)
+	}
+
+	w = httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/latency?route=/checkInventory", nil))
+	var snap Snapshot
+	if err := json.NewDecoder(w.Body).Decode(&snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Routes) != 1 || snap.Routes[0].Count != 3 || snap.Window != "30s" {
+		t.Errorf("GET /debug/latency = %+v", snap)
+	}
+
+	w = httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/latency?format=text&window=5s", nil))
+	text := w.Body.String()
+	if !strings.Contains(text, "/checkInventory  count=3") || !strings.Contains(text, "5s window") {
+		t.Errorf("text heatmap:\n%s", text)
+	}
+	// At most maxTextRows latency rows, each one cell per column.
+	rows := slices.DeleteFunc(strings.Split(text, "\n"), func(line string) bool { return !strings.HasSuffix(line, "|") })
+	if len(rows) == 0 || len(rows) > maxTextRows {
+		t.Fatalf("%d rows in text heatmap:\n%s", len(rows), text)
+	}
+	for _, row := range rows {
+		if cells := row[strings.Index(row, "|")+1 : len(row)-1]; len(cells) != 5 {
+			t.Errorf("row %q has %d cells, want 5", row, len(cells))
+		}
+	}
+
+	w = httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/latency?window=soon", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status for an invalid window = %d, want 400", w.Code)
+	}
+}
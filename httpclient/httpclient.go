@@ -0,0 +1,307 @@
+// Package httpclient provides an instrumented HTTP client for downstream calls.
+// Every attempt produces an otelhttp client span carrying the trace context, and
+// every request is counted and timed so outbound telemetry is consistent.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"app/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/httpclient"
+
+// DefaultTimeout bounds a single attempt.
+const DefaultTimeout = 5 * time.Second
+
+var (
+	meter = otel.Meter(instrumentationName)
+	// Counter for outbound requests, by peer, method, and outcome.
+	outboundRequestsCounter metric.Int64Counter
+	// Histogram of outbound request latency (per attempt).
+	outboundDurationHistogram metric.Float64Histogram
+	// Counter for retried attempts.
+	outboundRetriesCounter metric.Int64Counter
+)
+
+func init() {
+	var err error
+	outboundRequestsCounter, err = meter.Int64Counter(
+		"outbound_requests_total",
+		metric.WithDescription("The total number of outbound HTTP request attempts"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create outbound_requests_total counter: %v", err)
+	}
+	outboundDurationHistogram, err = meter.Float64Histogram(
+		"outbound_request_duration_ms",
+		metric.WithDescription("The latency of outbound HTTP request attempts"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create outbound_request_duration_ms histogram: %v", err)
+	}
+	outboundRetriesCounter, err = meter.Int64Counter(
+		"outbound_retries_total",
+		metric.WithDescription("The total number of retried outbound HTTP requests"),
+		metric.WithUnit("{retry}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create outbound_retries_total counter: %v", err)
+	}
+}
+
+// RetryPolicy controls whether and how failed attempts are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles for each further retry.
+	Backoff time.Duration
+	// ShouldRetry decides whether an attempt's outcome is retryable.
+	ShouldRetry func(req *http.Request, resp *http.Response, err error) bool
+	// OnRetry, if set, is called before each retry with the attempt that failed.
+	OnRetry func(ctx context.Context, attempt int, resp *http.Response, err error)
+}
+
+// DefaultRetryPolicy retries idempotent requests up to three attempts on
+// transport errors and 502/503/504 responses.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     50 * time.Millisecond,
+	ShouldRetry: RetryIdempotent,
+}
+
+// RetryIdempotent is a ShouldRetry hook that retries GET, HEAD, and OPTIONS
+// requests after transport errors or gateway-style responses. Other methods are
+// never retried so a charge is not submitted twice.
+func RetryIdempotent(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithTimeout overrides DefaultTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.http.Timeout = d }
+}
+
+// WithRetryPolicy overrides DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+// WithTransport sets the base transport wrapped by otelhttp.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) { c.base = rt }
+}
+
+// Client is an instrumented HTTP client for a single downstream peer.
+type Client struct {
+	peer  string
+	http  *http.Client
+	base  http.RoundTripper
+	retry RetryPolicy
+}
+
+// New creates a Client for the named downstream peer (e.g. "payment-service").
+// The name is recorded as peer.service on client spans and as the peer
+// attribute on outbound metrics.
+func New(peer string, opts ...Option) *Client {
+	c := &Client{
+		peer:  peer,
+		http:  &http.Client{Timeout: DefaultTimeout},
+		base:  http.DefaultTransport,
+		retry: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.http.Transport = otelhttp.NewTransport(traceResponseTransport{c.base}, tracing.HTTPOptions(
+		otelhttp.WithSpanOptions(trace.WithAttributes(semconv.PeerService(peer))),
+	)...)
+	return c
+}
+
+// Do sends the request, retrying according to the client's RetryPolicy. As with
+// http.Client, the caller must close the returned response body.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attempts := max(c.retry.MaxAttempts, 1)
+
+	var resp *http.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		resp, err = c.attempt(req)
+		if attempt >= attempts || c.retry.ShouldRetry == nil || !c.retry.ShouldRetry(req, resp, err) {
+			return resp, err
+		}
+		// A request body can only be replayed when it can be re-created.
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		if c.retry.OnRetry != nil {
+			c.retry.OnRetry(ctx, attempt, resp, err)
+		}
+		trace.SpanFromContext(ctx).AddEvent("http.retry", trace.WithAttributes(
+			semconv.PeerService(c.peer),
+			attribute.Int("http.retry.attempt", attempt),
+		))
+		outboundRetriesCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("peer", c.peer)))
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(c.retry.Backoff << (attempt - 1)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// attempt performs a single round trip and records its metrics.
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.http.Do(req)
+
+	outcome := "error"
+	if err == nil {
+		outcome = strconv.Itoa(resp.StatusCode)
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("peer", c.peer),
+		attribute.String("http.request.method", req.Method),
+		attribute.String("outcome", outcome),
+	)
+	outboundRequestsCounter.Add(req.Context(), 1, attrs)
+	outboundDurationHistogram.Record(req.Context(), float64(time.Since(start).Milliseconds()), attrs)
+	return resp, err
+}
+
+// traceResponseTransport runs inside otelhttp and reads the traceresponse of
+// each response. When the server recorded the request in a trace other than
+// the client span's, because it restarted the trace, the client span is
+// linked to the server's span.
+type traceResponseTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t traceResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	ctx := tracing.ResponsePropagator().Extract(req.Context(), propagation.HeaderCarrier(resp.Header))
+	if child, ok := tracing.TraceResponseFromContext(ctx); ok {
+		span := trace.SpanFromContext(ctx)
+		if child.TraceID() != span.SpanContext().TraceID() {
+			span.AddLink(trace.Link{SpanContext: child})
+		}
+	}
+	return resp, nil
+}
+
+// HandlerTransport is a RoundTripper that serves requests with an in-process
+// handler. It lets simulated downstream APIs be called through a Client, with
+// real client spans and propagated context, without a network hop.
+type HandlerTransport struct {
+	Handler http.Handler
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t HandlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := &responseWriter{header: make(http.Header)}
+	t.Handler.ServeHTTP(w, req)
+	return w.response(req), nil
+}
+
+// responseWriter buffers a handler's response for HandlerTransport. As with a
+// server, the header is sent as it was when the status was written, and a
+// missing Content-Type is sniffed from the body.
+type responseWriter struct {
+	header http.Header
+	sent   http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header implements http.ResponseWriter.
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	w.sent = w.header.Clone()
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		if w.header.Get("Content-Type") == "" && len(p) > 0 {
+			w.header.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(p)
+}
+
+// response returns the buffered response to req.
+func (w *responseWriter) response(req *http.Request) *http.Response {
+	w.WriteHeader(http.StatusOK)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.sent,
+		Body:          io.NopCloser(bytes.NewReader(w.body.Bytes())),
+		ContentLength: int64(w.body.Len()),
+		Request:       req,
+	}
+}
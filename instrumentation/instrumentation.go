@@ -0,0 +1,40 @@
+// Package instrumentation switches telemetry off for a share of requests, so
+// a load test can compare instrumented and uninstrumented requests served by
+// the same process at the same time. A request whose context is marked with
+// Disable starts no recording spans, records no metrics, and writes no logs:
+// the tracer and meter providers installed by tracing.InitTracer and the
+// loggers check the mark. The share is a runtime switch, set from the
+// configuration and the admin API.
+package instrumentation
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type disabledKey struct{}
+
+// Disable returns a copy of ctx in which telemetry is switched off.
+func Disable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, disabledKey{}, true)
+}
+
+// Disabled reports whether telemetry is switched off in ctx.
+func Disabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(disabledKey{}).(bool)
+	return disabled
+}
+
+// noopPercent is the share of requests served without telemetry.
+var noopPercent atomic.Int32
+
+// SetNoopPercent sets the percentage (0-100) of requests served without
+// telemetry.
+func SetNoopPercent(percent int) {
+	noopPercent.Store(int32(min(max(percent, 0), 100)))
+}
+
+// NoopPercent returns the percentage of requests served without telemetry.
+func NoopPercent() int {
+	return int(noopPercent.Load())
+}
@@ -0,0 +1,516 @@
+//go:build integration
+
+// Package integration boots the service in-process with the "memory"
+// telemetry exporter, drives real HTTP requests through its routes and
+// middleware, and asserts on the traces, metrics, and logs it exports. It is
+// built only with the integration tag:
+//
+//	go test -tags integration ./integration/
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"app/catalog"
+	"app/chaos"
+	"app/config"
+	"app/featureflags"
+	"app/handlers"
+	"app/heatmap"
+	"app/instrumentation"
+	"app/logging"
+	"app/middleware"
+	"app/recording"
+	"app/routes"
+	"app/store"
+	"app/tracing"
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// server is the booted service.
+	server *httptest.Server
+	// logFile is the service's JSON log.
+	logFile string
+	// recordingDir is where the service writes request recordings.
+	recordingDir string
+	// paymentStatus is the status the stub payment service answers with.
+	paymentStatus atomic.Int32
+	// paymentTrace is the trace ID propagated on the last payment call.
+	paymentTrace atomic.Value
+)
+
+// paymentTraceResponse is the traceresponse of the stub payment service, which
+// restarts every trace.
+const paymentTraceResponse = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "integration")
+	if err != nil {
+		log.Fatal(err)
+	}
+	logFile = filepath.Join(dir, "app.log")
+	recordingDir = filepath.Join(dir, "recordings")
+
+	payments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header)))
+		paymentTrace.Store(sc.TraceID())
+		w.Header().Set("traceresponse", paymentTraceResponse)
+		w.WriteHeader(int(paymentStatus.Load()))
+	}))
+	shutdown := boot(payments.URL)
+
+	code := m.Run()
+
+	server.Close()
+	payments.Close()
+	shutdown(context.Background())
+	_ = logging.JSONLogger.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// boot starts the service the way main does, minus the listeners, signals,
+// and background jobs: the configuration is loaded from the environment,
+// telemetry is kept in memory, the caches are warmed, and the public routes
+// are served, with payments going to paymentURL. It returns the telemetry
+// shutdown function.
+func boot(paymentURL string) func(context.Context) {
+	os.Setenv("TELEMETRY_EXPORTER", config.ExporterMemory)
+	os.Setenv("APP_LOG_FILE", logFile)
+	os.Setenv("PAYMENT_SERVICE_URL", paymentURL)
+	os.Setenv("RECORDING_DIR", recordingDir)
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	logging.JSONLogger.SetFile(cfg.Logging.File)
+	handlers.Configure(cfg.Downstream)
+	recording.Configure(cfg.Recording)
+	heatmap.Configure(cfg.Heatmap)
+	if err := featureflags.Configure(cfg.FeatureFlags.File, cfg.FeatureFlags.Overrides); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if err := chaos.Configure(cfg.Chaos.Scenario, cfg.Chaos.Overrides); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	shutdown := tracing.InitTracer(cfg.Service, cfg.Telemetry)
+	if err := catalog.Warm(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	limiter := middleware.NewRateLimiterFromConfig(cfg.RateLimit)
+	server = httptest.NewServer(routes.SetupRoutes(cfg, limiter))
+	return shutdown
+}
+
+// attach records the telemetry exported from now on, and sets chaos knobs with
+// no random failures and a fraction of the usual latency, changed by change.
+// The baseline knobs are restored after the test.
+func attach(t *testing.T, change func(*chaos.Knobs)) *tracetest.Recorder {
+	t.Helper()
+	k := chaos.Knobs{Scenario: "test", DBLatencyFactor: 1, LatencyFactor: 0.01}
+	if change != nil {
+		change(&k)
+	}
+	chaos.Set(k)
+	t.Cleanup(func() { _ = chaos.Configure(chaos.BaselineScenario, chaos.Overrides{}) })
+	paymentStatus.Store(http.StatusOK)
+	spans, metrics := tracing.Memory()
+	return tracetest.Attach(t, spans, metrics)
+}
+
+// createOrder posts an order to the service.
+func createOrder(t *testing.T) *http.Response {
+	t.Helper()
+	resp, err := http.Post(server.URL+"/createOrder", "application/json", strings.NewReader(`{"customer_id":"cust-042"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// logEntry is a line of the service's JSON log.
+type logEntry struct {
+	Level      string         `json:"level"`
+	Message    string         `json:"message"`
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// assertLogged fails the test unless the JSON log has an entry with the
+// message, correlated with span.
+func assertLogged(t *testing.T, span sdktrace.ReadOnlySpan, level, message string) {
+	t.Helper()
+	f, err := os.Open(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	traceID, spanID := span.SpanContext().TraceID().String(), span.SpanContext().SpanID().String()
+	var inTrace []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e logEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.TraceID != traceID {
+			continue
+		}
+		if e.Message == message && e.Level == level && e.SpanID == spanID {
+			return
+		}
+		inTrace = append(inTrace, e.Level+" "+e.Message+" (span "+e.SpanID+")")
+	}
+	t.Errorf("no %s %q log entry for span %q (%s) in trace %s; the trace logged %q", level, message, span.Name(), spanID, traceID, inTrace)
+}
+
+// children returns the spans of the trace whose parent is parent.
+func children(rec *tracetest.Recorder, parent sdktrace.ReadOnlySpan) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, s := range rec.Trace(parent.SpanContext().TraceID()) {
+		if s.Parent().SpanID() == parent.SpanContext().SpanID() {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestCreateOrderSuccess(t *testing.T) {
+	rec := attach(t, nil)
+	route := []attribute.KeyValue{attribute.String("http.route", "/createOrder"), attribute.Int("http.response.status_code", http.StatusOK)}
+	metrics := tracetest.StartMetrics(t)
+
+	resp := createOrder(t)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var body handlers.OrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	order, ok := store.DefaultStore.Get(body.OrderID)
+	if !ok {
+		t.Fatalf("order %d was not stored", body.OrderID)
+	}
+	traceID, err := trace.TraceIDFromHex(order.TraceID)
+	if err != nil {
+		t.Fatalf("order trace ID %q: %v", order.TraceID, err)
+	}
+
+	// otelhttp root → inventory, database, and payment steps → payment call.
+	root := rec.Await(t, traceID, "POST /createOrder")
+	if root.Parent().IsValid() {
+		t.Errorf("server span has parent %s, want a root span", root.Parent().SpanID())
+	}
+	if root.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span kind = %s, want server", root.SpanKind())
+	}
+	// The response hands the server span's context back to the client.
+	want := "00-" + traceID.String() + "-" + root.SpanContext().SpanID().String() + "-01"
+	if got := resp.Header.Get("traceresponse"); got != want {
+		t.Errorf("traceresponse = %q, want %q", got, want)
+	}
+	if got, want := resp.Header.Get("Server-Timing"), `traceparent;desc="`+want+`"`; got != want {
+		t.Errorf("Server-Timing = %q, want %q", got, want)
+	}
+	tracetest.AssertStatus(t, root, codes.Ok)
+	tracetest.AssertAttributes(t, root,
+		attribute.String("http.route", "/createOrder"),
+		attribute.Int("http.status_code", http.StatusOK),
+		attribute.Int("order.id", body.OrderID),
+	)
+	steps := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range children(rec, root) {
+		steps[s.Name()] = s
+	}
+	for _, name := range []string{"inventory.check", "db.insert_order", "payment.process"} {
+		span, ok := steps[name]
+		if !ok {
+			t.Fatalf("no %q span under the server span", name)
+		}
+		tracetest.AssertStatus(t, span, codes.Ok)
+	}
+	if !steps["inventory.check"].EndTime().Before(steps["db.insert_order"].StartTime()) ||
+		!steps["db.insert_order"].EndTime().Before(steps["payment.process"].StartTime()) {
+		t.Error("workflow steps did not run in order: inventory, database, payment")
+	}
+	var call sdktrace.ReadOnlySpan
+	for _, s := range children(rec, steps["payment.process"]) {
+		if s.SpanKind() == trace.SpanKindClient {
+			call = s
+		}
+	}
+	if call == nil {
+		t.Fatal("no client span for the payment call under payment.process")
+	}
+	if got, _ := paymentTrace.Load().(trace.TraceID); got != traceID {
+		t.Errorf("payment service received trace %s, want %s", got, traceID)
+	}
+	// The payment service's restarted trace is linked from the client span.
+	if links := call.Links(); len(links) != 1 || links[0].SpanContext.TraceID().String() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("payment call links = %v, want one to the trace in %s", links, paymentTraceResponse)
+	}
+
+	metrics.AssertCounter(t, "orders_processed_total", 1, attribute.String("status", "success"))
+	metrics.AssertHistogramCount(t, "http.server.request.duration", 1, route...)
+	// With the chaos latency cut, the whole request takes well under a second.
+	metrics.AssertHistogramBucket(t, "http.server.request.duration", 1, 1, route...)
+
+	assertLogged(t, root, "INFO", "Order created successfully")
+	assertLogged(t, root, "INFO", "POST /createOrder 200")
+}
+
+func TestCreateOrderFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		knobs       func(*chaos.Knobs)
+		paymentCode int
+		wantCode    int
+		failedSpan  string
+		skipped     []string
+		logMessage  string
+	}{
+		{
+			name:       "out of stock",
+			knobs:      func(k *chaos.Knobs) { k.OutOfStockRate = 1 },
+			wantCode:   http.StatusConflict,
+			failedSpan: "inventory.check",
+			skipped:    []string{"db.insert_order", "payment.process"},
+			logMessage: "inventory check failed",
+		},
+		{
+			name:       "database",
+			knobs:      func(k *chaos.Knobs) { k.DBFailureRate = 1 },
+			wantCode:   http.StatusInternalServerError,
+			failedSpan: "db.insert_order",
+			skipped:    []string{"payment.process"},
+			logMessage: "database operation failed",
+		},
+		{
+			name:        "payment",
+			paymentCode: http.StatusBadGateway,
+			wantCode:    http.StatusInternalServerError,
+			failedSpan:  "payment.process",
+			logMessage:  "payment processing failed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := attach(t, tt.knobs)
+			if tt.paymentCode != 0 {
+				paymentStatus.Store(int32(tt.paymentCode))
+			}
+			metrics := tracetest.StartMetrics(t)
+
+			resp := createOrder(t)
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			var problem struct {
+				TraceID string `json:"trace_id"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			traceID, err := trace.TraceIDFromHex(problem.TraceID)
+			if err != nil {
+				t.Fatalf("problem trace_id %q: %v", problem.TraceID, err)
+			}
+
+			root := rec.Await(t, traceID, "POST /createOrder")
+			tracetest.AssertStatus(t, root, codes.Error)
+			tracetest.AssertAttributes(t, root, attribute.Int("http.status_code", tt.wantCode))
+			var failed sdktrace.ReadOnlySpan
+			for _, s := range children(rec, root) {
+				for _, name := range tt.skipped {
+					if s.Name() == name {
+						t.Errorf("%q span recorded after the %s step failed", name, tt.failedSpan)
+					}
+				}
+				if s.Name() == tt.failedSpan {
+					failed = s
+				}
+			}
+			if failed == nil {
+				t.Fatalf("no %q span under the server span", tt.failedSpan)
+			}
+			tracetest.AssertError(t, failed)
+
+			metrics.AssertCounter(t, "orders_processed_total", 1, attribute.String("status", "failure"))
+			metrics.AssertHistogramCount(t, "http.server.request.duration", 1,
+				attribute.String("http.route", "/createOrder"),
+				attribute.Int("http.response.status_code", tt.wantCode),
+			)
+			logSpan := failed
+			if tt.failedSpan == "inventory.check" {
+				// Inventory failures are logged on the request span.
+				logSpan = root
+			}
+			assertLogged(t, logSpan, "ERROR", tt.logMessage)
+		})
+	}
+}
+
+func TestInstrumentationAB(t *testing.T) {
+	rec := attach(t, nil)
+	t.Cleanup(func() { instrumentation.SetNoopPercent(0) })
+	metrics := tracetest.StartMetrics(t)
+	post := func(requestID string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/createOrder", strings.NewReader(`{"customer_id":"cust-042"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.RequestIDHeader, requestID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+		return resp
+	}
+
+	// A request in the no-op arm records nothing, and says so.
+	instrumentation.SetNoopPercent(100)
+	off := post("ab-off")
+	if got := off.Header.Get(middleware.InstrumentationHeader); got != "off" {
+		t.Errorf("%s = %q, want off", middleware.InstrumentationHeader, got)
+	}
+	if got := off.Header.Get("traceresponse"); got != "" {
+		t.Errorf("uninstrumented request has traceresponse %q", got)
+	}
+
+	// The arm is chosen by request ID, so a repeated ID gets the same one.
+	instrumentation.SetNoopPercent(50)
+	arms := map[string]string{}
+	instrumented := 0
+	for i := range 20 {
+		id := fmt.Sprintf("ab-%d", i%5)
+		arm := post(id).Header.Get(middleware.InstrumentationHeader)
+		if prev, ok := arms[id]; ok && prev != arm {
+			t.Errorf("request ID %s served by %s, then by %s", id, prev, arm)
+		}
+		arms[id] = arm
+		if arm == "on" {
+			instrumented++
+		}
+	}
+
+	// With the switch off, requests are instrumented and untagged.
+	instrumentation.SetNoopPercent(0)
+	on := post("ab-on")
+	instrumented++
+	if got := on.Header.Get(middleware.InstrumentationHeader); got != "" {
+		t.Errorf("%s = %q with the switch off, want none", middleware.InstrumentationHeader, got)
+	}
+	sc, ok := tracing.TraceResponseFromContext(tracing.TraceResponse{}.Extract(context.Background(), propagation.HeaderCarrier(on.Header)))
+	if !ok {
+		t.Fatal("instrumented request has no traceresponse")
+	}
+	rec.Await(t, sc.TraceID(), "POST /createOrder")
+
+	if got := len(rec.Named("POST /createOrder")); got != instrumented {
+		t.Errorf("%d server spans, want %d, one per instrumented request", got, instrumented)
+	}
+	metrics.AssertCounter(t, "orders_processed_total", int64(instrumented), attribute.String("status", "success"))
+	metrics.AssertHistogramCount(t, "http.server.request.duration", uint64(instrumented), attribute.String("http.route", "/createOrder"))
+}
+
+func TestRequestRecording(t *testing.T) {
+	rec := attach(t, nil)
+	if _, err := recording.Start("test.jsonl", 2); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recording.Stop() })
+	post := func() *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/createOrder?source=test", strings.NewReader(`{"customer_id":"cust-042"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+		return resp
+	}
+
+	// The handler still reads the recorded body.
+	first := post()
+	post()
+	post()
+	if state := recording.Current(); state.Enabled || state.Recorded != 2 {
+		t.Errorf("state after the limit = %+v, want stopped after 2 requests", state)
+	}
+
+	reqs, err := recording.ReadFile(filepath.Join(recordingDir, "test.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("recorded %d requests, want 2", len(reqs))
+	}
+	got := reqs[0]
+	if got.Method != http.MethodPost || got.Target != "/createOrder?source=test" || got.Body != `{"customer_id":"cust-042"}` {
+		t.Errorf("recorded %+v", got)
+	}
+	for _, name := range []string{"Cookie", "Authorization", "Traceparent"} {
+		if v := got.Header.Get(name); v != "" {
+			t.Errorf("recorded %s: %q", name, v)
+		}
+	}
+	if got.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type not recorded: %v", got.Header)
+	}
+	sc, ok := tracing.TraceResponseFromContext(tracing.TraceResponse{}.Extract(context.Background(), propagation.HeaderCarrier(first.Header)))
+	if !ok {
+		t.Fatal("no traceresponse")
+	}
+	if got.TraceID != sc.TraceID().String() {
+		t.Errorf("recorded trace ID %s, want the request's %s", got.TraceID, sc.TraceID())
+	}
+	tracetest.AssertAttributes(t, rec.Await(t, sc.TraceID(), "POST /createOrder"), attribute.Bool("recording.captured", true))
+}
+
+func TestLatencyHeatmap(t *testing.T) {
+	attach(t, nil)
+	createOrder(t)
+
+	w := httptest.NewRecorder()
+	heatmap.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/latency?route=/createOrder", nil))
+	var snap heatmap.Snapshot
+	if err := json.NewDecoder(w.Body).Decode(&snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Routes) != 1 || snap.Routes[0].Count == 0 {
+		t.Fatalf("GET /debug/latency = %+v, want /createOrder timed", snap)
+	}
+}
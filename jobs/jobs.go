@@ -0,0 +1,243 @@
+// Package jobs runs the service's periodic background tasks, such as stock
+// replenishment and synthetic dependency probes. Jobs register with a name,
+// an interval, and a handler; the Manager runs each one on its own schedule,
+// traces every run as a "job.run" root span, records run counts, durations,
+// and the time and outcome of the last run as metrics, and stops them cleanly
+// on shutdown.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"app/background"
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/jobs"
+
+// Job is a periodic task.
+type Job struct {
+	// Name identifies the job in telemetry; it must be unique.
+	Name string
+	// Interval is the time between the end of one run and the start of the
+	// next. Jobs with no interval are not run.
+	Interval time.Duration
+	// RunAtStart runs the job once as soon as the manager starts, instead of
+	// after the first interval.
+	RunAtStart bool
+	// Run runs the job. Its context is canceled when the manager stops.
+	Run func(ctx context.Context) error
+}
+
+// lastRun is the time and outcome of a job's most recent run.
+type lastRun struct {
+	at     time.Time
+	failed bool
+}
+
+// Manager runs the registered jobs.
+type Manager struct {
+	mu      sync.Mutex
+	jobs    []Job
+	last    map[string]lastRun
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+
+	runCounter  metric.Int64Counter
+	runDuration metric.Float64Histogram
+}
+
+// NewManager returns a manager with no jobs.
+func NewManager() *Manager {
+	m := &Manager{last: make(map[string]lastRun)}
+	meter := otel.Meter(instrumentationName)
+
+	var err error
+	m.runCounter, err = meter.Int64Counter(
+		"job_runs_total",
+		metric.WithDescription("The total number of background job runs, by job and outcome"),
+		metric.WithUnit("{run}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create job_runs_total counter: %v", err)
+	}
+	m.runDuration, err = meter.Float64Histogram(
+		"job_duration_ms",
+		metric.WithDescription("The duration of background job runs"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create job_duration_ms histogram: %v", err)
+	}
+	lastRunTime, err := meter.Float64ObservableGauge(
+		"job_last_run_timestamp",
+		metric.WithDescription("The Unix time at which each background job last finished"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create job_last_run_timestamp gauge: %v", err)
+	}
+	lastRunFailed, err := meter.Int64ObservableGauge(
+		"job_last_run_failed",
+		metric.WithDescription("Whether each background job's last run failed (1) or succeeded (0)"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create job_last_run_failed gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for name, last := range m.last {
+			attrs := metric.WithAttributes(attribute.String("job.name", name))
+			failed := int64(0)
+			if last.failed {
+				failed = 1
+			}
+			o.ObserveFloat64(lastRunTime, float64(last.at.UnixMilli())/1000, attrs)
+			o.ObserveInt64(lastRunFailed, failed, attrs)
+		}
+		return nil
+	}, lastRunTime, lastRunFailed)
+	if err != nil {
+		log.Fatalf("failed to register job gauges: %v", err)
+	}
+	return m
+}
+
+// Register adds a job. It must be called before Start.
+func (m *Manager) Register(j Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.started:
+		return fmt.Errorf("job %q: manager already started", j.Name)
+	case j.Name == "" || j.Run == nil:
+		return errors.New("job must have a name and a handler")
+	}
+	for _, existing := range m.jobs {
+		if existing.Name == j.Name {
+			return fmt.Errorf("job %q is already registered", j.Name)
+		}
+	}
+	m.jobs = append(m.jobs, j)
+	return nil
+}
+
+// Start runs each job with an interval in its own goroutine until Stop.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return
+	}
+	m.started = true
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	for _, j := range m.jobs {
+		if j.Interval <= 0 {
+			log.Printf("Job %q is disabled", j.Name)
+			continue
+		}
+		m.wg.Add(1)
+		background.Go(ctx, "job."+j.Name, func() {
+			defer m.wg.Done()
+			m.loop(ctx, j)
+		})
+	}
+}
+
+// Stop cancels the running jobs and waits for them to return, until ctx is
+// done.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	cancel := m.cancel
+	m.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stopping jobs: %w", ctx.Err())
+	}
+}
+
+// loop runs j every interval until ctx is done.
+func (m *Manager) loop(ctx context.Context, j Job) {
+	if j.RunAtStart {
+		m.run(ctx, j)
+	}
+	timer := time.NewTimer(j.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			m.run(ctx, j)
+			timer.Reset(j.Interval)
+		}
+	}
+}
+
+// run runs j once inside a "job.run" root span and records its outcome.
+func (m *Manager) run(ctx context.Context, j Job) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "job.run",
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("job.name", j.Name)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := j.Run(ctx)
+	elapsed := time.Since(start)
+
+	outcome := "ok"
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Interrupted by Stop; not a job failure.
+		outcome = "canceled"
+	case err != nil:
+		outcome = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "job failed")
+		logging.JSONLogger.Error(ctx, "Background job failed",
+			attribute.String("job.name", j.Name),
+			attribute.String("error.reason", err.Error()),
+		)
+	default:
+		span.SetStatus(codes.Ok, "job succeeded")
+	}
+	span.SetAttributes(attribute.String("job.outcome", outcome))
+
+	attrs := []attribute.KeyValue{attribute.String("job.name", j.Name)}
+	m.runCounter.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("outcome", outcome))...))
+	m.runDuration.Record(ctx, float64(elapsed.Microseconds())/1000, metric.WithAttributes(attrs...))
+	if outcome == "canceled" {
+		return
+	}
+	m.mu.Lock()
+	m.last[j.Name] = lastRun{at: time.Now(), failed: err != nil}
+	m.mu.Unlock()
+}
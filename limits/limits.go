@@ -0,0 +1,265 @@
+// Package limits fits the Go runtime to the container it runs in. The CPU
+// quota and memory limit are read from the cgroup (v2, or v1 on older hosts);
+// GOMAXPROCS is lowered to the CPU quota, so the scheduler does not run more
+// threads than the container may use and get throttled, and the soft memory
+// limit (GOMEMLIMIT) is set to a share of the memory limit, so the garbage
+// collector works harder before the container is OOM-killed. The GOMAXPROCS
+// and GOMEMLIMIT environment variables, when set, take precedence.
+//
+// The limits and the effective settings are exported as gauges and resource
+// attributes, so saturation is judged against what the process may really
+// use rather than the host's size.
+package limits
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "app/limits"
+
+// cgroupRoot is where the cgroup filesystem is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// Info describes the detected limits and the runtime settings in effect.
+type Info struct {
+	// Source is where the limits were read from: "cgroup v2", "cgroup v1",
+	// or "none".
+	Source string
+	// CPULimit is the CPU quota in cores, or 0 if unlimited.
+	CPULimit float64
+	// MemoryLimit is the memory limit in bytes, or 0 if unlimited.
+	MemoryLimit int64
+	// MaxProcs is GOMAXPROCS, and MemLimit the soft memory limit in bytes
+	// (math.MaxInt64 when unset).
+	MaxProcs int
+	MemLimit int64
+}
+
+var (
+	mu       sync.RWMutex
+	detected = Info{Source: "none"}
+)
+
+func init() {
+	meter := otel.Meter(instrumentationName)
+	procs, err := meter.Int64ObservableGauge(
+		"go.processor.limit",
+		metric.WithDescription("The number of OS threads that can execute Go code at once (GOMAXPROCS)"),
+		metric.WithUnit("{thread}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create go.processor.limit gauge: %v", err)
+	}
+	memLimit, err := meter.Int64ObservableGauge(
+		"go.memory.limit",
+		metric.WithDescription("The Go runtime's soft memory limit (GOMEMLIMIT); not reported when unset"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create go.memory.limit gauge: %v", err)
+	}
+	cpuLimit, err := meter.Float64ObservableGauge(
+		"container.cpu.limit",
+		metric.WithDescription("The container's CPU quota in cores; not reported when unlimited"),
+		metric.WithUnit("{cpu}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create container.cpu.limit gauge: %v", err)
+	}
+	containerMem, err := meter.Int64ObservableGauge(
+		"container.memory.limit",
+		metric.WithDescription("The container's memory limit; not reported when unlimited"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create container.memory.limit gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		info := Get()
+		o.ObserveInt64(procs, int64(info.MaxProcs))
+		if info.MemLimit != math.MaxInt64 {
+			o.ObserveInt64(memLimit, info.MemLimit)
+		}
+		if info.CPULimit > 0 {
+			o.ObserveFloat64(cpuLimit, info.CPULimit)
+		}
+		if info.MemoryLimit > 0 {
+			o.ObserveInt64(containerMem, info.MemoryLimit)
+		}
+		return nil
+	}, procs, memLimit, cpuLimit, containerMem)
+	if err != nil {
+		log.Fatalf("failed to register runtime limit gauges: %v", err)
+	}
+}
+
+// Apply detects the container's limits and, when cfg.AutoTune is set, sets
+// GOMAXPROCS to the CPU quota (rounded down, at least 1) and the soft memory
+// limit to cfg.MemoryLimitRatio of the memory limit, unless the GOMAXPROCS or
+// GOMEMLIMIT environment variables are set. It returns the result, which Get
+// also reports.
+func Apply(cfg config.Runtime) Info {
+	info := detect()
+	if cfg.AutoTune {
+		if _, set := os.LookupEnv("GOMAXPROCS"); !set && info.CPULimit > 0 {
+			procs := max(1, int(math.Floor(info.CPULimit)))
+			if procs < runtime.GOMAXPROCS(0) {
+				runtime.GOMAXPROCS(procs)
+			}
+		}
+		if _, set := os.LookupEnv("GOMEMLIMIT"); !set && info.MemoryLimit > 0 {
+			debug.SetMemoryLimit(int64(float64(info.MemoryLimit) * cfg.MemoryLimitRatio))
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	detected = info
+	return current()
+}
+
+// Get returns the detected limits and the current runtime settings.
+func Get() Info {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current()
+}
+
+// current fills in the runtime settings. The caller holds mu.
+func current() Info {
+	info := detected
+	info.MaxProcs = runtime.GOMAXPROCS(0)
+	info.MemLimit = debug.SetMemoryLimit(-1)
+	return info
+}
+
+// String summarizes the limits for the startup log.
+func (i Info) String() string {
+	cpu, mem, memLimit := "unlimited", "unlimited", "unset"
+	if i.CPULimit > 0 {
+		cpu = strconv.FormatFloat(i.CPULimit, 'f', -1, 64) + " cores"
+	}
+	if i.MemoryLimit > 0 {
+		mem = fmt.Sprintf("%d MiB", i.MemoryLimit>>20)
+	}
+	if i.MemLimit != math.MaxInt64 {
+		memLimit = fmt.Sprintf("%d MiB", i.MemLimit>>20)
+	}
+	return fmt.Sprintf("CPU %s, memory %s (%s); GOMAXPROCS=%d, GOMEMLIMIT %s", cpu, mem, i.Source, i.MaxProcs, memLimit)
+}
+
+// Attributes returns the limits and settings as resource attributes.
+func (i Info) Attributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("go.limits.source", i.Source),
+		attribute.Int("go.max_procs", i.MaxProcs),
+	}
+	if i.MemLimit != math.MaxInt64 {
+		attrs = append(attrs, attribute.Int64("go.memory_limit", i.MemLimit))
+	}
+	if i.CPULimit > 0 {
+		attrs = append(attrs, attribute.Float64("container.cpu.limit", i.CPULimit))
+	}
+	if i.MemoryLimit > 0 {
+		attrs = append(attrs, attribute.Int64("container.memory.limit", i.MemoryLimit))
+	}
+	return attrs
+}
+
+// detect reads the CPU quota and memory limit of the process's cgroup.
+func detect() Info {
+	if dir, ok := cgroupV2Dir(); ok {
+		info := Info{Source: "cgroup v2"}
+		// cpu.max is "<quota> <period>" in microseconds, or "max <period>".
+		if fields := strings.Fields(readFile(filepath.Join(dir, "cpu.max"))); len(fields) == 2 {
+			info.CPULimit = quota(fields[0], fields[1])
+		}
+		info.MemoryLimit = bytes(readFile(filepath.Join(dir, "memory.max")))
+		return info
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cpu")); err == nil {
+		info := Info{Source: "cgroup v1"}
+		info.CPULimit = quota(
+			readFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us")),
+			readFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us")),
+		)
+		info.MemoryLimit = bytes(readFile(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes")))
+		return info
+	}
+	return Info{Source: "none"}
+}
+
+// cgroupV2Dir returns the directory of the process's cgroup v2 group, from
+// its "0::<path>" entry in /proc/self/cgroup. Inside a container with its own
+// cgroup namespace the path is "/", the mount root.
+func cgroupV2Dir() (string, bool) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", false
+	}
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return cgroupRoot, true
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			dir := filepath.Join(cgroupRoot, path)
+			if _, err := os.Stat(filepath.Join(dir, "cpu.max")); err == nil {
+				return dir, true
+			}
+		}
+	}
+	return cgroupRoot, true
+}
+
+// quota converts a CFS quota and period to cores; a missing, "max", or
+// negative quota is unlimited (0).
+func quota(q, period string) float64 {
+	qv, err := strconv.ParseFloat(q, 64)
+	if err != nil || qv <= 0 {
+		return 0
+	}
+	pv, err := strconv.ParseFloat(period, 64)
+	if err != nil || pv <= 0 {
+		return 0
+	}
+	return qv / pv
+}
+
+// bytes parses a memory limit; "max", or a value so large that it stands for
+// no limit (cgroup v1 reports one near MaxInt64), is unlimited (0).
+func bytes(s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n >= math.MaxInt64/2 {
+		return 0
+	}
+	return n
+}
+
+// readFile returns the trimmed content of a cgroup file, or "" if it cannot be
+// read.
+func readFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
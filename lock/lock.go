@@ -0,0 +1,265 @@
+// Package lock provides named locks whose contention shows up in telemetry.
+//
+// A lock is held per key, in-process or, when a Redis URL is configured, in
+// Redis so that every replica contends for it. Acquiring runs inside a
+// "lock.acquire" span that records how long the caller waited and whether it
+// had to, and releasing inside a "lock.release" span that records how long the
+// lock was held. The wait and hold times are recorded in the
+// lock_wait_duration_ms and lock_hold_duration_ms histograms, and the callers
+// waiting for and holding each lock in the lock_waiters and lock_holders
+// gauges. If Redis fails, the lock falls back to the in-process one, as the
+// rate limiter does.
+package lock
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/lock"
+
+// Backends, as reported in the lock.backend attribute.
+const (
+	backendMemory = "memory"
+	backendRedis  = "redis"
+)
+
+// releaseTimeout bounds releasing a lock, which outlives the caller's context
+// so a canceled request does not leave the lock held until it expires.
+const releaseTimeout = time.Second
+
+// ErrTimeout is returned by Acquire when the lock is not acquired within the
+// configured timeout.
+var ErrTimeout = errors.New("timed out waiting for lock")
+
+// Lock is a named set of locks, one per key.
+type Lock struct {
+	name    string
+	timeout time.Duration
+	local   *localLocks
+	// redis is nil unless the lock is held in Redis.
+	redis *redisLocks
+
+	waitTime metric.Float64Histogram
+	holdTime metric.Float64Histogram
+	waiters  metric.Int64UpDownCounter
+	holders  metric.Int64UpDownCounter
+}
+
+// Lease is a held lock.
+type Lease struct {
+	lock     *Lock
+	key      string
+	backend  string
+	acquired time.Time
+	release  func(context.Context) error
+	released atomic.Bool
+}
+
+// New returns the lock named name, configured by cfg. It fails if the Redis
+// URL is invalid.
+func New(name string, cfg config.InventoryLock) (*Lock, error) {
+	l := &Lock{name: name, timeout: cfg.Timeout, local: &localLocks{keys: make(map[string]chan struct{})}}
+	if cfg.RedisURL != "" {
+		r, err := newRedisLocks(cfg.RedisURL, cfg.TTL)
+		if err != nil {
+			return nil, err
+		}
+		l.redis = r
+	}
+
+	meter := otel.Meter(instrumentationName)
+	var err error
+	l.waitTime, err = meter.Float64Histogram(
+		"lock_wait_duration_ms",
+		metric.WithDescription("The time spent waiting to acquire a lock"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create lock_wait_duration_ms histogram: %v", err)
+	}
+	l.holdTime, err = meter.Float64Histogram(
+		"lock_hold_duration_ms",
+		metric.WithDescription("The time a lock was held before it was released"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create lock_hold_duration_ms histogram: %v", err)
+	}
+	l.waiters, err = meter.Int64UpDownCounter(
+		"lock_waiters",
+		metric.WithDescription("The number of callers waiting to acquire a lock"),
+		metric.WithUnit("{caller}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create lock_waiters gauge: %v", err)
+	}
+	l.holders, err = meter.Int64UpDownCounter(
+		"lock_holders",
+		metric.WithDescription("The number of callers holding a lock"),
+		metric.WithUnit("{caller}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create lock_holders gauge: %v", err)
+	}
+	return l, nil
+}
+
+// Acquire waits for the lock on key inside a "lock.acquire" span, for at most
+// the configured timeout. It returns ErrTimeout if the wait runs out, and
+// ctx's error if ctx is done first. The caller must release the lease.
+func (l *Lock) Acquire(ctx context.Context, key string) (*Lease, error) {
+	backend := backendMemory
+	if l.redis != nil && l.redis.available(time.Now()) {
+		backend = backendRedis
+	}
+	opts := []trace.SpanStartOption{trace.WithAttributes(
+		attribute.String("lock.name", l.name),
+		attribute.String("lock.key", key),
+	)}
+	if backend == backendRedis {
+		opts = append(opts,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemRedis, semconv.ServerAddress(l.redis.addr)),
+		)
+	}
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "lock.acquire", opts...)
+	defer span.End()
+
+	waiting := metric.WithAttributes(attribute.String("lock.name", l.name))
+	l.waiters.Add(ctx, 1, waiting)
+	defer l.waiters.Add(ctx, -1, waiting)
+
+	waitCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	start := time.Now()
+	var (
+		release   func(context.Context) error
+		contended bool
+		err       error
+	)
+	if backend == backendRedis {
+		release, contended, err = l.redis.acquire(waitCtx, l.name+":"+key)
+		if err != nil && waitCtx.Err() == nil {
+			// Redis failed rather than the wait running out: fall back to
+			// the in-process lock, which still serializes this replica.
+			span.RecordError(err)
+			span.AddEvent("lock.fallback", trace.WithAttributes(attribute.String("lock.backend", backendMemory)))
+			backend = backendMemory
+		}
+	}
+	if backend == backendMemory {
+		release, contended, err = l.local.acquire(waitCtx, l.name+":"+key)
+	}
+	wait := time.Since(start)
+
+	outcome := "acquired"
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		outcome, err = "canceled", ctx.Err()
+	default:
+		outcome, err = "timeout", ErrTimeout
+	}
+	span.SetAttributes(
+		attribute.String("lock.backend", backend),
+		attribute.Bool("lock.contended", contended),
+		attribute.Float64("lock.wait_ms", ms(wait)),
+	)
+	l.waitTime.Record(ctx, ms(wait), metric.WithAttributes(
+		attribute.String("lock.name", l.name),
+		attribute.String("lock.backend", backend),
+		attribute.String("outcome", outcome),
+	))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "lock not acquired")
+		return nil, err
+	}
+
+	l.holders.Add(ctx, 1, l.attrs(backend))
+	return &Lease{lock: l, key: key, backend: backend, acquired: time.Now(), release: release}, nil
+}
+
+// Release releases the lock inside a "lock.release" span. Releasing a lease
+// more than once does nothing.
+func (le *Lease) Release(ctx context.Context) {
+	if !le.released.CompareAndSwap(false, true) {
+		return
+	}
+	l := le.lock
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "lock.release", trace.WithAttributes(
+		attribute.String("lock.name", l.name),
+		attribute.String("lock.key", le.key),
+		attribute.String("lock.backend", le.backend),
+	))
+	defer span.End()
+
+	held := time.Since(le.acquired)
+	span.SetAttributes(attribute.Float64("lock.held_ms", ms(held)))
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	defer cancel()
+	if err := le.release(releaseCtx); err != nil {
+		// The lock is left to expire.
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "lock release failed")
+	}
+	l.holders.Add(ctx, -1, l.attrs(le.backend))
+	l.holdTime.Record(ctx, ms(held), l.attrs(le.backend))
+}
+
+func (l *Lock) attrs(backend string) metric.MeasurementOption {
+	return metric.WithAttributes(attribute.String("lock.name", l.name), attribute.String("lock.backend", backend))
+}
+
+// localLocks holds the in-process locks, each a channel with room for one
+// holder.
+type localLocks struct {
+	mu   sync.Mutex
+	keys map[string]chan struct{}
+}
+
+// acquire waits for the lock on key until ctx is done, and reports whether it
+// had to wait.
+func (m *localLocks) acquire(ctx context.Context, key string) (func(context.Context) error, bool, error) {
+	m.mu.Lock()
+	slot, ok := m.keys[key]
+	if !ok {
+		slot = make(chan struct{}, 1)
+		m.keys[key] = slot
+	}
+	m.mu.Unlock()
+
+	release := func(context.Context) error {
+		<-slot
+		return nil
+	}
+	select {
+	case slot <- struct{}{}:
+		return release, false, nil
+	default:
+	}
+	select {
+	case slot <- struct{}{}:
+		return release, true, nil
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
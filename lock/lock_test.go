@@ -0,0 +1,93 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"app/config"
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestAcquireContended(t *testing.T) {
+	rec := tracetest.Install(t)
+	metrics := tracetest.StartMetrics(t)
+	l, err := New("test", config.InventoryLock{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	held, err := l.Acquire(ctx, "sku-1")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	// Another key is not contended.
+	other, err := l.Acquire(ctx, "sku-2")
+	if err != nil {
+		t.Fatalf("Acquire() of another key error = %v", err)
+	}
+	other.Release(ctx)
+	if _, err := l.Acquire(ctx, "sku-1"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Acquire() of a held key error = %v, want ErrTimeout", err)
+	}
+	metrics.AssertCounter(t, "lock_holders", 1, attribute.String("lock.name", "test"))
+
+	// A waiter gets the lock once it is released.
+	l.timeout = time.Second
+	acquired := make(chan error)
+	go func() {
+		lease, err := l.Acquire(ctx, "sku-1")
+		if err == nil {
+			lease.Release(ctx)
+		}
+		acquired <- err
+	}()
+	for tracetest.Counter(t, "lock_waiters", attribute.String("lock.name", "test")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	held.Release(ctx)
+	held.Release(ctx) // a second release does nothing
+	if err := <-acquired; err != nil {
+		t.Fatalf("Acquire() after release error = %v", err)
+	}
+
+	spans := rec.Named("lock.acquire")
+	if len(spans) != 4 {
+		t.Fatalf("got %d lock.acquire spans, want 4", len(spans))
+	}
+	tracetest.AssertAttributes(t, spans[0], attribute.String("lock.key", "sku-1"), attribute.Bool("lock.contended", false))
+	tracetest.AssertStatus(t, spans[2], codes.Error)
+	tracetest.AssertAttributes(t, spans[3], attribute.String("lock.backend", "memory"), attribute.Bool("lock.contended", true))
+	if n := len(rec.Named("lock.release")); n != 3 {
+		t.Errorf("got %d lock.release spans, want 3", n)
+	}
+	metrics.AssertHistogramCount(t, "lock_wait_duration_ms", 3, attribute.String("outcome", "acquired"))
+	metrics.AssertHistogramCount(t, "lock_wait_duration_ms", 1, attribute.String("outcome", "timeout"))
+	metrics.AssertHistogramCount(t, "lock_hold_duration_ms", 3)
+	metrics.AssertCounter(t, "lock_holders", 0)
+	metrics.AssertCounter(t, "lock_waiters", 0)
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	tracetest.Install(t)
+	l, err := New("test", config.InventoryLock{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := l.Acquire(context.Background(), "sku-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "sku-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() error = %v, want the context's error", err)
+	}
+}
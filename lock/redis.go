@@ -0,0 +1,105 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redis lock settings.
+const (
+	// redisKeyPrefix namespaces the lock keys.
+	redisKeyPrefix = "lock:"
+	// redisRetryAfter is how long Redis is skipped after a failure.
+	redisRetryAfter = 5 * time.Second
+	// A contended lock is polled, backing off from redisPollMin to
+	// redisPollMax between attempts.
+	redisPollMin = 2 * time.Millisecond
+	redisPollMax = 50 * time.Millisecond
+)
+
+// releaseScript deletes the lock in KEYS[1] if it is still held with the token
+// in ARGV[1], so a holder whose lock expired cannot release its successor's.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// redisLocks holds locks in Redis, each a key set to its holder's token that
+// expires after ttl if the holder never releases it.
+type redisLocks struct {
+	client *redis.Client
+	addr   string
+	ttl    time.Duration
+	// downUntil is when, in Unix nanoseconds, Redis is tried again after a
+	// failure.
+	downUntil atomic.Int64
+}
+
+// newRedisLocks connects to the Redis server at url (e.g.
+// "redis://localhost:6379/0").
+func newRedisLocks(url string, ttl time.Duration) (*redisLocks, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &redisLocks{client: redis.NewClient(opts), addr: opts.Addr, ttl: ttl}, nil
+}
+
+// available reports whether Redis should be tried.
+func (r *redisLocks) available(now time.Time) bool {
+	return now.UnixNano() >= r.downUntil.Load()
+}
+
+// acquire polls for the lock on key until it is set or ctx is done, and
+// reports whether it had to wait. The attempts are recorded on the span in
+// ctx. On a Redis error, Redis is skipped for redisRetryAfter so an outage
+// does not add a failed attempt to every acquire.
+func (r *redisLocks) acquire(ctx context.Context, key string) (func(context.Context) error, bool, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, false, err
+	}
+	key = redisKeyPrefix + key
+	span := trace.SpanFromContext(ctx)
+	backoff := redisPollMin
+	for attempts := 1; ; attempts++ {
+		ok, err := r.client.SetNX(ctx, key, token, r.ttl).Result()
+		span.SetAttributes(attribute.Int("lock.attempts", attempts))
+		if err != nil {
+			if ctx.Err() == nil {
+				r.downUntil.Store(time.Now().Add(redisRetryAfter).UnixNano())
+			}
+			return nil, attempts > 1, err
+		}
+		if ok {
+			release := func(ctx context.Context) error {
+				return releaseScript.Run(ctx, r.client, []string{key}, token).Err()
+			}
+			return release, attempts > 1, nil
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+		backoff = min(2*backoff, redisPollMax)
+	}
+}
+
+// newToken returns a random token identifying a lock's holder.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -3,12 +3,19 @@ package logging
 import (
     "context"
     "encoding/json"
+    "fmt"
     "log"
     "os"
+    "strings"
     "sync"
+    "sync/atomic"
     "time"
 
+    "app/instrumentation"
+    "app/sampling"
+
     "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/baggage"
     "go.opentelemetry.io/otel/trace"
 )
 
@@ -16,13 +23,60 @@ import (
 type LogLevel string
 
 const (
+    LevelDebug LogLevel = "DEBUG"
     LevelInfo  LogLevel = "INFO"
+    LevelWarn  LogLevel = "WARN"
     LevelError LogLevel = "ERROR"
 )
 
+// minLevel is the rank of the lowest level that is logged.
+var minLevel atomic.Int32
+
+// rank orders the levels from least to most severe.
+func (lvl LogLevel) rank() int32 {
+    switch lvl {
+    case LevelDebug:
+        return -1
+    case LevelWarn:
+        return 1
+    case LevelError:
+        return 2
+    }
+    return 0
+}
+
+// ParseLevel parses a level name such as "info" or "WARN".
+func ParseLevel(s string) (LogLevel, error) {
+    lvl := LogLevel(strings.ToUpper(s))
+    switch lvl {
+    case LevelDebug, LevelInfo, LevelWarn, LevelError:
+        return lvl, nil
+    }
+    return "", fmt.Errorf("unknown log level %q (want debug, info, warn, or error)", s)
+}
+
+// SetLevel sets the minimum level written by both loggers; lower levels are
+// dropped.
+func SetLevel(lvl LogLevel) {
+    minLevel.Store(lvl.rank())
+}
+
+// enabled reports whether lvl is at or above the minimum level.
+func enabled(lvl LogLevel) bool {
+    return lvl.rank() >= minLevel.Load()
+}
+
+// RequestIDKey is the baggage member and log attribute that carries the
+// request ID. When present in the context's baggage it is added to every log.
+const RequestIDKey = "request.id"
+
 // DefaultLogger creates OpenTelemetry span events (in-trace logs).
 var DefaultLogger = New()
 
+// Stdout is the log file name that writes JSON logs to standard output, for
+// platforms that collect container output.
+const Stdout = "stdout"
+
 // JSONLogger writes structured JSON logs to a file for the collector's filelog receiver.
 var JSONLogger = NewStructured()
 
@@ -32,11 +86,22 @@ type Logger struct{}
 // New creates a new Logger.
 func New() *Logger { return &Logger{} }
 
+// Debug logs a message with DEBUG level as a span event. Debug logs are
+// dropped unless the level is set to debug.
+func (l *Logger) Debug(ctx context.Context, message string, attrs ...attribute.KeyValue) {
+    l.log(ctx, LevelDebug, message, attrs...)
+}
+
 // Info logs a message with INFO level as a span event.
 func (l *Logger) Info(ctx context.Context, message string, attrs ...attribute.KeyValue) {
     l.log(ctx, LevelInfo, message, attrs...)
 }
 
+// Warn logs a message with WARN level as a span event.
+func (l *Logger) Warn(ctx context.Context, message string, attrs ...attribute.KeyValue) {
+    l.log(ctx, LevelWarn, message, attrs...)
+}
+
 // Error logs a message with ERROR level as a span event.
 func (l *Logger) Error(ctx context.Context, message string, attrs ...attribute.KeyValue) {
     l.log(ctx, LevelError, message, attrs...)
@@ -45,6 +110,10 @@ func (l *Logger) Error(ctx context.Context, message string, attrs ...attribute.K
 // log records the message as a span event if a span exists in the context.
 // If no span is found, it falls back to the standard Go logger.
 func (l *Logger) log(ctx context.Context, level LogLevel, message string, attrs ...attribute.KeyValue) {
+    if !enabled(level) || instrumentation.Disabled(ctx) {
+        return
+    }
+    attrs = withContextAttrs(ctx, attrs)
     span := trace.SpanFromContext(ctx)
     if !span.SpanContext().IsValid() {
         // No span in context, fallback to standard logger.
@@ -65,23 +134,76 @@ func (l *Logger) log(ctx context.Context, level LogLevel, message string, attrs
 // StructuredLogger writes JSON logs to a file.
 type StructuredLogger struct {
     mu      sync.Mutex
+    path    string
+    opened  bool
     f       *os.File
     encoder *json.Encoder
 }
 
 // NewStructured creates a JSON logger. The output file defaults to ./app.log
-// and can be overridden via APP_LOG_FILE env var.
+// and can be overridden via APP_LOG_FILE env var or SetFile. It is opened on
+// the first write.
 func NewStructured() *StructuredLogger {
     path := os.Getenv("APP_LOG_FILE")
     if path == "" {
         path = "app.log"
     }
-    f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+    return &StructuredLogger{path: path}
+}
+
+// SetFile redirects the logger to the file at path, as set in the service
+// configuration.
+func (l *StructuredLogger) SetFile(path string) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if path == l.path {
+        return
+    }
+    if l.f != nil {
+        _ = l.f.Close()
+    }
+    l.path, l.opened, l.f, l.encoder = path, false, nil, nil
+}
+
+// Close flushes and closes the log file. Later writes fall back to the
+// standard logger.
+func (l *StructuredLogger) Close() error {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.opened, l.encoder = true, nil
+    if l.f == nil {
+        return nil
+    }
+    f := l.f
+    l.f = nil
+    if err := f.Sync(); err != nil {
+        _ = f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// open opens the log file once; l.mu must be held.
+func (l *StructuredLogger) open() {
+    if l.opened {
+        return
+    }
+    l.opened = true
+    if l.path == Stdout {
+        l.encoder = json.NewEncoder(os.Stdout)
+        return
+    }
+    f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
     if err != nil {
-        log.Printf("[WARN] failed to open log file %q: %v", path, err)
-        return &StructuredLogger{}
+        log.Printf("[WARN] failed to open log file %q: %v", l.path, err)
+        return
     }
-    return &StructuredLogger{f: f, encoder: json.NewEncoder(f)}
+    l.f, l.encoder = f, json.NewEncoder(f)
+}
+
+// Debug writes a JSON log with DEBUG level.
+func (l *StructuredLogger) Debug(ctx context.Context, message string, attrs ...attribute.KeyValue) {
+    l.write(ctx, LevelDebug, message, attrs...)
 }
 
 // Info writes a JSON log with INFO level.
@@ -89,12 +211,24 @@ func (l *StructuredLogger) Info(ctx context.Context, message string, attrs ...at
     l.write(ctx, LevelInfo, message, attrs...)
 }
 
+// Warn writes a JSON log with WARN level.
+func (l *StructuredLogger) Warn(ctx context.Context, message string, attrs ...attribute.KeyValue) {
+    l.write(ctx, LevelWarn, message, attrs...)
+}
+
 // Error writes a JSON log with ERROR level.
 func (l *StructuredLogger) Error(ctx context.Context, message string, attrs ...attribute.KeyValue) {
     l.write(ctx, LevelError, message, attrs...)
 }
 
 func (l *StructuredLogger) write(ctx context.Context, level LogLevel, message string, attrs ...attribute.KeyValue) {
+    if !enabled(level) || instrumentation.Disabled(ctx) {
+        return
+    }
+    attrs = withContextAttrs(ctx, attrs)
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.open()
     if l.encoder == nil {
         // Fallback if file could not be opened.
         log.Printf("[%s] %s %v", level, message, attrs)
@@ -111,12 +245,25 @@ func (l *StructuredLogger) write(ctx context.Context, level LogLevel, message st
     if sc.IsValid() {
         entry["trace_id"] = sc.TraceID().String()
         entry["span_id"] = sc.SpanID().String()
+        // Whether the trace was sampled, and at what ratio, so logs can be
+        // matched with the share of traces that reach the backend.
+        entry["trace_flags"] = sc.TraceFlags().String()
+        if ratio, ok := sampling.Ratio(sc.TraceState()); ok {
+            entry["sampling_ratio"] = ratio
+        }
     }
-    l.mu.Lock()
-    defer l.mu.Unlock()
     _ = l.encoder.Encode(entry)
 }
 
+// withContextAttrs appends attributes carried by the context, such as the request ID.
+func withContextAttrs(ctx context.Context, attrs []attribute.KeyValue) []attribute.KeyValue {
+    if id := baggage.FromContext(ctx).Member(RequestIDKey).Value(); id != "" {
+        // Clip first so the caller's slice is never written to.
+        attrs = append(attrs[:len(attrs):len(attrs)], attribute.String(RequestIDKey, id))
+    }
+    return attrs
+}
+
 func attrsToMap(attrs ...attribute.KeyValue) map[string]any {
     m := make(map[string]any, len(attrs))
     for _, a := range attrs {
@@ -130,7 +277,8 @@ func attrsToMap(attrs ...attribute.KeyValue) map[string]any {
         case attribute.FLOAT64:
             m[string(a.Key)] = a.Value.AsFloat64()
         default:
-            m[string(a.Key)] = a.Value.AsString()
+            // Slices are written as JSON arrays.
+            m[string(a.Key)] = a.Value.AsInterface()
         }
     }
     return m
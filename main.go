@@ -2,49 +2,441 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
+	"syscall"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"app/admin"
+	"app/background"
+	"app/catalog"
+	"app/chaos"
+	"app/config"
+	"app/featureflags"
+	"app/handlers"
+	"app/handoff"
+	"app/heatmap"
+	"app/instrumentation"
+	"app/jobs"
+	"app/limits"
+	"app/logging"
+	"app/middleware"
+	"app/process"
+	"app/recording"
 	"app/routes"
+	"app/seed"
+	"app/slo"
+	"app/store"
+	"app/synthetic"
+	"app/systemd"
+	"app/tlscert"
 	"app/tracing"
 )
 
 func main() {
+	// Startup and shutdown are traced as "startup" and "shutdown" root spans
+	// with a child span per phase. Phases that run before the tracer provider
+	// is installed are recorded afterwards with their original timestamps.
+	processStart := time.Now()
+
+	// Load and validate the configuration (app.yaml or APP_CONFIG, overlaid
+	// with environment variables and then command-line flags) before anything
+	// starts.
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	configLoaded := time.Now()
+	logging.JSONLogger.SetFile(cfg.Logging.File)
+	level, _ := logging.ParseLevel(cfg.Logging.Level) // validated by Load
+	logging.SetLevel(level)
+	handlers.Configure(cfg.Downstream)
+	recording.Configure(cfg.Recording)
+	heatmap.Configure(cfg.Heatmap)
+	if err := featureflags.Configure(cfg.FeatureFlags.File, cfg.FeatureFlags.Overrides); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if err := chaos.Configure(cfg.Chaos.Scenario, cfg.Chaos.Overrides); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	// Fit GOMAXPROCS and GOMEMLIMIT to the container's limits before the
+	// telemetry resource records them.
+	log.Printf("Runtime limits: %s", limits.Apply(cfg.Runtime))
+
 	// Initialize OpenTelemetry (traces and metrics).
-	shutdown := tracing.InitTracer()
+	shutdown := tracing.InitTracer(cfg.Service, cfg.Telemetry)
+	// A panic in a background goroutine is reported and flushed before the
+	// process exits.
+	background.OnExit(func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+		defer cancel()
+		shutdown(flushCtx)
+		_ = logging.JSONLogger.Close()
+	})
+	// Reserve stock under the inventory lock when it is enabled.
+	if err := handlers.ConfigureInventoryLock(cfg.InventoryLock); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	tracer := otel.Tracer("app")
+	// After a restart handoff, startup joins the old process's handoff trace.
+	ctx, startup := tracer.Start(handoff.Context(context.Background()), "startup", trace.WithTimestamp(processStart))
+	_, span := tracer.Start(ctx, "startup.config_load", trace.WithTimestamp(processStart),
+		trace.WithAttributes(attribute.String("config.file", cfg.File)))
+	span.End(trace.WithTimestamp(configLoaded))
+	_, span = tracer.Start(ctx, "startup.telemetry_init", trace.WithTimestamp(configLoaded))
+	span.End()
 
-	router := routes.SetupRoutes()
+	// Count this start as a restart if the service has run before, so crash
+	// loops show in process.restarts.
+	if info, err := process.Start(cfg.Server.StateFile, handoff.Inherited()); err != nil {
+		log.Printf("[WARN] %v", err)
+	} else if info.Restarts > 0 {
+		startup.SetAttributes(
+			attribute.Int64("process.restarts", info.Restarts),
+			attribute.String("process.previous_exit", info.PreviousExit),
+		)
+		log.Printf("Restart #%d; the previous run exited %s", info.Restarts, info.PreviousExit)
+	}
+
+	// Fill the order store with generated history when seeding is enabled.
+	if cfg.Seed.Enabled {
+		seedCtx, span := tracer.Start(ctx, "startup.seed")
+		counts := seed.Run(seedCtx, store.DefaultStore, cfg.Seed)
+		span.End()
+		log.Printf("Seeded %d orders (%v)", cfg.Seed.Orders, counts)
+	}
+
+	// Warm the catalog caches in the background; order endpoints answer 503 until it finishes.
+	background.Go(ctx, "catalog.warm", func() { warmCaches(ctx) })
+
+	_, span = tracer.Start(ctx, "startup.routes")
+
+	// The admin listener serves pprof, the admin API, the health probes, and
+	// /metrics, keeping the public listener to the API itself. Without it, the
+	// probes and /metrics stay on the public listener.
+	adminCfg, adminEnabled := admin.NewConfig(cfg.Admin)
+	if !adminEnabled {
+		cfg.Server.PublicProbes = true
+	}
+
+	// Per-client rate limiting; its limits can be changed by a config reload.
+	limiter := middleware.NewRateLimiterFromConfig(cfg.RateLimit)
+	router := routes.SetupRoutes(cfg, limiter)
+	if cfg.Server.H2C && !cfg.Server.TLS.Enabled() {
+		// Cleartext HTTP/2 for gRPC-gateway style clients; HTTP/1.1 is still served.
+		router = h2c.NewHandler(router, &http2.Server{})
+	}
 
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: router,
+		Addr:              cfg.Server.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		ConnState:         middleware.ConnState,
 	}
 
-	// Start the server in a goroutine for graceful shutdown.
-	go func() {
-		log.Println("Server is running on port 8080")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
+	// Serve HTTPS when a certificate is configured, reloading it whenever the
+	// files change. HTTP/2 is negotiated over TLS via ALPN.
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if tlsCfg := cfg.Server.TLS; tlsCfg.Enabled() {
+		certs, err := tlscert.NewReloader(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			log.Fatalf("TLS setup failed: %v", err)
 		}
-	}()
+		server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate, MinVersion: tls.VersionTLS12}
+		background.Go(watchCtx, "tlscert.watch", func() { certs.Watch(watchCtx, tlsCfg.ReloadInterval) })
+	}
 
-	// Wait for interrupt signal and perform graceful shutdown.
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	span.End()
+
+	// Apply safe configuration changes (log level, sampling, rate limits, and
+	// chaos) on SIGHUP or when the file changes, without a restart.
+	watcher := config.NewWatcher(cfg, os.Args[1:], applyRuntimeConfig(limiter))
+	background.Go(watchCtx, "config.watch", func() { watcher.Watch(watchCtx) })
+
+	// Bind the listeners before serving, so a port in use fails startup, then
+	// serve them as a group for graceful shutdown. Under systemd socket
+	// activation, or after a restart handoff, the passed sockets are used
+	// instead: the one named "http" (or the first) for the API, and the one
+	// named "admin" for the admin listener.
+	_, span = tracer.Start(ctx, "startup.listen", trace.WithAttributes(attribute.String("server.address", cfg.Server.Addr)))
+	activated, err := systemd.Listeners()
+	span.SetAttributes(attribute.Bool("server.socket_activated", activated != nil))
+	if err == nil && activated == nil {
+		activated, err = handoff.Listeners()
+		span.SetAttributes(attribute.Bool("server.handoff", activated != nil))
+	}
+	ln := activated["http"]
+	if ln == nil {
+		ln = activated["0"]
+	}
+	if err == nil && ln == nil {
+		ln, err = net.Listen("tcp", cfg.Server.Addr)
+	}
+	var servers serverGroup
+	// listeners are handed to the new process on a restart.
+	listeners := make(map[string]net.Listener)
+	if err == nil {
+		servers.Add("public", server, ln)
+		listeners["http"] = ln
+	}
+	// The admin listener serves on its own address, and shuts down after the
+	// public one so the probes and /metrics outlast the drain.
+	if err == nil && adminEnabled {
+		adminLn := activated["admin"]
+		if adminLn == nil {
+			adminLn, err = net.Listen("tcp", adminCfg.Addr)
+		}
+		if err == nil {
+			servers.Add("admin", admin.NewServer(adminCfg.Addr, routes.SetupAdminRoutes(adminCfg)), adminLn)
+			listeners["admin"] = adminLn
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "listen failed")
+		span.End()
+		startup.End()
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+		shutdown(flushCtx)
+		cancel()
+		log.Fatalf("HTTP server error: %v", err)
+	}
+	span.End()
+	servers.Start(ctx)
 
-	log.Println("Shutting down server...")
+	// Check the collector, the store, and the other dependencies once the
+	// listener is up; /readyz fails until this has run.
+	background.Go(ctx, "self_check", func() { handlers.RunSelfCheck(ctx, cfg.Warnings()) })
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Run the periodic background jobs.
+	jobManager := jobs.NewManager()
+	registerJobs(jobManager, cfg.Jobs)
+	jobManager.Start()
+
+	// Compute the SLOs' error-budget burn rates from the service's own
+	// request metrics, and report them at /slo.
+	if cfg.SLO.Interval > 0 && len(cfg.SLO.Objectives) > 0 {
+		tracker := slo.New(cfg.SLO, tracing.Collect)
+		handlers.ConfigureSLO(tracker)
+		background.Go(watchCtx, "slo.watch", func() { tracker.Watch(watchCtx) })
+	}
+
+	// Call the service's own endpoints on a schedule, as synthetic traffic.
+	if cfg.Synthetic.Interval > 0 && len(cfg.Synthetic.Checks) > 0 {
+		monitor := synthetic.New(cfg.Synthetic, cfg.Server)
+		background.Go(watchCtx, "synthetic.run", func() { monitor.Run(watchCtx) })
+	}
 
-	if err := server.Shutdown(ctx); err != nil {
+	// Check the collector on a schedule, so a broken telemetry pipeline shows
+	// in the metrics served on /metrics and on /readyz.
+	if cfg.Telemetry.Exporter == config.ExporterOTLP && cfg.Telemetry.CollectorCheckInterval > 0 {
+		background.Go(watchCtx, "collector.monitor", func() { tracing.MonitorCollector(watchCtx, cfg.Telemetry) })
+	}
+
+	startup.End()
+	log.Printf("Started in %s", time.Since(processStart).Round(time.Millisecond))
+
+	// Tell systemd, and the old process after a handoff, that the service is
+	// up, and keep the systemd watchdog fed while it runs.
+	if _, err := systemd.Notify("READY=1"); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	if err := handoff.Ready(); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	background.Go(watchCtx, "systemd.watchdog", func() { systemd.Watchdog(watchCtx) })
+
+	// Wait for an interrupt or SIGTERM (sent by Kubernetes when a pod is
+	// stopped), or for a server to fail, and perform graceful shutdown.
+	// SIGUSR2 first hands the listeners to a new process of the (possibly
+	// upgraded) binary and drains once it is ready; if the handoff fails, the
+	// service keeps running.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	restart := make(chan os.Signal, 1)
+	signal.Notify(restart, syscall.SIGUSR2)
+	var serveErr error
+	var shutdownAttrs []attribute.KeyValue
+	// handoffPID is the new process's ID after a restart handoff.
+	handoffPID := 0
+wait:
+	for {
+		select {
+		case sig := <-quit:
+			log.Printf("Shutting down server (%v)...", sig)
+			shutdownAttrs = append(shutdownAttrs, attribute.String("shutdown.signal", sig.String()))
+			break wait
+		case serveErr = <-servers.Err():
+			log.Printf("[ERROR] %v; shutting down", serveErr)
+			break wait
+		case <-restart:
+			pid, err := handoff.Start(listeners, cfg.Server.HandoffTimeout)
+			if err != nil {
+				log.Printf("[ERROR] restart handoff failed; still serving: %v", err)
+				continue
+			}
+			log.Printf("Handed off to process %d; draining...", pid)
+			shutdownAttrs = append(shutdownAttrs, attribute.Int("shutdown.handoff_pid", pid))
+			handoffPID = pid
+			break wait
+		}
+	}
+	if handoffPID != 0 {
+		// The new process is the service now; with NotifyAccess=all, systemd
+		// tracks it instead.
+		_, _ = systemd.Notify("MAINPID=" + strconv.Itoa(handoffPID))
+	} else {
+		_, _ = systemd.Notify("STOPPING=1")
+	}
+	start := time.Now()
+	ctx, stopping := tracer.Start(context.Background(), "shutdown", trace.WithAttributes(shutdownAttrs...))
+	if serveErr != nil {
+		stopping.RecordError(serveErr)
+		stopping.SetStatus(codes.Error, "server failed")
+	}
+	// Fail readiness first, and keep serving for the pre-stop delay so load
+	// balancers stop sending new requests before the listener closes. A second
+	// signal skips the rest of the delay. After a handoff, the new process
+	// serves the same sockets, so there is nothing for load balancers to do.
+	if handoffPID == 0 {
+		handlers.StartDraining()
+	}
+	if delay := cfg.Server.PreStopDelay; delay > 0 && handoffPID == 0 {
+		log.Printf("Waiting %v for load balancers to drain", delay)
+		_, span := tracer.Start(ctx, "shutdown.pre_stop_delay")
+		select {
+		case <-time.After(delay):
+		case <-quit:
+			span.SetAttributes(attribute.Bool("shutdown.interrupted", true))
+		}
+		span.End()
+	}
+
+	// Stop accepting connections and wait for in-flight requests, public
+	// listener first, within one drain timeout.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelDrain()
+	_, span = tracer.Start(ctx, "shutdown.drain")
+	if err := servers.Shutdown(drainCtx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "drain timed out")
 		log.Printf("Server forced to shutdown: %v", err)
 	}
+	stopWatching()
+	span.End()
+	// Close any recording once no more requests can arrive.
+	recording.Stop()
+	_, span = tracer.Start(ctx, "shutdown.jobs")
+	if err := jobManager.Stop(drainCtx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "jobs did not stop")
+		log.Printf("[WARN] %v", err)
+	}
+	span.End()
+	logging.JSONLogger.Info(ctx, "Server drained",
+		attribute.Float64("shutdown.drain_ms", float64(time.Since(start).Microseconds())/1000),
+	)
+	// The shutdown span ends before the final flush, which exports it; the
+	// flush itself is only logged.
+	stopping.End()
 
-	// Perform graceful shutdown of the OTel providers after the server.
-	shutdown(ctx)
+	// Flush and shut down the OTel providers after the servers, with their own
+	// budget, then close the structured log last so shutdown errors are kept.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Telemetry.ShutdownTimeout)
+	defer cancelFlush()
+	shutdown(flushCtx)
+	if err := logging.JSONLogger.Close(); err != nil {
+		log.Printf("Error closing log file: %v", err)
+	}
+	if handoffPID == 0 {
+		if err := process.Stopped(); err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+	}
+	log.Printf("Shutdown complete in %s", time.Since(start).Round(time.Millisecond))
+	if serveErr != nil {
+		os.Exit(1)
+	}
+}
+
+// registerJobs registers the background jobs with their configured intervals.
+func registerJobs(m *jobs.Manager, cfg config.Jobs) {
+	for _, j := range []jobs.Job{
+		{
+			Name:     "catalog.replenish",
+			Interval: cfg.ReplenishInterval,
+			Run: func(ctx context.Context) error {
+				_, err := catalog.Replenish(ctx)
+				return err
+			},
+		},
+		{
+			Name:     "dependency.probe",
+			Interval: cfg.ProbeInterval,
+			Run:      handlers.ProbeDependencies,
+		},
+		{
+			Name:     "order.settlement",
+			Interval: cfg.SettlementInterval,
+			Run:      handlers.SettleOrders,
+		},
+	} {
+		if err := m.Register(j); err != nil {
+			log.Fatalf("registering job: %v", err)
+		}
+	}
+}
+
+// applyRuntimeConfig returns the config reload callback, which applies the
+// reloadable settings to the running service.
+func applyRuntimeConfig(limiter *middleware.RateLimiter) func(context.Context, config.Config, config.Config) {
+	return func(ctx context.Context, old, cfg config.Config) {
+		level, _ := logging.ParseLevel(cfg.Logging.Level) // validated by Load
+		logging.SetLevel(level)
+		tracing.SetSampleRatio(cfg.Telemetry.SampleRatio)
+		instrumentation.SetNoopPercent(cfg.Telemetry.NoopPercent)
+		tracing.SetRuntimeTraceTasks(cfg.Telemetry.RuntimeTraceTasks)
+		limiter.SetLimits(cfg.RateLimit.RPS, cfg.RateLimit.Burst)
+		// Only a changed chaos section replaces the knobs, so changes made
+		// through the admin API survive unrelated reloads.
+		if !reflect.DeepEqual(old.Chaos, cfg.Chaos) {
+			_ = chaos.Configure(cfg.Chaos.Scenario, cfg.Chaos.Overrides) // validated by Load
+		}
+	}
+}
+
+// warmCaches runs the startup cache warm-up inside a "startup.warm_caches"
+// span under the startup span in ctx, with a child span per warm task, so cold
+// starts are visible in traces.
+func warmCaches(ctx context.Context) {
+	ctx, span := otel.Tracer("app").Start(ctx, "startup.warm_caches")
+	defer span.End()
+
+	if err := catalog.Warm(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "cache warm-up failed")
+		log.Printf("[WARN] cache warm-up failed: %v", err)
+		return
+	}
+	span.SetStatus(codes.Ok, "caches warmed")
+	log.Println("Caches warmed; order endpoints are ready")
 }
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"app/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// responseRecorder captures the status code and body size written by a handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// AccessLog writes one canonical line per request to the JSON log: method,
+// route, status, duration, response bytes, and client IP. The structured
+// logger adds the trace and span IDs, so each line links to its trace. It is
+// not recorded as a span event; the request span already carries the same data.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		route := r.Pattern
+		switch {
+		case route == CatchAllPattern && rec.status == http.StatusMethodNotAllowed:
+			route = MethodNotAllowedRoute
+		case route == CatchAllPattern:
+			route = NotFoundRoute
+		case route == "":
+			route = r.URL.Path
+		}
+		logging.JSONLogger.Info(r.Context(), r.Method+" "+r.URL.Path+" "+strconv.Itoa(rec.status),
+			attribute.String("log.type", "access"),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", r.URL.Path),
+			attribute.Int("http.response.status_code", rec.status),
+			attribute.Int("http.response.body.size", rec.bytes),
+			attribute.Float64("http.server.duration_ms", float64(time.Since(start).Microseconds())/1000),
+			attribute.String("client.address", clientKey(r)),
+			attribute.String("user_agent.original", userAgent(r)),
+		)
+	})
+}
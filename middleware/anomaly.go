@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"app/anomaly"
+	"app/config"
+)
+
+// LatencyAnomalies flags requests much slower than their route's rolling
+// latency baseline; see the anomaly package.
+type LatencyAnomalies struct {
+	detector *anomaly.Detector
+}
+
+// NewLatencyAnomaliesFromConfig creates the anomaly detection middleware from
+// the service configuration. With a threshold of 0 it passes requests through.
+func NewLatencyAnomaliesFromConfig(cfg config.Anomaly) *LatencyAnomalies {
+	return &LatencyAnomalies{detector: anomaly.New(cfg)}
+}
+
+// Middleware times each routed request and hands its latency to the detector
+// while the request span is still open, so an anomaly event lands on it.
+func (l *LatencyAnomalies) Middleware(next http.Handler) http.Handler {
+	if l.detector == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeFromPattern(r.Pattern)
+		if route == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		l.detector.Observe(r.Context(), route, time.Since(start))
+	})
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"app/config"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// APIKeyHeader is the header clients send their API key in.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is an accepted API key.
+type APIKey struct {
+	// Name identifies the key (e.g. "checkout-web") and is recorded as api_key.name.
+	Name string
+	// Key is the secret value.
+	Key string
+	// EndUser is recorded as enduser.id; it defaults to Name.
+	EndUser string
+}
+
+type apiKeyContextKey struct{}
+
+// APIKeyAuth validates API keys against a fixed set.
+type APIKeyAuth struct {
+	keys            []APIKey
+	rejectedCounter metric.Int64Counter
+}
+
+// NewAPIKeyAuth creates an authenticator for the given keys. With no keys,
+// authentication is disabled and every request is accepted.
+func NewAPIKeyAuth(keys []APIKey) *APIKeyAuth {
+	counter, err := meter.Int64Counter(
+		"auth_rejected_total",
+		metric.WithDescription("The total number of requests rejected by authentication"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create auth_rejected_total counter: %v", err)
+	}
+	return &APIKeyAuth{keys: keys, rejectedCounter: counter}
+}
+
+// NewAPIKeyAuthFromConfig creates an authenticator accepting the configured
+// API keys.
+func NewAPIKeyAuthFromConfig(cfg config.Auth) *APIKeyAuth {
+	keys := make([]APIKey, 0, len(cfg.APIKeys))
+	for _, k := range cfg.APIKeys {
+		keys = append(keys, APIKey{Name: k.Name, Key: k.Key, EndUser: k.EndUser})
+	}
+	return NewAPIKeyAuth(keys)
+}
+
+// Enabled reports whether any keys are configured.
+func (a *APIKeyAuth) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Middleware rejects requests without a valid X-API-Key with 401. Accepted
+// requests get enduser.id and api_key.name on the request span. Requests
+// already accepted by JWTAuth skip the check.
+func (a *APIKeyAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() || authenticatedByJWT(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		presented := r.Header.Get(APIKeyHeader)
+		if presented == "" {
+			a.reject(w, r, span, "missing")
+			return
+		}
+		key, ok := a.lookup(presented)
+		if !ok {
+			a.reject(w, r, span, "invalid")
+			return
+		}
+
+		span.SetAttributes(
+			attribute.String(EndUserIDKey, key.EndUser),
+			attribute.String("api_key.name", key.Name),
+		)
+		ctx := context.WithValue(r.Context(), apiKeyContextKey{}, key)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// lookup finds the key matching presented, comparing in constant time.
+func (a *APIKeyAuth) lookup(presented string) (APIKey, bool) {
+	var found APIKey
+	ok := false
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(presented)) == 1 {
+			found, ok = k, true
+		}
+	}
+	return found, ok
+}
+
+// reject answers 401 and records why on the request span.
+func (a *APIKeyAuth) reject(w http.ResponseWriter, r *http.Request, span trace.Span, reason string) {
+	span.AddEvent("auth.rejected", trace.WithAttributes(attribute.String("auth.reason", reason)))
+	span.SetAttributes(attribute.String("auth.result", reason))
+	a.rejectedCounter.Add(r.Context(), 1, metric.WithAttributes(attribute.String("auth.reason", reason)))
+	w.Header().Set("WWW-Authenticate", `ApiKey header="`+APIKeyHeader+`"`)
+	problem.Write(w, r, problem.Unauthorized, "A valid "+APIKeyHeader+" header is required.")
+}
+
+// APIKeyFromContext returns the API key that authenticated the request.
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return key, ok
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultBaggageKeys are the baggage members copied to spans when
+// BAGGAGE_SPAN_ATTRIBUTES is unset.
+var defaultBaggageKeys = []string{"tenant", "user.id", "synthetic"}
+
+// maxBaggageAttributeLen clips copied values, so a large baggage value cannot
+// bloat every span.
+const maxBaggageAttributeLen = 128
+
+// BaggageAttributes copies selected baggage members of a request to its span
+// as baggage.<key> attributes, so values set by an upstream hop can be
+// searched for in traces.
+type BaggageAttributes struct {
+	// keys are the members copied; all are copied when nil.
+	keys []string
+}
+
+// NewBaggageAttributes copies the members named by keys, or every member if
+// keys is nil.
+func NewBaggageAttributes(keys []string) *BaggageAttributes {
+	return &BaggageAttributes{keys: keys}
+}
+
+// NewBaggageAttributesFromEnv copies the members listed in
+// BAGGAGE_SPAN_ATTRIBUTES, a comma-separated list of keys; "*" copies every
+// member and "off" none.
+func NewBaggageAttributesFromEnv() *BaggageAttributes {
+	switch v := os.Getenv("BAGGAGE_SPAN_ATTRIBUTES"); v {
+	case "":
+		return NewBaggageAttributes(defaultBaggageKeys)
+	case "*":
+		return NewBaggageAttributes(nil)
+	case "off":
+		return NewBaggageAttributes([]string{})
+	default:
+		var keys []string
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+		return NewBaggageAttributes(keys)
+	}
+}
+
+// Middleware adds the selected baggage members to the request span.
+func (b *BaggageAttributes) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attrs := b.Attributes(baggage.FromContext(r.Context())); len(attrs) > 0 {
+			trace.SpanFromContext(r.Context()).SetAttributes(attrs...)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Attributes returns the selected members of bag as span attributes.
+func (b *BaggageAttributes) Attributes(bag baggage.Baggage) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	add := func(m baggage.Member) {
+		v := m.Value()
+		if len(v) > maxBaggageAttributeLen {
+			// Cut at a character boundary, so the value stays valid UTF-8.
+			n := maxBaggageAttributeLen
+			for n > 0 && !utf8.RuneStart(v[n]) {
+				n--
+			}
+			v = v[:n]
+		}
+		attrs = append(attrs, attribute.String("baggage."+m.Key(), v))
+	}
+	if b.keys == nil {
+		for _, m := range bag.Members() {
+			add(m)
+		}
+		return attrs
+	}
+	for _, k := range b.keys {
+		if m := bag.Member(k); m.Key() != "" {
+			add(m)
+		}
+	}
+	return attrs
+}
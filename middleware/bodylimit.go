@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"app/config"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultRouteBodyLimits are the built-in per-route overrides. Bulk imports
+// stream many rows in one body.
+var defaultRouteBodyLimits = map[string]int64{
+	"POST /orders/import": 32 << 20,
+}
+
+// BodyLimit caps request body sizes, per route.
+type BodyLimit struct {
+	fallback int64
+	routes   map[string]int64
+
+	rejectedCounter metric.Int64Counter
+}
+
+// NewBodyLimit creates a limit of maxBytes with per-route overrides keyed by
+// ServeMux pattern. A limit of 0 disables it.
+func NewBodyLimit(maxBytes int64, routes map[string]int64) *BodyLimit {
+	counter, err := meter.Int64Counter(
+		"request_body_rejected_total",
+		metric.WithDescription("The total number of requests rejected for an oversized body"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create request_body_rejected_total counter: %v", err)
+	}
+	return &BodyLimit{fallback: maxBytes, routes: routes, rejectedCounter: counter}
+}
+
+// NewBodyLimitFromConfig creates a limit of server.max_body_bytes, keeping the
+// built-in per-route overrides.
+func NewBodyLimitFromConfig(cfg config.Server) *BodyLimit {
+	return NewBodyLimit(cfg.MaxBodyBytes, defaultRouteBodyLimits)
+}
+
+// Middleware answers 413 when the declared Content-Length exceeds the route's
+// limit, recording the attempted size on the request span. Bodies without a
+// length are wrapped in http.MaxBytesReader, so reads past the limit fail with
+// *http.MaxBytesError; the rejection is recorded when that happens and the
+// handler answers 413.
+func (b *BodyLimit) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := b.fallback
+		if l, ok := b.routes[r.Pattern]; ok {
+			limit = l
+		}
+		if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			b.reject(r, limit, r.ContentLength)
+			problem.Write(w, r, problem.PayloadTooLarge, "The request body exceeds the "+strconv.FormatInt(limit, 10)+"-byte limit.")
+			return
+		}
+		r.Body = &limitedBody{
+			ReadCloser: http.MaxBytesReader(w, r.Body, limit),
+			onExceeded: func() { b.reject(r, limit, limit+1) },
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reject records an oversized body. attempted is the declared size, or a lower
+// bound when the body was streamed.
+func (b *BodyLimit) reject(r *http.Request, limit, attempted int64) {
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.Bool("http.request.body.rejected", true),
+		attribute.Int64("http.request.body.size", attempted),
+		attribute.Int64("http.request.body.limit", limit),
+	)
+	b.rejectedCounter.Add(r.Context(), 1, metric.WithAttributes(attribute.String("http.route", routeFromPattern(r.Pattern))))
+}
+
+// limitedBody calls onExceeded once when the wrapped MaxBytesReader trips.
+type limitedBody struct {
+	io.ReadCloser
+	onExceeded func()
+	exceeded   bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	if _, ok := err.(*http.MaxBytesError); ok && !l.exceeded {
+		l.exceeded = true
+		l.onExceeded()
+	}
+	return n, err
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxUserAgentLen bounds the user agent recorded on spans and logs.
+const maxUserAgentLen = 256
+
+type clientInfoKey struct{}
+
+// clientInfo is the resolved client of a request.
+type clientInfo struct {
+	address   string
+	userAgent string
+}
+
+// ClientInfo resolves the real client IP address of each request, honoring
+// X-Forwarded-For only when the request came through a trusted proxy.
+type ClientInfo struct {
+	trusted []netip.Prefix
+}
+
+// NewClientInfo creates a resolver that trusts X-Forwarded-For from proxies in
+// the given CIDRs. Invalid CIDRs are logged and skipped.
+func NewClientInfo(trustedProxies []string) *ClientInfo {
+	c := &ClientInfo{}
+	for _, cidr := range trustedProxies {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			log.Printf("[WARN] ignoring invalid trusted proxy %q: %v", cidr, err)
+			continue
+		}
+		c.trusted = append(c.trusted, p.Masked())
+	}
+	return c
+}
+
+// NewClientInfoFromConfig creates a resolver trusting server.trusted_proxies.
+// With none set, X-Forwarded-For is ignored.
+func NewClientInfoFromConfig(cfg config.Server) *ClientInfo {
+	return NewClientInfo(cfg.TrustedProxies)
+}
+
+// Middleware sets client.address (the resolved client IP),
+// network.peer.address (the immediate peer), a normalized
+// user_agent.original, and the negotiated protocol on the request span. The
+// rate limiter, IP filter, and access log use the resolved address.
+func (c *ClientInfo) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := remoteHost(r)
+		info := clientInfo{
+			address:   c.resolve(peer, r.Header.Values("X-Forwarded-For")),
+			userAgent: normalizeUserAgent(r.UserAgent()),
+		}
+
+		ctx := context.WithValue(r.Context(), clientInfoKey{}, info)
+		attrs := []attribute.KeyValue{
+			attribute.String("client.address", info.address),
+			attribute.String("network.peer.address", peer),
+		}
+		if info.userAgent != "" {
+			attrs = append(attrs, attribute.String("user_agent.original", info.userAgent))
+		}
+		attrs = append(attrs, protocolAttrs(r)...)
+		trace.SpanFromContext(ctx).SetAttributes(attrs...)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// resolve walks X-Forwarded-For from the nearest hop back, skipping trusted
+// proxies, and returns the first untrusted address. Without a trusted peer
+// the header could be forged, so the peer itself is the client.
+func (c *ClientInfo) resolve(peer string, forwardedFor []string) string {
+	if !c.isTrusted(peer) {
+		return peer
+	}
+	var hops []string
+	for _, v := range forwardedFor {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// A malformed hop ends the trusted chain.
+			break
+		}
+		client = hop
+		if !c.isTrusted(hop) {
+			break
+		}
+	}
+	return client
+}
+
+func (c *ClientInfo) isTrusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return containsAddr(c.trusted, addr.Unmap())
+}
+
+// normalizeUserAgent trims the user agent, collapses runs of whitespace, drops
+// control characters, and bounds its length.
+func normalizeUserAgent(ua string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.TrimSpace(ua) {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r):
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+		if b.Len() >= maxUserAgentLen {
+			break
+		}
+	}
+	return b.String()
+}
+
+// protocolAttrs describes the protocol the request arrived over:
+// network.protocol.version ("1.1" or "2"), and for HTTPS the TLS version and
+// the ALPN protocol. Cleartext HTTP/2 is h2c.
+func protocolAttrs(r *http.Request) []attribute.KeyValue {
+	version := strconv.Itoa(r.ProtoMajor)
+	if r.ProtoMajor == 1 {
+		version += "." + strconv.Itoa(r.ProtoMinor)
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("network.protocol.name", "http"),
+		attribute.String("network.protocol.version", version),
+	}
+	if r.TLS == nil {
+		attrs = append(attrs, attribute.Bool("http.h2c", r.ProtoMajor == 2))
+		return attrs
+	}
+	attrs = append(attrs, attribute.String("tls.protocol.version", strings.TrimPrefix(tls.VersionName(r.TLS.Version), "TLS ")))
+	if r.TLS.NegotiatedProtocol != "" {
+		attrs = append(attrs, attribute.String("tls.next_protocol", r.TLS.NegotiatedProtocol))
+	}
+	return attrs
+}
+
+// remoteHost returns the host part of the request's remote address.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientKey identifies the client by its IP address: the address resolved by
+// ClientInfo when it ran, otherwise the remote address.
+func clientKey(r *http.Request) string {
+	if info, ok := r.Context().Value(clientInfoKey{}).(clientInfo); ok {
+		return info.address
+	}
+	return remoteHost(r)
+}
+
+// userAgent returns the normalized user agent of the request.
+func userAgent(r *http.Request) string {
+	if info, ok := r.Context().Value(clientInfoKey{}).(clientInfo); ok {
+		return info.userAgent
+	}
+	return normalizeUserAgent(r.UserAgent())
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"app/config"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// globalLimiter names the shared limit in metrics and on spans.
+const globalLimiter = "global"
+
+// ConcurrencyLimit is the number of requests a limit lets run at once and how
+// many more may wait in its queue. A Limit of 0 disables it; a Queue of 0
+// sheds excess requests immediately.
+type ConcurrencyLimit struct {
+	Limit int
+	Queue int
+}
+
+// semaphore is one limit's slots and queue.
+type semaphore struct {
+	name   string
+	limit  ConcurrencyLimit
+	slots  chan struct{}
+	queued atomic.Int64
+}
+
+// ConcurrencyLimiter bounds the number of requests in flight. Routes with
+// their own limit get their own semaphore; all other routes share the global
+// one. Requests over the limit wait in a bounded queue, and are shed with 503
+// when the queue is full or they have waited too long.
+type ConcurrencyLimiter struct {
+	global  *semaphore
+	routes  map[string]*semaphore
+	maxWait time.Duration
+
+	waitHistogram metric.Float64Histogram
+	shedCounter   metric.Int64Counter
+}
+
+// NewConcurrencyLimiter creates a limiter with a global limit and per-route
+// limits keyed by ServeMux pattern. Queued requests are shed after maxWait.
+func NewConcurrencyLimiter(global ConcurrencyLimit, routes map[string]ConcurrencyLimit, maxWait time.Duration) *ConcurrencyLimiter {
+	c := &ConcurrencyLimiter{
+		global:  newSemaphore(globalLimiter, global),
+		routes:  make(map[string]*semaphore, len(routes)),
+		maxWait: maxWait,
+	}
+	for pattern, limit := range routes {
+		c.routes[pattern] = newSemaphore(pattern, limit)
+	}
+
+	var err error
+	c.waitHistogram, err = meter.Float64Histogram(
+		"concurrency_queue_wait_ms",
+		metric.WithDescription("Time requests spent queued for a concurrency slot"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create concurrency_queue_wait_ms histogram: %v", err)
+	}
+	c.shedCounter, err = meter.Int64Counter(
+		"concurrency_shed_total",
+		metric.WithDescription("The total number of requests shed by the concurrency limiter"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create concurrency_shed_total counter: %v", err)
+	}
+	depthGauge, err := meter.Int64ObservableGauge(
+		"concurrency_queue_depth",
+		metric.WithDescription("The number of requests waiting for a concurrency slot"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create concurrency_queue_depth gauge: %v", err)
+	}
+	inFlightGauge, err := meter.Int64ObservableGauge(
+		"concurrency_in_flight",
+		metric.WithDescription("The number of requests holding a concurrency slot"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create concurrency_in_flight gauge: %v", err)
+	}
+	limitGauge, err := meter.Int64ObservableGauge(
+		"concurrency_limit",
+		metric.WithDescription("The configured concurrency limit"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create concurrency_limit gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, s := range c.semaphores() {
+			attrs := metric.WithAttributes(attribute.String("concurrency.limiter", s.name))
+			o.ObserveInt64(depthGauge, s.queued.Load(), attrs)
+			o.ObserveInt64(inFlightGauge, int64(len(s.slots)), attrs)
+			o.ObserveInt64(limitGauge, int64(s.limit.Limit), attrs)
+		}
+		return nil
+	}, depthGauge, inFlightGauge, limitGauge)
+	if err != nil {
+		log.Fatalf("failed to register concurrency gauges: %v", err)
+	}
+	return c
+}
+
+// NewConcurrencyLimiterFromConfig creates a limiter configured by
+// server.concurrency.
+func NewConcurrencyLimiterFromConfig(cfg config.Concurrency) *ConcurrencyLimiter {
+	routes := make(map[string]ConcurrencyLimit, len(cfg.Routes))
+	for pattern, limit := range cfg.Routes {
+		routes[pattern] = ConcurrencyLimit{Limit: limit.Limit, Queue: limit.Queue}
+	}
+	return NewConcurrencyLimiter(ConcurrencyLimit{Limit: cfg.Limit, Queue: cfg.Queue}, routes, cfg.QueueTimeout)
+}
+
+func newSemaphore(name string, limit ConcurrencyLimit) *semaphore {
+	return &semaphore{name: name, limit: limit, slots: make(chan struct{}, max(limit.Limit, 0))}
+}
+
+// semaphores returns every semaphore, the global one first.
+func (c *ConcurrencyLimiter) semaphores() []*semaphore {
+	all := make([]*semaphore, 0, len(c.routes)+1)
+	all = append(all, c.global)
+	for _, s := range c.routes {
+		all = append(all, s)
+	}
+	return all
+}
+
+// Middleware runs the request once it holds a slot of its route's limit. A
+// request that has to queue sets the "queue" stage while it waits and records
+// its wait in concurrency_queue_wait_ms; a shed request gets 503 with
+// Retry-After. The limiter and queueing outcome are set on the request span.
+func (c *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sem, ok := c.routes[r.Pattern]
+		if !ok {
+			sem = c.global
+		}
+		if sem.limit.Limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("concurrency.limiter", sem.name))
+
+		select {
+		case sem.slots <- struct{}{}:
+			span.SetAttributes(attribute.Bool("concurrency.queued", false))
+		default:
+			span.SetAttributes(attribute.Bool("concurrency.queued", true))
+			if reason := c.wait(ctx, sem); reason != "" {
+				span.SetAttributes(attribute.String("concurrency.shed_reason", reason))
+				if ctx.Err() != nil {
+					// The client or the request timeout gave up; there is no
+					// one left to answer.
+					return
+				}
+				c.shedCounter.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("concurrency.limiter", sem.name),
+					attribute.String("concurrency.shed_reason", reason),
+				))
+				w.Header().Set("Retry-After", "1")
+				problem.Write(w, r, problem.Overloaded, "The server is at its concurrency limit; retry shortly.")
+				return
+			}
+		}
+		defer func() { <-sem.slots }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wait queues for a slot of sem. It returns "" once the slot is held, or the
+// reason the request was shed: queue_full, queue_timeout, or canceled.
+func (c *ConcurrencyLimiter) wait(ctx context.Context, sem *semaphore) string {
+	if sem.queued.Add(1) > int64(sem.limit.Queue) {
+		sem.queued.Add(-1)
+		return "queue_full"
+	}
+	defer sem.queued.Add(-1)
+
+	SetStage(ctx, "queue")
+	start := time.Now()
+	timer := time.NewTimer(c.maxWait)
+	defer timer.Stop()
+
+	outcome := ""
+	select {
+	case sem.slots <- struct{}{}:
+		SetStage(ctx, "handler")
+	case <-timer.C:
+		outcome = "queue_timeout"
+	case <-ctx.Done():
+		outcome = "canceled"
+	}
+
+	waited := float64(time.Since(start).Microseconds()) / 1000
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Float64("concurrency.wait_ms", waited))
+	result := outcome
+	if result == "" {
+		result = "admitted"
+	}
+	c.waitHistogram.Record(ctx, waited, metric.WithAttributes(
+		attribute.String("concurrency.limiter", sem.name),
+		attribute.String("concurrency.outcome", result),
+	))
+	return outcome
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// openConns tracks the state of each open connection on the servers using
+// ConnState, and the number of connections in each state.
+var openConns struct {
+	mu      sync.Mutex
+	states  map[net.Conn]http.ConnState
+	byState map[http.ConnState]int64
+}
+
+// connStates are the reported states; hijacked and closed connections are no
+// longer open.
+var connStates = []http.ConnState{http.StateNew, http.StateActive, http.StateIdle}
+
+func init() {
+	openConns.states = make(map[net.Conn]http.ConnState)
+	openConns.byState = make(map[http.ConnState]int64)
+
+	gauge, err := meter.Int64ObservableGauge(
+		"http.server.open_connections",
+		metric.WithDescription("Number of open HTTP server connections, by state (new, active, or idle)"),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create http.server.open_connections gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		openConns.mu.Lock()
+		defer openConns.mu.Unlock()
+		for _, s := range connStates {
+			o.ObserveInt64(gauge, openConns.byState[s], metric.WithAttributes(attribute.String("http.connection.state", s.String())))
+		}
+		return nil
+	}, gauge)
+	if err != nil {
+		log.Fatalf("failed to register http.server.open_connections gauge: %v", err)
+	}
+}
+
+// ConnState is an http.Server ConnState hook that counts open connections by
+// state in the http.server.open_connections gauge, showing keep-alive reuse
+// and connections held by slow clients.
+func ConnState(c net.Conn, state http.ConnState) {
+	openConns.mu.Lock()
+	defer openConns.mu.Unlock()
+	if prev, ok := openConns.states[c]; ok {
+		openConns.byState[prev]--
+	}
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(openConns.states, c)
+	default:
+		openConns.states[c] = state
+		openConns.byState[state]++
+	}
+}
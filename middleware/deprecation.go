@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Deprecation describes a deprecated route: when it was deprecated, when it
+// will be removed, and the route that replaces it.
+type Deprecation struct {
+	Since     time.Time
+	Sunset    time.Time
+	Successor string
+}
+
+var deprecatedHitsCounter metric.Int64Counter
+
+func init() {
+	var err error
+	deprecatedHitsCounter, err = meter.Int64Counter(
+		"deprecated_route_hits_total",
+		metric.WithDescription("The total number of requests served by deprecated routes"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create deprecated_route_hits_total counter: %v", err)
+	}
+}
+
+// Deprecate marks a route deprecated. Responses carry the Deprecation (RFC
+// 9745) and Sunset (RFC 8594) headers and a successor-version Link, the
+// request span gets http.route.deprecated and the sunset date, and each hit is
+// counted in deprecated_route_hits_total by route and API key, so remaining
+// callers can be found before the route is removed. Requests are still served
+// after the sunset date; deprecation.past_sunset marks them.
+func Deprecate(d Deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			h := w.Header()
+			if !d.Since.IsZero() {
+				h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+			} else {
+				h.Set("Deprecation", "true")
+			}
+			attrs := []attribute.KeyValue{attribute.Bool("http.route.deprecated", true)}
+			if !d.Sunset.IsZero() {
+				h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+				attrs = append(attrs,
+					attribute.String("deprecation.sunset", d.Sunset.UTC().Format(time.DateOnly)),
+					attribute.Bool("deprecation.past_sunset", time.Now().After(d.Sunset)),
+				)
+			}
+			if d.Successor != "" {
+				h.Add("Link", "<"+d.Successor+`>; rel="successor-version"`)
+				attrs = append(attrs, attribute.String("deprecation.successor", d.Successor))
+			}
+			trace.SpanFromContext(ctx).SetAttributes(attrs...)
+
+			client := "anonymous"
+			if key, ok := APIKeyFromContext(ctx); ok {
+				client = key.Name
+			}
+			deprecatedHitsCounter.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("http.route", routeFromPattern(r.Pattern)),
+				attribute.String("api_key.name", client),
+			))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"app/featureflags"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// FeatureGate serves a route only while the named feature flag is on for the
+// client. When it is off the route answers as if it did not exist (404) when
+// hide is set, otherwise with 503. Flags are evaluated per session, falling
+// back to the client address, so partial rollouts are sticky; each evaluation
+// is recorded on the request span (see featureflags.Evaluate).
+func FeatureGate(flag string, hide bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if featureflags.Evaluate(r.Context(), flag, rolloutKey(r)).Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if hide {
+				problem.Write(w, r, problem.NotFound, "No route matches "+r.URL.Path+".")
+				return
+			}
+			problem.Write(w, r, problem.FeatureDisabled, "This feature is currently disabled.")
+		})
+	}
+}
+
+// rolloutKey identifies the client for percentage rollouts: the session ID
+// when Sessions ran, otherwise the client address.
+func rolloutKey(r *http.Request) string {
+	if id := baggage.FromContext(r.Context()).Member(SessionIDKey).Value(); id != "" {
+		return id
+	}
+	return clientKey(r)
+}
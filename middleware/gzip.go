@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	compressionRatioHistogram metric.Float64Histogram
+
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+func init() {
+	var err error
+	compressionRatioHistogram, err = meter.Float64Histogram(
+		"response_compression_ratio",
+		metric.WithDescription("The ratio of uncompressed to compressed response body size"),
+		metric.WithUnit("1"),
+		metric.WithExplicitBucketBoundaries(1, 1.5, 2, 3, 4, 6, 8, 12, 16),
+	)
+	if err != nil {
+		log.Fatalf("failed to create response_compression_ratio histogram: %v", err)
+	}
+}
+
+// Gzip compresses JSON responses (including problem+json) for clients that
+// accept gzip. The negotiated encoding is set as
+// http.response.content_encoding on the request span, and the compression
+// ratio of each compressed response is recorded.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(gw, r)
+		gw.close()
+
+		encoding := "identity"
+		if gw.gz != nil {
+			encoding = "gzip"
+			if gw.compressed.n > 0 {
+				compressionRatioHistogram.Record(r.Context(), float64(gw.uncompressed)/float64(gw.compressed.n))
+			}
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.response.content_encoding", encoding))
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter decides on the first write whether to compress, based on
+// the response's content type and status.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	decided      bool
+	gz           *gzip.Writer
+	compressed   countingWriter
+	uncompressed int
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	g.decide(status)
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.decided {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz == nil {
+		return g.ResponseWriter.Write(b)
+	}
+	g.uncompressed += len(b)
+	return g.gz.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *gzipResponseWriter) decide(status int) {
+	if g.decided {
+		return
+	}
+	g.decided = true
+	h := g.Header()
+	if status == http.StatusNoContent || status == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	g.compressed.w = g.ResponseWriter
+	g.gz = gzipWriters.Get().(*gzip.Writer)
+	g.gz.Reset(&g.compressed)
+}
+
+func (g *gzipResponseWriter) close() {
+	if g.gz == nil {
+		return
+	}
+	_ = g.gz.Close()
+	gzipWriters.Put(g.gz)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w interface{ Write([]byte) (int, error) }
+	n int
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"app/heatmap"
+)
+
+// LatencyHeatmap times each routed request into its route's latency heatmap,
+// served at GET /debug/latency (see the heatmap package). Requests no route
+// matches are not timed.
+func LatencyHeatmap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeFromPattern(r.Pattern)
+		if route == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		heatmap.Observe(route, time.Since(start))
+	})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sync/atomic"
+
+	"app/instrumentation"
+)
+
+// InstrumentationHeader tells load tests which arm of the instrumentation A/B
+// test served a response: "off" for no-op telemetry, "on" for the rest.
+const InstrumentationHeader = "X-Instrumentation"
+
+// abCounter buckets requests that carry no request ID.
+var abCounter atomic.Uint64
+
+// InstrumentationAB serves the configured percentage of requests with no-op
+// telemetry (see the instrumentation package) and tags every response with the
+// arm it was served by, so a load test can compare the latencies of the two
+// arms served by the same process. A request is bucketed by a hash of its
+// X-Request-ID, so a client that sends the same ID gets the same arm, and
+// round-robin otherwise. It runs before otelhttp so the request span and HTTP
+// server metrics are switched off too. With the percentage at 0, the default,
+// requests are left alone and untagged.
+func InstrumentationAB(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		percent := instrumentation.NoopPercent()
+		if percent == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if abBucket(r) < percent {
+			w.Header().Set(InstrumentationHeader, "off")
+			r = r.WithContext(instrumentation.Disable(r.Context()))
+		} else {
+			w.Header().Set(InstrumentationHeader, "on")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// abBucket returns the request's A/B bucket, 0-99.
+func abBucket(r *http.Request) int {
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(id))
+		return int(h.Sum32() % 100)
+	}
+	return int(abCounter.Add(1) % 100)
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+
+	"app/logging"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// IPFilter admits clients by CIDR. Denied ranges take precedence over allowed
+// ones; with no allowed ranges, every client not denied is admitted.
+type IPFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+
+	rejectedCounter metric.Int64Counter
+}
+
+// NewIPFilter creates a filter from CIDR lists such as "10.0.0.0/8". Invalid
+// entries are skipped with a warning.
+func NewIPFilter(allow, deny []string) *IPFilter {
+	counter, err := meter.Int64Counter(
+		"ip_filter_rejected_total",
+		metric.WithDescription("The total number of requests rejected by the IP allowlist or denylist"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create ip_filter_rejected_total counter: %v", err)
+	}
+	return &IPFilter{allow: parsePrefixes(allow), deny: parsePrefixes(deny), rejectedCounter: counter}
+}
+
+func parsePrefixes(cidrs []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			log.Printf("[WARN] ignoring invalid CIDR %q: %v", cidr, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// Middleware answers 403 to clients outside the allowed ranges or inside the
+// denied ones. Each rejection is logged at WARN and counted with the client's
+// network (its /24, or /64 for IPv6) rather than its address, to keep the
+// attribute's cardinality low.
+func (f *IPFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := clientAddr(r)
+		reason := ""
+		switch {
+		case !ok:
+			reason = "unparseable"
+		case containsAddr(f.deny, addr):
+			reason = "denied"
+		case len(f.allow) > 0 && !containsAddr(f.allow, addr):
+			reason = "not_allowed"
+		}
+		if reason == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		network := clientNetwork(addr, ok)
+		attrs := []attribute.KeyValue{
+			attribute.String("client.network", network),
+			attribute.String("ip_filter.reason", reason),
+		}
+		f.rejectedCounter.Add(r.Context(), 1, metric.WithAttributes(attrs...))
+		logAttrs := append(attrs, attribute.String("url.path", r.URL.Path))
+		logging.DefaultLogger.Warn(r.Context(), "Rejected request from disallowed client", logAttrs...)
+		logging.JSONLogger.Warn(r.Context(), "Rejected request from disallowed client", logAttrs...)
+		problem.Write(w, r, problem.Forbidden, "The client address is not allowed.")
+	})
+}
+
+// clientAddr parses the request's remote IP address.
+func clientAddr(r *http.Request) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(clientKey(r))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientNetwork returns the /24 (IPv4) or /64 (IPv6) network containing addr.
+func clientNetwork(addr netip.Addr, ok bool) string {
+	if !ok {
+		return "unknown"
+	}
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "unknown"
+	}
+	return prefix.String()
+}
@@ -0,0 +1,404 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"app/config"
+	"app/httpclient"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Baggage members and span attributes populated from JWT claims.
+const (
+	EndUserIDKey = "enduser.id"
+	TenantIDKey  = "tenant.id"
+)
+
+// jwksRefreshInterval limits how often the JWKS is refetched for unknown key IDs.
+const jwksRefreshInterval = 5 * time.Minute
+
+// jwksRetryInterval is how long a failed JWKS fetch holds off the next one.
+const jwksRetryInterval = 10 * time.Second
+
+// jwksFetchTimeout bounds a JWKS fetch, retries included.
+const jwksFetchTimeout = 3 * time.Second
+
+// clockSkew is the leeway allowed when checking exp and nbf.
+const clockSkew = 30 * time.Second
+
+var (
+	errTokenMalformed = errors.New("malformed token")
+	errTokenSignature = errors.New("invalid token signature")
+	errTokenExpired   = errors.New("token expired or not yet valid")
+	errTokenClaims    = errors.New("token issuer or audience mismatch")
+)
+
+// JWTConfig configures JWTAuth. Set HMACSecret for HS256 tokens, JWKSURL for
+// RS256 tokens, or both.
+type JWTConfig struct {
+	HMACSecret []byte
+	JWKSURL    string
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// Required rejects requests without a bearer token.
+	Required bool
+}
+
+// jwtClaims are the registered and custom claims this service reads.
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Tenant    string          `json:"tenant"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type authenticatedKey struct{}
+
+// JWTAuth validates bearer tokens and maps the sub and tenant claims into
+// baggage and span attributes, so identity follows the request downstream.
+type JWTAuth struct {
+	cfg    JWTConfig
+	client *httpclient.Client
+
+	mu   sync.RWMutex
+	jwks map[string]*rsa.PublicKey
+	// lastFetch is when the JWKS was last fetched, and lastFailure when a
+	// fetch last failed.
+	lastFetch   time.Time
+	lastFailure time.Time
+	// fetching is closed when the fetch in flight ends; nil when there is
+	// none.
+	fetching chan struct{}
+
+	rejectedCounter metric.Int64Counter
+}
+
+// NewJWTAuth creates a validator. With neither an HMAC secret nor a JWKS URL,
+// validation is disabled.
+func NewJWTAuth(cfg JWTConfig) *JWTAuth {
+	counter, err := meter.Int64Counter(
+		"jwt_rejected_total",
+		metric.WithDescription("The total number of requests rejected by JWT validation"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create jwt_rejected_total counter: %v", err)
+	}
+	return &JWTAuth{
+		cfg:             cfg,
+		client:          httpclient.New("jwks"),
+		jwks:            make(map[string]*rsa.PublicKey),
+		rejectedCounter: counter,
+	}
+}
+
+// NewJWTAuthFromConfig creates a validator configured by auth.jwt.
+func NewJWTAuthFromConfig(cfg config.JWT) *JWTAuth {
+	return NewJWTAuth(JWTConfig{
+		HMACSecret: []byte(cfg.HMACSecret),
+		JWKSURL:    cfg.JWKSURL,
+		Issuer:     cfg.Issuer,
+		Audience:   cfg.Audience,
+		Required:   cfg.Required,
+	})
+}
+
+// Enabled reports whether a signing key source is configured.
+func (a *JWTAuth) Enabled() bool {
+	return len(a.cfg.HMACSecret) > 0 || a.cfg.JWKSURL != ""
+}
+
+// Middleware validates an "Authorization: Bearer" token when present, answering
+// 401 for invalid tokens (and for missing ones when Required is set). Valid
+// tokens put sub and tenant into baggage and onto the request span, and mark
+// the request as authenticated so API-key checks are skipped.
+func (a *JWTAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			if a.cfg.Required {
+				a.reject(w, r, span, "missing", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := a.validate(r.Context(), token, time.Now())
+		if err != nil {
+			a.reject(w, r, span, "invalid", err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), authenticatedKey{}, true)
+		bag := baggage.FromContext(ctx)
+		for key, value := range map[string]string{EndUserIDKey: claims.Subject, TenantIDKey: claims.Tenant} {
+			if value == "" {
+				continue
+			}
+			span.SetAttributes(attribute.String(key, value))
+			if member, err := baggage.NewMember(key, value); err == nil {
+				if b, err := bag.SetMember(member); err == nil {
+					bag = b
+				}
+			}
+		}
+		ctx = baggage.ContextWithBaggage(ctx, bag)
+		span.SetAttributes(attribute.String("auth.method", "jwt"))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticatedByJWT reports whether JWTAuth accepted the request.
+func authenticatedByJWT(ctx context.Context) bool {
+	ok, _ := ctx.Value(authenticatedKey{}).(bool)
+	return ok
+}
+
+// reject answers 401 and records why on the request span.
+func (a *JWTAuth) reject(w http.ResponseWriter, r *http.Request, span trace.Span, reason string, err error) {
+	attrs := []attribute.KeyValue{attribute.String("auth.reason", reason)}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.reason", err.Error()))
+	}
+	span.AddEvent("auth.rejected", trace.WithAttributes(attrs...))
+	span.SetAttributes(attribute.String("auth.result", reason))
+	a.rejectedCounter.Add(r.Context(), 1, metric.WithAttributes(attribute.String("auth.reason", reason)))
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	problem.Write(w, r, problem.Unauthorized, "A valid bearer token is required.")
+}
+
+// validate verifies the token's signature and time-based and configured claims.
+func (a *JWTAuth) validate(ctx context.Context, token string, now time.Time) (jwtClaims, error) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errTokenMalformed
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errTokenMalformed
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if len(a.cfg.HMACSecret) == 0 {
+			return claims, fmt.Errorf("%w: HS256 is not configured", errTokenSignature)
+		}
+		mac := hmac.New(sha256.New, a.cfg.HMACSecret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return claims, errTokenSignature
+		}
+	case "RS256":
+		key, err := a.publicKey(ctx, header.Kid)
+		if err != nil {
+			return claims, err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return claims, errTokenSignature
+		}
+	default:
+		return claims, fmt.Errorf("%w: unsupported alg %q", errTokenSignature, header.Alg)
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, err
+	}
+	if claims.ExpiresAt != nil && now.After(time.Unix(*claims.ExpiresAt, 0).Add(clockSkew)) {
+		return claims, errTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return claims, errTokenExpired
+	}
+	if a.cfg.Issuer != "" && claims.Issuer != a.cfg.Issuer {
+		return claims, errTokenClaims
+	}
+	if a.cfg.Audience != "" && !audienceContains(claims.Audience, a.cfg.Audience) {
+		return claims, errTokenClaims
+	}
+	return claims, nil
+}
+
+// publicKey returns the JWKS key with the given ID, refetching the JWKS at most
+// once per jwksRefreshInterval when the ID is unknown, or once per
+// jwksRetryInterval after a failed fetch. Known keys are served under the read
+// lock, and the fetch runs without the lock, so it does not hold up requests
+// signed with known keys. Concurrent requests with unknown IDs wait for the
+// one fetch in flight.
+func (a *JWTAuth) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if a.cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("%w: RS256 is not configured", errTokenSignature)
+	}
+	if key, ok := a.cachedKey(kid); ok {
+		return key, nil
+	}
+
+	a.mu.Lock()
+	if key, ok := a.jwks[kid]; ok {
+		a.mu.Unlock()
+		return key, nil
+	}
+	if fetching := a.fetching; fetching != nil {
+		a.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if key, ok := a.cachedKey(kid); ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w: unknown key id %q", errTokenSignature, kid)
+	}
+	if time.Since(a.lastFetch) < jwksRefreshInterval || time.Since(a.lastFailure) < jwksRetryInterval {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("%w: unknown key id %q", errTokenSignature, kid)
+	}
+	fetching := make(chan struct{})
+	a.fetching = fetching
+	a.mu.Unlock()
+
+	// The fetch outlives the request that started it, so a client going away
+	// does not fail it for the requests waiting on it.
+	fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksFetchTimeout)
+	keys, err := a.fetchJWKS(fetchCtx)
+	cancel()
+
+	a.mu.Lock()
+	if err != nil {
+		a.lastFailure = time.Now()
+	} else {
+		a.jwks = keys
+		a.lastFetch = time.Now()
+	}
+	a.fetching = nil
+	close(fetching)
+	a.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key id %q", errTokenSignature, kid)
+}
+
+// cachedKey returns the key with the given ID from the last fetched JWKS.
+func (a *JWTAuth) cachedKey(kid string) (*rsa.PublicKey, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	key, ok := a.jwks[kid]
+	return key, ok
+}
+
+// fetchJWKS downloads and parses the RSA keys in the JWKS.
+func (a *JWTAuth) fetchJWKS(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building JWKS request: %w", err)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// decodeSegment decodes a base64url JSON token segment.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errTokenMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errTokenMalformed
+	}
+	return nil
+}
+
+// audienceContains reports whether the aud claim (a string or an array) contains want.
+func audienceContains(raw json.RawMessage, want string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == want
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil {
+		for _, aud := range many {
+			if aud == want {
+				return true
+			}
+		}
+	}
+	return false
+}
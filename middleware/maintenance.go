@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"app/problem"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultMaintenanceRetryAfter is the Retry-After sent when none is configured.
+const defaultMaintenanceRetryAfter = time.Minute
+
+// MaintenanceState is the maintenance mode setting.
+type MaintenanceState struct {
+	Enabled    bool          `json:"enabled"`
+	RetryAfter time.Duration `json:"-"`
+	Since      *time.Time    `json:"since,omitempty"`
+}
+
+var (
+	maintenanceMu    sync.RWMutex
+	maintenanceState MaintenanceState
+)
+
+func init() {
+	gauge, err := meter.Int64ObservableGauge(
+		"maintenance_mode",
+		metric.WithDescription("Whether maintenance mode is enabled (1) or not (0)"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create maintenance_mode gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		var v int64
+		if Maintenance().Enabled {
+			v = 1
+		}
+		o.ObserveInt64(gauge, v)
+		return nil
+	}, gauge)
+	if err != nil {
+		log.Fatalf("failed to register maintenance_mode gauge: %v", err)
+	}
+}
+
+// Maintenance returns the current maintenance mode setting.
+func Maintenance() MaintenanceState {
+	maintenanceMu.RLock()
+	defer maintenanceMu.RUnlock()
+	return maintenanceState
+}
+
+// SetMaintenance turns maintenance mode on or off. A retryAfter of 0 uses the
+// default of one minute.
+func SetMaintenance(enabled bool, retryAfter time.Duration) MaintenanceState {
+	if retryAfter <= 0 {
+		retryAfter = defaultMaintenanceRetryAfter
+	}
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	state := MaintenanceState{Enabled: enabled, RetryAfter: retryAfter}
+	if enabled {
+		since := time.Now()
+		if maintenanceState.Enabled && maintenanceState.Since != nil {
+			since = *maintenanceState.Since
+		}
+		state.Since = &since
+	}
+	maintenanceState = state
+	return state
+}
+
+// MaintenanceMode answers 503 with Retry-After while maintenance mode is on.
+// Those requests are tagged maintenance=true on the request span and on the
+// otelhttp server metrics, so dashboards can separate them from real failures.
+func MaintenanceMode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := Maintenance()
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		attr := attribute.Bool("maintenance", true)
+		trace.SpanFromContext(r.Context()).SetAttributes(attr)
+		if labeler, ok := otelhttp.LabelerFromContext(r.Context()); ok {
+			labeler.Add(attr)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(state.RetryAfter.Seconds())))
+		problem.Write(w, r, problem.Maintenance, "The service is undergoing maintenance.")
+	})
+}
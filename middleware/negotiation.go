@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// jsonMediaType is the default request and response media type.
+const jsonMediaType = "application/json"
+
+// MediaTypes are the media types a route consumes and produces. An empty
+// field means JSON.
+type MediaTypes struct {
+	Request  string
+	Response string
+}
+
+// defaultRouteMediaTypes are the routes that do not speak JSON both ways.
+var defaultRouteMediaTypes = map[string]MediaTypes{
+	"POST /orders/import": {Request: "application/x-ndjson"},
+	"GET /docs":           {Response: "text/html"},
+}
+
+// ContentNegotiation enforces request Content-Types and honors Accept, per
+// route.
+type ContentNegotiation struct {
+	routes map[string]MediaTypes
+
+	failureCounter metric.Int64Counter
+}
+
+// NewContentNegotiation creates content negotiation with per-route media types
+// keyed by ServeMux pattern. Other routes consume and produce JSON.
+func NewContentNegotiation(routes map[string]MediaTypes) *ContentNegotiation {
+	counter, err := meter.Int64Counter(
+		"content_negotiation_failures_total",
+		metric.WithDescription("The total number of requests rejected for their Content-Type or Accept header"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create content_negotiation_failures_total counter: %v", err)
+	}
+	return &ContentNegotiation{routes: routes, failureCounter: counter}
+}
+
+// NewContentNegotiationFromEnv creates content negotiation with the built-in
+// per-route media types.
+func NewContentNegotiationFromEnv() *ContentNegotiation {
+	return NewContentNegotiation(defaultRouteMediaTypes)
+}
+
+// Middleware answers 415 when a request body's Content-Type is not the one the
+// route consumes (JSON also accepts +json types), and 406 when the Accept
+// header rules out the type it produces. Clients that accept application/json
+// but not application/problem+json get their error responses as plain JSON.
+// The negotiated types are recorded on the request span.
+func (c *ContentNegotiation) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		types := c.routes[r.Pattern]
+		if types.Request == "" {
+			types.Request = jsonMediaType
+		}
+		if types.Response == "" {
+			types.Response = jsonMediaType
+		}
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+
+		accept := r.Header.Get("Accept")
+		if accept != "" && !accepts(accept, problem.ContentType) && accepts(accept, jsonMediaType) {
+			ctx = problem.WithMediaType(ctx, jsonMediaType)
+			r = r.WithContext(ctx)
+		}
+
+		if r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			span.SetAttributes(attribute.String("http.request.media_type", mediaType))
+			if err != nil || !matchesMediaType(mediaType, types.Request) {
+				c.reject(r, span, "unsupported_media_type")
+				problem.Write(w, r, problem.UnsupportedMedia, "The request body must be "+types.Request+".")
+				return
+			}
+		}
+
+		if accept != "" && !accepts(accept, types.Response) {
+			c.reject(r, span, "not_acceptable")
+			problem.Write(w, r, problem.NotAcceptable, "This endpoint only produces "+types.Response+".")
+			return
+		}
+		span.SetAttributes(attribute.String("http.response.media_type", types.Response))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reject records a negotiation failure on the span and in the counter.
+func (c *ContentNegotiation) reject(r *http.Request, span trace.Span, reason string) {
+	span.SetAttributes(attribute.String("content_negotiation.failure", reason))
+	c.failureCounter.Add(r.Context(), 1, metric.WithAttributes(
+		attribute.String("http.route", r.Pattern),
+		attribute.String("content_negotiation.failure", reason),
+	))
+}
+
+// matchesMediaType reports whether a request's media type is acceptable where
+// want is expected. JSON routes also take structured-syntax +json types.
+func matchesMediaType(mediaType, want string) bool {
+	if mediaType == want {
+		return true
+	}
+	return want == jsonMediaType && strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// accepts reports whether an Accept header allows mediaType: some range with
+// a non-zero quality matches it exactly, by type (type/*), or as */*.
+func accepts(accept, mediaType string) bool {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	for _, entry := range strings.Split(accept, ",") {
+		rng, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				continue
+			}
+		}
+		if rng == "*/*" || rng == mediaType || rng == typ+"/*" {
+			return true
+		}
+	}
+	return false
+}
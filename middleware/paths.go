@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type originalPathKey struct{}
+
+// PathNormalizer rewrites request paths to their canonical form before
+// routing, so that the matched pattern, span names, and metrics do not depend
+// on how clients spell a path.
+type PathNormalizer struct {
+	exact  map[string]string
+	prefix map[string]string
+
+	rewriteCounter metric.Int64Counter
+}
+
+// NewPathNormalizer creates a normalizer with aliases mapping an alternative
+// path to its canonical one. An alias ending in "/*" maps a whole prefix: the
+// rest of the path is appended to the target, which must also end in "/*".
+func NewPathNormalizer(aliases map[string]string) *PathNormalizer {
+	counter, err := meter.Int64Counter(
+		"path_rewrites_total",
+		metric.WithDescription("The total number of request paths rewritten to their canonical form"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create path_rewrites_total counter: %v", err)
+	}
+	n := &PathNormalizer{
+		exact:          make(map[string]string),
+		prefix:         make(map[string]string),
+		rewriteCounter: counter,
+	}
+	for from, to := range aliases {
+		fromPrefix, isPrefix := strings.CutSuffix(from, "/*")
+		toPrefix, toIsPrefix := strings.CutSuffix(to, "/*")
+		switch {
+		case isPrefix && toIsPrefix:
+			n.prefix[fromPrefix+"/"] = toPrefix + "/"
+		case !isPrefix && !toIsPrefix:
+			n.exact[from] = to
+		default:
+			log.Printf("[WARN] ignoring route alias %q=%q: both or neither must end in /*", from, to)
+		}
+	}
+	return n
+}
+
+// NewPathNormalizerFromConfig creates a normalizer with server.route_aliases.
+func NewPathNormalizerFromConfig(cfg config.Server) *PathNormalizer {
+	return NewPathNormalizer(cfg.RouteAliases)
+}
+
+// Middleware wraps the router, like CORS, so paths are rewritten before
+// routing. It cleans the path (dropping trailing slashes, duplicate slashes,
+// and dot segments) and then applies the aliases; an exact alias wins over a
+// prefix one, and among prefixes the longest wins. Requests are rewritten in
+// place rather than redirected, so POST bodies survive. Rewrites are counted
+// in path_rewrites_total by kind, and Route records the path the client sent.
+func (n *PathNormalizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		original := r.URL.Path
+		p := cleanPath(original)
+		kind := "normalized"
+		if aliased, ok := n.alias(p); ok {
+			p, kind = aliased, "alias"
+		}
+		if p == original {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		n.rewriteCounter.Add(r.Context(), 1, metric.WithAttributes(attribute.String("path_rewrite.kind", kind)))
+		r2 := r.WithContext(context.WithValue(r.Context(), originalPathKey{}, original))
+		u := *r.URL
+		u.Path, u.RawPath = p, ""
+		r2.URL = &u
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// alias returns the canonical path for an aliased path.
+func (n *PathNormalizer) alias(p string) (string, bool) {
+	if to, ok := n.exact[p]; ok {
+		return to, true
+	}
+	best := ""
+	for from := range n.prefix {
+		if strings.HasPrefix(p, from) && len(from) > len(best) {
+			best = from
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return n.prefix[best] + strings.TrimPrefix(p, best), true
+}
+
+// cleanPath returns the canonical form of a request path. The root path and
+// empty paths become "/".
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
+
+// originalPath returns the path the client sent when PathNormalizer rewrote
+// it.
+func originalPath(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(originalPathKey{}).(string)
+	return p, ok
+}
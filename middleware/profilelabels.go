@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+
+	"app/tracing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type profileLabelsKey struct{}
+
+// ProfileLabels runs the request with runtime/pprof labels naming its route
+// (http.route) and trace (trace_id), so CPU and goroutine profiles taken from
+// /debug/pprof can be sliced by endpoint with -tagfocus and their hot samples
+// looked up in the trace backend. SetStage adds the workflow stage as the
+// stage label. Goroutines the request starts inherit the labels. While
+// continuous profiles are pushed, trace_id is left out, since Pyroscope would
+// make a series of every trace; the request span's ID is added as span_id
+// instead, which Pyroscope keeps out of its series, and set on the span as
+// pyroscope.profile.id, linking the two.
+func ProfileLabels(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		labels := []string{"http.route", routeFromPattern(r.Pattern)}
+		span := trace.SpanFromContext(r.Context())
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			if !tracing.ProfilingEnabled() {
+				labels = append(labels, "trace_id", sc.TraceID().String())
+			} else if span.IsRecording() {
+				labels = append(labels, "span_id", sc.SpanID().String())
+				span.SetAttributes(tracing.ProfileIDAttribute.String(sc.SpanID().String()))
+			}
+		}
+		ctx := context.WithValue(r.Context(), profileLabelsKey{}, true)
+		pprof.Do(ctx, pprof.Labels(labels...), func(ctx context.Context) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+// setStageLabel replaces the calling goroutine's labels with those of ctx
+// plus the stage. It is a no-op outside ProfileLabels, which restores the
+// goroutine's labels when the request ends.
+func setStageLabel(ctx context.Context, stage string) {
+	if ctx.Value(profileLabelsKey{}) == nil {
+		return
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels("stage", stage)))
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"app/config"
+	"app/problem"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/middleware"
+
+// bucketIdleTTL is how long an idle client's bucket is kept.
+const bucketIdleTTL = 10 * time.Minute
+
+var meter = otel.Meter(instrumentationName)
+
+// tokenBucket is a single client's bucket.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a per-client token-bucket rate limiter. Clients are identified
+// by their API key when they present a valid one, otherwise by their IP address
+// as resolved by ClientInfo. Buckets are kept in memory, or in Redis when
+// configured so that replicas share them.
+type RateLimiter struct {
+	shared *redisBuckets
+	// apiKeys validates presented API keys; unset, clients are limited by
+	// IP address only.
+	apiKeys *APIKeyAuth
+
+	// mu guards the limits as well as the buckets, since the limits can be
+	// changed at runtime.
+	mu        sync.Mutex
+	rps       float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	rejectedCounter metric.Int64Counter
+}
+
+// NewRateLimiter creates a limiter allowing rps requests per second per client,
+// with bursts of up to burst requests. An rps of 0 disables limiting.
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	l := &RateLimiter{
+		rps:       rps,
+		burst:     float64(max(burst, 1)),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+
+	var err error
+	l.rejectedCounter, err = meter.Int64Counter(
+		"rate_limit_rejected_total",
+		metric.WithDescription("The total number of requests rejected by the rate limiter"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create rate_limit_rejected_total counter: %v", err)
+	}
+	limitGauge, err := meter.Float64ObservableGauge(
+		"rate_limit_requests_per_second",
+		metric.WithDescription("The configured per-client request rate limit"),
+		metric.WithUnit("{request}/s"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create rate_limit_requests_per_second gauge: %v", err)
+	}
+	burstGauge, err := meter.Int64ObservableGauge(
+		"rate_limit_burst",
+		metric.WithDescription("The configured per-client burst size"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create rate_limit_burst gauge: %v", err)
+	}
+	clientsGauge, err := meter.Int64ObservableGauge(
+		"rate_limit_clients",
+		metric.WithDescription("The number of clients currently tracked by the rate limiter"),
+		metric.WithUnit("{client}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create rate_limit_clients gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		l.mu.Lock()
+		o.ObserveFloat64(limitGauge, l.rps)
+		o.ObserveInt64(burstGauge, int64(l.burst))
+		o.ObserveInt64(clientsGauge, int64(len(l.buckets)))
+		l.mu.Unlock()
+		return nil
+	}, limitGauge, burstGauge, clientsGauge)
+	if err != nil {
+		log.Fatalf("failed to register rate limit gauges: %v", err)
+	}
+	return l
+}
+
+// NewRateLimiterFromConfig creates a limiter from the service configuration.
+// When a Redis URL is configured, buckets are shared through that Redis
+// server, with each update bounded by the configured timeout.
+func NewRateLimiterFromConfig(cfg config.RateLimit) *RateLimiter {
+	l := NewRateLimiter(cfg.RPS, cfg.Burst)
+	if cfg.RedisURL != "" {
+		shared, err := newRedisBuckets(cfg.RedisURL, cfg.RedisTimeout)
+		if err != nil {
+			log.Printf("[WARN] invalid rate limit Redis URL, limiting locally: %v", err)
+		} else {
+			l.shared = shared
+		}
+	}
+	return l
+}
+
+// SetLimits changes the per-client rate and burst. Existing buckets keep their
+// tokens, capped at the new burst on their next request.
+func (l *RateLimiter) SetLimits(rps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rps = rps
+	l.burst = float64(max(burst, 1))
+}
+
+// IdentifyByAPIKey limits clients presenting a key that auth accepts by that
+// key rather than by address. The limiter runs before authentication, so keys
+// are checked here: a client cycling through made-up keys is still limited by
+// its address. It must be called before the limiter serves requests.
+func (l *RateLimiter) IdentifyByAPIKey(auth *APIKeyAuth) {
+	l.apiKeys = auth
+}
+
+// limits returns the current rate and burst.
+func (l *RateLimiter) limits() (rps, burst float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rps, l.burst
+}
+
+// Middleware rejects requests over the client's limit with 429 and Retry-After.
+// Every limited request records its outcome and the bucket backend on the
+// request span. When Redis is configured but unavailable, the request is
+// limited by the local buckets instead and counted in rate_limit_fallback_total.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rps, _ := l.limits(); rps <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := bucketKey(l.apiKeyName(r), clientKey(r))
+		ok, retryAfter, backend := l.take(r.Context(), key)
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.Bool("rate_limit.rejected", !ok),
+			attribute.String("rate_limit.backend", backend),
+		)
+		if !ok {
+			l.rejectedCounter.Add(r.Context(), 1, metric.WithAttributes(attribute.String("http.request.method", r.Method)))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			problem.Write(w, r, problem.TooManyRequests, "The client exceeded its request rate limit.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKeyName returns the name of the valid API key the request presents, or ""
+// if it presents none or an invalid one.
+func (l *RateLimiter) apiKeyName(r *http.Request) string {
+	if l.apiKeys == nil || !l.apiKeys.Enabled() {
+		return ""
+	}
+	presented := r.Header.Get(APIKeyHeader)
+	if presented == "" {
+		return ""
+	}
+	key, ok := l.apiKeys.lookup(presented)
+	if !ok {
+		return ""
+	}
+	return key.Name
+}
+
+// take takes a token from the client's shared bucket when Redis is available,
+// otherwise from its local bucket. It returns the backend that decided.
+func (l *RateLimiter) take(ctx context.Context, key string) (bool, time.Duration, string) {
+	now := time.Now()
+	if l.shared == nil {
+		ok, retryAfter := l.allow(key, now)
+		return ok, retryAfter, "local"
+	}
+	if l.shared.available(now) {
+		rps, burst := l.limits()
+		ok, retryAfter, err := l.shared.allow(ctx, key, rps, burst)
+		if err == nil {
+			return ok, retryAfter, "redis"
+		}
+		log.Printf("[WARN] rate limit Redis unavailable, limiting locally for %s: %v", redisRetryAfter, err)
+	}
+	l.shared.fallbackCount.Add(ctx, 1)
+	ok, retryAfter := l.allow(key, now)
+	return ok, retryAfter, "local"
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it
+// returns false and how long until a token is available.
+func (l *RateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rps <= 0 {
+		// Limiting was disabled since the request was admitted.
+		return true, 0
+	}
+
+	if now.Sub(l.lastSweep) > bucketIdleTTL {
+		for key, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdleTTL {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rps)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rps * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
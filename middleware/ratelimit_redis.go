@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redis rate limiting settings.
+const (
+	// redisKeyPrefix namespaces the bucket keys.
+	redisKeyPrefix = "ratelimit:"
+	// redisRetryAfter is how long Redis is skipped after a failure.
+	redisRetryAfter = 5 * time.Second
+)
+
+// errBucketReply is returned when the bucket script's reply is malformed.
+var errBucketReply = errors.New("unexpected rate limit script reply")
+
+// tokenBucketScript takes a token from the bucket in KEYS[1], refilling it at
+// ARGV[1] tokens per second up to ARGV[2]. It returns whether a token was
+// taken and, if not, the seconds until one is available. Redis's own clock is
+// used so replicas with skewed clocks share buckets correctly.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(b[1]) or burst
+local last = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = (1 - tokens) / rate
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('EXPIRE', KEYS[1], tonumber(ARGV[3]))
+return {allowed, tostring(wait)}
+`)
+
+// redisBuckets keeps token buckets in Redis so that every replica draws from
+// the same per-client bucket.
+type redisBuckets struct {
+	client  *redis.Client
+	addr    string
+	timeout time.Duration
+	// downUntil is when, in Unix nanoseconds, Redis is tried again after a
+	// failure.
+	downUntil atomic.Int64
+
+	latency       metric.Float64Histogram
+	fallbackCount metric.Int64Counter
+}
+
+// newRedisBuckets connects to the Redis server at url (e.g.
+// "redis://localhost:6379/0").
+func newRedisBuckets(url string, timeout time.Duration) (*redisBuckets, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	b := &redisBuckets{client: redis.NewClient(opts), addr: opts.Addr, timeout: timeout}
+	b.latency, err = meter.Float64Histogram(
+		"rate_limit_backend_duration_ms",
+		metric.WithDescription("The time taken to update a shared rate limit bucket"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create rate_limit_backend_duration_ms histogram: %v", err)
+	}
+	b.fallbackCount, err = meter.Int64Counter(
+		"rate_limit_fallback_total",
+		metric.WithDescription("The total number of requests limited locally because Redis was unavailable"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create rate_limit_fallback_total counter: %v", err)
+	}
+	return b, nil
+}
+
+// available reports whether Redis should be tried.
+func (b *redisBuckets) available(now time.Time) bool {
+	return now.UnixNano() >= b.downUntil.Load()
+}
+
+// allow takes a token from the client's shared bucket inside a
+// "rate_limit.redis" span. On error the caller falls back to local limiting,
+// and Redis is skipped for redisRetryAfter so an outage does not add a timeout
+// to every request.
+func (b *redisBuckets) allow(ctx context.Context, client string, rps, burst float64) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "rate_limit.redis",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperationName("EVALSHA"),
+			semconv.ServerAddress(b.addr),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	res, err := tokenBucketScript.Run(ctx, b.client, []string{redisKeyPrefix + client},
+		rps, burst, int(bucketIdleTTL.Seconds())).Slice()
+	outcome := "ok"
+	if err == nil && len(res) != 2 {
+		err = errBucketReply
+	}
+	if err != nil {
+		outcome = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "rate limit bucket update failed")
+		b.downUntil.Store(time.Now().Add(redisRetryAfter).UnixNano())
+	}
+	b.latency.Record(ctx, float64(time.Since(start).Microseconds())/1000, metric.WithAttributes(attribute.String("outcome", outcome)))
+	if err != nil {
+		return false, 0, err
+	}
+
+	allowed, _ := res[0].(int64)
+	wait, _ := res[1].(string)
+	secs, _ := strconv.ParseFloat(wait, 64)
+	return allowed == 1, time.Duration(secs * float64(time.Second)), nil
+}
+
+// bucketKey names a client's bucket. Clients presenting a valid API key share
+// one bucket per key name across addresses and replicas, so the key itself
+// never reaches Redis. Other clients are limited by IP address.
+func bucketKey(keyName, addr string) string {
+	if keyName == "" {
+		return "ip:" + addr
+	}
+	return "key:" + keyName
+}
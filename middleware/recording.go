@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"app/recording"
+)
+
+// RecordRequests captures each request while the admin API has recording on
+// (see the recording package), for replay with cmd/replay. It runs inside
+// otelhttp so the recording holds the request's trace ID, and inside the
+// timeout so reading the body is bounded by the request's deadline.
+func RecordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recording.Capture(r)
+		next.ServeHTTP(w, r)
+	})
+}
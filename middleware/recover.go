@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"app/logging"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var panicsRecoveredCounter metric.Int64Counter
+
+func init() {
+	var err error
+	panicsRecoveredCounter, err = meter.Int64Counter(
+		"panics_recovered_total",
+		metric.WithDescription("The total number of handler panics recovered"),
+		metric.WithUnit("{panic}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create panics_recovered_total counter: %v", err)
+	}
+}
+
+// Recover turns a panic in the wrapped handler into a 500. The panic is
+// recorded as an exception event on the request span, which is marked as
+// failed, and the stack is logged. http.ErrAbortHandler is re-panicked so
+// net/http can abort the connection as intended.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			ctx := r.Context()
+			message := fmt.Sprint(rec)
+			stack := string(debug.Stack())
+
+			span := trace.SpanFromContext(ctx)
+			span.AddEvent("exception", trace.WithAttributes(
+				attribute.String("exception.type", fmt.Sprintf("%T", rec)),
+				attribute.String("exception.message", message),
+				attribute.String("exception.stacktrace", stack),
+				attribute.Bool("exception.escaped", true),
+			))
+			span.SetStatus(codes.Error, "panic: "+message)
+			panicsRecoveredCounter.Add(ctx, 1)
+
+			logging.DefaultLogger.Error(ctx, "Recovered from handler panic",
+				attribute.String("error.reason", message),
+				attribute.String("exception.stacktrace", stack),
+			)
+			logging.JSONLogger.Error(ctx, "Recovered from handler panic",
+				attribute.String("error.reason", message),
+				attribute.String("exception.stacktrace", stack),
+			)
+
+			problem.Write(w, r, problem.InternalError, "The server encountered an unexpected error.")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
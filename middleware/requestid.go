@@ -0,0 +1,80 @@
+// Package middleware provides the HTTP middlewares applied to the application's
+// routes. Except for CORS, which wraps the whole router, and InstrumentationAB,
+// which decides whether the request is instrumented, each middleware runs
+// inside the otelhttp handler, so the request span is available from the
+// request context.
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"app/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header used to accept and echo request IDs.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds client-supplied request IDs.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestID accepts a valid X-Request-ID from the client or generates one, and
+// attaches it to the request span, the baggage (so downstream services and all
+// logs see it), and the response header.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		if member, err := baggage.NewMember(logging.RequestIDKey, id); err == nil {
+			if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+				ctx = baggage.ContextWithBaggage(ctx, bag)
+			}
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(logging.RequestIDKey, id))
+		w.Header().Set(RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the request ID set by RequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns a random 128-bit hex request ID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether a client-supplied ID is safe to reuse:
+// non-empty, bounded, and limited to characters that are safe in headers,
+// baggage, and logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Route sets http.route on the request span and on the otelhttp server
+// metrics from the matched ServeMux pattern, so requests are grouped by route
+// rather than by raw path. When PathNormalizer rewrote the path, the path the
+// client sent is recorded as http.request.original_path.
+func Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordOriginalPath(r)
+		if route := routeFromPattern(r.Pattern); route != "" {
+			attr := semconv.HTTPRoute(route)
+			trace.SpanFromContext(r.Context()).SetAttributes(attr)
+			if labeler, ok := otelhttp.LabelerFromContext(r.Context()); ok {
+				labeler.Add(attr)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RouteSpanName is an otelhttp span name formatter that names server spans
+// after the matched pattern (e.g. "GET /orders/{id}"), keeping span-name
+// cardinality bounded by the number of routes. It falls back to the method.
+func RouteSpanName(_ string, r *http.Request) string {
+	if r.Pattern == "" {
+		return r.Method
+	}
+	return r.Pattern
+}
+
+// routeFromPattern strips the method (and any host) from a ServeMux pattern,
+// leaving the path template used for http.route.
+func routeFromPattern(pattern string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = strings.TrimLeft(path, " \t")
+	}
+	if i := strings.Index(pattern, "/"); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
+// recordOriginalPath sets http.request.original_path on the request span when
+// the path was rewritten.
+func recordOriginalPath(r *http.Request) {
+	if original, ok := originalPath(r.Context()); ok {
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request.original_path", original))
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var (
+	requestDuration metric.Float64Histogram
+	activeRequests  metric.Int64UpDownCounter
+)
+
+func init() {
+	var err error
+	requestDuration, err = meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	)
+	if err != nil {
+		log.Fatalf("failed to create http.server.request.duration histogram: %v", err)
+	}
+	activeRequests, err = meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create http.server.active_requests counter: %v", err)
+	}
+}
+
+// ServerMetrics records the stable HTTP semantic-convention server metrics,
+// http.server.request.duration and http.server.active_requests, which the
+// otelhttp handler does not yet emit. It must run directly inside the otelhttp
+// handler: the duration metric also takes the attributes other middlewares add
+// through the otelhttp labeler, such as http.route and the route tags.
+// Requests the otelhttp filter excluded are not recorded.
+func ServerMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		labeler, ok := otelhttp.LabelerFromContext(ctx)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLScheme(scheme),
+		}
+		activeRequests.Add(ctx, 1, metric.WithAttributes(base...))
+		defer activeRequests.Add(ctx, -1, metric.WithAttributes(base...))
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		attrs := append(base,
+			semconv.HTTPResponseStatusCode(rec.status),
+			semconv.NetworkProtocolVersion(strings.TrimPrefix(r.Proto, "HTTP/")),
+		)
+		if rec.status >= 500 {
+			attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(rec.status)))
+		}
+		attrs = append(attrs, labeler.Get()...)
+		requestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	})
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SessionCookie is the name of the session cookie.
+const SessionCookie = "session_id"
+
+// SessionIDKey is the baggage member and span attribute that carries the
+// session ID.
+const SessionIDKey = "session.id"
+
+// session is one browser session's state.
+type session struct {
+	user     string
+	requests int
+	lastSeen time.Time
+}
+
+// Sessions simulates cookie-based user sessions so traces can be stitched into
+// user journeys: every request is tied to a session, and each session's
+// requests are numbered. Sessions are held in memory and expire after ttl of
+// inactivity. They carry no authority; authentication is still required on
+// every request.
+type Sessions struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	lastSweep time.Time
+
+	startedCounter metric.Int64Counter
+}
+
+// NewSessions creates a session store whose sessions expire after ttl of
+// inactivity. A ttl of 0 disables sessions.
+func NewSessions(ttl time.Duration) *Sessions {
+	s := &Sessions{
+		ttl:       ttl,
+		sessions:  make(map[string]*session),
+		lastSweep: time.Now(),
+	}
+
+	var err error
+	s.startedCounter, err = meter.Int64Counter(
+		"sessions_started_total",
+		metric.WithDescription("The total number of sessions started"),
+		metric.WithUnit("{session}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create sessions_started_total counter: %v", err)
+	}
+	activeGauge, err := meter.Int64ObservableGauge(
+		"sessions_active",
+		metric.WithDescription("The number of sessions that have not expired"),
+		metric.WithUnit("{session}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create sessions_active gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(activeGauge, int64(s.active(time.Now())))
+		return nil
+	}, activeGauge)
+	if err != nil {
+		log.Fatalf("failed to register sessions_active gauge: %v", err)
+	}
+	return s
+}
+
+// NewSessionsFromConfig creates a session store configured by
+// server.session_ttl (0 disables sessions).
+func NewSessionsFromConfig(cfg config.Server) *Sessions {
+	return NewSessions(cfg.SessionTTL)
+}
+
+// Middleware reads the session cookie, or issues a new one when it is missing
+// or expired. The session ID goes into the baggage and onto the request span
+// with the request's position in the session. The session remembers the last
+// authenticated end user, so later requests in the session carry enduser.id
+// even when they are anonymous. It must run after authentication to see the
+// end user.
+func (s *Sessions) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.ttl <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		bag := baggage.FromContext(ctx)
+		user := bag.Member(EndUserIDKey).Value()
+		if key, ok := APIKeyFromContext(ctx); ok && user == "" {
+			user = key.EndUser
+		}
+
+		var id string
+		if c, err := r.Cookie(SessionCookie); err == nil {
+			id = c.Value
+		}
+		id, sess, isNew := s.touch(id, user, time.Now())
+		if isNew {
+			s.startedCounter.Add(ctx, 1)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     SessionCookie,
+			Value:    id,
+			Path:     "/",
+			MaxAge:   int(s.ttl.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		attrs := []attribute.KeyValue{
+			attribute.String(SessionIDKey, id),
+			attribute.Bool("session.new", isNew),
+			attribute.Int("session.request_count", sess.requests),
+		}
+		members := map[string]string{SessionIDKey: id}
+		if user == "" && sess.user != "" {
+			members[EndUserIDKey] = sess.user
+			attrs = append(attrs, attribute.String(EndUserIDKey, sess.user))
+		}
+		for key, value := range members {
+			if member, err := baggage.NewMember(key, value); err == nil {
+				if b, err := bag.SetMember(member); err == nil {
+					bag = b
+				}
+			}
+		}
+		ctx = baggage.ContextWithBaggage(ctx, bag)
+		trace.SpanFromContext(ctx).SetAttributes(attrs...)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// touch records a request in the session with the given ID, starting a new
+// session when the ID is unknown or expired. It returns the session's ID, a
+// copy of its state, and whether it was started by this request.
+func (s *Sessions) touch(id, user string, now time.Time) (string, session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > s.ttl {
+		for key, sess := range s.sessions {
+			if now.Sub(sess.lastSeen) > s.ttl {
+				delete(s.sessions, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	sess, ok := s.sessions[id]
+	isNew := !ok || now.Sub(sess.lastSeen) > s.ttl
+	if isNew {
+		// Session IDs are only ever issued here, never taken from the client.
+		id = newRequestID()
+		sess = &session{}
+		s.sessions[id] = sess
+	}
+	if user != "" {
+		sess.user = user
+	}
+	sess.requests++
+	sess.lastSeen = now
+	return id, *sess, isNew
+}
+
+// active returns the number of sessions that have not expired.
+func (s *Sessions) active(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, sess := range s.sessions {
+		if now.Sub(sess.lastSeen) <= s.ttl {
+			n++
+		}
+	}
+	return n
+}
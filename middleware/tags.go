@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"app/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tags attaches static tags, such as owning team or criticality tier, to a
+// route: they are set on the request span and on the otelhttp server metrics,
+// and carried in the request context so every span started while serving the
+// request gets them too. Tags are declared when the route is registered and
+// must be low-cardinality, since they become metric attributes.
+func Tags(tags ...attribute.KeyValue) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			trace.SpanFromContext(ctx).SetAttributes(tags...)
+			if labeler, ok := otelhttp.LabelerFromContext(ctx); ok {
+				labeler.Add(tags...)
+			}
+			// Tags set by an enclosing group are kept. Clip first so the
+			// enclosing group's slice is never written to.
+			outer := tracing.RouteTags(ctx)
+			merged := append(outer[:len(outer):len(outer)], tags...)
+			next.ServeHTTP(w, r.WithContext(tracing.ContextWithRouteTags(ctx, merged)))
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"app/config"
+	"app/problem"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type stageKey struct{}
+
+// SetStage records the stage a request is in, so a timeout can report which
+// stage was in flight, and sets it as the goroutine's stage profiler label
+// under ProfileLabels. It is a no-op outside those middlewares.
+func SetStage(ctx context.Context, stage string) {
+	setStageLabel(ctx, stage)
+	if current, ok := ctx.Value(stageKey{}).(*atomic.Value); ok {
+		current.Store(stage)
+	}
+}
+
+// Timeouts bounds how long a request may run, per route.
+type Timeouts struct {
+	fallback time.Duration
+	routes   map[string]time.Duration
+
+	timeoutCounter metric.Int64Counter
+}
+
+// NewTimeouts creates timeouts with a default and per-route overrides keyed by
+// ServeMux pattern (e.g. "POST /createOrder"). A timeout of 0 disables it.
+func NewTimeouts(fallback time.Duration, routes map[string]time.Duration) *Timeouts {
+	counter, err := meter.Int64Counter(
+		"request_timeouts_total",
+		metric.WithDescription("The total number of requests that exceeded their route timeout"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create request_timeouts_total counter: %v", err)
+	}
+	return &Timeouts{fallback: fallback, routes: routes, timeoutCounter: counter}
+}
+
+// NewTimeoutsFromConfig creates timeouts with the configured request timeout
+// as the default, overridden per route by server.route_timeouts.
+func NewTimeoutsFromConfig(cfg config.Server) *Timeouts {
+	return NewTimeouts(cfg.RequestTimeout, cfg.RouteTimeouts)
+}
+
+// timeoutFor returns the timeout for the matched route pattern.
+func (t *Timeouts) timeoutFor(pattern string) time.Duration {
+	if d, ok := t.routes[pattern]; ok {
+		return d
+	}
+	return t.fallback
+}
+
+// Middleware runs the handler with a deadline. When it is exceeded the context
+// is canceled and 504 is returned, and a "request.timeout" event on the request
+// span names the stage that was in flight (see SetStage). The handler's output
+// is buffered and discarded once the request has timed out.
+func (t *Timeouts) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := t.timeoutFor(r.Pattern)
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		stage := new(atomic.Value)
+		stage.Store("handler")
+		ctx = context.WithValue(ctx, stageKey{}, stage)
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			// Re-panic on the request goroutine so outer handlers see it.
+			panic(p)
+		case <-done:
+			tw.flushTo(w)
+		case <-ctx.Done():
+			tw.abandon()
+			select {
+			case <-done:
+				// The handler finished just as the deadline passed.
+				tw.flushTo(w)
+				return
+			default:
+			}
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// The client went away; there is nobody to answer.
+				return
+			}
+			inFlight, _ := stage.Load().(string)
+			span := trace.SpanFromContext(r.Context())
+			span.AddEvent("request.timeout", trace.WithAttributes(
+				attribute.Int64("timeout.ms", timeout.Milliseconds()),
+				attribute.String("timeout.stage", inFlight),
+			))
+			span.SetStatus(codes.Error, "request timed out during "+inFlight)
+			t.timeoutCounter.Add(r.Context(), 1, metric.WithAttributes(
+				attribute.String("http.route", routeFromPattern(r.Pattern)),
+				attribute.String("timeout.stage", inFlight),
+			))
+			problem.Write(w, r, problem.GatewayTimeout, "The request did not complete within "+timeout.String()+" (in "+inFlight+").")
+		}
+	})
+}
+
+// timeoutWriter buffers a handler's response until it completes.
+type timeoutWriter struct {
+	mu        sync.Mutex
+	header    http.Header
+	buf       bytes.Buffer
+	status    int
+	abandoned bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status == 0 {
+		tw.status = status
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+// abandon makes any further writes fail with http.ErrHandlerTimeout.
+func (tw *timeoutWriter) abandon() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.abandoned = true
+}
+
+// flushTo copies the buffered response to w.
+func (tw *timeoutWriter) flushTo(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	for k, v := range tw.header {
+		w.Header()[k] = v
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	w.WriteHeader(tw.status)
+	_, _ = w.Write(tw.buf.Bytes())
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"app/tracing"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// ServerTimingHeader carries the request's trace context as a traceparent
+// metric, which browser RUM agents read from the Performance API.
+const ServerTimingHeader = "Server-Timing"
+
+// TraceResponse returns the request span's context to the client through the
+// response propagator: with the traceresponse propagator configured, in the
+// traceresponse header and as a Server-Timing traceparent entry. The values are
+// version-00 traceparents with the server span's ID and the sampled flag, so a
+// failing call can be reported with an ID that opens its trace, and a caller
+// that restarted its trace can link to this one. Problem responses carry the
+// trace ID in their body as well. Untraced requests get neither header.
+func TraceResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracing.ResponsePropagator().Inject(r.Context(), propagation.HeaderCarrier(w.Header()))
+		if v := w.Header().Get(tracing.TraceResponseHeader); v != "" {
+			w.Header().Add(ServerTimingHeader, `traceparent;desc="`+v+`"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"app/problem"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Pseudo-routes recorded as http.route for requests no route matched, so they
+// are grouped together instead of by raw path.
+const (
+	NotFoundRoute         = "__not_found__"
+	MethodNotAllowedRoute = "__method_not_allowed__"
+)
+
+// CatchAllPattern is the ServeMux pattern Unmatched is registered under.
+const CatchAllPattern = "/"
+
+// probeMethods are the methods tried when looking for the routes a path has.
+var probeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+var unmatchedCounter metric.Int64Counter
+
+func init() {
+	var err error
+	unmatchedCounter, err = meter.Int64Counter(
+		"http_unmatched_requests_total",
+		metric.WithDescription("The total number of requests that matched no route"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create http_unmatched_requests_total counter: %v", err)
+	}
+}
+
+// Unmatched returns the handler for requests no route of mux matched; register
+// it under CatchAllPattern. Paths that exist for other methods get 405 with
+// Allow, others 404, both as problem+json. The request span is renamed after
+// the pseudo-route, which is also set as http.route on the span and server
+// metrics, and each request is counted in http_unmatched_requests_total.
+func Unmatched(mux *http.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(mux, r)
+
+		route, typ, detail := NotFoundRoute, problem.NotFound, "No route matches "+r.URL.Path+"."
+		if len(allowed) > 0 {
+			route, typ, detail = MethodNotAllowedRoute, problem.MethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path+"."
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+		}
+
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+		recordOriginalPath(r)
+		if labeler, ok := otelhttp.LabelerFromContext(ctx); ok {
+			labeler.Add(semconv.HTTPRoute(route))
+		}
+		unmatchedCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("http.route", route),
+			attribute.String("http.request.method", r.Method),
+		))
+
+		problem.Write(w, r, typ, detail)
+	}
+}
+
+// allowedMethods returns the methods that have a route for the request's path.
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	var allowed []string
+	for _, method := range probeMethods {
+		if method == r.Method {
+			continue
+		}
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "" && pattern != CatchAllPattern {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,234 @@
+// Package openapi builds the API's OpenAPI 3.0 document from the route table
+// in spec.go, deriving JSON schemas from the handlers' request and response
+// structs so the document follows the code. It serves the document at
+// /openapi.json and a Swagger UI page at /docs.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Document is an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+	Tags       []Tag               `json:"tags,omitempty"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a base URL the API is served from.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations.
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of one path, keyed by lowercase method.
+type PathItem map[string]*Operation
+
+// Operation is a single API operation.
+type Operation struct {
+	Tags        []string            `json:"tags,omitempty"`
+	Summary     string              `json:"summary"`
+	OperationID string              `json:"operationId"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	Security    []map[string][]any  `json:"security,omitempty"`
+	Servers     []Server            `json:"servers,omitempty"`
+}
+
+// Parameter is a path, query, or header parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes an operation's body.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one response status.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the named schemas and security schemes.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes an authentication method.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Schema is the subset of JSON Schema used by the document.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// schemaRegistry converts Go types into schemas, registering named structs as
+// components and referring to them by $ref.
+type schemaRegistry struct {
+	schemas map[string]*Schema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of v's type.
+func (reg *schemaRegistry) schemaFor(v any) *Schema {
+	return reg.schema(reflect.TypeOf(v))
+}
+
+func (reg *schemaRegistry) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		s := reg.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: reg.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: reg.schema(t.Elem())}
+	case reflect.Struct:
+		return reg.structSchema(t)
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema registers a named struct as a component and returns a $ref to it.
+// Fields without omitempty are listed as required.
+func (reg *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	name := t.Name()
+	if name != "" {
+		if _, ok := reg.schemas[name]; ok {
+			return &Schema{Ref: "#/components/schemas/" + name}
+		}
+		// Reserve the name first so recursive types terminate.
+		reg.schemas[name] = nil
+	}
+
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		fieldName, opts, _ := strings.Cut(tag, ",")
+		if fieldName == "" {
+			fieldName = f.Name
+		}
+		s.Properties[fieldName] = reg.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, fieldName)
+		}
+	}
+
+	if name == "" {
+		return s
+	}
+	reg.schemas[name] = s
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+)
+
+// Handler serves the OpenAPI document as JSON.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	specOnce.Do(func() {
+		specJSON, _ = json.MarshalIndent(Spec(), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(specJSON)))
+	_, _ = w.Write(specJSON)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at /openapi.json.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Orders API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// DocsHandler serves a Swagger UI page for the document.
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(swaggerUIPage))
+}
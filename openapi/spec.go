@@ -0,0 +1,231 @@
+package openapi
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"app/admin"
+	"app/buildinfo"
+	"app/chaos"
+	"app/handlers"
+	"app/problem"
+	"app/recording"
+	"app/store"
+)
+
+// adminServer is where the admin operations are served.
+var adminServer = []Server{{URL: "http://localhost:6060", Description: "Admin listener"}}
+
+// route describes one operation. Request and Response are zero values of the
+// body types; Response is served with Status. The request body is required
+// unless BodyOptional is set.
+type route struct {
+	Method, Path, Tag, Summary, OperationID string
+	Params                                  []Parameter
+	Request                                 any
+	RequestMedia                            string
+	BodyOptional                            bool
+	Status                                  int
+	Response                                any
+	Problems                                []problem.Type
+	// Authenticated routes accept an API key or JWT; Admin routes are served on
+	// the admin listener; Probe routes are served there too, without its
+	// token, and skip the common middlewares.
+	Authenticated, Admin, Probe bool
+	// Deprecated routes answer with Deprecation and Sunset headers.
+	Deprecated bool
+	// Checks routes answer 503 with the Response body when a check fails, as
+	// probes do.
+	Checks bool
+}
+
+var (
+	idParam = Parameter{Name: "id", In: "path", Required: true, Description: "Order ID", Schema: &Schema{Type: "integer"}}
+
+	// problemsCommon apply to every application route.
+	problemsCommon = []problem.Type{problem.NotAcceptable, problem.TooManyRequests, problem.GatewayTimeout, problem.Overloaded, problem.Maintenance, problem.InternalError}
+	// problemsOrder apply to order creation.
+	problemsOrder = []problem.Type{problem.InvalidRequest, problem.UnsupportedMedia, problem.PayloadTooLarge, problem.OutOfStock, problem.DatabaseError, problem.PaymentFailed, problem.UpstreamFailed, problem.StockBusy, problem.WarmingUp}
+)
+
+// routes is the API's route table.
+var routes = []route{
+	{Method: http.MethodPost, Path: "/createOrder", Tag: "orders", Summary: "Create an order (v1 alias)", OperationID: "createOrder",
+		Request: handlers.CreateOrderRequest{}, BodyOptional: true, Status: http.StatusOK, Response: handlers.OrderResponse{}, Problems: problemsOrder, Authenticated: true, Deprecated: true},
+	{Method: http.MethodPost, Path: "/v1/createOrder", Tag: "orders", Summary: "Create an order", OperationID: "createOrderV1",
+		Request: handlers.CreateOrderRequest{}, BodyOptional: true, Status: http.StatusOK, Response: handlers.OrderResponse{}, Problems: problemsOrder, Authenticated: true, Deprecated: true},
+	{Method: http.MethodPost, Path: "/v2/createOrder", Tag: "orders", Summary: "Create an order with line items", OperationID: "createOrderV2",
+		Request: handlers.CreateOrderV2Request{}, Status: http.StatusCreated, Response: handlers.OrderV2Response{},
+		Problems: append([]problem.Type{problem.UnsupportedCurrency, problem.NotFound}, problemsOrder...), Authenticated: true},
+	{Method: http.MethodGet, Path: "/orders/search", Tag: "orders", Summary: "Search orders", OperationID: "searchOrders",
+		Params: []Parameter{
+			{Name: "customer", In: "query", Description: "Customer ID", Schema: &Schema{Type: "string"}},
+			{Name: "status", In: "query", Description: "Order status", Schema: &Schema{Type: "string"}},
+			{Name: "since", In: "query", Description: "RFC 3339 timestamp or a duration such as 1h", Schema: &Schema{Type: "string"}},
+		},
+		Status: http.StatusOK, Response: handlers.OrderSearchResponse{}, Problems: []problem.Type{problem.InvalidRequest}, Authenticated: true},
+	{Method: http.MethodPost, Path: "/orders/import", Tag: "orders", Summary: "Bulk import orders from NDJSON", OperationID: "importOrders",
+		Request: handlers.ImportRow{}, RequestMedia: "application/x-ndjson", Status: http.StatusOK, Response: handlers.ImportResponse{},
+		Problems: []problem.Type{problem.UnsupportedMedia, problem.PayloadTooLarge, problem.FeatureDisabled}, Authenticated: true},
+	{Method: http.MethodGet, Path: "/orders/{id}", Tag: "orders", Summary: "Get an order", OperationID: "getOrder",
+		Params: []Parameter{idParam, {Name: "If-None-Match", In: "header", Description: "ETag from a previous response", Schema: &Schema{Type: "string"}}},
+		Status: http.StatusOK, Response: store.Order{}, Problems: []problem.Type{problem.InvalidRequest, problem.NotFound}, Authenticated: true},
+	{Method: http.MethodPost, Path: "/orders/{id}/refund", Tag: "orders", Summary: "Refund an order", OperationID: "refundOrder",
+		Params: []Parameter{idParam}, Status: http.StatusOK, Response: handlers.RefundResponse{},
+		Problems: []problem.Type{problem.InvalidRequest, problem.NotFound, problem.OrderNotRefundable, problem.RefundFailed}, Authenticated: true},
+	{Method: http.MethodGet, Path: "/orders/{id}/tracking", Tag: "orders", Summary: "Track an order's shipment", OperationID: "trackOrder",
+		Params: []Parameter{idParam}, Status: http.StatusOK, Response: handlers.TrackingResponse{},
+		Problems: []problem.Type{problem.InvalidRequest, problem.NotFound, problem.UpstreamFailed, problem.FeatureDisabled}, Authenticated: true},
+	{Method: http.MethodGet, Path: "/checkInventory", Tag: "inventory", Summary: "Check inventory", OperationID: "checkInventory",
+		Status: http.StatusOK, Response: handlers.InventoryResponse{}, Problems: []problem.Type{problem.StockBusy}, Authenticated: true},
+	{Method: http.MethodGet, Path: "/status", Tag: "operations", Summary: "Dependency status", OperationID: "getStatus",
+		Status: http.StatusOK, Response: handlers.StatusResponse{}, Checks: true},
+	{Method: http.MethodGet, Path: "/version", Tag: "operations", Summary: "Build information", OperationID: "getVersion",
+		Status: http.StatusOK, Response: buildinfo.Info{}},
+	{Method: http.MethodGet, Path: "/slo", Tag: "operations", Summary: "SLO compliance and error budgets", OperationID: "getSLO",
+		Status: http.StatusOK, Response: handlers.SLOResponse{}, Problems: []problem.Type{problem.FeatureDisabled}},
+	{Method: http.MethodGet, Path: "/debug/propagation", Tag: "operations", Summary: "Echo the propagated trace context", OperationID: "debugPropagation",
+		Params: []Parameter{
+			{Name: "traceparent", In: "header", Description: "W3C trace context of the caller's span", Schema: &Schema{Type: "string"}},
+			{Name: "tracestate", In: "header", Description: "W3C vendor trace state", Schema: &Schema{Type: "string"}},
+			{Name: "baggage", In: "header", Description: "W3C baggage", Schema: &Schema{Type: "string"}},
+		},
+		Status: http.StatusOK, Response: handlers.PropagationResponse{}},
+	{Method: http.MethodGet, Path: "/debug/baggage", Tag: "operations", Summary: "Dump the received baggage", OperationID: "getBaggage",
+		Params: []Parameter{{Name: "baggage", In: "header", Description: "W3C baggage", Schema: &Schema{Type: "string"}}},
+		Status: http.StatusOK, Response: handlers.BaggageResponse{}},
+	{Method: http.MethodPost, Path: "/debug/baggage", Tag: "operations", Summary: "Set baggage for the next hop", OperationID: "setBaggage",
+		Params:  []Parameter{{Name: "baggage", In: "header", Description: "W3C baggage", Schema: &Schema{Type: "string"}}},
+		Request: handlers.BaggageRequest{}, BodyOptional: true, Status: http.StatusOK, Response: handlers.BaggageResponse{},
+		Problems: []problem.Type{problem.InvalidRequest, problem.UnsupportedMedia, problem.PayloadTooLarge}},
+	{Method: http.MethodGet, Path: "/healthz", Tag: "operations", Summary: "Health check", OperationID: "healthz",
+		Status: http.StatusOK, Response: handlers.HealthResponse{}, Probe: true},
+	{Method: http.MethodGet, Path: "/readyz", Tag: "operations", Summary: "Readiness check", OperationID: "readyz",
+		Status: http.StatusOK, Response: handlers.HealthResponse{}, Probe: true},
+	{Method: http.MethodGet, Path: "/livez", Tag: "operations", Summary: "Liveness check", OperationID: "livez",
+		Status: http.StatusOK, Response: handlers.HealthResponse{}, Probe: true},
+
+	{Method: http.MethodGet, Path: "/admin/chaos", Tag: "admin", Summary: "Get chaos settings", OperationID: "getChaos",
+		Status: http.StatusOK, Response: admin.ChaosResponse{}, Admin: true},
+	{Method: http.MethodPut, Path: "/admin/chaos", Tag: "admin", Summary: "Update chaos settings", OperationID: "updateChaos",
+		Request: admin.ChaosUpdate{}, Status: http.StatusOK, Response: admin.ChaosResponse{}, Problems: []problem.Type{problem.InvalidRequest}, Admin: true},
+	{Method: http.MethodPost, Path: "/admin/chaos/outages", Tag: "admin", Summary: "Schedule an outage", OperationID: "scheduleOutage",
+		Request: admin.OutageRequest{}, Status: http.StatusCreated, Response: chaos.Outage{}, Problems: []problem.Type{problem.InvalidRequest}, Admin: true},
+	{Method: http.MethodDelete, Path: "/admin/chaos/outages/{id}", Tag: "admin", Summary: "Cancel an outage", OperationID: "cancelOutage",
+		Params: []Parameter{{Name: "id", In: "path", Required: true, Description: "Outage ID", Schema: &Schema{Type: "integer"}}},
+		Status: http.StatusOK, Response: chaos.Outage{}, Problems: []problem.Type{problem.InvalidRequest, problem.NotFound}, Admin: true},
+	{Method: http.MethodGet, Path: "/admin/maintenance", Tag: "admin", Summary: "Get maintenance mode", OperationID: "getMaintenance",
+		Status: http.StatusOK, Response: admin.MaintenanceResponse{}, Admin: true},
+	{Method: http.MethodPut, Path: "/admin/maintenance", Tag: "admin", Summary: "Set maintenance mode", OperationID: "setMaintenance",
+		Request: admin.MaintenanceUpdate{}, Status: http.StatusOK, Response: admin.MaintenanceResponse{}, Problems: []problem.Type{problem.InvalidRequest}, Admin: true},
+	{Method: http.MethodGet, Path: "/admin/sampling", Tag: "admin", Summary: "Get the trace sampling ratio", OperationID: "getSampling",
+		Status: http.StatusOK, Response: admin.Sampling{}, Admin: true},
+	{Method: http.MethodPut, Path: "/admin/sampling", Tag: "admin", Summary: "Set the trace sampling ratio", OperationID: "setSampling",
+		Request: admin.Sampling{}, Status: http.StatusOK, Response: admin.Sampling{}, Problems: []problem.Type{problem.InvalidRequest}, Admin: true},
+	{Method: http.MethodGet, Path: "/admin/instrumentation", Tag: "admin", Summary: "Get the share of requests served without telemetry", OperationID: "getInstrumentation",
+		Status: http.StatusOK, Response: admin.Instrumentation{}, Admin: true},
+	{Method: http.MethodPut, Path: "/admin/instrumentation", Tag: "admin", Summary: "Set the share of requests served without telemetry", OperationID: "setInstrumentation",
+		Request: admin.Instrumentation{}, Status: http.StatusOK, Response: admin.Instrumentation{}, Problems: []problem.Type{problem.InvalidRequest}, Admin: true},
+	{Method: http.MethodGet, Path: "/admin/recording", Tag: "admin", Summary: "Get the request recording state", OperationID: "getRecording",
+		Status: http.StatusOK, Response: recording.State{}, Admin: true},
+	{Method: http.MethodPut, Path: "/admin/recording", Tag: "admin", Summary: "Start or stop recording requests", OperationID: "setRecording",
+		Request: admin.RecordingUpdate{}, Status: http.StatusOK, Response: recording.State{}, Problems: []problem.Type{problem.InvalidRequest}, Admin: true},
+}
+
+// Spec builds the OpenAPI document from the route table.
+func Spec() Document {
+	reg := &schemaRegistry{schemas: make(map[string]*Schema)}
+	problemRef := reg.schemaFor(problem.Details{})
+
+	doc := Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "sc-go-app-backend",
+			Version:     buildinfo.Get().Version,
+			Description: "Order service instrumented end to end with OpenTelemetry. Errors are RFC 7807 problem+json bodies carrying the trace ID.",
+		},
+		Servers: []Server{{URL: "http://localhost:8080", Description: "Public API"}},
+		Paths:   make(map[string]PathItem),
+		Tags: []Tag{
+			{Name: "orders", Description: "Order creation and lifecycle"},
+			{Name: "inventory", Description: "Stock checks"},
+			{Name: "operations", Description: "Health and dependency status"},
+			{Name: "admin", Description: "Runtime control, served on the admin listener"},
+		},
+		Components: Components{
+			SecuritySchemes: map[string]SecurityScheme{
+				"apiKey":     {Type: "apiKey", In: "header", Name: "X-API-Key"},
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"adminToken": {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+
+	for _, rt := range routes {
+		op := &Operation{
+			Tags:        []string{rt.Tag},
+			Summary:     rt.Summary,
+			OperationID: rt.OperationID,
+			Parameters:  rt.Params,
+			Deprecated:  rt.Deprecated,
+			Responses: map[string]Response{
+				strconv.Itoa(rt.Status): {Description: http.StatusText(rt.Status), Content: jsonContent(reg.schemaFor(rt.Response))},
+			},
+		}
+		if rt.Request != nil {
+			media := rt.RequestMedia
+			if media == "" {
+				media = "application/json"
+			}
+			op.RequestBody = &RequestBody{Required: !rt.BodyOptional, Content: map[string]MediaType{media: {Schema: reg.schemaFor(rt.Request)}}}
+		}
+
+		if rt.Probe || rt.Checks {
+			// Probes answer 503 with the same body when a check fails.
+			op.Responses[strconv.Itoa(http.StatusServiceUnavailable)] = Response{Description: "A check is failing", Content: jsonContent(reg.schemaFor(rt.Response))}
+		}
+
+		if rt.Probe {
+			op.Servers = adminServer
+		}
+
+		problems := slices.Clip(rt.Problems)
+		switch {
+		case rt.Admin:
+			op.Servers = adminServer
+			op.Security = []map[string][]any{{"adminToken": {}}}
+			problems = append(problems, problem.Unauthorized, problem.Forbidden)
+		case rt.Authenticated:
+			op.Security = []map[string][]any{{"apiKey": {}}, {"bearerAuth": {}}}
+			problems = append(append(problems, problem.Unauthorized), problemsCommon...)
+		case !rt.Probe:
+			problems = append(problems, problemsCommon...)
+		}
+		for _, p := range problems {
+			code := strconv.Itoa(p.Status)
+			if resp, ok := op.Responses[code]; ok {
+				resp.Description += "; " + p.Title
+				resp.Content[problem.ContentType] = MediaType{Schema: problemRef}
+				op.Responses[code] = resp
+				continue
+			}
+			op.Responses[code] = Response{Description: p.Title, Content: map[string]MediaType{problem.ContentType: {Schema: problemRef}}}
+		}
+
+		item := doc.Paths[rt.Path]
+		if item == nil {
+			item = PathItem{}
+			doc.Paths[rt.Path] = item
+		}
+		item[strings.ToLower(rt.Method)] = op
+	}
+
+	doc.Components.Schemas = reg.schemas
+	return doc
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
@@ -0,0 +1,396 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/config"
+	"app/logging"
+	"app/problem"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/openapi"
+
+var meter = otel.Meter(instrumentationName)
+
+// maxValidatedResponse is the largest response body checked when response
+// validation is on; larger bodies are passed through unchecked.
+const maxValidatedResponse = 1 << 20
+
+// Validator checks requests, and optionally responses, against the document.
+// Operations are looked up by the request's ServeMux pattern, so it must run
+// inside the router; requests for routes the document does not describe pass
+// through.
+type Validator struct {
+	operations map[string]*Operation
+	schemas    map[string]*Schema
+	responses  bool
+
+	failureCounter metric.Int64Counter
+}
+
+// NewValidator creates a validator for doc. When responses is set, response
+// bodies are checked too; mismatches are logged and counted but the response
+// is sent unchanged.
+func NewValidator(doc Document, responses bool) *Validator {
+	counter, err := meter.Int64Counter(
+		"openapi_validation_failures_total",
+		metric.WithDescription("The total number of fields that failed OpenAPI validation"),
+		metric.WithUnit("{field}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create openapi_validation_failures_total counter: %v", err)
+	}
+
+	v := &Validator{
+		operations:     make(map[string]*Operation),
+		schemas:        doc.Components.Schemas,
+		responses:      responses,
+		failureCounter: counter,
+	}
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			v.operations[strings.ToUpper(method)+" "+path] = op
+		}
+	}
+	return v
+}
+
+// NewValidatorFromConfig creates a validator for this API's document.
+// Response validation is enabled by server.validate_responses.
+func NewValidatorFromConfig(cfg config.Server) *Validator {
+	return NewValidator(Spec(), cfg.ValidateResponses)
+}
+
+// Middleware validates the path, query, and header parameters and the JSON
+// body of each request. Invalid requests are answered 400 with every failing
+// field listed in invalid_params; the first failing field is set as
+// validation.field on the request span. Bodies of other media types, such as
+// NDJSON imports, are left to the handler.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, ok := v.operations[r.Pattern]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		invalid := v.checkParams(r, op)
+		if op.RequestBody != nil {
+			if _, ok := op.RequestBody.Content["application/json"]; ok {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					var maxErr *http.MaxBytesError
+					if errors.As(err, &maxErr) {
+						problem.Write(w, r, problem.PayloadTooLarge, "The request body exceeds the "+strconv.FormatInt(maxErr.Limit, 10)+"-byte limit.")
+						return
+					}
+					problem.Write(w, r, problem.InvalidRequest, "The request body could not be read.")
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				invalid = append(invalid, v.checkBody(body, op.RequestBody)...)
+			}
+		}
+
+		if len(invalid) > 0 {
+			v.record(r, invalid)
+			problem.WriteInvalidParams(w, r, "The request does not match the API description.", invalid)
+			return
+		}
+
+		if !v.responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &responseCapture{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		v.checkResponse(r, op, rec)
+	})
+}
+
+// checkParams checks the operation's path, query, and header parameters.
+func (v *Validator) checkParams(r *http.Request, op *Operation) []problem.InvalidParam {
+	var invalid []problem.InvalidParam
+	for _, p := range op.Parameters {
+		var value string
+		switch p.In {
+		case "path":
+			value = r.PathValue(p.Name)
+		case "query":
+			value = r.URL.Query().Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+		}
+		if value == "" {
+			if p.Required {
+				invalid = append(invalid, problem.InvalidParam{Name: p.Name, In: p.In, Reason: "is required"})
+			}
+			continue
+		}
+		if reason := checkScalar(value, p.Schema); reason != "" {
+			invalid = append(invalid, problem.InvalidParam{Name: p.Name, In: p.In, Reason: reason})
+		}
+	}
+	return invalid
+}
+
+// checkScalar checks a parameter's string value against a scalar schema.
+func checkScalar(value string, s *Schema) string {
+	var err error
+	switch s.Type {
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "number":
+		_, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return "must be of type " + s.Type
+	}
+	return ""
+}
+
+// checkBody checks a JSON request body. An empty body is only accepted when
+// the body is optional.
+func (v *Validator) checkBody(body []byte, rb *RequestBody) []problem.InvalidParam {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if rb.Required {
+			return []problem.InvalidParam{{Name: "$", In: "body", Reason: "is required"}}
+		}
+		return nil
+	}
+	value, err := decodeJSON(body)
+	if err != nil {
+		return []problem.InvalidParam{{Name: "$", In: "body", Reason: "is not valid JSON"}}
+	}
+	var invalid []problem.InvalidParam
+	for _, f := range v.check(value, rb.Content["application/json"].Schema, "$") {
+		invalid = append(invalid, problem.InvalidParam{Name: f.name, In: "body", Reason: f.reason})
+	}
+	return invalid
+}
+
+// fieldError is a value that does not match its schema, named by its JSONPath.
+type fieldError struct {
+	name, reason string
+}
+
+// check checks a decoded JSON value against s, returning every mismatch.
+// Properties not in the schema are accepted, as the handlers ignore them.
+func (v *Validator) check(value any, s *Schema, path string) []fieldError {
+	s = v.resolve(s)
+	if s == nil || s.Type == "" {
+		return nil
+	}
+	if value == nil {
+		if s.Nullable {
+			return nil
+		}
+		return []fieldError{{path, "must not be null"}}
+	}
+
+	mismatch := []fieldError{{path, "must be of type " + s.Type}}
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return mismatch
+		}
+		var errs []fieldError
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, fieldError{path + "." + name, "is required"})
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(obj)) {
+			val := obj[name]
+			if ps, ok := s.Properties[name]; ok {
+				errs = append(errs, v.check(val, ps, path+"."+name)...)
+			} else if s.AdditionalProperties != nil {
+				errs = append(errs, v.check(val, s.AdditionalProperties, path+"."+name)...)
+			}
+		}
+		return errs
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return mismatch
+		}
+		var errs []fieldError
+		for i, item := range arr {
+			errs = append(errs, v.check(item, s.Items, path+"["+strconv.Itoa(i)+"]")...)
+		}
+		return errs
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return []fieldError{{path, "must be an RFC 3339 date-time"}}
+			}
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return mismatch
+		}
+		if _, err := n.Int64(); err != nil {
+			return mismatch
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return mismatch
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch
+		}
+	}
+	return nil
+}
+
+// resolve follows a $ref to its component schema.
+func (v *Validator) resolve(s *Schema) *Schema {
+	if s != nil && s.Ref != "" {
+		return v.schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers as json.Number so
+// integers can be told apart from fractions.
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return value, nil
+}
+
+// arrayIndex matches the array indexes in a field's JSONPath.
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+// record sets the first failing field on the span and counts each failure. The
+// metric's validation.field drops array indexes to bound its cardinality.
+func (v *Validator) record(r *http.Request, invalid []problem.InvalidParam) {
+	ctx := r.Context()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("validation.field", invalid[0].Name),
+		attribute.String("validation.location", invalid[0].In),
+		attribute.Int("validation.failures", len(invalid)),
+	)
+	for _, p := range invalid {
+		v.failureCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("http.route", r.Pattern),
+			attribute.String("validation.location", p.In),
+			attribute.String("validation.field", arrayIndex.ReplaceAllString(p.Name, "[*]")),
+		))
+	}
+}
+
+// responseCapture keeps a copy of the response status, and of the body up to
+// maxValidatedResponse, while writing it through.
+type responseCapture struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	if rc.status == 0 {
+		rc.status = status
+	}
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.status == 0 {
+		rc.status = http.StatusOK
+	}
+	if !rc.overflow {
+		if rc.body.Len()+len(b) > maxValidatedResponse {
+			rc.overflow = true
+			rc.body.Reset()
+		} else {
+			rc.body.Write(b)
+		}
+	}
+	return rc.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rc *responseCapture) Unwrap() http.ResponseWriter {
+	return rc.ResponseWriter
+}
+
+// checkResponse checks a captured JSON response against the operation's
+// response for its status, logging and counting any mismatch.
+func (v *Validator) checkResponse(r *http.Request, op *Operation, rc *responseCapture) {
+	if rc.overflow || rc.body.Len() == 0 {
+		return
+	}
+	media, _, _ := mime.ParseMediaType(rc.Header().Get("Content-Type"))
+	if media != "application/json" && media != problem.ContentType {
+		return
+	}
+
+	var errs []fieldError
+	resp, ok := op.Responses[strconv.Itoa(rc.status)]
+	mt, hasMedia := resp.Content[media]
+	if !hasMedia && media == "application/json" {
+		// Clients that do not accept problem+json get problems as plain JSON.
+		mt, hasMedia = resp.Content[problem.ContentType]
+	}
+	switch {
+	case !ok:
+		errs = []fieldError{{"$", "status " + strconv.Itoa(rc.status) + " is not documented"}}
+	case !hasMedia:
+		errs = []fieldError{{"$", "media type " + media + " is not documented"}}
+	default:
+		value, err := decodeJSON(rc.body.Bytes())
+		if err != nil {
+			errs = []fieldError{{"$", "is not valid JSON"}}
+		} else {
+			errs = v.check(value, mt.Schema, "$")
+		}
+	}
+
+	ctx := r.Context()
+	for _, f := range errs {
+		logging.DefaultLogger.Warn(ctx, "Response does not match the API description",
+			attribute.String("validation.field", f.name), attribute.String("error.reason", f.reason))
+		logging.JSONLogger.Warn(ctx, "Response does not match the API description",
+			attribute.String("validation.field", f.name), attribute.String("error.reason", f.reason))
+		v.failureCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("http.route", r.Pattern),
+			attribute.String("validation.location", "response"),
+			attribute.String("validation.field", arrayIndex.ReplaceAllString(f.name, "[*]")),
+		))
+	}
+}
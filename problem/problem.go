@@ -0,0 +1,114 @@
+// Package problem writes RFC 7807 application/problem+json error responses.
+// Each response carries the trace ID, and the problem type is recorded on the
+// request span, so a client-side error can be matched to its trace.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// Type is a problem type: a URI reference identifying it, a short
+// human-readable title, and the HTTP status it is served with.
+type Type struct {
+	URI    string
+	Title  string
+	Status int
+}
+
+// Problem types served by this application.
+var (
+	InvalidRequest      = Type{URI: "/problems/invalid-request", Title: "Invalid request", Status: http.StatusBadRequest}
+	Unauthorized        = Type{URI: "/problems/unauthorized", Title: "Authentication required", Status: http.StatusUnauthorized}
+	Forbidden           = Type{URI: "/problems/forbidden", Title: "Access denied", Status: http.StatusForbidden}
+	NotFound            = Type{URI: "/problems/not-found", Title: "Resource not found", Status: http.StatusNotFound}
+	MethodNotAllowed    = Type{URI: "/problems/method-not-allowed", Title: "Method not allowed", Status: http.StatusMethodNotAllowed}
+	NotAcceptable       = Type{URI: "/problems/not-acceptable", Title: "No acceptable response format", Status: http.StatusNotAcceptable}
+	OutOfStock          = Type{URI: "/problems/out-of-stock", Title: "Item out of stock", Status: http.StatusConflict}
+	OrderNotRefundable  = Type{URI: "/problems/order-not-refundable", Title: "Order cannot be refunded", Status: http.StatusConflict}
+	UnsupportedCurrency = Type{URI: "/problems/unsupported-currency", Title: "Unsupported currency", Status: http.StatusBadRequest}
+	DatabaseError       = Type{URI: "/problems/database-error", Title: "Database operation failed", Status: http.StatusInternalServerError}
+	PaymentFailed       = Type{URI: "/problems/payment-failed", Title: "Payment processing failed", Status: http.StatusInternalServerError}
+	RefundFailed        = Type{URI: "/problems/refund-failed", Title: "Refund processing failed", Status: http.StatusInternalServerError}
+	InternalError       = Type{URI: "/problems/internal-error", Title: "Internal server error", Status: http.StatusInternalServerError}
+	UpstreamFailed      = Type{URI: "/problems/upstream-failed", Title: "Upstream dependency failed", Status: http.StatusBadGateway}
+	GatewayTimeout      = Type{URI: "/problems/timeout", Title: "Request timed out", Status: http.StatusGatewayTimeout}
+	UnsupportedMedia    = Type{URI: "/problems/unsupported-media-type", Title: "Unsupported request content type", Status: http.StatusUnsupportedMediaType}
+	PayloadTooLarge     = Type{URI: "/problems/payload-too-large", Title: "Request body too large", Status: http.StatusRequestEntityTooLarge}
+	TooManyRequests     = Type{URI: "/problems/too-many-requests", Title: "Too many requests", Status: http.StatusTooManyRequests}
+	Overloaded          = Type{URI: "/problems/overloaded", Title: "Server overloaded", Status: http.StatusServiceUnavailable}
+	FeatureDisabled     = Type{URI: "/problems/feature-disabled", Title: "Feature disabled", Status: http.StatusServiceUnavailable}
+	Maintenance         = Type{URI: "/problems/maintenance", Title: "Service under maintenance", Status: http.StatusServiceUnavailable}
+	WarmingUp           = Type{URI: "/problems/warming-up", Title: "Service is warming up", Status: http.StatusServiceUnavailable}
+	StockBusy           = Type{URI: "/problems/stock-busy", Title: "Stock reservation timed out", Status: http.StatusServiceUnavailable}
+)
+
+type mediaTypeKey struct{}
+
+// WithMediaType returns a copy of ctx in which problem responses are served as
+// mediaType instead of ContentType, for clients that accept plain JSON but not
+// problem+json.
+func WithMediaType(ctx context.Context, mediaType string) context.Context {
+	return context.WithValue(ctx, mediaTypeKey{}, mediaType)
+}
+
+// Details is the problem+json response body.
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	TraceID  string `json:"trace_id,omitempty"`
+	// InvalidParams lists the fields that failed validation, for InvalidRequest.
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam is one field that failed validation. In is where the field was
+// found: body, path, query, or header.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	In     string `json:"in"`
+	Reason string `json:"reason"`
+}
+
+// Write writes a problem response of the given type and records problem.type
+// on the request span.
+func Write(w http.ResponseWriter, r *http.Request, typ Type, detail string) {
+	write(w, r, typ, Details{Detail: detail})
+}
+
+// WriteInvalidParams writes an InvalidRequest problem listing the fields that
+// failed validation.
+func WriteInvalidParams(w http.ResponseWriter, r *http.Request, detail string, params []InvalidParam) {
+	write(w, r, InvalidRequest, Details{Detail: detail, InvalidParams: params})
+}
+
+func write(w http.ResponseWriter, r *http.Request, typ Type, body Details) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.String("problem.type", typ.URI))
+
+	body.Type = typ.URI
+	body.Title = typ.Title
+	body.Status = typ.Status
+	body.Instance = r.URL.Path
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		body.TraceID = sc.TraceID().String()
+	}
+
+	mediaType, ok := r.Context().Value(mediaTypeKey{}).(string)
+	if !ok {
+		mediaType = ContentType
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(typ.Status)
+	_ = json.NewEncoder(w).Encode(body)
+}
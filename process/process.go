@@ -0,0 +1,185 @@
+// Package process reports how long the service has been up and how often it
+// has restarted, so crash loops during chaos demos show up in metrics. The
+// restart count survives restarts in a small JSON state file, which also
+// records whether the previous run stopped cleanly: a run that crashed,
+// panicked, or was killed never marks itself stopped.
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "app/process"
+
+// Previous exits, recorded on restarts. A handoff is a restart in which the
+// previous process passed on its listeners and drained.
+const (
+	ExitClean   = "clean"
+	ExitUnclean = "unclean"
+	ExitHandoff = "handoff"
+)
+
+// startTime is when the process started, close enough for uptime.
+var startTime = time.Now()
+
+// state is the content of the state file.
+type state struct {
+	// Restarts counts the starts after the first, by how the previous run
+	// exited.
+	Restarts map[string]int64 `json:"restarts"`
+	// Running is set while the process runs and cleared by Stopped, so it is
+	// still set at the next start if the process died.
+	Running   bool      `json:"running"`
+	StartTime time.Time `json:"start_time"`
+	PID       int       `json:"pid"`
+}
+
+var (
+	mu      sync.Mutex
+	path    string
+	current = state{Restarts: make(map[string]int64)}
+)
+
+// Info describes this start.
+type Info struct {
+	// Restarts is the number of starts before this one.
+	Restarts int64
+	// PreviousExit is ExitClean, ExitUnclean, or ExitHandoff, or empty on the
+	// first start.
+	PreviousExit string
+	// PreviousStart is when the previous run started.
+	PreviousStart time.Time
+}
+
+func init() {
+	meter := otel.Meter(instrumentationName)
+	uptime, err := meter.Float64ObservableGauge(
+		"process.uptime",
+		metric.WithDescription("The time the process has been running"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create process.uptime gauge: %v", err)
+	}
+	started, err := meter.Int64ObservableGauge(
+		"process.start_time",
+		metric.WithDescription("When the process started, in seconds since the Unix epoch"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create process.start_time gauge: %v", err)
+	}
+	restarts, err := meter.Int64ObservableCounter(
+		"process.restarts",
+		metric.WithDescription("The number of times the service has restarted, persisted across restarts, by how the previous run exited (clean, unclean, or handoff)"),
+		metric.WithUnit("{restart}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create process.restarts counter: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(uptime, time.Since(startTime).Seconds())
+		o.ObserveInt64(started, startTime.Unix())
+		mu.Lock()
+		defer mu.Unlock()
+		for _, exit := range []string{ExitClean, ExitUnclean, ExitHandoff} {
+			o.ObserveInt64(restarts, current.Restarts[exit], metric.WithAttributes(attribute.String("process.previous_exit", exit)))
+		}
+		return nil
+	}, uptime, started, restarts)
+	if err != nil {
+		log.Fatalf("failed to register process gauges: %v", err)
+	}
+}
+
+// Start records this start in the state file at file, counting it as a
+// restart if the file exists, and returns what it found. An empty file keeps
+// the count in memory only, so it starts at zero. handoff reports that the
+// previous process handed over its listeners and is still draining, so its
+// run has not ended yet but is not unclean either.
+func Start(file string, handoff bool) (Info, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var info Info
+	if file != "" {
+		data, err := os.ReadFile(file)
+		switch {
+		case err == nil:
+			var prev state
+			if err := json.Unmarshal(data, &prev); err != nil {
+				return info, fmt.Errorf("parsing %s: %w", file, err)
+			}
+			info.PreviousExit, info.PreviousStart = ExitClean, prev.StartTime
+			switch {
+			case handoff:
+				info.PreviousExit = ExitHandoff
+			case prev.Running:
+				info.PreviousExit = ExitUnclean
+			}
+			if prev.Restarts != nil {
+				current.Restarts = prev.Restarts
+			}
+			for _, n := range current.Restarts {
+				info.Restarts += n
+			}
+			info.Restarts++
+			current.Restarts[info.PreviousExit]++
+		case !errors.Is(err, os.ErrNotExist):
+			return info, fmt.Errorf("reading state: %w", err)
+		}
+	}
+	path = file
+	current.Running, current.StartTime, current.PID = true, startTime.UTC(), os.Getpid()
+	return info, save()
+}
+
+// Stopped marks the run as having stopped cleanly. It is called last during a
+// graceful shutdown, but not after a handoff, when the new process owns the
+// state file.
+func Stopped() error {
+	mu.Lock()
+	defer mu.Unlock()
+	current.Running = false
+	return save()
+}
+
+// save writes the state file atomically, so a crash mid-write cannot corrupt
+// it. The caller holds mu.
+func save() error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	return nil
+}
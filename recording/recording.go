@@ -0,0 +1,293 @@
+// Package recording captures sanitized incoming requests to a file, so that
+// cmd/replay can send them again to reproduce a traced incident locally.
+//
+// Recording is off until the admin API starts it. Each recorded request is one
+// JSON line with its method, target, headers, and body, and the trace and span
+// IDs of its server span, which the replay links to. Credentials, cookies, and
+// trace context headers are dropped, JSON body fields and form fields with
+// sensitive names are redacted, and other bodies are omitted, so a recording
+// can be shared.
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redacted replaces the values of sensitive body fields.
+const redacted = "[REDACTED]"
+
+// droppedHeaders are never recorded: credentials, and the trace context and
+// request ID, which a replay sends afresh.
+var droppedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"X-Api-Key",
+	"Traceparent",
+	"Tracestate",
+	"Baggage",
+	"X-Request-Id",
+	"Content-Length",
+}
+
+// sensitiveFields are substrings of the JSON and form field names that are
+// redacted.
+var sensitiveFields = []string{"password", "secret", "token", "api_key", "apikey", "card", "cvv"}
+
+// Request is a recorded request, one JSON object per line of a recording.
+type Request struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Target is the path and query.
+	Target string      `json:"target"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	// BodyOmitted is set when the body was too large to record, or was
+	// neither JSON nor a form, so it could not be redacted.
+	BodyOmitted bool `json:"body_omitted,omitempty"`
+	// TraceID and SpanID identify the request's server span.
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+}
+
+// State is the recorder's state.
+type State struct {
+	Enabled bool `json:"enabled"`
+	// File is the recording's file name, in the recording directory.
+	File string `json:"file,omitempty"`
+	// Limit is the number of requests after which recording stops; 0 is no
+	// limit.
+	Limit    int        `json:"limit,omitempty"`
+	Recorded int        `json:"recorded"`
+	Since    *time.Time `json:"since,omitempty"`
+}
+
+var (
+	mu           sync.Mutex
+	dir                = "recordings"
+	maxBodyBytes int64 = 64 << 10
+	state        State
+	file         *os.File
+)
+
+// Configure sets where recordings are written and the largest body recorded.
+// It must be called before recording starts.
+func Configure(cfg config.Recording) {
+	mu.Lock()
+	defer mu.Unlock()
+	dir, maxBodyBytes = cfg.Dir, cfg.MaxBodyBytes
+}
+
+// Current returns the recorder's state.
+func Current() State {
+	mu.Lock()
+	defer mu.Unlock()
+	return state
+}
+
+// Start records the requests that follow to name, a file in the recording
+// directory that is created or appended to, until Stop is called or limit
+// requests (if above 0) are recorded. A recording already in progress is
+// stopped first.
+func Start(name string, limit int) (State, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return State{}, fmt.Errorf("invalid recording file name %q", name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return State{}, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return State{}, err
+	}
+	stop()
+	since := time.Now().UTC()
+	file = f
+	state = State{Enabled: true, File: name, Limit: limit, Since: &since}
+	log.Printf("Recording requests to %s", f.Name())
+	return state, nil
+}
+
+// Stop stops recording and returns the final state.
+func Stop() State {
+	mu.Lock()
+	defer mu.Unlock()
+	stop()
+	return state
+}
+
+// stop closes the recording, if any. mu must be held.
+func stop() {
+	if file == nil {
+		return
+	}
+	if err := file.Close(); err != nil {
+		log.Printf("[WARN] closing recording %s: %v", state.File, err)
+	}
+	log.Printf("Recorded %d requests to %s", state.Recorded, state.File)
+	file = nil
+	state.Enabled = false
+}
+
+// Capture records r while recording is on. Up to the body limit, the body is
+// read and then put back in front of the rest, so handlers still read all of
+// it. The request span is marked with recording.captured.
+func Capture(r *http.Request) {
+	mu.Lock()
+	enabled, limit := state.Enabled, maxBodyBytes
+	mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	span := trace.SpanFromContext(r.Context())
+	rec := Request{
+		Time:   time.Now().UTC(),
+		Method: r.Method,
+		Target: r.URL.RequestURI(),
+		Header: sanitizeHeader(r.Header),
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		rec.TraceID, rec.SpanID = sc.TraceID().String(), sc.SpanID().String()
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		prefix, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+		if err == nil && int64(len(prefix)) <= limit {
+			rec.Body, rec.BodyOmitted = sanitizeBody(r.Header.Get("Content-Type"), prefix)
+		} else {
+			rec.BodyOmitted = true
+		}
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !state.Enabled {
+		return
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("[WARN] writing recording %s, stopping: %v", state.File, err)
+		stop()
+		return
+	}
+	state.Recorded++
+	span.SetAttributes(attribute.Bool("recording.captured", true))
+	if state.Limit > 0 && state.Recorded >= state.Limit {
+		stop()
+	}
+}
+
+// ReadFile reads the requests recorded in the named file.
+func ReadFile(name string) ([]Request, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []Request
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, i+1, err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// sanitizeHeader returns a copy of h without droppedHeaders.
+func sanitizeHeader(h http.Header) http.Header {
+	clean := h.Clone()
+	for _, name := range droppedHeaders {
+		clean.Del(name)
+	}
+	return clean
+}
+
+// sanitizeBody redacts the sensitive fields of a JSON body, or of a form body
+// with the contentType. Other bodies cannot be redacted, so they are omitted:
+// it returns an empty body and true.
+func sanitizeBody(contentType string, body []byte) (string, bool) {
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		clean, err := json.Marshal(redact(v))
+		if err != nil {
+			return "", true
+		}
+		return string(clean), false
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", true
+		}
+		for k, values := range form {
+			if sensitive(k) {
+				for i := range values {
+					values[i] = redacted
+				}
+			}
+		}
+		return form.Encode(), false
+	}
+	return "", true
+}
+
+// redact replaces the values of sensitive fields in v, at any depth.
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if sensitive(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redact(field)
+			}
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = redact(elem)
+		}
+	}
+	return v
+}
+
+func sensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, s := range sensitiveFields {
+		if strings.Contains(field, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package recording
+
+import "testing"
+
+func TestSanitizeBody(t *testing.T) {
+	for _, tt := range []struct {
+		name, contentType, body, want string
+		omitted                       bool
+	}{
+		{name: "no secrets", body: `{"customer_id":"cust-042"}`, want: `{"customer_id":"cust-042"}`},
+		{name: "nested", body: `{"payment":{"card_number":"4111","amount":5},"items":[{"api_key":"k"}]}`,
+			want: `{"items":[{"api_key":"[REDACTED]"}],"payment":{"amount":5,"card_number":"[REDACTED]"}}`},
+		{name: "case-insensitive", body: `{"Password":"p"}`, want: `{"Password":"[REDACTED]"}`},
+		{name: "form", contentType: "application/x-www-form-urlencoded; charset=utf-8", body: "a=b&token=c&Token=d",
+			want: "Token=%5BREDACTED%5D&a=b&token=%5BREDACTED%5D"},
+		{name: "not JSON", contentType: "text/plain", body: "a=b&token=c", omitted: true},
+		{name: "no content type", body: "a=b&token=c", omitted: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, omitted := sanitizeBody(tt.contentType, []byte(tt.body))
+			if got != tt.want || omitted != tt.omitted {
+				t.Errorf("sanitizeBody(%q, %s) = %q, %v, want %q, %v", tt.contentType, tt.body, got, omitted, tt.want, tt.omitted)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package routes
+
+import "net/http"
+
+// Middleware wraps a handler with cross-cutting behavior.
+type Middleware func(http.Handler) http.Handler
+
+// Router registers routes on a ServeMux through a middleware chain, so a
+// stack is declared once and applied the same way to every route.
+type Router struct {
+	mux         *http.ServeMux
+	middlewares []Middleware
+}
+
+// NewRouter returns a router with an empty chain that registers on mux.
+func NewRouter(mux *http.ServeMux) *Router {
+	return &Router{mux: mux}
+}
+
+// Use appends middlewares to the chain. They apply to routes registered
+// afterwards; the first middleware in the chain is the outermost.
+func (rt *Router) Use(middlewares ...Middleware) {
+	rt.middlewares = append(rt.middlewares, middlewares...)
+}
+
+// Group calls fn with a router that shares the mux and starts with a copy of
+// this router's chain, so middlewares it adds apply only to its own routes.
+func (rt *Router) Group(fn func(g *Router)) {
+	fn(&Router{mux: rt.mux, middlewares: append([]Middleware(nil), rt.middlewares...)})
+}
+
+// With returns a router whose chain adds middlewares to this one's, for
+// declaring middlewares on individual routes:
+//
+//	api.With(middleware.Tags(attribute.String("team", "checkout"))).HandleFunc("POST /createOrder", h)
+func (rt *Router) With(middlewares ...Middleware) *Router {
+	g := &Router{mux: rt.mux, middlewares: append([]Middleware(nil), rt.middlewares...)}
+	g.Use(middlewares...)
+	return g
+}
+
+// Handle registers h for pattern, wrapped in the chain.
+func (rt *Router) Handle(pattern string, h http.Handler) {
+	for i := len(rt.middlewares) - 1; i >= 0; i-- {
+		h = rt.middlewares[i](h)
+	}
+	rt.mux.Handle(pattern, h)
+}
+
+// HandleFunc registers h for pattern, wrapped in the chain.
+func (rt *Router) HandleFunc(pattern string, h http.HandlerFunc) {
+	rt.Handle(pattern, h)
+}
@@ -1,24 +1,245 @@
 package routes
 
 import (
+	"log"
 	"net/http"
+	"sync"
+	"time"
 
+	"app/admin"
+	"app/config"
+	"app/featureflags"
 	"app/handlers"
+	"app/heatmap"
+	"app/middleware"
+	"app/openapi"
+	"app/tracing"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// SetupRoutes defines all the application's routes and maps them to their corresponding handlers.
-func SetupRoutes() *http.ServeMux {
-    router := http.NewServeMux()
+// SetupRoutes defines all the application's routes and maps them to their
+// corresponding handlers. Routes are organized in groups with their own
+// middleware stacks: public routes get the common chain, including rate
+// limiting, and authenticated routes add JWT or API-key authentication. The
+// admin group, the health probes, and /metrics are served on the admin
+// listener; see SetupAdminRoutes. The returned handler wraps the router with
+// path normalization and CORS handling. limiter is the per-client rate limiter
+// shared by all routes.
+func SetupRoutes(cfg config.Config, limiter *middleware.RateLimiter) http.Handler {
+	mux := http.NewServeMux()
 
-    // Wrap each handler with otelhttp.NewHandler to create a distinct span for each route.
-    // The second argument sets the span name.
-    createOrderHandler := otelhttp.NewHandler(http.HandlerFunc(handlers.CreateOrderHandler), "POST /createOrder")
-    router.Handle("/createOrder", createOrderHandler)
+	// Per-route request timeouts (server.request_timeout and
+	// server.route_timeouts).
+	timeouts := middleware.NewTimeoutsFromConfig(cfg.Server)
+	// In-flight request limits with bounded queues (server.concurrency).
+	concurrency := middleware.NewConcurrencyLimiterFromConfig(cfg.Server.Concurrency)
+	// Request body size limits (server.max_body_bytes).
+	bodyLimit := middleware.NewBodyLimitFromConfig(cfg.Server)
+	// Client IP resolution behind trusted proxies (server.trusted_proxies).
+	clientInfo := middleware.NewClientInfoFromConfig(cfg.Server)
+	// Strict Content-Type and Accept negotiation.
+	negotiation := middleware.NewContentNegotiationFromEnv()
+	// Authentication for the business routes: a bearer JWT (when JWT_HMAC_SECRET
+	// or auth.jwt.jwks_url is set) or an API key (when API_KEYS is set).
+	jwtAuth := middleware.NewJWTAuthFromConfig(cfg.Auth.JWT)
+	apiKeyAuth := middleware.NewAPIKeyAuthFromConfig(cfg.Auth)
+	limiter.IdentifyByAPIKey(apiKeyAuth)
+	// Simulated session cookies (server.session_ttl), for stitching user
+	// journeys.
+	sessions := middleware.NewSessionsFromConfig(cfg.Server)
+	// Baggage members copied to request spans (BAGGAGE_SPAN_ATTRIBUTES).
+	baggageAttrs := middleware.NewBaggageAttributesFromEnv()
+	// Validation against the OpenAPI document; responses too with
+	// server.validate_responses.
+	validator := openapi.NewValidatorFromConfig(cfg.Server)
+	// Requests far slower than their route's norm get an anomaly event.
+	anomalies := middleware.NewLatencyAnomaliesFromConfig(cfg.Anomaly)
 
-    checkInventoryHandler := otelhttp.NewHandler(http.HandlerFunc(handlers.CheckInventoryHandler), "GET /checkInventory")
-    router.Handle("/checkInventory", checkInventoryHandler)
+	// The common chain, outermost first. The instrumentation A/B switch comes
+	// first so it can turn off all of a request's telemetry. otelhttp follows
+	// so every other middleware runs inside the request span, and ServerMetrics
+	// next so its duration covers the whole chain. Anomaly detection follows
+	// Route, which it keys baselines on, and so do the latency heatmap and
+	// ProfileLabels, so the pprof labels carry the route. Content negotiation
+	// wraps the middlewares that answer with problems, so clients that do not
+	// accept problem+json get their 429, 503, and 504 responses as JSON too.
+	// Recover sits inside RequestID so recovered panics are logged with the ID,
+	// inside AccessLog so their 500 responses are logged, and inside the
+	// timeout so it runs on the handler's goroutine. Requests are recorded
+	// inside the timeout, so reading their bodies is bounded by the deadline,
+	// but before the limiters, so a recording holds the requests that were
+	// throttled or shed as well. The concurrency limiter is inside the timeout
+	// too, so time spent queued counts against the request's deadline.
+	router := NewRouter(mux)
+	router.Use(
+		middleware.InstrumentationAB,
+		traced,
+		middleware.ServerMetrics,
+		middleware.Route,
+		anomalies.Middleware,
+		middleware.LatencyHeatmap,
+		middleware.ProfileLabels,
+		middleware.RequestID,
+		middleware.TraceResponse,
+		clientInfo.Middleware,
+		baggageAttrs.Middleware,
+		middleware.Gzip,
+		middleware.AccessLog,
+		negotiation.Middleware,
+		middleware.MaintenanceMode,
+		timeouts.Middleware,
+		middleware.Recover,
+		middleware.RecordRequests,
+		limiter.Middleware,
+		concurrency.Middleware,
+		bodyLimit.Middleware,
+	)
 
-    return router
+	// Routes use method patterns. The matched pattern names the request span
+	// and sets http.route, so path values such as {id} never reach span names.
+	// Each route is tagged with its owning team and criticality tier. Newer
+	// features are gated by runtime feature flags (FEATURE_FLAGS and
+	// /admin/flags); v2 is hidden while its flag is off.
+
+	// Authenticated group: the order and inventory API.
+	router.Group(func(api *Router) {
+		api.Use(jwtAuth.Middleware, apiKeyAuth.Middleware, sessions.Middleware, validator.Middleware)
+
+		// Versioned order API. /createOrder remains an alias of v1; both are
+		// deprecated in favor of v2.
+		api.With(tags("checkout", "critical"), middleware.Deprecate(v1OrderDeprecation)).HandleFunc("POST /createOrder", handlers.CreateOrderHandler)
+		api.With(tags("checkout", "critical"), middleware.Deprecate(v1OrderDeprecation)).HandleFunc("POST /v1/createOrder", handlers.CreateOrderHandler)
+		api.With(tags("checkout", "critical"), middleware.FeatureGate(featureflags.OrdersV2, true)).HandleFunc("POST /v2/createOrder", handlers.CreateOrderV2Handler)
+
+		api.With(tags("inventory", "critical")).HandleFunc("GET /checkInventory", handlers.CheckInventoryHandler)
+
+		api.With(tags("checkout", "standard")).HandleFunc("GET /orders/search", handlers.SearchOrdersHandler)
+		api.With(tags("checkout", "standard"), middleware.FeatureGate(featureflags.OrderImport, false)).HandleFunc("POST /orders/import", handlers.ImportOrdersHandler)
+		api.With(tags("checkout", "standard")).HandleFunc("GET /orders/{id}", handlers.GetOrderHandler)
+		api.With(tags("checkout", "critical")).HandleFunc("POST /orders/{id}/refund", handlers.RefundOrderHandler)
+		api.With(tags("fulfillment", "standard"), middleware.FeatureGate(featureflags.OrderTracking, false)).HandleFunc("GET /orders/{id}/tracking", handlers.TrackingHandler)
+	})
+
+	// Public group.
+	router.Group(func(public *Router) {
+		public.Use(sessions.Middleware, validator.Middleware, tags("platform", "internal"))
+
+		public.HandleFunc("GET /status", handlers.StatusHandler)
+		public.HandleFunc("GET /version", handlers.VersionHandler)
+		// Each objective's compliance, error budget, and burn rates.
+		public.HandleFunc("GET /slo", handlers.SLOHandler)
+
+		// Echoes the propagated trace context, for checking clients' propagation.
+		public.HandleFunc("GET /debug/propagation", handlers.PropagationHandler)
+		// Dumps the received baggage, and sets members for the next hop.
+		public.HandleFunc("GET /debug/baggage", handlers.BaggageHandler)
+		public.HandleFunc("POST /debug/baggage", handlers.SetBaggageHandler)
+
+		// Third-party API stub used as the downstream for payment (POST) and FX
+		// (GET) calls.
+		public.HandleFunc("GET /stub/partner/{operation}", handlers.PartnerStubHandler)
+		public.HandleFunc("POST /stub/partner/{operation}", handlers.PartnerStubHandler)
+
+		// API description and its Swagger UI.
+		public.HandleFunc("GET /openapi.json", openapi.Handler)
+		public.HandleFunc("GET /docs", openapi.DocsHandler)
+	})
+
+	// Probes and /metrics are served on the admin listener; they are public
+	// only when asked for, or when there is no admin listener to serve them.
+	if cfg.Server.PublicProbes {
+		registerProbes(mux)
+	}
+
+	// Requests no route matches get problem+json 404s and 405s, traced and
+	// counted under pseudo-routes. They skip the route-specific middlewares
+	// but are rate limited like any other request.
+	unmatched := NewRouter(mux)
+	unmatched.Use(middleware.InstrumentationAB, traced, middleware.ServerMetrics, middleware.RequestID, middleware.TraceResponse, clientInfo.Middleware, middleware.AccessLog, limiter.Middleware)
+	unmatched.Handle(middleware.CatchAllPattern, middleware.Unmatched(mux))
+
+	// Paths are normalized and aliases resolved (server.route_aliases) before
+	// routing, and CORS wraps that so preflights are answered before method
+	// routing.
+	normalizer := middleware.NewPathNormalizerFromConfig(cfg.Server)
+	return middleware.NewCORSFromConfig(cfg.Server.CORS).Middleware(normalizer.Middleware(mux))
+}
+
+// SetupAdminRoutes defines the admin group served on the admin listener. Every
+// admin route requires an allowed client address and, when a token is
+// configured, the admin bearer token. The /admin API is only registered with a
+// token, and its requests are traced; pprof requests are not.
+func SetupAdminRoutes(cfg admin.Config) http.Handler {
+	mux := http.NewServeMux()
+	router := NewRouter(mux)
+	router.Use(cfg.Filter.Middleware)
+	if cfg.Token != "" {
+		router.Use(admin.RequireToken(cfg.Token))
+	}
+
+	admin.RegisterPprof(router)
+	// The recent-traces viewer, for inspecting traces without a collector.
+	router.Handle("GET /debug/traces", tracing.TracesHandler())
+	router.Handle("GET /debug/traces/{id}", tracing.TracesHandler())
+	// The current metric values as JSON, for checking instruments and their
+	// attribute sets without a backend.
+	router.Handle("GET /debug/metrics", tracing.DebugMetricsHandler())
+	// Per-route latency heatmaps from in-process histograms, as JSON or ASCII.
+	router.Handle("GET /debug/latency", heatmap.Handler())
+
+	// Probes and scrapes are answered without the CIDR filter or token, so
+	// kubelets and Prometheus need no credentials.
+	registerProbes(mux)
+
+	if cfg.Token == "" {
+		log.Println("[WARN] ADMIN_TOKEN is unset; the /admin API is disabled")
+		return mux
+	}
+	router.Group(func(api *Router) {
+		api.Use(traced, middleware.ServerMetrics, middleware.Route)
+		admin.RegisterAPI(api)
+	})
+	return mux
+}
+
+// registerProbes registers the health probes and the Prometheus scrape
+// endpoint. They are polled constantly, so they skip the request middlewares,
+// and the trace filter keeps them out of traces by default.
+func registerProbes(mux *http.ServeMux) {
+	probes := NewRouter(mux)
+	probes.Use(traced, middleware.ServerMetrics, middleware.Route)
+	probes.HandleFunc("GET /healthz", handlers.HealthzHandler)
+	probes.HandleFunc("GET /readyz", handlers.ReadyzHandler)
+	probes.HandleFunc("GET /livez", handlers.LivezHandler)
+	// For local setups without a collector.
+	probes.Handle("GET /metrics", tracing.MetricsHandler())
+}
+
+// v1OrderDeprecation retires the v1 order contract in favor of /v2/createOrder.
+var v1OrderDeprecation = middleware.Deprecation{
+	Since:     time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC),
+	Sunset:    time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC),
+	Successor: "/v2/createOrder",
+}
+
+// tags tags a route with its owning team and criticality tier (critical,
+// standard, or internal).
+func tags(team, tier string) Middleware {
+	return middleware.Tags(attribute.String("team", team), attribute.String("tier", tier))
+}
+
+// traceFilter decides which requests are traced; see tracing.NewTraceFilter.
+// It is built on first use, after the providers are installed.
+var traceFilter = sync.OnceValue(tracing.TraceFilter)
+
+// traced wraps a handler in an otelhttp server span named after its route.
+// Requests excluded by telemetry.trace_exclude (by default health probes,
+// scrapes, and admin polling) get no span and no HTTP server metrics.
+func traced(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "", tracing.HTTPOptions(
+		otelhttp.WithSpanNameFormatter(middleware.RouteSpanName),
+		otelhttp.WithFilter(traceFilter()),
+	)...)
 }
@@ -0,0 +1,36 @@
+// Package sampling records in the W3C trace state the ratio a trace was
+// sampled at, so the spans and logs of every service the trace reaches can say
+// how many traces each one stands for. The root sampler writes the entry;
+// samplers that follow the parent's decision keep the parent's trace state, so
+// it reaches every span of the trace.
+package sampling
+
+import (
+	"strconv"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceStateKey is the trace state entry holding the sampling ratio.
+const TraceStateKey = "sc-sampling"
+
+// WithRatio returns ts with its entry set to ratio.
+func WithRatio(ts trace.TraceState, ratio float64) trace.TraceState {
+	if updated, err := ts.Insert(TraceStateKey, strconv.FormatFloat(ratio, 'g', -1, 64)); err == nil {
+		return updated
+	}
+	return ts
+}
+
+// Ratio returns the sampling ratio recorded in ts, and false if there is none.
+func Ratio(ts trace.TraceState) (float64, bool) {
+	v := ts.Get(TraceStateKey)
+	if v == "" {
+		return 0, false
+	}
+	ratio, err := strconv.ParseFloat(v, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return 0, false
+	}
+	return ratio, true
+}
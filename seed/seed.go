@@ -0,0 +1,130 @@
+// Package seed populates the order store with generated history, so the list
+// endpoints and dashboards have data on a fresh start. Orders come from a pool
+// of returning customers, a few of whom order much more often than the rest,
+// and are spread over a window with more of them during the day. Each order
+// can also be recorded as a back-dated "seed.order" span at its creation time,
+// linked from the order by its trace ID.
+package seed
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"app/catalog"
+	"app/config"
+	"app/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/seed"
+
+// customerCount matches the pool of returning customers the order endpoint
+// picks from, so seeded and live orders share customers.
+const customerCount = 50
+
+// skuCount is the number of SKUs in the catalog.
+const skuCount = 20
+
+// Run adds cfg.Orders generated orders to s, oldest first, spread over
+// cfg.Window before now, and records a back-dated span for each when
+// cfg.Telemetry is set. It returns the number of orders by status.
+func Run(ctx context.Context, s *store.Store, cfg config.Seed) map[string]int {
+	now := time.Now().UTC()
+	times := make([]time.Time, cfg.Orders)
+	for i := range times {
+		times[i] = createdAt(now, cfg.Window)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	counts := make(map[string]int)
+	for _, at := range times {
+		o := store.Order{CustomerID: customer(), Status: status(), CreatedAt: at}
+		if cfg.Telemetry {
+			o = addTraced(ctx, s, o)
+		} else {
+			o = s.Add(o)
+		}
+		counts[o.Status]++
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("seed.orders", cfg.Orders),
+		attribute.Bool("seed.telemetry", cfg.Telemetry),
+	)
+	return counts
+}
+
+// addTraced adds the order inside a "seed.order" root span back-dated to its
+// creation time, with its line items as attributes.
+func addTraced(ctx context.Context, s *store.Store, o store.Order) store.Order {
+	_, span := otel.Tracer(instrumentationName).Start(ctx, "seed.order",
+		trace.WithNewRoot(),
+		trace.WithTimestamp(o.CreatedAt),
+	)
+	sc := span.SpanContext()
+	o.TraceID, o.SpanID = sc.TraceID().String(), sc.SpanID().String()
+	o = s.Add(o)
+
+	skus := make([]string, rand.IntN(3)+1)
+	for i := range skus {
+		skus[i] = catalog.SKU(rand.IntN(skuCount) + 1)
+	}
+	span.SetAttributes(
+		attribute.Int("order.id", o.ID),
+		attribute.String("customer.id", o.CustomerID),
+		attribute.String("order.status", o.Status),
+		attribute.StringSlice("order.skus", skus),
+		attribute.Bool("seed.backdated", true),
+	)
+	if o.Status == store.StatusFailed {
+		span.SetStatus(codes.Error, "order failed")
+	}
+	span.End(trace.WithTimestamp(o.CreatedAt.Add(time.Duration(rand.IntN(360)+40) * time.Millisecond)))
+	return o
+}
+
+// customer picks a customer, weighting the n-th by 1/n so a few customers
+// account for most orders.
+func customer() string {
+	var total float64
+	for n := 1; n <= customerCount; n++ {
+		total += 1 / float64(n)
+	}
+	r := rand.Float64() * total
+	for n := 1; n <= customerCount; n++ {
+		if r -= 1 / float64(n); r < 0 {
+			return fmt.Sprintf("cust-%03d", n)
+		}
+	}
+	return fmt.Sprintf("cust-%03d", customerCount)
+}
+
+// status picks the outcome of a historical order: most were created, and of
+// the rest about half failed and half were later refunded.
+func status() string {
+	switch r := rand.IntN(100); {
+	case r < 8:
+		return store.StatusFailed
+	case r < 15:
+		return store.StatusRefunded
+	default:
+		return store.StatusCreated
+	}
+}
+
+// createdAt picks a time in the window before now, three times as likely
+// between 08:00 and 22:00 UTC as overnight.
+func createdAt(now time.Time, window time.Duration) time.Time {
+	for {
+		t := now.Add(-time.Duration(rand.Int64N(int64(window))))
+		if h := t.Hour(); (h >= 8 && h < 22) || rand.IntN(3) == 0 {
+			return t
+		}
+	}
+}
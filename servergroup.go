@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"app/background"
+)
+
+// serverGroup runs the service's listeners (the public API and the admin
+// listener) as one unit: they start together, the first one to fail stops
+// the service, and they shut down in the order they were added under a
+// shared deadline.
+type serverGroup struct {
+	servers []groupServer
+	errc    chan error
+}
+
+type groupServer struct {
+	name string
+	srv  *http.Server
+	ln   net.Listener
+}
+
+// Add adds a server that serves on ln, over TLS if srv has a TLSConfig.
+func (g *serverGroup) Add(name string, srv *http.Server, ln net.Listener) {
+	g.servers = append(g.servers, groupServer{name: name, srv: srv, ln: ln})
+}
+
+// Start serves every server in its own goroutine.
+func (g *serverGroup) Start(ctx context.Context) {
+	g.errc = make(chan error, len(g.servers))
+	for _, s := range g.servers {
+		background.Go(ctx, s.name+".server", func() {
+			var err error
+			if s.srv.TLSConfig != nil {
+				log.Printf("Server %q is running on %s (HTTPS)", s.name, s.ln.Addr())
+				err = s.srv.ServeTLS(s.ln, "", "")
+			} else {
+				log.Printf("Server %q is running on %s", s.name, s.ln.Addr())
+				err = s.srv.Serve(s.ln)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				g.errc <- fmt.Errorf("%s server: %w", s.name, err)
+			}
+		})
+	}
+}
+
+// Err returns a channel that receives the first error a server stops with.
+func (g *serverGroup) Err() <-chan error {
+	return g.errc
+}
+
+// Shutdown gracefully shuts the servers down one after another, in the order
+// they were added, until ctx is done; servers still running then are closed.
+// It returns the errors of the servers that did not drain in time.
+func (g *serverGroup) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, s := range g.servers {
+		if err := s.srv.Shutdown(ctx); err != nil {
+			_ = s.srv.Close()
+			errs = append(errs, fmt.Errorf("%s server: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
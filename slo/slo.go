@@ -0,0 +1,299 @@
+// Package slo computes the error-budget burn rates of the service level
+// objectives declared in the configuration. The good and total request counts
+// come from the service's own http.server.request.duration histogram, read
+// in-process, so no metrics backend is needed to know whether an objective is
+// at risk.
+//
+// A burn rate is the share of bad requests over a window divided by the share
+// the objective allows (1 - target): at 1 the error budget lasts exactly the
+// SLO period, at 14.4 a 30-day budget is spent in about two days. Burn rates
+// over a short and a long window are exported as the slo_burn_rate gauge, and
+// a warning is logged while both exceed the threshold, so a brief spike does
+// not warn and a sustained burn does.
+package slo
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"app/config"
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const instrumentationName = "app/slo"
+
+// durationMetric is the histogram the request counts are read from.
+const durationMetric = "http.server.request.duration"
+
+// CollectFunc gathers the current metric values, such as tracing.Collect.
+type CollectFunc func(context.Context, *metricdata.ResourceMetrics) error
+
+// Tracker computes the burn rates of the objectives from periodic collections.
+type Tracker struct {
+	cfg     config.SLO
+	collect CollectFunc
+	now     func() time.Time
+
+	mu sync.Mutex
+	// start is the first sample, and history the samples in the long window.
+	start   sample
+	history []sample
+	status  []Status
+}
+
+// sample is the cumulative good and total request counts of each objective at
+// one collection.
+type sample struct {
+	at     time.Time
+	counts []counts
+}
+
+type counts struct {
+	good, total uint64
+}
+
+// Status is an objective's burn rates as of the last evaluation.
+type Status struct {
+	Objective config.Objective
+	// Good and Total count the objective's requests since Since, the first
+	// evaluation.
+	Good, Total uint64
+	Since       time.Time
+	// Short and Long are the burn rates over the short and long windows.
+	Short, Long float64
+	// Burning is set while both exceed the threshold.
+	Burning bool
+	// Evaluated is when the status was computed, or zero before the first
+	// evaluation.
+	Evaluated time.Time
+}
+
+// Compliance returns the share of good requests since Since, and false if
+// there were none.
+func (s Status) Compliance() (float64, bool) {
+	if s.Total == 0 {
+		return 0, false
+	}
+	return float64(s.Good) / float64(s.Total), true
+}
+
+// BudgetRemaining returns the share of the error budget left since Since: 1
+// with no bad requests, 0 when the objective is exactly met, and negative once
+// it is missed.
+func (s Status) BudgetRemaining() float64 {
+	if s.Total == 0 {
+		return 1
+	}
+	allowed := (1 - s.Objective.Target) * float64(s.Total)
+	return 1 - float64(s.Total-s.Good)/allowed
+}
+
+// New returns a tracker of cfg's objectives reading metrics with collect, and
+// registers the slo_burn_rate gauge.
+func New(cfg config.SLO, collect CollectFunc) *Tracker {
+	t := &Tracker{cfg: cfg, collect: collect, now: time.Now, status: make([]Status, len(cfg.Objectives))}
+	for i, o := range cfg.Objectives {
+		t.status[i].Objective = o
+	}
+
+	meter := otel.Meter(instrumentationName)
+	gauge, err := meter.Float64ObservableGauge(
+		"slo_burn_rate",
+		metric.WithDescription("The rate at which each objective's error budget is spent over the short and long windows; 1 spends it exactly over the SLO period"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create slo_burn_rate gauge: %v", err)
+	}
+	short, long := WindowLabel(cfg.ShortWindow), WindowLabel(cfg.LongWindow)
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, s := range t.Statuses() {
+			name := attribute.String("slo.name", s.Objective.Name)
+			o.ObserveFloat64(gauge, s.Short, metric.WithAttributes(name, attribute.String("slo.window", short)))
+			o.ObserveFloat64(gauge, s.Long, metric.WithAttributes(name, attribute.String("slo.window", long)))
+		}
+		return nil
+	}, gauge)
+	if err != nil {
+		log.Fatalf("failed to register slo_burn_rate gauge: %v", err)
+	}
+	return t
+}
+
+// Watch evaluates the objectives now, which sets the baseline the first
+// windows are counted from, and then every interval until ctx is done.
+func (t *Tracker) Watch(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := t.Evaluate(ctx); err != nil {
+			log.Printf("[WARN] SLO evaluation failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Windows returns the short and long windows the burn rates are computed over.
+func (t *Tracker) Windows() (short, long time.Duration) {
+	return t.cfg.ShortWindow, t.cfg.LongWindow
+}
+
+// Statuses returns the objectives' burn rates as of the last evaluation.
+func (t *Tracker) Statuses() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Status(nil), t.status...)
+}
+
+// Evaluate collects the request counts, recomputes the burn rates, and logs
+// objectives that start or stop burning.
+func (t *Tracker) Evaluate(ctx context.Context) error {
+	var rm metricdata.ResourceMetrics
+	if err := t.collect(ctx, &rm); err != nil {
+		return err
+	}
+	now := t.now()
+	current := sample{at: now, counts: make([]counts, len(t.cfg.Objectives))}
+	for i, o := range t.cfg.Objectives {
+		current.counts[i] = count(rm, o)
+	}
+
+	t.mu.Lock()
+	if t.start.at.IsZero() {
+		t.start = current
+	}
+	t.history = append(t.history, current)
+	// Keep the newest sample at or before the start of the long window, as
+	// the baseline the window's requests are counted from.
+	for len(t.history) > 1 && !t.history[1].at.After(now.Add(-t.cfg.LongWindow)) {
+		t.history = t.history[1:]
+	}
+	var started, stopped []Status
+	for i := range t.status {
+		s := &t.status[i]
+		s.Good = current.counts[i].good - t.start.counts[i].good
+		s.Total = current.counts[i].total - t.start.counts[i].total
+		s.Since, s.Evaluated = t.start.at, now
+		s.Short = t.burnRate(i, t.cfg.ShortWindow)
+		s.Long = t.burnRate(i, t.cfg.LongWindow)
+		burning := s.Short > t.cfg.BurnRateThreshold && s.Long > t.cfg.BurnRateThreshold
+		if burning && !s.Burning {
+			started = append(started, *s)
+		} else if !burning && s.Burning {
+			stopped = append(stopped, *s)
+		}
+		s.Burning = burning
+	}
+	t.mu.Unlock()
+
+	for _, s := range started {
+		log.Printf("[WARN] SLO %s is burning its error budget: %.1fx over %s, %.1fx over %s",
+			s.Objective.Name, s.Short, WindowLabel(t.cfg.ShortWindow), s.Long, WindowLabel(t.cfg.LongWindow))
+		logging.JSONLogger.Warn(ctx, "SLO error budget burning", t.attributes(s)...)
+	}
+	for _, s := range stopped {
+		logging.JSONLogger.Info(ctx, "SLO burn rate recovered", t.attributes(s)...)
+	}
+	return nil
+}
+
+// burnRate returns objective i's burn rate over the window ending at the last
+// sample. Before a full window has been collected, the window starts at the
+// first sample. The caller holds mu.
+func (t *Tracker) burnRate(i int, window time.Duration) float64 {
+	last := t.history[len(t.history)-1]
+	base := t.history[0]
+	for _, s := range t.history {
+		if s.at.After(last.at.Add(-window)) {
+			break
+		}
+		base = s
+	}
+	total := last.counts[i].total - base.counts[i].total
+	if total == 0 {
+		return 0
+	}
+	bad := total - (last.counts[i].good - base.counts[i].good)
+	return float64(bad) / float64(total) / (1 - t.cfg.Objectives[i].Target)
+}
+
+func (t *Tracker) attributes(s Status) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("slo.name", s.Objective.Name),
+		attribute.String("slo.route", s.Objective.Route),
+		attribute.Float64("slo.target", s.Objective.Target),
+		attribute.Float64("slo.burn_rate.short", s.Short),
+		attribute.Float64("slo.burn_rate.long", s.Long),
+		attribute.Float64("slo.burn_rate.threshold", t.cfg.BurnRateThreshold),
+	}
+}
+
+// count returns the cumulative good and total request counts of the
+// objective's route. A latency objective counts requests in the histogram's
+// buckets up to its latency as good, so a latency between bucket boundaries is
+// rounded down to the one below; other objectives count non-5xx responses.
+func count(rm metricdata.ResourceMetrics, o config.Objective) counts {
+	method, route := "", o.Route
+	if m, path, ok := strings.Cut(o.Route, " "); ok {
+		method, route = m, strings.TrimSpace(path)
+	}
+	threshold := o.Latency.Seconds()
+
+	var c counts
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if m.Name != durationMetric || !ok {
+				continue
+			}
+			for _, dp := range hist.DataPoints {
+				if v, _ := dp.Attributes.Value(semconv.HTTPRouteKey); v.AsString() != route {
+					continue
+				}
+				if v, _ := dp.Attributes.Value(semconv.HTTPRequestMethodKey); method != "" && v.AsString() != method {
+					continue
+				}
+				c.total += dp.Count
+				switch {
+				case o.Latency > 0:
+					for b, bound := range dp.Bounds {
+						if bound > threshold+1e-9 {
+							break
+						}
+						c.good += dp.BucketCounts[b]
+					}
+				default:
+					if v, _ := dp.Attributes.Value(semconv.HTTPResponseStatusCodeKey); v.AsInt64() < 500 {
+						c.good += dp.Count
+					}
+				}
+			}
+		}
+	}
+	return c
+}
+
+// WindowLabel formats a window without zero units: "5m", "1h", "1h30m".
+func WindowLabel(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
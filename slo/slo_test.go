@@ -0,0 +1,111 @@
+package slo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"app/config"
+	"app/logging"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestBurnRates(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	hist, _ := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test").Float64Histogram(
+		durationMetric, metric.WithExplicitBucketBoundaries(0.1, 0.5, 1))
+	record := func(n int, method, route string, status int, seconds float64) {
+		for range n {
+			hist.Record(context.Background(), seconds, metric.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.HTTPRoute(route),
+				semconv.HTTPResponseStatusCode(status),
+			))
+		}
+	}
+
+	cfg := config.SLO{
+		ShortWindow:       5 * time.Minute,
+		LongWindow:        time.Hour,
+		BurnRateThreshold: 10,
+		Objectives: []config.Objective{
+			{Name: "latency", Route: "POST /orders", Latency: 500 * time.Millisecond, Target: 0.99},
+			{Name: "availability", Route: "/orders", Target: 0.9},
+		},
+	}
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	logging.JSONLogger.SetFile(logFile)
+	tracker := New(cfg, reader.Collect)
+	now := time.Unix(0, 0)
+	tracker.now = func() time.Time { return now }
+	evaluate := func(after time.Duration) []Status {
+		t.Helper()
+		now = now.Add(after)
+		if err := tracker.Evaluate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return tracker.Statuses()
+	}
+
+	// A healthy hour, then a bad five minutes.
+	record(1, "POST", "/orders", 200, 0.05)
+	evaluate(0)
+	record(1000, "POST", "/orders", 200, 0.05)
+	record(100, "GET", "/other", 500, 2)
+	evaluate(55 * time.Minute)
+	record(90, "POST", "/orders", 200, 0.05)
+	record(10, "POST", "/orders", 200, 0.75)
+	record(10, "GET", "/orders", 503, 0.05)
+	got := evaluate(5 * time.Minute)
+
+	// Latency: 10 of the last 5 minutes' 100 POSTs are slow, 10 of the hour's 1100.
+	if s := got[0]; !near(s.Short, 10) || !near(s.Long, 10.0/1100/0.01) || s.Burning {
+		t.Errorf("latency = %+v, want short 10, long %.2f, not burning", s, 10.0/1100/0.01)
+	}
+	if s := got[0]; s.Total != 1100 || s.Good != 1090 || !near(s.BudgetRemaining(), 1-10/11.0) {
+		t.Errorf("latency since start = %d of %d good, budget %.3f; want 1090 of 1100, %.3f", s.Good, s.Total, s.BudgetRemaining(), 1-10/11.0)
+	}
+	// Availability: 10 of 110 requests failed in the last 5 minutes, 10 of 1110 in the hour.
+	if s := got[1]; !near(s.Short, 10.0/110/0.1) || !near(s.Long, 10.0/1110/0.1) || s.Burning {
+		t.Errorf("availability = %+v, want short %.2f, long %.2f, not burning", s, 10.0/110/0.1, 10.0/1110/0.1)
+	}
+
+	// Another bad interval pushes the long window over the threshold too.
+	record(1000, "POST", "/orders", 200, 0.75)
+	got = evaluate(30 * time.Second)
+	if !got[0].Burning {
+		t.Errorf("latency = %+v, want burning", got[0])
+	}
+	if data, _ := os.ReadFile(logFile); !strings.Contains(string(data), `"SLO error budget burning"`) {
+		t.Errorf("log = %s, want an SLO warning", data)
+	}
+	// An hour of good requests later, it has recovered.
+	record(1000, "POST", "/orders", 200, 0.05)
+	got = evaluate(time.Hour)
+	if got[0].Burning || got[0].Short != 0 {
+		t.Errorf("latency = %+v, want recovered", got[0])
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func TestWindowLabel(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		5 * time.Minute:  "5m",
+		time.Hour:        "1h",
+		90 * time.Minute: "1h30m",
+		30 * time.Second: "30s",
+	} {
+		if got := WindowLabel(d); got != want {
+			t.Errorf("WindowLabel(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Package store keeps an in-memory record of orders so that read endpoints
+// (search, retrieval, refunds) have data to work with.
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Order statuses.
+const (
+	StatusPending  = "pending"
+	StatusCreated  = "created"
+	StatusFailed   = "failed"
+	StatusRefunded = "refunded"
+)
+
+// MaxOrders bounds the number of orders kept in memory; the oldest are evicted first.
+const MaxOrders = 10000
+
+// Order is a stored order record.
+type Order struct {
+	ID         int       `json:"id"`
+	CustomerID string    `json:"customer_id"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	// TraceID and SpanID identify the request span that created the order.
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+	// SettlementID is the settlement batch that included the order, if any.
+	SettlementID string `json:"settlement_id,omitempty"`
+}
+
+// Query filters orders in Search. Zero-valued fields match everything.
+type Query struct {
+	CustomerID string
+	Status     string
+	Since      time.Time
+}
+
+// Store is a concurrency-safe in-memory order store.
+type Store struct {
+	mu     sync.RWMutex
+	orders map[int]Order
+	nextID int
+}
+
+// DefaultStore is the process-wide order store used by the handlers.
+var DefaultStore = New()
+
+// New creates an empty Store.
+func New() *Store {
+	return &Store{orders: make(map[int]Order), nextID: 1}
+}
+
+// Create stores a new pending order and returns it with its assigned ID.
+func (s *Store) Create(customerID, traceID, spanID string) Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := Order{
+		ID:         s.nextID,
+		CustomerID: customerID,
+		Status:     StatusPending,
+		CreatedAt:  time.Now().UTC(),
+		TraceID:    traceID,
+		SpanID:     spanID,
+	}
+	s.orders[o.ID] = o
+	s.nextID++
+	delete(s.orders, o.ID-MaxOrders)
+	return o
+}
+
+// Add stores a complete order record, such as a historical one, and returns
+// it with its assigned ID. The record's own ID is ignored.
+func (s *Store) Add(o Order) Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o.ID = s.nextID
+	s.orders[o.ID] = o
+	s.nextID++
+	delete(s.orders, o.ID-MaxOrders)
+	return o
+}
+
+// SetStatus updates the status of an order. It reports false if the order does not exist.
+func (s *Store) SetStatus(id int, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return false
+	}
+	o.Status = status
+	s.orders[id] = o
+	return true
+}
+
+// CompareAndSetStatus updates the status of an order only if it currently has
+// status from. It reports whether the update happened.
+func (s *Store) CompareAndSetStatus(id int, from, to string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok || o.Status != from {
+		return false
+	}
+	o.Status = to
+	s.orders[id] = o
+	return true
+}
+
+// ClaimForSettlement assigns up to limit created orders not yet in a
+// settlement batch, oldest first, to the batch, and returns them.
+func (s *Store) ClaimForSettlement(batchID string, limit int) []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int
+	for id, o := range s.orders {
+		if o.Status == StatusCreated && o.SettlementID == "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	claimed := make([]Order, 0, len(ids))
+	for _, id := range ids {
+		o := s.orders[id]
+		o.SettlementID = batchID
+		s.orders[id] = o
+		claimed = append(claimed, o)
+	}
+	return claimed
+}
+
+// ReleaseSettlement removes the orders of a settlement batch that was not
+// posted from it, so a later batch can claim them.
+func (s *Store) ReleaseSettlement(batchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, o := range s.orders {
+		if o.SettlementID == batchID {
+			o.SettlementID = ""
+			s.orders[id] = o
+		}
+	}
+}
+
+// Ping checks that the store can serve reads.
+func (s *Store) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.orders == nil {
+		return errors.New("store is not initialized")
+	}
+	return nil
+}
+
+// Get returns the order with the given ID.
+func (s *Store) Get(id int) (Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[id]
+	return o, ok
+}
+
+// Search returns the orders matching q, oldest first.
+func (s *Store) Search(q Query) []Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Order
+	for _, o := range s.orders {
+		if q.CustomerID != "" && o.CustomerID != q.CustomerID {
+			continue
+		}
+		if q.Status != "" && o.Status != q.Status {
+			continue
+		}
+		if !q.Since.IsZero() && o.CreatedAt.Before(q.Since) {
+			continue
+		}
+		result = append(result, o)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
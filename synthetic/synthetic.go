@@ -0,0 +1,274 @@
+// Package synthetic runs the synthetic monitor: on a schedule it calls the
+// service's own endpoints, and any downstream URLs configured as checks, the
+// way a client would, so availability and latency are measured even when
+// there is no real traffic.
+//
+// Each check is a "synthetic.check" root span whose client span continues into
+// the server's trace. Requests carry the synthetic=true baggage member, which
+// the server copies to its spans as baggage.synthetic, and a distinct
+// User-Agent, so synthetic requests can be told apart from real ones. Results
+// are recorded in their own synthetic.* metrics rather than only in the HTTP
+// server metrics real traffic shares.
+package synthetic
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"app/config"
+	"app/httpclient"
+	"app/logging"
+	"app/middleware"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "app/synthetic"
+
+// UserAgent identifies synthetic requests.
+const UserAgent = "sc-go-synthetic/1.0"
+
+// Outcomes of a check.
+const (
+	OutcomeOK               = "ok"
+	OutcomeUnexpectedStatus = "unexpected_status"
+	OutcomeError            = "error"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Check    string
+	Outcome  string
+	Status   int
+	Duration time.Duration
+	Err      error
+}
+
+// Monitor runs the configured checks.
+type Monitor struct {
+	cfg    config.Synthetic
+	target string
+	client *httpclient.Client
+	tracer trace.Tracer
+
+	checks   metric.Int64Counter
+	duration metric.Float64Histogram
+
+	mu sync.Mutex
+	up map[string]bool
+}
+
+// New returns a monitor of cfg's checks. Relative check URLs resolve against
+// cfg.Target or, when it is empty, the public listener at server.Addr.
+func New(cfg config.Synthetic, server config.Server) *Monitor {
+	m := &Monitor{
+		cfg:    cfg,
+		target: strings.TrimSuffix(cmp.Or(cfg.Target, selfURL(server)), "/"),
+		tracer: otel.Tracer(instrumentationName),
+		up:     make(map[string]bool),
+	}
+	// Checks are not retried, so every failure counts. The service's own
+	// certificate need not be valid for localhost.
+	opts := []httpclient.Option{
+		httpclient.WithTimeout(cfg.Timeout),
+		httpclient.WithRetryPolicy(httpclient.RetryPolicy{MaxAttempts: 1}),
+	}
+	if cfg.Target == "" && server.TLS.Enabled() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		opts = append(opts, httpclient.WithTransport(transport))
+	}
+	m.client = httpclient.New("self", opts...)
+
+	meter := otel.Meter(instrumentationName)
+	var err error
+	m.checks, err = meter.Int64Counter(
+		"synthetic.checks",
+		metric.WithDescription("The number of synthetic checks run, by check and outcome"),
+		metric.WithUnit("{check}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create synthetic.checks counter: %v", err)
+	}
+	m.duration, err = meter.Float64Histogram(
+		"synthetic.check.duration",
+		metric.WithDescription("The duration of synthetic checks, by check and outcome"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	)
+	if err != nil {
+		log.Fatalf("failed to create synthetic.check.duration histogram: %v", err)
+	}
+	up, err := meter.Int64ObservableGauge(
+		"synthetic.check.up",
+		metric.WithDescription("Whether each synthetic check passed on its last run (1) or not (0)"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create synthetic.check.up gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for check, ok := range m.up {
+			v := int64(0)
+			if ok {
+				v = 1
+			}
+			o.ObserveInt64(up, v, metric.WithAttributes(attribute.String("synthetic.check", check)))
+		}
+		return nil
+	}, up)
+	if err != nil {
+		log.Fatalf("failed to register synthetic.check.up gauge: %v", err)
+	}
+	return m
+}
+
+// Run runs every check now and then every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		m.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs every check concurrently and returns their results, in the
+// configured order.
+func (m *Monitor) RunOnce(ctx context.Context) []Result {
+	results := make([]Result, len(m.cfg.Checks))
+	var wg sync.WaitGroup
+	for i, c := range m.cfg.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.check(ctx, c)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// check runs one check in its own "synthetic.check" root span and records
+// its result.
+func (m *Monitor) check(ctx context.Context, c config.SyntheticCheck) Result {
+	method := cmp.Or(c.Method, http.MethodGet)
+	url := c.URL
+	if strings.HasPrefix(url, "/") {
+		url = m.target + url
+	}
+	ctx, span := m.tracer.Start(ctx, "synthetic.check",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("synthetic.check", c.Name),
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLFull(url),
+		),
+	)
+	defer span.End()
+	member, _ := baggage.NewMember("synthetic", "true")
+	bag, _ := baggage.New(member)
+	ctx = baggage.ContextWithBaggage(ctx, bag)
+
+	start := time.Now()
+	status, err := m.do(ctx, method, url)
+	res := Result{Check: c.Name, Outcome: OutcomeOK, Status: status, Duration: time.Since(start), Err: err}
+	switch {
+	case err != nil:
+		res.Outcome = OutcomeError
+	case !passes(c, status):
+		res.Outcome = OutcomeUnexpectedStatus
+		res.Err = fmt.Errorf("unexpected status %d", status)
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("synthetic.check", c.Name),
+		attribute.String("synthetic.outcome", res.Outcome),
+	}
+	m.checks.Add(ctx, 1, metric.WithAttributes(attrs...))
+	m.duration.Record(ctx, res.Duration.Seconds(), metric.WithAttributes(attrs...))
+	m.mu.Lock()
+	m.up[c.Name] = res.Outcome == OutcomeOK
+	m.mu.Unlock()
+
+	span.SetAttributes(attribute.String("synthetic.outcome", res.Outcome))
+	if status != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	}
+	if res.Err != nil {
+		span.RecordError(res.Err)
+		span.SetStatus(codes.Error, "synthetic check failed")
+		logging.JSONLogger.Warn(ctx, "Synthetic check failed",
+			attribute.String("synthetic.check", c.Name),
+			attribute.String("synthetic.outcome", res.Outcome),
+			attribute.String("error.message", res.Err.Error()),
+		)
+	}
+	return res
+}
+
+// do sends the request and returns the response status.
+func (m *Monitor) do(ctx context.Context, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if m.cfg.APIKey != "" {
+		req.Header.Set(middleware.APIKeyHeader, m.cfg.APIKey)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// passes reports whether status is one the check expects.
+func passes(c config.SyntheticCheck, status int) bool {
+	if len(c.Expect) == 0 {
+		return status >= 200 && status < 300
+	}
+	return slices.Contains(c.Expect, status)
+}
+
+// selfURL returns the base URL of the public listener at addr, on localhost
+// when it listens on every interface.
+func selfURL(server config.Server) string {
+	host, port, err := net.SplitHostPort(server.Addr)
+	if err != nil {
+		return "http://localhost:8080"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if server.TLS.Enabled() {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,105 @@
+package synthetic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"app/config"
+	"app/logging"
+	"app/tracing/tracetest"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMonitor(t *testing.T) {
+	logging.JSONLogger.SetFile(filepath.Join(t.TempDir(), "app.log"))
+	spans := tracetest.Install(t)
+	metrics := tracetest.StartMetrics(t)
+
+	type received struct {
+		traceID   trace.TraceID
+		synthetic string
+		userAgent string
+	}
+	requests := make(chan received, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		requests <- received{
+			traceID:   trace.SpanContextFromContext(ctx).TraceID(),
+			synthetic: baggage.FromContext(ctx).Member("synthetic").Value(),
+			userAgent: r.UserAgent(),
+		}
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	m := New(config.Synthetic{
+		Interval: time.Minute,
+		Target:   srv.URL,
+		Timeout:  time.Second,
+		Checks: []config.SyntheticCheck{
+			{Name: "ok", URL: "/ok"},
+			{Name: "broken", URL: "/broken"},
+			{Name: "absolute", URL: srv.URL + "/broken", Expect: []int{503}},
+		},
+	}, config.Server{})
+	results := m.RunOnce(context.Background())
+
+	for i, want := range []string{OutcomeOK, OutcomeUnexpectedStatus, OutcomeOK} {
+		if results[i].Outcome != want {
+			t.Errorf("check %s: outcome %s (%v), want %s", results[i].Check, results[i].Outcome, results[i].Err, want)
+		}
+	}
+	roots := spans.Named("synthetic.check")
+	if len(roots) != 3 {
+		t.Fatalf("got %d synthetic.check spans, want 3", len(roots))
+	}
+	traces := make(map[trace.TraceID]bool)
+	for _, s := range roots {
+		if s.Parent().IsValid() {
+			t.Errorf("synthetic.check span has parent %s, want a root span", s.Parent().SpanID())
+		}
+		traces[s.SpanContext().TraceID()] = true
+		for _, kv := range s.Attributes() {
+			if kv.Key == "synthetic.check" && kv.Value.AsString() == "broken" {
+				tracetest.AssertError(t, s)
+			}
+			if kv.Key == "synthetic.check" && kv.Value.AsString() == "ok" {
+				tracetest.AssertStatus(t, s, codes.Unset)
+			}
+		}
+	}
+	for range 3 {
+		r := <-requests
+		if !traces[r.traceID] || r.synthetic != "true" || r.userAgent != UserAgent {
+			t.Errorf("server received %+v, want a check's trace, synthetic baggage, and %q", r, UserAgent)
+		}
+	}
+
+	metrics.AssertCounter(t, "synthetic.checks", 1, attribute.String("synthetic.check", "ok"), attribute.String("synthetic.outcome", OutcomeOK))
+	metrics.AssertCounter(t, "synthetic.checks", 1, attribute.String("synthetic.check", "broken"), attribute.String("synthetic.outcome", OutcomeUnexpectedStatus))
+	metrics.AssertHistogramCount(t, "synthetic.check.duration", 1, attribute.String("synthetic.check", "absolute"))
+}
+
+func TestSelfURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8080":          "http://localhost:8080",
+		"127.0.0.1:9000": "http://127.0.0.1:9000",
+		"[::]:8080":      "http://localhost:8080",
+	} {
+		if got := selfURL(config.Server{Addr: addr}); got != want {
+			t.Errorf("selfURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
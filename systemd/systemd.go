@@ -0,0 +1,114 @@
+// Package systemd integrates the service with systemd: socket activation
+// (sockets passed in LISTEN_FDS), readiness and shutdown notifications over
+// NOTIFY_SOCKET (READY=1, STOPPING=1), and watchdog keepalives (WATCHDOG=1)
+// when the unit sets WatchdogSec=. Outside systemd the variables are unset
+// and every function is a no-op.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed by systemd socket activation, keyed by
+// their FileDescriptorName= (LISTEN_FDNAMES), or by their position ("0",
+// "1", ...) when unnamed. It returns nil if the process was not socket
+// activated. The LISTEN_* variables are cleared so child processes do not
+// inherit them.
+func Listeners() (map[string]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make(map[string]net.Listener, n)
+	for i := 0; i < n; i++ {
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" && names[i] != "unknown" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		// FileListener duplicates the descriptor, so the original is closed.
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: descriptor %d (%s): %w", listenFDsStart+i, name, err)
+		}
+		listeners[name] = ln
+	}
+	return listeners, nil
+}
+
+// Notify sends a state notification, such as "READY=1", to systemd. It
+// reports whether the notification was sent; it is not when NOTIFY_SOCKET is
+// unset.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("sd_notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("sd_notify: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval within which systemd expects a
+// keepalive (WatchdogSec=), or 0 if the watchdog is not enabled for this
+// process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog sends WATCHDOG=1 at half the watchdog interval until ctx is done,
+// so a hung process is restarted by systemd. It returns at once if the
+// watchdog is not enabled.
+func Watchdog(ctx context.Context) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := Notify("WATCHDOG=1"); err != nil {
+				log.Printf("[WARN] systemd watchdog: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package tlscert serves the public listener's TLS certificate and reloads it
+// when the certificate or key file changes, so certificates can be rotated
+// without a restart.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "app/tlscert"
+
+var meter = otel.Meter(instrumentationName)
+
+// Reloader holds the current certificate loaded from a cert/key file pair.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	notAfter time.Time
+	modTimes [2]time.Time
+
+	reloadCounter metric.Int64Counter
+}
+
+// NewReloader loads the certificate and key. It fails if they cannot be
+// loaded, so a misconfigured server does not start.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.reloadCounter, err = meter.Int64Counter(
+		"tls_certificate_reloads_total",
+		metric.WithDescription("The total number of TLS certificate reloads, by outcome"),
+		metric.WithUnit("{reload}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create tls_certificate_reloads_total counter: %v", err)
+	}
+	expiryGauge, err := meter.Float64ObservableGauge(
+		"tls_certificate_expiry_seconds",
+		metric.WithDescription("The time until the served TLS certificate expires"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create tls_certificate_expiry_seconds gauge: %v", err)
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		o.ObserveFloat64(expiryGauge, time.Until(r.notAfter).Seconds(),
+			metric.WithAttributes(attribute.String("tls.certificate.file", r.certFile)))
+		return nil
+	}, expiryGauge)
+	if err != nil {
+		log.Fatalf("failed to register tls_certificate_expiry_seconds gauge: %v", err)
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate; use it as
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch checks the files every interval until ctx is done, reloading the
+// certificate when either file's modification time changes. A pair that fails
+// to load (for example, while only one file has been replaced) keeps the
+// previous certificate in service and is retried on the next check.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTimes, err := r.stat()
+		r.mu.RLock()
+		changed := err == nil && modTimes != r.modTimes
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.load(); err != nil {
+			r.reloadCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "error")))
+			log.Printf("[WARN] TLS certificate reload failed, keeping the current certificate: %v", err)
+			continue
+		}
+		r.reloadCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "ok")))
+		r.mu.RLock()
+		log.Printf("TLS certificate reloaded from %s (expires %s)", r.certFile, r.notAfter.Format(time.RFC3339))
+		r.mu.RUnlock()
+	}
+}
+
+// load reads and parses the cert/key pair and makes it current.
+func (r *Reloader) load() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parsing TLS certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.notAfter, r.modTimes = &cert, leaf.NotAfter, modTimes
+	return nil
+}
+
+// stat returns the modification times of the cert and key files.
+func (r *Reloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
@@ -0,0 +1,194 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"app/config"
+	"app/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// collectorProbeTimeout bounds each collector check.
+const collectorProbeTimeout = 5 * time.Second
+
+// CollectorStatus is the state of the OTel Collector as last checked by
+// MonitorCollector.
+type CollectorStatus struct {
+	Endpoint string `json:"endpoint"`
+	Up       bool   `json:"up"`
+	// ConsecutiveFailures counts the failed checks since the last one that
+	// passed.
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastCheck           time.Time  `json:"last_check"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+}
+
+var (
+	collectorMu sync.Mutex
+	// collector is the last check's state, or nil before the first check.
+	collector *CollectorStatus
+)
+
+// Collector returns the state of the OTel Collector, and false while it is
+// not monitored or has not been checked yet.
+func Collector() (CollectorStatus, bool) {
+	collectorMu.Lock()
+	defer collectorMu.Unlock()
+	if collector == nil {
+		return CollectorStatus{}, false
+	}
+	return *collector, true
+}
+
+// MonitorCollector checks the OTel Collector now and then every
+// telemetry.CollectorCheckInterval until ctx is done, and exports the result
+// as the otel_collector_up and otel_collector_consecutive_failures gauges. A
+// check GETs telemetry.CollectorHealthURL, such as the collector's
+// health_check extension, or else sends an empty OTLP trace export, which a
+// healthy receiver accepts. Checks are neither traced nor retried, and the
+// gauges are also served on /metrics, so a broken pipeline can be seen
+// without going through it.
+func MonitorCollector(ctx context.Context, telemetry config.Telemetry) {
+	probe := collectorProbe(telemetry)
+	attrs := metric.WithAttributes(attribute.String("server.address", telemetry.OTLPEndpoint))
+	meter := otel.Meter(instrumentationName)
+	up, err := meter.Int64ObservableGauge(
+		"otel_collector_up",
+		metric.WithDescription("Whether the last check of the OTel Collector passed (1) or not (0)"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create otel_collector_up gauge: %v", err)
+	}
+	failures, err := meter.Int64ObservableGauge(
+		"otel_collector_consecutive_failures",
+		metric.WithDescription("The number of failed checks of the OTel Collector since the last one that passed"),
+		metric.WithUnit("{check}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create otel_collector_consecutive_failures gauge: %v", err)
+	}
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		status, ok := Collector()
+		if !ok {
+			return nil
+		}
+		v := int64(0)
+		if status.Up {
+			v = 1
+		}
+		o.ObserveInt64(up, v, attrs)
+		o.ObserveInt64(failures, int64(status.ConsecutiveFailures), attrs)
+		return nil
+	}, up, failures)
+	if err != nil {
+		log.Fatalf("failed to register collector gauges: %v", err)
+	}
+	defer func() { _ = reg.Unregister() }()
+
+	ticker := time.NewTicker(telemetry.CollectorCheckInterval)
+	defer ticker.Stop()
+	for {
+		checkCollector(ctx, telemetry.OTLPEndpoint, probe)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkCollector runs the probe and records its result, logging when the
+// collector goes down and when it comes back.
+func checkCollector(ctx context.Context, endpoint string, probe func(context.Context) error) {
+	probeCtx, cancel := context.WithTimeout(ctx, collectorProbeTimeout)
+	err := probe(probeCtx)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	collectorMu.Lock()
+	prev := collector
+	next := CollectorStatus{Endpoint: endpoint, Up: err == nil, LastCheck: time.Now().UTC()}
+	if prev != nil {
+		next.LastError, next.LastErrorAt = prev.LastError, prev.LastErrorAt
+	}
+	if err != nil {
+		next.LastError, next.LastErrorAt = err.Error(), &next.LastCheck
+		next.ConsecutiveFailures = 1
+		if prev != nil {
+			next.ConsecutiveFailures += prev.ConsecutiveFailures
+		}
+	}
+	collector = &next
+	collectorMu.Unlock()
+
+	switch {
+	case err != nil && (prev == nil || prev.Up):
+		log.Printf("[WARN] OTel Collector at %s is unreachable: %v", endpoint, err)
+		logging.JSONLogger.Warn(ctx, "OTel Collector unreachable",
+			attribute.String("server.address", endpoint),
+			attribute.String("error.message", err.Error()),
+		)
+	case err == nil && prev != nil && !prev.Up:
+		log.Printf("OTel Collector at %s is back after %d failed checks", endpoint, prev.ConsecutiveFailures)
+		logging.JSONLogger.Info(ctx, "OTel Collector reachable again",
+			attribute.String("server.address", endpoint),
+			attribute.Int("collector.failed_checks", prev.ConsecutiveFailures),
+		)
+	}
+}
+
+// collectorProbe returns the check of the collector telemetry configures.
+func collectorProbe(telemetry config.Telemetry) func(context.Context) error {
+	client := &http.Client{}
+	if telemetry.CollectorHealthURL != "" {
+		return func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, telemetry.CollectorHealthURL, nil)
+			if err != nil {
+				return err
+			}
+			return doProbe(client, req)
+		}
+	}
+	scheme := "https"
+	if telemetry.Insecure {
+		scheme = "http"
+	}
+	exportURL := scheme + "://" + telemetry.OTLPEndpoint + "/v1/traces"
+	return func(ctx context.Context) error {
+		// An empty ExportTraceServiceRequest encodes to no bytes.
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, exportURL, bytes.NewReader(nil))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		return doProbe(client, req)
+	}
+}
+
+// doProbe sends the request and fails unless it is answered with a 2xx.
+func doProbe(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: status %d", req.Method, req.URL.Redacted(), resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"app/config"
+	"app/logging"
+)
+
+func TestCheckCollector(t *testing.T) {
+	logging.JSONLogger.SetFile(filepath.Join(t.TempDir(), "app.log"))
+	var status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("probe sent %s %s (%s), want an OTLP trace export", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	collectorMu.Lock()
+	collector = nil
+	collectorMu.Unlock()
+
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	probe := collectorProbe(config.Telemetry{OTLPEndpoint: endpoint, Insecure: true})
+	ctx := context.Background()
+	if _, ok := Collector(); ok {
+		t.Fatal("collector state reported before the first check")
+	}
+	for _, step := range []struct {
+		status       int
+		wantUp       bool
+		wantFailures int
+	}{
+		{http.StatusOK, true, 0},
+		{http.StatusServiceUnavailable, false, 1},
+		{http.StatusServiceUnavailable, false, 2},
+		{http.StatusOK, true, 0},
+	} {
+		status.Store(int32(step.status))
+		checkCollector(ctx, endpoint, probe)
+		got, ok := Collector()
+		if !ok {
+			t.Fatal("no collector state after a check")
+		}
+		if got.Up != step.wantUp || got.ConsecutiveFailures != step.wantFailures {
+			t.Errorf("after a %d: up = %t with %d failures, want %t with %d", step.status, got.Up, got.ConsecutiveFailures, step.wantUp, step.wantFailures)
+		}
+	}
+	// The last error is kept after recovery.
+	if got, _ := Collector(); !strings.Contains(got.LastError, "status 503") || got.LastErrorAt == nil {
+		t.Errorf("last error = %q at %v, want the 503", got.LastError, got.LastErrorAt)
+	}
+
+	srv.Close()
+	checkCollector(ctx, endpoint, probe)
+	if got, _ := Collector(); got.Up || got.ConsecutiveFailures != 1 {
+		t.Errorf("unreachable collector: up = %t with %d failures, want down with 1", got.Up, got.ConsecutiveFailures)
+	}
+}
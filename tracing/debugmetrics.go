@@ -0,0 +1,187 @@
+package tracing
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// MetricsSnapshot is the JSON response payload for GET /debug/metrics.
+type MetricsSnapshot struct {
+	CollectedAt time.Time       `json:"collected_at"`
+	Resource    map[string]any  `json:"resource"`
+	Scopes      []ScopeSnapshot `json:"scopes"`
+}
+
+// ScopeSnapshot holds the metrics of one instrumentation scope.
+type ScopeSnapshot struct {
+	Scope   string           `json:"scope"`
+	Metrics []MetricSnapshot `json:"metrics"`
+}
+
+// MetricSnapshot is one instrument's current data points. Type is "sum",
+// "gauge", or "histogram"; sums are monotonic counters or up-down counters.
+type MetricSnapshot struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Unit        string              `json:"unit,omitempty"`
+	Type        string              `json:"type"`
+	Monotonic   bool                `json:"monotonic,omitempty"`
+	Temporality string              `json:"temporality,omitempty"`
+	DataPoints  []DataPointSnapshot `json:"data_points"`
+}
+
+// DataPointSnapshot is the value of one attribute set. Sums and gauges set
+// Value; histograms set Count, Sum, Min, Max, Bounds, and BucketCounts, where
+// BucketCounts[i] counts the values in (Bounds[i-1], Bounds[i]] and the last
+// count is the overflow bucket.
+type DataPointSnapshot struct {
+	Attributes   map[string]any `json:"attributes"`
+	StartTime    *time.Time     `json:"start_time,omitempty"`
+	Time         time.Time      `json:"time"`
+	Value        any            `json:"value,omitempty"`
+	Count        *uint64        `json:"count,omitempty"`
+	Sum          any            `json:"sum,omitempty"`
+	Min          any            `json:"min,omitempty"`
+	Max          any            `json:"max,omitempty"`
+	Bounds       []float64      `json:"bounds,omitempty"`
+	BucketCounts []uint64       `json:"bucket_counts,omitempty"`
+}
+
+// DebugMetricsHandler serves GET /debug/metrics: it collects every instrument
+// now and returns the values as JSON, with the attribute sets as recorded, for
+// checking instrument registration without a backend. The name parameter
+// keeps the metrics whose names contain it, and scope those of the
+// instrumentation scopes whose names contain it.
+func DebugMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rm metricdata.ResourceMetrics
+		if err := promReader.Collect(r.Context(), &rm); err != nil {
+			http.Error(w, "collecting metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		snap := snapshotMetrics(rm, r.URL.Query().Get("name"), r.URL.Query().Get("scope"))
+		snap.CollectedAt = time.Now().UTC()
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(snap)
+	})
+}
+
+// snapshotMetrics converts collected metrics, keeping those whose name
+// contains name and whose scope contains scope.
+func snapshotMetrics(rm metricdata.ResourceMetrics, name, scope string) MetricsSnapshot {
+	snap := MetricsSnapshot{Scopes: []ScopeSnapshot{}}
+	if rm.Resource != nil {
+		snap.Resource = attributeMap(rm.Resource.Attributes())
+	}
+	for _, sm := range rm.ScopeMetrics {
+		if !strings.Contains(sm.Scope.Name, scope) {
+			continue
+		}
+		ss := ScopeSnapshot{Scope: sm.Scope.Name}
+		for _, m := range sm.Metrics {
+			if strings.Contains(m.Name, name) {
+				ss.Metrics = append(ss.Metrics, metricSnapshot(m))
+			}
+		}
+		if len(ss.Metrics) > 0 {
+			snap.Scopes = append(snap.Scopes, ss)
+		}
+	}
+	return snap
+}
+
+func metricSnapshot(m metricdata.Metrics) MetricSnapshot {
+	ms := MetricSnapshot{Name: m.Name, Description: m.Description, Unit: m.Unit, DataPoints: []DataPointSnapshot{}}
+	switch data := m.Data.(type) {
+	case metricdata.Sum[int64]:
+		ms.Type, ms.Monotonic, ms.Temporality = "sum", data.IsMonotonic, data.Temporality.String()
+		for _, dp := range data.DataPoints {
+			ms.DataPoints = append(ms.DataPoints, valuePoint(dp.Attributes, dp.StartTime, dp.Time, dp.Value))
+		}
+	case metricdata.Sum[float64]:
+		ms.Type, ms.Monotonic, ms.Temporality = "sum", data.IsMonotonic, data.Temporality.String()
+		for _, dp := range data.DataPoints {
+			ms.DataPoints = append(ms.DataPoints, valuePoint(dp.Attributes, dp.StartTime, dp.Time, jsonFloat(dp.Value)))
+		}
+	case metricdata.Gauge[int64]:
+		ms.Type = "gauge"
+		for _, dp := range data.DataPoints {
+			ms.DataPoints = append(ms.DataPoints, valuePoint(dp.Attributes, dp.StartTime, dp.Time, dp.Value))
+		}
+	case metricdata.Gauge[float64]:
+		ms.Type = "gauge"
+		for _, dp := range data.DataPoints {
+			ms.DataPoints = append(ms.DataPoints, valuePoint(dp.Attributes, dp.StartTime, dp.Time, jsonFloat(dp.Value)))
+		}
+	case metricdata.Histogram[int64]:
+		ms.Type, ms.Temporality = "histogram", data.Temporality.String()
+		for _, dp := range data.DataPoints {
+			p := histogramPoint(dp.Attributes, dp.StartTime, dp.Time, dp.Count, dp.Bounds, dp.BucketCounts)
+			p.Sum = dp.Sum
+			if v, ok := dp.Min.Value(); ok {
+				p.Min = v
+			}
+			if v, ok := dp.Max.Value(); ok {
+				p.Max = v
+			}
+			ms.DataPoints = append(ms.DataPoints, p)
+		}
+	case metricdata.Histogram[float64]:
+		ms.Type, ms.Temporality = "histogram", data.Temporality.String()
+		for _, dp := range data.DataPoints {
+			p := histogramPoint(dp.Attributes, dp.StartTime, dp.Time, dp.Count, dp.Bounds, dp.BucketCounts)
+			p.Sum = jsonFloat(dp.Sum)
+			if v, ok := dp.Min.Value(); ok {
+				p.Min = jsonFloat(v)
+			}
+			if v, ok := dp.Max.Value(); ok {
+				p.Max = jsonFloat(v)
+			}
+			ms.DataPoints = append(ms.DataPoints, p)
+		}
+	default:
+		ms.Type = "unsupported"
+	}
+	return ms
+}
+
+func valuePoint(attrs attribute.Set, start, t time.Time, value any) DataPointSnapshot {
+	return DataPointSnapshot{Attributes: attributeMap(attrs.ToSlice()), StartTime: startTime(start), Time: t, Value: value}
+}
+
+func histogramPoint(attrs attribute.Set, start, t time.Time, count uint64, bounds []float64, counts []uint64) DataPointSnapshot {
+	return DataPointSnapshot{Attributes: attributeMap(attrs.ToSlice()), StartTime: startTime(start), Time: t, Count: &count, Bounds: bounds, BucketCounts: counts}
+}
+
+// startTime returns a data point's start time, or nil for gauges, which have
+// none.
+func startTime(start time.Time) *time.Time {
+	if start.IsZero() {
+		return nil
+	}
+	return &start
+}
+
+func attributeMap(attrs []attribute.KeyValue) map[string]any {
+	m := make(map[string]any, len(attrs))
+	for _, kv := range attrs {
+		m[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return m
+}
+
+// jsonFloat returns v, or its string form if JSON cannot represent it.
+func jsonFloat(v float64) any {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return promFloat(v)
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSnapshotMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	ctx := context.Background()
+
+	orders, _ := meter.Int64Counter("orders.created", metric.WithUnit("{order}"))
+	orders.Add(ctx, 2, metric.WithAttributes(attribute.String("tier", "gold")))
+	orders.Add(ctx, 1, metric.WithAttributes(attribute.String("tier", "free")))
+	latency, _ := meter.Float64Histogram("orders.latency", metric.WithExplicitBucketBoundaries(0.1, 1))
+	latency.Record(ctx, 0.05)
+	latency.Record(ctx, 0.5)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := snapshotMetrics(rm, "", "")
+	if len(snap.Scopes) != 1 || len(snap.Scopes[0].Metrics) != 2 {
+		t.Fatalf("snapshot = %+v, want one scope with two metrics", snap)
+	}
+	counter := snap.Scopes[0].Metrics[0]
+	if counter.Name != "orders.created" || counter.Type != "sum" || !counter.Monotonic || len(counter.DataPoints) != 2 {
+		t.Fatalf("counter = %+v, want a monotonic sum with two data points", counter)
+	}
+	for _, dp := range counter.DataPoints {
+		want := map[string]int64{"gold": 2, "free": 1}[dp.Attributes["tier"].(string)]
+		if dp.Value != want {
+			t.Errorf("orders.created{tier=%v} = %v, want %d", dp.Attributes["tier"], dp.Value, want)
+		}
+	}
+	hist := snap.Scopes[0].Metrics[1]
+	if hist.Type != "histogram" || len(hist.DataPoints) != 1 {
+		t.Fatalf("histogram = %+v, want one data point", hist)
+	}
+	if dp := hist.DataPoints[0]; *dp.Count != 2 || dp.Sum != 0.55 || len(dp.BucketCounts) != 3 || dp.BucketCounts[0] != 1 || dp.BucketCounts[1] != 1 {
+		t.Errorf("orders.latency = %+v, want 2 values in the first two buckets", dp)
+	}
+
+	if snap := snapshotMetrics(rm, "latency", ""); len(snap.Scopes) != 1 || len(snap.Scopes[0].Metrics) != 1 {
+		t.Errorf("name filter kept %+v, want orders.latency only", snap.Scopes)
+	}
+	if snap := snapshotMetrics(rm, "", "other"); len(snap.Scopes) != 0 {
+		t.Errorf("scope filter kept %+v, want none", snap.Scopes)
+	}
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// traceExclude holds the telemetry.trace_exclude rules InitTracer was
+// configured with.
+var traceExclude atomic.Value
+
+// excludeRule matches requests by optional method and by path, exactly or, when
+// the rule ends in "*", by prefix.
+type excludeRule struct {
+	raw    string
+	method string
+	path   string
+	prefix bool
+}
+
+func (rule excludeRule) matches(r *http.Request) bool {
+	if rule.method != "" && rule.method != r.Method {
+		return false
+	}
+	if rule.prefix {
+		return strings.HasPrefix(r.URL.Path, rule.path)
+	}
+	return r.URL.Path == rule.path
+}
+
+// NewTraceFilter returns an otelhttp filter that excludes requests matching
+// any of rules, each "[METHOD ]/path" with an optional trailing "*" for a
+// prefix match. Excluded requests get no span and are not counted in the HTTP
+// server metrics; they are only counted in trace_filtered_requests_total, by
+// rule.
+func NewTraceFilter(rules []string) otelhttp.Filter {
+	var parsed []excludeRule
+	for _, raw := range rules {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		rule := excludeRule{raw: raw, path: raw}
+		if method, path, ok := strings.Cut(raw, " "); ok {
+			rule.method, rule.path = method, strings.TrimSpace(path)
+		}
+		if !strings.HasPrefix(rule.path, "/") {
+			log.Printf("[WARN] ignoring invalid trace exclusion %q", raw)
+			continue
+		}
+		rule.path, rule.prefix = strings.CutSuffix(rule.path, "*")
+		parsed = append(parsed, rule)
+	}
+
+	counter, err := otel.Meter(instrumentationName).Int64Counter(
+		"trace_filtered_requests_total",
+		metric.WithDescription("The total number of requests excluded from tracing and HTTP server metrics"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create trace_filtered_requests_total counter: %v", err)
+	}
+
+	return func(r *http.Request) bool {
+		for _, rule := range parsed {
+			if rule.matches(r) {
+				counter.Add(r.Context(), 1, metric.WithAttributes(attribute.String("trace_filter.rule", rule.raw)))
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// TraceFilter returns a filter for the telemetry.trace_exclude rules InitTracer
+// was configured with (see NewTraceFilter). Before InitTracer, every request
+// is traced.
+func TraceFilter() otelhttp.Filter {
+	rules, _ := traceExclude.Load().([]string)
+	return NewTraceFilter(rules)
+}
@@ -0,0 +1,29 @@
+package tracing
+
+import (
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// memory holds the telemetry kept by the "memory" exporter.
+var memory struct {
+	spans   *tracetest.InMemoryExporter
+	metrics *sdkmetric.ManualReader
+}
+
+// Memory returns the span exporter and metric reader installed by InitTracer
+// with the "memory" exporter, or nils with any other exporter. Spans are
+// exported as they end; metrics are collected on demand.
+func Memory() (*tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	return memory.spans, memory.metrics
+}
+
+// newMemory creates the span processor and metric reader of the "memory"
+// exporter.
+func newMemory() (sdktrace.SpanProcessor, sdkmetric.Reader) {
+	endpoint.Store("")
+	memory.spans = tracetest.NewInMemoryExporter()
+	memory.metrics = sdkmetric.NewManualReader()
+	return sdktrace.NewSimpleSpanProcessor(memory.spans), memory.metrics
+}
@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	rtrace "runtime/trace"
+
+	"app/instrumentation"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// The providers InitTracer installs globally wrap the SDK's, so requests that
+// instrumentation.Disable marks get no-op spans and drop their measurements,
+// and spans can be mirrored as runtime/trace tasks (see runtimetrace.go).
+// Observable instruments are read outside requests and are not wrapped.
+
+type switchTracerProvider struct {
+	embedded.TracerProvider
+	tp trace.TracerProvider
+}
+
+func (p switchTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return switchTracer{tracer: p.tp.Tracer(name, opts...)}
+}
+
+type switchTracer struct {
+	embedded.Tracer
+	tracer trace.Tracer
+}
+
+func (t switchTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if instrumentation.Disabled(ctx) {
+		return tracenoop.Tracer{}.Start(ctx, name, opts...)
+	}
+	ctx, span := t.tracer.Start(ctx, name, opts...)
+	if runtimeTasks.Load() && rtrace.IsEnabled() {
+		return startTask(ctx, span)
+	}
+	return ctx, span
+}
+
+type switchMeterProvider struct {
+	metric.MeterProvider
+}
+
+func (p switchMeterProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	return switchMeter{p.MeterProvider.Meter(name, opts...)}
+}
+
+// switchMeter wraps the synchronous instruments of a meter.
+type switchMeter struct {
+	metric.Meter
+}
+
+func (m switchMeter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	i, err := m.Meter.Int64Counter(name, opts...)
+	return switchInt64Counter{i}, err
+}
+
+func (m switchMeter) Int64UpDownCounter(name string, opts ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	i, err := m.Meter.Int64UpDownCounter(name, opts...)
+	return switchInt64UpDownCounter{i}, err
+}
+
+func (m switchMeter) Int64Histogram(name string, opts ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	i, err := m.Meter.Int64Histogram(name, opts...)
+	return switchInt64Histogram{i}, err
+}
+
+func (m switchMeter) Int64Gauge(name string, opts ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	i, err := m.Meter.Int64Gauge(name, opts...)
+	return switchInt64Gauge{i}, err
+}
+
+func (m switchMeter) Float64Counter(name string, opts ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	i, err := m.Meter.Float64Counter(name, opts...)
+	return switchFloat64Counter{i}, err
+}
+
+func (m switchMeter) Float64UpDownCounter(name string, opts ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	i, err := m.Meter.Float64UpDownCounter(name, opts...)
+	return switchFloat64UpDownCounter{i}, err
+}
+
+func (m switchMeter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	i, err := m.Meter.Float64Histogram(name, opts...)
+	return switchFloat64Histogram{i}, err
+}
+
+func (m switchMeter) Float64Gauge(name string, opts ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	i, err := m.Meter.Float64Gauge(name, opts...)
+	return switchFloat64Gauge{i}, err
+}
+
+type switchInt64Counter struct{ metric.Int64Counter }
+
+func (i switchInt64Counter) Add(ctx context.Context, v int64, opts ...metric.AddOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Int64Counter.Add(ctx, v, opts...)
+	}
+}
+
+type switchInt64UpDownCounter struct{ metric.Int64UpDownCounter }
+
+func (i switchInt64UpDownCounter) Add(ctx context.Context, v int64, opts ...metric.AddOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Int64UpDownCounter.Add(ctx, v, opts...)
+	}
+}
+
+type switchInt64Histogram struct{ metric.Int64Histogram }
+
+func (i switchInt64Histogram) Record(ctx context.Context, v int64, opts ...metric.RecordOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Int64Histogram.Record(ctx, v, opts...)
+	}
+}
+
+type switchInt64Gauge struct{ metric.Int64Gauge }
+
+func (i switchInt64Gauge) Record(ctx context.Context, v int64, opts ...metric.RecordOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Int64Gauge.Record(ctx, v, opts...)
+	}
+}
+
+type switchFloat64Counter struct{ metric.Float64Counter }
+
+func (i switchFloat64Counter) Add(ctx context.Context, v float64, opts ...metric.AddOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Float64Counter.Add(ctx, v, opts...)
+	}
+}
+
+type switchFloat64UpDownCounter struct{ metric.Float64UpDownCounter }
+
+func (i switchFloat64UpDownCounter) Add(ctx context.Context, v float64, opts ...metric.AddOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Float64UpDownCounter.Add(ctx, v, opts...)
+	}
+}
+
+type switchFloat64Histogram struct{ metric.Float64Histogram }
+
+func (i switchFloat64Histogram) Record(ctx context.Context, v float64, opts ...metric.RecordOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Float64Histogram.Record(ctx, v, opts...)
+	}
+}
+
+type switchFloat64Gauge struct{ metric.Float64Gauge }
+
+func (i switchFloat64Gauge) Record(ctx context.Context, v float64, opts ...metric.RecordOption) {
+	if !instrumentation.Disabled(ctx) {
+		i.Float64Gauge.Record(ctx, v, opts...)
+	}
+}
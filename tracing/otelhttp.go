@@ -0,0 +1,18 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+)
+
+// HTTPOptions returns the otelhttp options shared by server handlers and client
+// transports, followed by opts: the tracer and meter providers and the
+// propagator are passed explicitly, so otelhttp records its spans and metrics
+// through the providers InitTracer installed.
+func HTTPOptions(opts ...otelhttp.Option) []otelhttp.Option {
+	return append([]otelhttp.Option{
+		otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+		otelhttp.WithMeterProvider(otel.GetMeterProvider()),
+		otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+	}, opts...)
+}
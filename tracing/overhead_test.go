@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// BenchmarkRequestOverhead measures the cost of instrumenting a request shaped
+// like an order: a server span and HTTP server metrics, three workflow spans
+// with attributes and an event, and a counter and histogram update. It runs
+// uninstrumented, with no-op providers (instrumentation compiled in but
+// disabled), and with the SDK at several sampling ratios, exporting to a
+// discarding exporter through the batch processor as the service does. Each
+// instrumented case reports its overhead over the uninstrumented one as
+// overhead-ns/req; allocations are reported too:
+//
+//	go test ./tracing -run '^$' -bench RequestOverhead -benchmem
+func BenchmarkRequestOverhead(b *testing.B) {
+	type providers struct {
+		tp trace.TracerProvider
+		mp metric.MeterProvider
+	}
+	sdk := func(ratio float64) func(b *testing.B) providers {
+		return func(b *testing.B) providers {
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+				sdktrace.WithBatcher(discardExporter{}),
+			)
+			mp := sdkmetric.NewMeterProvider(
+				sdkmetric.WithReader(sdkmetric.NewManualReader()),
+				sdkmetric.WithView(httpServerView()),
+			)
+			b.Cleanup(func() {
+				_ = tp.Shutdown(context.Background())
+				_ = mp.Shutdown(context.Background())
+			})
+			return providers{tp, mp}
+		}
+	}
+
+	var baseline float64
+	for _, bc := range []struct {
+		name      string
+		providers func(b *testing.B) providers
+	}{
+		{name: "uninstrumented"},
+		{name: "disabled", providers: func(*testing.B) providers {
+			return providers{tracenoop.NewTracerProvider(), metricnoop.NewMeterProvider()}
+		}},
+		{name: "ratio=0", providers: sdk(0)},
+		{name: "ratio=0.1", providers: sdk(0.1)},
+		{name: "ratio=1", providers: sdk(1)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var h http.Handler
+			if bc.providers == nil {
+				h = orderLikeHandler(metricnoop.NewMeterProvider())
+			} else {
+				p := bc.providers(b)
+				h = otelhttp.NewHandler(orderLikeHandler(p.mp), "POST /createOrder",
+					otelhttp.WithTracerProvider(p.tp),
+					otelhttp.WithMeterProvider(p.mp),
+					otelhttp.WithPropagators(propagation.TraceContext{}),
+				)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/createOrder", nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				h.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			b.StopTimer()
+
+			perRequest := float64(b.Elapsed().Nanoseconds()) / float64(b.N)
+			if bc.providers == nil {
+				baseline = perRequest
+			} else if baseline > 0 {
+				b.ReportMetric(perRequest-baseline, "overhead-ns/req")
+			}
+		})
+	}
+}
+
+// orderLikeHandler returns a handler that records what an order request
+// records, through the tracer of the request span and meters of mp.
+func orderLikeHandler(mp metric.MeterProvider) http.Handler {
+	meter := mp.Meter("bench")
+	orders, _ := meter.Int64Counter("orders_processed_total")
+	duration, _ := meter.Float64Histogram("payment_duration_ms")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer("bench")
+		for i, step := range []string{"inventory.check", "db.insert_order", "payment.process"} {
+			_, span := tracer.Start(ctx, step, trace.WithAttributes(
+				attribute.String("customer.id", "cust-042"),
+				attribute.Int("order.step", i),
+			))
+			span.AddEvent("step.done", trace.WithAttributes(attribute.String("step", strconv.Itoa(i))))
+			span.End()
+		}
+		status := attribute.String("status", "success")
+		orders.Add(ctx, 1, metric.WithAttributes(status))
+		duration.Record(ctx, 12.5, metric.WithAttributes(status))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","order_id":1}`))
+	})
+}
+
+// discardExporter drops exported spans.
+type discardExporter struct{}
+
+func (discardExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error { return nil }
+func (discardExporter) Shutdown(context.Context) error                             { return nil }
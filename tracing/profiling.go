@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ProfileIDAttribute is set on request spans, while profiles are pushed, to
+// the span ID that labels the request's profile samples (span_id), so the
+// backend can link a trace to its profile.
+const ProfileIDAttribute = attribute.Key("pyroscope.profile.id")
+
+// profiling is set while profiles are pushed.
+var profiling atomic.Bool
+
+// ProfilingEnabled reports whether continuous profiles are being pushed.
+func ProfilingEnabled() bool {
+	return profiling.Load()
+}
+
+// profiler pushes a CPU and a goroutine profile per interval to a Pyroscope
+// server's /ingest API. Samples keep the request goroutines' pprof labels, so
+// they can be filtered by route and stage, and looked up by span.
+type profiler struct {
+	ingest   string
+	name     string
+	interval time.Duration
+	client   *http.Client
+	uploads  metric.Int64Counter
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startProfiler starts pushing profiles to endpoint, named after the service
+// and tagged with the other resource attributes, and returns a function that
+// pushes the profile in progress and stops.
+func startProfiler(endpoint string, interval time.Duration, res *resource.Resource) func(context.Context) {
+	uploads, err := otel.Meter(instrumentationName).Int64Counter(
+		"profiling_uploads_total",
+		metric.WithDescription("The total number of profiles pushed to the profiling backend, by profile type and outcome"),
+		metric.WithUnit("{profile}"),
+	)
+	if err != nil {
+		log.Fatalf("failed to create profiling_uploads_total counter: %v", err)
+	}
+	p := &profiler{
+		ingest:   strings.TrimSuffix(endpoint, "/") + "/ingest",
+		name:     profileName(res),
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		uploads:  uploads,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	profiling.Store(true)
+	go p.run()
+	return func(ctx context.Context) {
+		profiling.Store(false)
+		close(p.stop)
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (p *profiler) run() {
+	defer close(p.done)
+	busy := false
+	for {
+		var cpu bytes.Buffer
+		from := time.Now()
+		// Only one CPU profile can run at a time; while /debug/pprof/profile
+		// holds it, the interval is pushed without one.
+		err := pprof.StartCPUProfile(&cpu)
+		if err != nil && !busy {
+			log.Printf("[WARN] continuous CPU profiling paused: %v", err)
+		}
+		busy = err != nil
+
+		stopped := false
+		select {
+		case <-time.After(p.interval):
+		case <-p.stop:
+			stopped = true
+		}
+		if !busy {
+			pprof.StopCPUProfile()
+			p.push("cpu", from, time.Now(), 100, cpu.Bytes())
+		}
+		var goroutines bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 0); err == nil {
+			p.push("goroutines", from, time.Now(), 0, goroutines.Bytes())
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+// push uploads one pprof-encoded profile covering from to until. sampleRate is
+// the CPU profiler's rate in Hz, or 0 for other profiles.
+func (p *profiler) push(kind string, from, until time.Time, sampleRate int, data []byte) {
+	outcome := "ok"
+	if err := p.upload(from, until, sampleRate, data); err != nil {
+		outcome = "error"
+		log.Printf("failed to push %s profile: %v", kind, err)
+	}
+	p.uploads.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("profile.type", kind),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func (p *profiler) upload(from, until time.Time, sampleRate int, data []byte) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("profile", "profile.pprof")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	q.Set("name", p.name)
+	q.Set("from", strconv.FormatInt(from.Unix(), 10))
+	q.Set("until", strconv.FormatInt(until.Unix(), 10))
+	q.Set("format", "pprof")
+	q.Set("spyName", "gospy")
+	if sampleRate > 0 {
+		q.Set("sampleRate", strconv.Itoa(sampleRate))
+	}
+	req, err := http.NewRequest(http.MethodPost, p.ingest+"?"+q.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// profileName returns the application name Pyroscope expects, the service
+// name followed by the other resource attributes as tags:
+// "svc{deployment_environment=prod,service_version=1.2.0}". Tag names may only
+// hold letters, digits, and underscores, and values none of "{},=".
+func profileName(res *resource.Resource) string {
+	service := "unknown_service"
+	var tags []string
+	for _, kv := range res.Attributes() {
+		if kv.Key == semconv.ServiceNameKey {
+			service = kv.Value.Emit()
+			continue
+		}
+		value := strings.Map(func(r rune) rune {
+			if strings.ContainsRune("{},=", r) {
+				return '_'
+			}
+			return r
+		}, kv.Value.Emit())
+		tags = append(tags, tagName(string(kv.Key))+"="+value)
+	}
+	return service + "{" + strings.Join(tags, ",") + "}"
+}
+
+func tagName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
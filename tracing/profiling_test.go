@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+func TestProfiler(t *testing.T) {
+	type upload struct {
+		query   map[string]string
+		profile int
+	}
+	uploads := make(chan upload, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ingest" {
+			t.Errorf("pushed to %s, want /ingest", r.URL.Path)
+		}
+		f, _, err := r.FormFile("profile")
+		if err != nil {
+			t.Errorf("no profile part: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		q := map[string]string{}
+		for k := range r.URL.Query() {
+			q[k] = r.URL.Query().Get(k)
+		}
+		uploads <- upload{query: q, profile: len(data)}
+	}))
+	defer srv.Close()
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName("orders"),
+		attribute.String("deployment.environment", "test"),
+		attribute.String("build.commit", "a,b=c"),
+	)
+	stop := startProfiler(srv.URL+"/", 100*time.Millisecond, res)
+	if !ProfilingEnabled() {
+		t.Error("ProfilingEnabled() = false while pushing")
+	}
+
+	seen := map[string]bool{}
+	for !seen["cpu"] || !seen["goroutines"] {
+		select {
+		case u := <-uploads:
+			kind := "goroutines"
+			if u.query["sampleRate"] == "100" {
+				kind = "cpu"
+			}
+			seen[kind] = true
+			if want := "orders{build_commit=a_b_c,deployment_environment=test}"; u.query["name"] != want {
+				t.Errorf("name = %q, want %q", u.query["name"], want)
+			}
+			if u.query["format"] != "pprof" || u.query["from"] == "" || u.query["until"] == "" || u.profile == 0 {
+				t.Errorf("upload %v with a %d-byte profile, want a pprof profile with its time range", u.query, u.profile)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("pushed %v, want a cpu and a goroutine profile", seen)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stop(ctx)
+	if ProfilingEnabled() {
+		t.Error("ProfilingEnabled() = true after stopping")
+	}
+}
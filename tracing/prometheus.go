@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// promReader is a pull reader registered on the MeterProvider alongside the
+// OTLP periodic reader, so metrics can be scraped without a collector,
+// inspected at /debug/metrics, and read by Collect.
+var promReader = sdkmetric.NewManualReader()
+
+// Collect gathers the current values of every instrument into rm, for
+// in-process consumers such as the SLO burn rates.
+func Collect(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return promReader.Collect(ctx, rm)
+}
+
+// MetricsHandler serves the current metrics in the Prometheus text exposition
+// format. Counters, gauges, and explicit-bucket histograms are exported;
+// attributes become labels.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rm metricdata.ResourceMetrics
+		if err := promReader.Collect(r.Context(), &rm); err != nil {
+			http.Error(w, "collecting metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		writeTargetInfo(bw, rm)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				writeMetric(bw, m)
+			}
+		}
+		_ = bw.Flush()
+	})
+}
+
+// writeTargetInfo exports the resource attributes as the target_info metric.
+func writeTargetInfo(w *bufio.Writer, rm metricdata.ResourceMetrics) {
+	if rm.Resource == nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP target_info Target metadata")
+	fmt.Fprintln(w, "# TYPE target_info gauge")
+	fmt.Fprintf(w, "target_info%s 1\n", promLabels(rm.Resource.Set().ToSlice()))
+}
+
+// writeMetric writes one metric family, skipping unsupported aggregations.
+func writeMetric(w *bufio.Writer, m metricdata.Metrics) {
+	name := promName(m.Name)
+	switch data := m.Data.(type) {
+	case metricdata.Sum[int64]:
+		name = writeSumHeader(w, name, m.Description, data.IsMonotonic)
+		for _, dp := range data.DataPoints {
+			fmt.Fprintf(w, "%s%s %d\n", name, promLabels(dp.Attributes.ToSlice()), dp.Value)
+		}
+	case metricdata.Sum[float64]:
+		name = writeSumHeader(w, name, m.Description, data.IsMonotonic)
+		for _, dp := range data.DataPoints {
+			fmt.Fprintf(w, "%s%s %s\n", name, promLabels(dp.Attributes.ToSlice()), promFloat(dp.Value))
+		}
+	case metricdata.Gauge[int64]:
+		writeHeader(w, name, m.Description, "gauge")
+		for _, dp := range data.DataPoints {
+			fmt.Fprintf(w, "%s%s %d\n", name, promLabels(dp.Attributes.ToSlice()), dp.Value)
+		}
+	case metricdata.Gauge[float64]:
+		writeHeader(w, name, m.Description, "gauge")
+		for _, dp := range data.DataPoints {
+			fmt.Fprintf(w, "%s%s %s\n", name, promLabels(dp.Attributes.ToSlice()), promFloat(dp.Value))
+		}
+	case metricdata.Histogram[int64]:
+		writeHeader(w, name, m.Description, "histogram")
+		for _, dp := range data.DataPoints {
+			writeHistogram(w, name, dp.Attributes.ToSlice(), dp.Bounds, dp.BucketCounts, float64(dp.Sum), dp.Count)
+		}
+	case metricdata.Histogram[float64]:
+		writeHeader(w, name, m.Description, "histogram")
+		for _, dp := range data.DataPoints {
+			writeHistogram(w, name, dp.Attributes.ToSlice(), dp.Bounds, dp.BucketCounts, dp.Sum, dp.Count)
+		}
+	}
+}
+
+// writeSumHeader writes the header for a sum, which is a counter when
+// monotonic and a gauge otherwise, and returns the exported name.
+func writeSumHeader(w *bufio.Writer, name, help string, monotonic bool) string {
+	if !monotonic {
+		writeHeader(w, name, help, "gauge")
+		return name
+	}
+	if !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	writeHeader(w, name, help, "counter")
+	return name
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	if help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// writeHistogram writes cumulative _bucket series plus _sum and _count.
+func writeHistogram(w *bufio.Writer, name string, attrs []attribute.KeyValue, bounds []float64, counts []uint64, sum float64, count uint64) {
+	var cumulative uint64
+	for i, bound := range bounds {
+		cumulative += counts[i]
+		le := attribute.String("le", promFloat(bound))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, promLabels(append(attrs[:len(attrs):len(attrs)], le)), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, promLabels(append(attrs[:len(attrs):len(attrs)], attribute.String("le", "+Inf"))), count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, promLabels(attrs), promFloat(sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, promLabels(attrs), count)
+}
+
+// promLabels formats attributes as a sorted Prometheus label set.
+func promLabels(attrs []attribute.KeyValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(attrs))
+	for _, kv := range attrs {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv.Value.Emit())
+		pairs = append(pairs, promName(string(kv.Key))+`="`+value+`"`)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// promName replaces characters Prometheus does not allow in names with '_'.
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func promFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,339 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultRecentTraces is the number of traces listed by /debug/traces unless
+// the limit parameter is set.
+const defaultRecentTraces = 50
+
+// recent keeps the last finished spans for the /debug/traces viewer.
+var recent = &ringProcessor{}
+
+// ringProcessor is a span processor that keeps the last finished spans in a
+// ring buffer.
+type ringProcessor struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+	next  int
+	full  bool
+}
+
+// reset empties the buffer and sizes it for n spans.
+func (p *ringProcessor) reset(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spans, p.next, p.full = make([]sdktrace.ReadOnlySpan, n), 0, false
+}
+
+func (p *ringProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *ringProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.spans) == 0 {
+		return
+	}
+	p.spans[p.next] = s
+	p.next = (p.next + 1) % len(p.spans)
+	if p.next == 0 {
+		p.full = true
+	}
+}
+
+func (p *ringProcessor) Shutdown(context.Context) error   { return nil }
+func (p *ringProcessor) ForceFlush(context.Context) error { return nil }
+
+// snapshot returns the buffered spans, oldest first.
+func (p *ringProcessor) snapshot() []sdktrace.ReadOnlySpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.full {
+		return append([]sdktrace.ReadOnlySpan(nil), p.spans[:p.next]...)
+	}
+	return append(append([]sdktrace.ReadOnlySpan(nil), p.spans[p.next:]...), p.spans[:p.next]...)
+}
+
+// TraceSummary describes a buffered trace.
+type TraceSummary struct {
+	TraceID string `json:"trace_id"`
+	// Root is the name of the root span, or of the earliest buffered span
+	// when the root has not finished or was evicted.
+	Root       string    `json:"root"`
+	Start      time.Time `json:"start"`
+	DurationMS float64   `json:"duration_ms"`
+	Spans      int       `json:"spans"`
+	Errors     int       `json:"errors"`
+}
+
+// SpanView is a buffered span. Depth is its nesting under the trace's root.
+type SpanView struct {
+	SpanID            string            `json:"span_id"`
+	ParentID          string            `json:"parent_id,omitempty"`
+	Name              string            `json:"name"`
+	Kind              string            `json:"kind"`
+	Scope             string            `json:"scope"`
+	Start             time.Time         `json:"start"`
+	OffsetMS          float64           `json:"offset_ms"`
+	DurationMS        float64           `json:"duration_ms"`
+	Status            string            `json:"status"`
+	StatusDescription string            `json:"status_description,omitempty"`
+	Attributes        map[string]string `json:"attributes,omitempty"`
+	Events            []string          `json:"events,omitempty"`
+	Depth             int               `json:"depth"`
+}
+
+// TracesHandler serves the recent-traces viewer: GET /debug/traces lists the
+// latest buffered traces, newest first, and GET /debug/traces/{id} shows one
+// trace's spans as a tree. Both answer JSON when the request accepts
+// application/json or has format=json, and HTML otherwise. Only sampled spans
+// are buffered, and only when telemetry.recent_spans is positive.
+func TracesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asJSON := r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+		spans := recent.snapshot()
+
+		if id := r.PathValue("id"); id != "" {
+			traceID, err := trace.TraceIDFromHex(id)
+			if err != nil {
+				http.Error(w, "invalid trace ID", http.StatusBadRequest)
+				return
+			}
+			views := traceTree(spans, traceID)
+			if len(views) == 0 {
+				http.Error(w, "trace not found; it may have been evicted", http.StatusNotFound)
+				return
+			}
+			if asJSON {
+				writeJSON(w, views)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = traceTemplate.Execute(w, struct {
+				TraceID string
+				Spans   []SpanView
+				Total   float64
+			}{id, views, traceDuration(views)})
+			return
+		}
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = defaultRecentTraces
+		}
+		summaries := summarize(spans)
+		if len(summaries) > limit {
+			summaries = summaries[:limit]
+		}
+		if asJSON {
+			writeJSON(w, summaries)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = listTemplate.Execute(w, struct {
+			Traces   []TraceSummary
+			Buffered int
+		}{summaries, len(spans)})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// summarize groups spans by trace, most recently finished first.
+func summarize(spans []sdktrace.ReadOnlySpan) []TraceSummary {
+	type acc struct {
+		TraceSummary
+		end  time.Time
+		root string
+	}
+	byTrace := make(map[trace.TraceID]*acc)
+	for _, s := range spans {
+		id := s.SpanContext().TraceID()
+		t, ok := byTrace[id]
+		if !ok {
+			t = &acc{TraceSummary: TraceSummary{TraceID: id.String(), Root: s.Name(), Start: s.StartTime()}}
+			byTrace[id] = t
+		}
+		t.Spans++
+		if s.Status().Code == codes.Error {
+			t.Errors++
+		}
+		// A span continued from another service's trace is this service's root.
+		if !s.Parent().IsValid() || s.Parent().IsRemote() {
+			t.root = s.Name()
+		}
+		if s.StartTime().Before(t.Start) {
+			t.Start, t.Root = s.StartTime(), s.Name()
+		}
+		if s.EndTime().After(t.end) {
+			t.end = s.EndTime()
+		}
+	}
+	accs := make([]*acc, 0, len(byTrace))
+	for _, t := range byTrace {
+		if t.root != "" {
+			t.Root = t.root
+		}
+		t.DurationMS = ms(t.end.Sub(t.Start))
+		accs = append(accs, t)
+	}
+	sort.Slice(accs, func(i, j int) bool { return accs[i].end.After(accs[j].end) })
+	summaries := make([]TraceSummary, len(accs))
+	for i, t := range accs {
+		summaries[i] = t.TraceSummary
+	}
+	return summaries
+}
+
+// traceTree returns the buffered spans of a trace in depth-first order, each
+// parent before its children and siblings in start order. Spans whose parent
+// is not buffered are listed as roots.
+func traceTree(spans []sdktrace.ReadOnlySpan, traceID trace.TraceID) []SpanView {
+	var inTrace []sdktrace.ReadOnlySpan
+	present := make(map[trace.SpanID]bool)
+	for _, s := range spans {
+		if s.SpanContext().TraceID() == traceID {
+			inTrace = append(inTrace, s)
+			present[s.SpanContext().SpanID()] = true
+		}
+	}
+	if len(inTrace) == 0 {
+		return nil
+	}
+	sort.SliceStable(inTrace, func(i, j int) bool { return inTrace[i].StartTime().Before(inTrace[j].StartTime()) })
+	start := inTrace[0].StartTime()
+	children := make(map[trace.SpanID][]sdktrace.ReadOnlySpan)
+	var roots []sdktrace.ReadOnlySpan
+	for _, s := range inTrace {
+		if parent := s.Parent().SpanID(); s.Parent().IsValid() && present[parent] {
+			children[parent] = append(children[parent], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+	var views []SpanView
+	var walk func(s sdktrace.ReadOnlySpan, depth int)
+	walk = func(s sdktrace.ReadOnlySpan, depth int) {
+		views = append(views, spanView(s, start, depth))
+		for _, c := range children[s.SpanContext().SpanID()] {
+			walk(c, depth+1)
+		}
+	}
+	for _, s := range roots {
+		walk(s, 0)
+	}
+	return views
+}
+
+func spanView(s sdktrace.ReadOnlySpan, traceStart time.Time, depth int) SpanView {
+	v := SpanView{
+		SpanID:            s.SpanContext().SpanID().String(),
+		Name:              s.Name(),
+		Kind:              s.SpanKind().String(),
+		Scope:             s.InstrumentationScope().Name,
+		Start:             s.StartTime(),
+		OffsetMS:          ms(s.StartTime().Sub(traceStart)),
+		DurationMS:        ms(s.EndTime().Sub(s.StartTime())),
+		Status:            s.Status().Code.String(),
+		StatusDescription: s.Status().Description,
+		Depth:             depth,
+	}
+	if s.Parent().IsValid() {
+		v.ParentID = s.Parent().SpanID().String()
+	}
+	if attrs := s.Attributes(); len(attrs) > 0 {
+		v.Attributes = make(map[string]string, len(attrs))
+		for _, kv := range attrs {
+			v.Attributes[string(kv.Key)] = kv.Value.Emit()
+		}
+	}
+	for _, e := range s.Events() {
+		v.Events = append(v.Events, e.Name)
+	}
+	return v
+}
+
+// traceDuration returns the time from the first span's start to the last
+// span's end, in milliseconds.
+func traceDuration(views []SpanView) float64 {
+	var total float64
+	for _, v := range views {
+		total = max(total, v.OffsetMS+v.DurationMS)
+	}
+	return total
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+var templateFuncs = template.FuncMap{
+	// pct is the share of total, as a CSS percentage.
+	"pct": func(v, total float64) string {
+		if total <= 0 {
+			return "0%"
+		}
+		return strconv.FormatFloat(100*v/total, 'f', 2, 64) + "%"
+	},
+	"indent": func(depth int) string { return strconv.Itoa(depth*16) + "px" },
+}
+
+const pageStyle = `<style>
+body { font: 14px sans-serif; margin: 1.5em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; vertical-align: top; }
+.error { color: #b00020; }
+.bar { position: relative; height: 12px; background: #eee; min-width: 300px; }
+.bar span { position: absolute; height: 12px; background: #4a7bd0; min-width: 1px; }
+.bar span.error { background: #b00020; }
+details summary { cursor: pointer; }
+code { font-size: 12px; }
+</style>`
+
+var listTemplate = template.Must(template.New("list").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html><head><title>Recent traces</title>` + pageStyle + `</head><body>
+<h1>Recent traces</h1>
+<p>{{.Buffered}} spans buffered. Newest first; <a href="?format=json">JSON</a>.</p>
+<table>
+<tr><th>Root span</th><th>Trace ID</th><th>Start</th><th>Duration (ms)</th><th>Spans</th><th>Errors</th></tr>
+{{range .Traces}}<tr{{if .Errors}} class="error"{{end}}>
+<td><a href="/debug/traces/{{.TraceID}}">{{.Root}}</a></td><td><code>{{.TraceID}}</code></td>
+<td>{{.Start.Format "15:04:05.000"}}</td><td>{{printf "%.2f" .DurationMS}}</td><td>{{.Spans}}</td><td>{{.Errors}}</td>
+</tr>{{else}}<tr><td colspan="6">No traces buffered yet.</td></tr>{{end}}
+</table>
+</body></html>`))
+
+var traceTemplate = template.Must(template.New("trace").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html><head><title>Trace {{.TraceID}}</title>` + pageStyle + `</head><body>
+<p><a href="/debug/traces">&larr; Recent traces</a></p>
+<h1>Trace <code>{{.TraceID}}</code></h1>
+<p>{{len .Spans}} spans, {{printf "%.2f" .Total}} ms; <a href="?format=json">JSON</a>.</p>
+<table>
+<tr><th>Span</th><th>Duration (ms)</th><th>Timeline</th></tr>
+{{$total := .Total}}{{range .Spans}}<tr{{if eq .Status "Error"}} class="error"{{end}}>
+<td style="padding-left: {{indent .Depth}}"><details><summary>{{.Name}}</summary>
+<div>{{.Kind}} &middot; {{.Scope}} &middot; {{.Status}}{{with .StatusDescription}}: {{.}}{{end}}</div>
+{{range $k, $v := .Attributes}}<div><code>{{$k}}</code> = {{$v}}</div>{{end}}
+{{with .Events}}<div>Events: {{range $i, $e := .}}{{if $i}}, {{end}}{{$e}}{{end}}</div>{{end}}
+</details></td>
+<td>{{printf "%.2f" .DurationMS}}</td>
+<td><div class="bar"><span{{if eq .Status "Error"}} class="error"{{end}} style="left: {{pct .OffsetMS $total}}; width: {{pct .DurationMS $total}}"></span></div></td>
+</tr>{{end}}
+</table>
+</body></html>`))
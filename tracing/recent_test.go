@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestRecentSpans(t *testing.T) {
+	ring := &ringProcessor{}
+	ring.reset(4)
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(ring)).Tracer("test")
+
+	// An older trace, mostly evicted by the next one.
+	_, old := tracer.Start(context.Background(), "old")
+	old.End()
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, first := tracer.Start(ctx, "first")
+	childCtx, second := tracer.Start(ctx, "second")
+	_, nested := tracer.Start(childCtx, "nested")
+	nested.End()
+	second.End()
+	first.End()
+	root.End()
+
+	spans := ring.snapshot()
+	if len(spans) != 4 {
+		t.Fatalf("buffered %d spans, want 4", len(spans))
+	}
+	summaries := summarize(spans)
+	if len(summaries) != 1 || summaries[0].Root != "root" || summaries[0].Spans != 4 {
+		t.Fatalf("summaries = %+v, want one 4-span trace rooted at root", summaries)
+	}
+
+	var got []string
+	for _, v := range traceTree(spans, root.SpanContext().TraceID()) {
+		got = append(got, fmt.Sprintf("%s:%d", v.Name, v.Depth))
+	}
+	if want := []string{"root:0", "first:1", "second:1", "nested:2"}; !slices.Equal(got, want) {
+		t.Errorf("tree = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	rtrace "runtime/trace"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// runtimeTasks is set when spans are mirrored as runtime/trace tasks.
+var runtimeTasks atomic.Bool
+
+// SetRuntimeTraceTasks turns the mirroring of spans as runtime/trace tasks on
+// or off. While a runtime trace is captured, such as from /debug/pprof/trace,
+// the SDK already opens a task named after each recording span; with the
+// mirroring on, each span also opens a subtask of it named after its trace ID,
+// with the span ID logged in it. In go tool trace, the tasks of a distributed
+// trace can then be found by its ID, with the goroutines, blocking, and GC
+// that served it. Outside a capture, spans pay only for the check.
+func SetRuntimeTraceTasks(on bool) {
+	runtimeTasks.Store(on)
+}
+
+// startTask opens the runtime/trace task of span, started in ctx, and returns
+// the context carrying it and a span that ends the task with itself.
+func startTask(ctx context.Context, span trace.Span) (context.Context, trace.Span) {
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return ctx, span
+	}
+	ctx, task := rtrace.NewTask(ctx, sc.TraceID().String())
+	rtrace.Log(ctx, "otel.span_id", sc.SpanID().String())
+	s := taskSpan{Span: span, task: task}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// taskSpan is a span mirrored as a runtime/trace task.
+type taskSpan struct {
+	trace.Span
+	task *rtrace.Task
+}
+
+func (s taskSpan) End(opts ...trace.SpanEndOption) {
+	s.Span.End(opts...)
+	s.task.End()
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	rtrace "runtime/trace"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRuntimeTraceTasks(t *testing.T) {
+	tracer := switchTracerProvider{tp: sdktrace.NewTracerProvider()}.Tracer("test")
+	SetRuntimeTraceTasks(true)
+	defer SetRuntimeTraceTasks(false)
+
+	// Outside a capture, spans are not wrapped.
+	_, idle := tracer.Start(context.Background(), "idle")
+	if _, ok := idle.(taskSpan); ok {
+		t.Error("span mirrored as a task with no runtime trace running")
+	}
+	idle.End()
+
+	var buf bytes.Buffer
+	if err := rtrace.Start(&buf); err != nil {
+		t.Skipf("runtime trace unavailable: %v", err)
+	}
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	if _, ok := trace.SpanFromContext(ctx).(taskSpan); !ok {
+		t.Error("root span in the context is not mirrored as a task")
+	}
+	if child.SpanContext().TraceID() != root.SpanContext().TraceID() {
+		t.Error("child span is not in the root span's trace")
+	}
+	child.End()
+	root.End()
+	rtrace.Stop()
+
+	for _, want := range []string{root.SpanContext().TraceID().String(), child.SpanContext().SpanID().String()} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("runtime trace does not mention %q", want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"sync/atomic"
+
+	"app/sampling"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ratioSampler samples new traces at a ratio that can be changed while the
+// service runs, and records the ratio in the trace state (see the sampling
+// package). It is wrapped in a ParentBased sampler, so it only decides for
+// root spans.
+type ratioSampler struct {
+	current atomic.Pointer[ratioSetting]
+}
+
+// ratioSetting is a ratio and its sampler, swapped together.
+type ratioSetting struct {
+	ratio   float64
+	sampler sdktrace.Sampler
+}
+
+// rootSampler is the ratio sampler installed by InitTracer.
+var rootSampler = newRatioSampler(1)
+
+func newRatioSampler(ratio float64) *ratioSampler {
+	s := &ratioSampler{}
+	s.set(ratio)
+	return s
+}
+
+func (s *ratioSampler) set(ratio float64) {
+	s.current.Store(&ratioSetting{ratio: ratio, sampler: sdktrace.TraceIDRatioBased(ratio)})
+}
+
+func (s *ratioSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	current := s.current.Load()
+	res := current.sampler.ShouldSample(p)
+	res.Tracestate = sampling.WithRatio(res.Tracestate, current.ratio)
+	return res
+}
+
+func (s *ratioSampler) Description() string {
+	return s.current.Load().sampler.Description()
+}
+
+// SetSampleRatio changes the fraction (0-1) of new traces sampled. Traces
+// already started keep their decision.
+func SetSampleRatio(ratio float64) {
+	rootSampler.set(ratio)
+}
+
+// SampleRatio returns the fraction of new traces sampled.
+func SampleRatio() float64 {
+	return rootSampler.current.Load().ratio
+}
+
+// samplingProcessor annotates spans as they start with how they were sampled,
+// so span counts in a backend can be reconciled with the service's metrics:
+// sampling.sampler is TraceIDRatioBased on the root span of a trace sampled
+// here and ParentBased on spans that followed their parent's decision, and
+// sampling.ratio and sampling.adjusted_count (1/ratio, the number of traces
+// each sampled one stands for) are set when the trace state records the
+// ratio the trace was sampled at.
+type samplingProcessor struct{}
+
+func (samplingProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	ratio, ok := sampling.Ratio(s.SpanContext().TraceState())
+	if s.Parent().IsValid() {
+		s.SetAttributes(attribute.String("sampling.sampler", "ParentBased"))
+	} else {
+		s.SetAttributes(attribute.String("sampling.sampler", "TraceIDRatioBased"))
+	}
+	if ok {
+		s.SetAttributes(attribute.Float64("sampling.ratio", ratio))
+		if ratio > 0 {
+			s.SetAttributes(attribute.Float64("sampling.adjusted_count", 1/ratio))
+		}
+	}
+}
+
+func (samplingProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (samplingProcessor) Shutdown(context.Context) error   { return nil }
+func (samplingProcessor) ForceFlush(context.Context) error { return nil }
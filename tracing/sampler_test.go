@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"app/sampling"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSamplingAnnotations(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(newRatioSampler(1))),
+		sdktrace.WithSpanProcessor(samplingProcessor{}),
+		sdktrace.WithSpanProcessor(spans),
+	)
+	tracer := tp.Tracer("test")
+	remote := func(ts trace.TraceState) context.Context {
+		return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: trace.FlagsSampled,
+			TraceState: ts,
+			Remote:     true,
+		}))
+	}
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	root.End()
+	if ratio, ok := sampling.Ratio(root.SpanContext().TraceState()); !ok || ratio != 1 {
+		t.Errorf("root trace state %q, want the ratio 1", root.SpanContext().TraceState())
+	}
+	_, upstream := tracer.Start(remote(sampling.WithRatio(trace.TraceState{}, 0.25)), "sampled upstream")
+	upstream.End()
+	_, unknown := tracer.Start(remote(trace.TraceState{}), "unknown upstream")
+	unknown.End()
+
+	want := map[string][]attribute.KeyValue{
+		"root": {
+			attribute.String("sampling.sampler", "TraceIDRatioBased"),
+			attribute.Float64("sampling.ratio", 1),
+			attribute.Float64("sampling.adjusted_count", 1),
+		},
+		"child": {
+			attribute.String("sampling.sampler", "ParentBased"),
+			attribute.Float64("sampling.ratio", 1),
+			attribute.Float64("sampling.adjusted_count", 1),
+		},
+		"sampled upstream": {
+			attribute.String("sampling.sampler", "ParentBased"),
+			attribute.Float64("sampling.ratio", 0.25),
+			attribute.Float64("sampling.adjusted_count", 4),
+		},
+		"unknown upstream": {
+			attribute.String("sampling.sampler", "ParentBased"),
+		},
+	}
+	for _, s := range spans.Ended() {
+		got := s.Attributes()
+		if len(got) != len(want[s.Name()]) {
+			t.Errorf("%s attributes = %v, want %v", s.Name(), got, want[s.Name()])
+			continue
+		}
+		for i, kv := range want[s.Name()] {
+			if got[i] != kv {
+				t.Errorf("%s attributes = %v, want %v", s.Name(), got, want[s.Name()])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type routeTagsKey struct{}
+
+// ContextWithRouteTags returns a copy of ctx carrying a route's static tags.
+// Spans started from the returned context get the tags as attributes.
+func ContextWithRouteTags(ctx context.Context, tags []attribute.KeyValue) context.Context {
+	return context.WithValue(ctx, routeTagsKey{}, tags)
+}
+
+// RouteTags returns the route tags carried by ctx.
+func RouteTags(ctx context.Context) []attribute.KeyValue {
+	tags, _ := ctx.Value(routeTagsKey{}).([]attribute.KeyValue)
+	return tags
+}
+
+// routeTagsProcessor copies the route tags from a span's parent context onto
+// the span as it starts, so every span of a tagged route carries them.
+type routeTagsProcessor struct{}
+
+func (routeTagsProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	if tags := RouteTags(parent); len(tags) > 0 {
+		s.SetAttributes(tags...)
+	}
+}
+
+func (routeTagsProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (routeTagsProcessor) Shutdown(context.Context) error   { return nil }
+func (routeTagsProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceResponseHeader is the W3C Trace Context Level 2 response header.
+const TraceResponseHeader = "traceresponse"
+
+// TraceResponse propagates span contexts on responses, in the draft W3C
+// traceresponse header: a server injects the context of the span that handled
+// the request, and a client extracts it from the response. A caller that
+// started a new trace, or whose context the server did not continue, can then
+// link its client span to the trace the server recorded.
+type TraceResponse struct{}
+
+var _ propagation.TextMapPropagator = TraceResponse{}
+
+type traceResponseKey struct{}
+
+// Inject sets the traceresponse header to the context of the span in ctx.
+func (TraceResponse) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	carrier.Set(TraceResponseHeader, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-"+sc.TraceFlags().String())
+}
+
+// Extract returns a copy of ctx holding the span context in the traceresponse
+// header, for TraceResponseFromContext. The span context in ctx is unchanged.
+func (TraceResponse) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, ok := parseTraceResponse(carrier.Get(TraceResponseHeader))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, traceResponseKey{}, sc)
+}
+
+// Fields returns the traceresponse header.
+func (TraceResponse) Fields() []string {
+	return []string{TraceResponseHeader}
+}
+
+// TraceResponseFromContext returns the span context extracted from a
+// response's traceresponse header.
+func TraceResponseFromContext(ctx context.Context) (trace.SpanContext, bool) {
+	sc, ok := ctx.Value(traceResponseKey{}).(trace.SpanContext)
+	return sc, ok
+}
+
+// parseTraceResponse parses a version-00 traceresponse value. Later versions
+// may append fields, which are ignored.
+func parseTraceResponse(v string) (trace.SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return trace.SpanContext{}, false
+	}
+	traceID, err := trace.TraceIDFromHex(parts[1])
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(parts[2])
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return trace.SpanContext{}, false
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.TraceFlags(flags[0]) & trace.FlagsSampled,
+		Remote:     true,
+	}), true
+}
+
+// traceResponses is set unless the configured propagators leave out
+// traceresponse.
+var traceResponses atomic.Bool
+
+func init() {
+	traceResponses.Store(true)
+}
+
+// ResponsePropagator returns the propagator of contexts on responses:
+// TraceResponse, or one that propagates nothing when traceresponse is not
+// among the configured propagators.
+func ResponsePropagator() propagation.TextMapPropagator {
+	if !traceResponses.Load() {
+		return propagation.NewCompositeTextMapPropagator()
+	}
+	return TraceResponse{}
+}
+
+// setPropagators installs the named propagators: the request formats as the
+// global propagator and traceresponse as the response propagator.
+func setPropagators(names []string) {
+	var request []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name {
+		case config.PropagatorTraceContext:
+			request = append(request, propagation.TraceContext{})
+		case config.PropagatorBaggage:
+			request = append(request, propagation.Baggage{})
+		default:
+			if slices.Contains(config.UnsupportedPropagators, name) {
+				log.Printf("[WARN] the %s propagator is not supported; skipping it", name)
+			}
+		}
+	}
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(request...))
+	traceResponses.Store(slices.Contains(names, config.PropagatorTraceResponse))
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"app/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceResponse(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	header := http.Header{}
+	TraceResponse{}.Inject(trace.ContextWithSpanContext(context.Background(), sc), propagation.HeaderCarrier(header))
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := header.Get(TraceResponseHeader); got != want {
+		t.Fatalf("traceresponse = %q, want %q", got, want)
+	}
+
+	ctx := TraceResponse{}.Extract(context.Background(), propagation.HeaderCarrier(header))
+	got, ok := TraceResponseFromContext(ctx)
+	if !ok {
+		t.Fatal("no span context extracted")
+	}
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() || !got.IsSampled() || !got.IsRemote() {
+		t.Errorf("extracted %+v, want the remote %+v", got, sc)
+	}
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("Extract set the span context of the context")
+	}
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-x1",
+	} {
+		if _, ok := parseTraceResponse(v); ok {
+			t.Errorf("parsed invalid traceresponse %q", v)
+		}
+	}
+	if _, ok := parseTraceResponse("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Error("rejected a later version with an extra field")
+	}
+}
+
+func TestSetPropagators(t *testing.T) {
+	defer setPropagators(config.Default().Telemetry.Propagators)
+
+	// Unsupported standard propagators are skipped.
+	setPropagators([]string{config.PropagatorTraceContext, "b3"})
+	if got := slices.Sorted(slices.Values(otel.GetTextMapPropagator().Fields())); !slices.Equal(got, []string{"traceparent", "tracestate"}) {
+		t.Errorf("request propagator fields = %v, want traceparent and tracestate", got)
+	}
+	if got := ResponsePropagator().Fields(); len(got) != 0 {
+		t.Errorf("response propagator fields = %v without traceresponse, want none", got)
+	}
+
+	setPropagators([]string{config.PropagatorTraceResponse})
+	if got := otel.GetTextMapPropagator().Fields(); len(got) != 0 {
+		t.Errorf("request propagator fields = %v, want none", got)
+	}
+	if got := ResponsePropagator().Fields(); len(got) != 1 || got[0] != TraceResponseHeader {
+		t.Errorf("response propagator fields = %v, want [%s]", got, TraceResponseHeader)
+	}
+}
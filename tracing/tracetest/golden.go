@@ -0,0 +1,225 @@
+package tracetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var update = flag.Bool("update", false, "rewrite golden span snapshots with the spans recorded")
+
+// volatileAttributes vary from run to run, so their values are masked in
+// snapshots; they are still recorded as present.
+var volatileAttributes = []string{
+	"client.address", "network.peer.address", "network.peer.port",
+	"server.address", "server.port", "url.full",
+	"net.host.name", "net.host.port", "net.peer.name", "net.peer.port",
+	"net.sock.peer.addr", "net.sock.peer.port", "http.url",
+	"user_agent.original", "http.user_agent",
+	"http.request_content_length", "http.response_content_length",
+	"http.read_bytes", "http.wrote_bytes",
+	"request.id", "exception.stacktrace",
+}
+
+// masked replaces the value of a volatile attribute.
+const masked = "<masked>"
+
+// SnapshotOption configures a span snapshot.
+type SnapshotOption func(*snapshotter)
+
+// Mask masks the values of attributes (on spans and their events) that vary
+// between runs, in addition to the network, size, and ID attributes masked by
+// default.
+func Mask(keys ...string) SnapshotOption {
+	return func(s *snapshotter) {
+		for _, k := range keys {
+			s.mask[k] = true
+		}
+	}
+}
+
+type snapshotter struct {
+	mask map[string]bool
+}
+
+// spanSnapshot holds the fields of a span that are stable between runs. IDs
+// and timestamps are left out; the parent is given by nesting, and children
+// are in the order they started.
+type spanSnapshot struct {
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"`
+	Scope      string          `json:"scope"`
+	Status     string          `json:"status"`
+	StatusDesc string          `json:"status_description,omitempty"`
+	Attributes map[string]any  `json:"attributes,omitempty"`
+	Events     []eventSnapshot `json:"events,omitempty"`
+	Children   []*spanSnapshot `json:"children,omitempty"`
+}
+
+type eventSnapshot struct {
+	Name       string         `json:"name"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Snapshot serializes the stable fields of spans as indented JSON: one tree
+// per root, where a root is a span whose parent is not among spans.
+func Snapshot(spans []sdktrace.ReadOnlySpan, opts ...SnapshotOption) []byte {
+	s := &snapshotter{mask: make(map[string]bool)}
+	Mask(volatileAttributes...)(s)
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	sorted := append([]sdktrace.ReadOnlySpan(nil), spans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if a, b := sorted[i].StartTime(), sorted[j].StartTime(); !a.Equal(b) {
+			return a.Before(b)
+		}
+		return sorted[i].Name() < sorted[j].Name()
+	})
+	nodes := make(map[trace.SpanID]*spanSnapshot, len(sorted))
+	for _, span := range sorted {
+		nodes[span.SpanContext().SpanID()] = s.span(span)
+	}
+	roots := []*spanSnapshot{}
+	for _, span := range sorted {
+		node := nodes[span.SpanContext().SpanID()]
+		if parent, ok := nodes[span.Parent().SpanID()]; ok && span.Parent().IsValid() {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(roots); err != nil {
+		// Attribute values are all marshalable.
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *snapshotter) span(span sdktrace.ReadOnlySpan) *spanSnapshot {
+	snap := &spanSnapshot{
+		Name:       span.Name(),
+		Kind:       span.SpanKind().String(),
+		Scope:      span.InstrumentationScope().Name,
+		Status:     span.Status().Code.String(),
+		StatusDesc: span.Status().Description,
+		Attributes: s.attributes(span.Attributes()),
+	}
+	for _, e := range span.Events() {
+		snap.Events = append(snap.Events, eventSnapshot{Name: e.Name, Attributes: s.attributes(e.Attributes)})
+	}
+	return snap
+}
+
+func (s *snapshotter) attributes(attrs []attribute.KeyValue) map[string]any {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(attrs))
+	for _, kv := range attrs {
+		if s.mask[string(kv.Key)] {
+			m[string(kv.Key)] = masked
+			continue
+		}
+		m[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return m
+}
+
+// AssertGolden compares a snapshot of spans with the golden file
+// testdata/<name>.golden.json, failing the test with a diff if they differ.
+// Run the test with -update to write the file from the spans instead.
+func AssertGolden(t testing.TB, name string, spans []sdktrace.ReadOnlySpan, opts ...SnapshotOption) {
+	t.Helper()
+	got := Snapshot(spans, opts...)
+	path := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden spans (run with -update to create them): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("spans differ from %s (-want +got; run with -update to accept):\n%s", path, diff(string(want), string(got)))
+	}
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// diff returns a line diff of want and got, with removed lines prefixed by
+// "-", added lines by "+", and unchanged lines near a change by a space.
+func diff(want, got string) string {
+	a, b := strings.Split(want, "\n"), strings.Split(got, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+
+	// Keep the changed lines and their context.
+	keep := make([]bool, len(lines))
+	for n, line := range lines {
+		if line[0] != ' ' {
+			for k := max(0, n-diffContext); k <= min(len(lines)-1, n+diffContext); k++ {
+				keep[k] = true
+			}
+		}
+	}
+	var out strings.Builder
+	for n, line := range lines {
+		switch {
+		case keep[n]:
+			fmt.Fprintln(&out, line)
+		case n > 0 && keep[n-1]:
+			fmt.Fprintln(&out, "  ...")
+		}
+	}
+	return out.String()
+}
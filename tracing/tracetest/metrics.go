@@ -0,0 +1,175 @@
+package tracetest
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Collect returns the current value of every metric instrument, read through
+// the manual reader set by Install or Attach.
+func Collect(t testing.TB) metricdata.ResourceMetrics {
+	t.Helper()
+	if reader == nil {
+		t.Fatal("tracetest: Collect called before Install or Attach")
+	}
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collecting metrics: %v", err)
+	}
+	return rm
+}
+
+// Counter returns the sum of the data points of the named integer counter
+// that have all of the given attributes, or 0 if it has not been recorded.
+func Counter(t testing.TB, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	return counter(Collect(t), name, attrs)
+}
+
+// HistogramCount returns the number of values recorded by the named float
+// histogram in data points that have all of the given attributes.
+func HistogramCount(t testing.TB, name string, attrs ...attribute.KeyValue) uint64 {
+	t.Helper()
+	return histogramBucket(Collect(t), name, math.Inf(1), attrs)
+}
+
+// Metrics holds the metric values collected at the start of the code under
+// test. Instruments are shared by the whole test binary, so its assertions are
+// on what was recorded since, not on the totals.
+type Metrics struct {
+	before metricdata.ResourceMetrics
+}
+
+// StartMetrics collects the current metric values, to compare with after the
+// code under test has run.
+func StartMetrics(t testing.TB) *Metrics {
+	t.Helper()
+	return &Metrics{before: Collect(t)}
+}
+
+// AssertCounter fails the test unless the named integer counter rose by want
+// since StartMetrics, summed over the data points that have all of the given
+// attributes.
+func (m *Metrics) AssertCounter(t testing.TB, name string, want int64, attrs ...attribute.KeyValue) {
+	t.Helper()
+	if got := counter(Collect(t), name, attrs) - counter(m.before, name, attrs); got != want {
+		t.Errorf("%s%s rose by %d, want %d", name, labels(attrs), got, want)
+	}
+}
+
+// AssertHistogramCount fails the test unless the named float histogram
+// recorded want values since StartMetrics in the data points that have all of
+// the given attributes.
+func (m *Metrics) AssertHistogramCount(t testing.TB, name string, want uint64, attrs ...attribute.KeyValue) {
+	t.Helper()
+	m.AssertHistogramBucket(t, name, math.Inf(1), want, attrs...)
+}
+
+// AssertHistogramBucket fails the test unless the named float histogram
+// recorded want values no greater than le since StartMetrics, in the data
+// points that have all of the given attributes. Like a Prometheus _bucket
+// series the count is cumulative, and le must be one of the histogram's
+// bucket boundaries or +Inf.
+func (m *Metrics) AssertHistogramBucket(t testing.TB, name string, le float64, want uint64, attrs ...attribute.KeyValue) {
+	t.Helper()
+	after := Collect(t)
+	if !math.IsInf(le, 1) && !hasBound(after, name, le) {
+		t.Fatalf("%s has no bucket boundary %g", name, le)
+	}
+	if got := histogramBucket(after, name, le, attrs) - histogramBucket(m.before, name, le, attrs); got != want {
+		t.Errorf("%s_bucket%s recorded %d values <= %g, want %d", name, labels(attrs), got, le, want)
+	}
+}
+
+func counter(rm metricdata.ResourceMetrics, name string, attrs []attribute.KeyValue) int64 {
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if m.Name != name || !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				if hasAll(dp.Attributes, attrs) {
+					total += dp.Value
+				}
+			}
+		}
+	}
+	return total
+}
+
+// histogramBucket returns the cumulative count of values no greater than le.
+func histogramBucket(rm metricdata.ResourceMetrics, name string, le float64, attrs []attribute.KeyValue) uint64 {
+	var total uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if m.Name != name || !ok {
+				continue
+			}
+			for _, dp := range hist.DataPoints {
+				if !hasAll(dp.Attributes, attrs) {
+					continue
+				}
+				if math.IsInf(le, 1) {
+					total += dp.Count
+					continue
+				}
+				// BucketCounts[i] counts values in (Bounds[i-1], Bounds[i]].
+				for i, bound := range dp.Bounds {
+					if bound > le {
+						break
+					}
+					total += dp.BucketCounts[i]
+				}
+			}
+		}
+	}
+	return total
+}
+
+// hasBound reports whether le is a bucket boundary of the named histogram.
+func hasBound(rm metricdata.ResourceMetrics, name string, le float64) bool {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if hist, ok := m.Data.(metricdata.Histogram[float64]); ok && m.Name == name {
+				for _, dp := range hist.DataPoints {
+					if slices.Contains(dp.Bounds, le) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func hasAll(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if v, ok := set.Value(kv.Key); !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// labels formats attributes as a Prometheus-style label set.
+func labels(attrs []attribute.KeyValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	s := "{"
+	for i, kv := range attrs {
+		if i > 0 {
+			s += ","
+		}
+		s += string(kv.Key) + "=" + kv.Value.Emit()
+	}
+	return s + "}"
+}
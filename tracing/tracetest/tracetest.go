@@ -0,0 +1,226 @@
+// Package tracetest records the telemetry the service emits in memory, for
+// tests that assert on it: spans by name, their attributes, status, and
+// parent, and the values of metric instruments.
+//
+// Tracers and instruments obtained from the global providers bind to the first
+// providers installed, and some are created when their packages are
+// initialized, so Install sets the providers once per test binary. Spans are
+// routed to the recorder of the test that is running; metrics are recorded
+// into one provider shared by the whole binary, so compare values before and
+// after the code under test.
+// Integration tests that boot the service with the "memory" exporter use
+// Attach instead, to read what the service's own providers exported.
+package tracetest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	installOnce sync.Once
+	installed   bool
+	reader      *sdkmetric.ManualReader
+	// current receives the spans of the running test.
+	current atomic.Pointer[tracetest.SpanRecorder]
+)
+
+// Recorder holds the spans ended since Install or Attach.
+type Recorder struct {
+	ended func() []sdktrace.ReadOnlySpan
+}
+
+// Install records the spans ended during the test. The first call sets the
+// global tracer and meter providers, which record every span, and the W3C
+// propagators. Tests that call Install must not run in parallel.
+func Install(t testing.TB) *Recorder {
+	t.Helper()
+	installOnce.Do(func() {
+		reader = sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(
+			sdktrace.WithSampler(sdktrace.AlwaysSample()),
+			sdktrace.WithSpanProcessor(forwarder{}),
+		))
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+		installed = true
+	})
+	if !installed {
+		t.Fatal("tracetest: Install called after Attach")
+	}
+	spans := tracetest.NewSpanRecorder()
+	current.Store(spans)
+	t.Cleanup(func() { current.CompareAndSwap(spans, nil) })
+	return &Recorder{ended: spans.Ended}
+}
+
+// forwarder passes spans to the current test's recorder.
+type forwarder struct{}
+
+func (forwarder) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if r := current.Load(); r != nil {
+		r.OnStart(ctx, s)
+	}
+}
+
+func (forwarder) OnEnd(s sdktrace.ReadOnlySpan) {
+	if r := current.Load(); r != nil {
+		r.OnEnd(s)
+	}
+}
+
+func (forwarder) Shutdown(context.Context) error   { return nil }
+func (forwarder) ForceFlush(context.Context) error { return nil }
+
+// Attach records from the providers already installed, such as those of
+// tracing.InitTracer with the "memory" exporter: spans exported by spans
+// after the call, and metrics collected by metrics. It cannot be mixed with
+// Install in one test binary.
+func Attach(t testing.TB, spans *tracetest.InMemoryExporter, metrics *sdkmetric.ManualReader) *Recorder {
+	t.Helper()
+	if spans == nil || metrics == nil {
+		t.Fatal("tracetest: Attach needs the memory exporter's span exporter and metric reader")
+	}
+	installOnce.Do(func() { reader = metrics })
+	if reader != metrics {
+		t.Fatal("tracetest: Attach called after Install")
+	}
+	spans.Reset()
+	return &Recorder{ended: func() []sdktrace.ReadOnlySpan { return spans.GetSpans().Snapshots() }}
+}
+
+// Ended returns the spans ended so far, in the order they ended.
+func (r *Recorder) Ended() []sdktrace.ReadOnlySpan {
+	return r.ended()
+}
+
+// Named returns the ended spans with the given name.
+func (r *Recorder) Named(name string) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, s := range r.ended() {
+		if s.Name() == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// Span returns the single ended span with the given name, failing the test if
+// there is none or more than one.
+func (r *Recorder) Span(t testing.TB, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	spans := r.Named(name)
+	if len(spans) != 1 {
+		t.Fatalf("got %d %q spans, want 1 (ended: %v)", len(spans), name, names(r.ended()))
+	}
+	return spans[0]
+}
+
+// Await waits up to five seconds for a span with the given name to end in the
+// trace, and returns it. Server spans end after the response is written, so a
+// client can see the response first.
+func (r *Recorder) Await(t testing.TB, traceID trace.TraceID, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, s := range r.Trace(traceID) {
+			if s.Name() == name {
+				return s
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %q span ended in trace %s (ended: %v)", name, traceID, names(r.Trace(traceID)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Trace returns the ended spans of the trace, in the order they ended.
+func (r *Recorder) Trace(traceID trace.TraceID) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, s := range r.ended() {
+		if s.SpanContext().TraceID() == traceID {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// NoSpan fails the test if a span with the given name has ended.
+func (r *Recorder) NoSpan(t testing.TB, name string) {
+	t.Helper()
+	if spans := r.Named(name); len(spans) > 0 {
+		t.Errorf("got %d %q spans, want none", len(spans), name)
+	}
+}
+
+// AssertAttributes fails the test unless the span has each of the attributes
+// with the given value.
+func AssertAttributes(t testing.TB, span sdktrace.ReadOnlySpan, want ...attribute.KeyValue) {
+	t.Helper()
+	got := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		got[kv.Key] = kv.Value
+	}
+	for _, kv := range want {
+		v, ok := got[kv.Key]
+		switch {
+		case !ok:
+			t.Errorf("span %q: attribute %s is missing", span.Name(), kv.Key)
+		case v != kv.Value:
+			t.Errorf("span %q: attribute %s = %s, want %s", span.Name(), kv.Key, v.Emit(), kv.Value.Emit())
+		}
+	}
+}
+
+// AssertStatus fails the test unless the span's status has the given code.
+func AssertStatus(t testing.TB, span sdktrace.ReadOnlySpan, want codes.Code) {
+	t.Helper()
+	if got := span.Status(); got.Code != want {
+		t.Errorf("span %q: status %s (%q), want %s", span.Name(), got.Code, got.Description, want)
+	}
+}
+
+// AssertError fails the test unless the span has an error status and a
+// recorded exception event.
+func AssertError(t testing.TB, span sdktrace.ReadOnlySpan) {
+	t.Helper()
+	AssertStatus(t, span, codes.Error)
+	for _, e := range span.Events() {
+		if e.Name == "exception" {
+			return
+		}
+	}
+	t.Errorf("span %q: no exception event recorded", span.Name())
+}
+
+// AssertChildOf fails the test unless child's parent is parent.
+func AssertChildOf(t testing.TB, child, parent sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if got, want := child.Parent().SpanID(), parent.SpanContext().SpanID(); got != want {
+		t.Errorf("span %q: parent span %s, want %q (%s)", child.Name(), got, parent.Name(), want)
+	}
+	if got, want := child.SpanContext().TraceID(), parent.SpanContext().TraceID(); got != want {
+		t.Errorf("span %q: trace %s, want %s", child.Name(), got, want)
+	}
+}
+
+func names(spans []sdktrace.ReadOnlySpan) []string {
+	out := make([]string, len(spans))
+	for i, s := range spans {
+		out[i] = s.Name()
+	}
+	return out
+}
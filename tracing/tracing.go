@@ -3,72 +3,188 @@ package tracing
 import (
 	"context"
 	"log"
+	"os"
+	"sync/atomic"
+
+	"app/buildinfo"
+	"app/config"
+	"app/instrumentation"
+	"app/limits"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-// InitTracer initializes OpenTelemetry and returns a shutdown function.
-func InitTracer() func(context.Context) {
-	ctx := context.Background()
+const instrumentationName = "app/tracing"
+
+// initialized is set while the providers and exporters are installed.
+var initialized atomic.Bool
+
+// endpoint is the OTLP endpoint the exporters were configured with.
+var endpoint atomic.Value
 
-	// OTel Collector endpoint.
-	otlpEndpoint := "localhost:4318"
+// newExporters creates the span and metric exporters. OTLP exporters send
+// over HTTP to the collector; stdout exporters print JSON for local
+// development without one.
+func newExporters(ctx context.Context, telemetry config.Telemetry) (sdktrace.SpanExporter, sdkmetric.Exporter) {
+	if telemetry.Exporter == config.ExporterStdout {
+		endpoint.Store("")
+		traceExporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			log.Fatalf("failed to create stdout trace exporter: %v", err)
+		}
+		metricExporter, err := stdoutmetric.New(stdoutmetric.WithWriter(os.Stdout))
+		if err != nil {
+			log.Fatalf("failed to create stdout metric exporter: %v", err)
+		}
+		return traceExporter, metricExporter
+	}
 
+	endpoint.Store(telemetry.OTLPEndpoint)
 	// Configure the OTLP HTTP trace exporter (sends traces over HTTP).
-	traceExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(otlpEndpoint), otlptracehttp.WithInsecure())
+	traceOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(telemetry.OTLPEndpoint)}
+	if telemetry.Insecure {
+		traceOpts = append(traceOpts, otlptracehttp.WithInsecure())
+	}
+	traceExporter, err := otlptracehttp.New(ctx, traceOpts...)
 	if err != nil {
 		log.Fatalf("failed to create OTLP trace exporter: %v", err)
 	}
 
 	// Configure the OTLP HTTP metric exporter (sends metrics over HTTP).
-	metricExporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpoint(otlpEndpoint), otlpmetrichttp.WithInsecure())
+	metricOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(telemetry.OTLPEndpoint)}
+	if telemetry.Insecure {
+		metricOpts = append(metricOpts, otlpmetrichttp.WithInsecure())
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, metricOpts...)
 	if err != nil {
 		log.Fatalf("failed to create OTLP metric exporter: %v", err)
 	}
+	return traceExporter, metricExporter
+}
+
+// Initialized reports whether InitTracer has set up the exporters and they have
+// not been shut down.
+func Initialized() bool {
+	return initialized.Load()
+}
+
+// Endpoint returns the OTel Collector's OTLP/HTTP endpoint (host:port), or ""
+// before InitTracer and when exporting to stdout.
+func Endpoint() string {
+	e, _ := endpoint.Load().(string)
+	return e
+}
+
+// InitTracer initializes OpenTelemetry for the service, exporting to the
+// configured collector (or to stdout, or memory) and pushing profiles to the
+// configured profiling backend, and returns a shutdown function.
+func InitTracer(service config.Service, telemetry config.Telemetry) func(context.Context) {
+	ctx := context.Background()
+	var (
+		spanProcessor sdktrace.SpanProcessor
+		metricReader  sdkmetric.Reader
+	)
+	if telemetry.Exporter == config.ExporterMemory {
+		spanProcessor, metricReader = newMemory()
+	} else {
+		traceExporter, metricExporter := newExporters(ctx, telemetry)
+		spanProcessor, metricReader = sdktrace.NewBatchSpanProcessor(traceExporter), sdkmetric.NewPeriodicReader(metricExporter)
+	}
 
 	// Define the service resource. These attributes are applied to all telemetry (e.g., for SigNoz).
+	// The build information identifies the deployed binary, and the runtime
+	// limits the capacity it runs with.
+	buildinfo.SetVersion(service.Version)
 	res, err := resource.New(ctx,
 		resource.WithAttributes(
-			semconv.ServiceName("sc-go-app-backend"),
-			semconv.ServiceVersion("1.0.0"),
-			semconv.DeploymentEnvironment("development"),
+			semconv.ServiceName(service.Name),
+			semconv.DeploymentEnvironment(service.Environment),
 		),
+		resource.WithAttributes(buildinfo.Get().Attributes()...),
+		resource.WithAttributes(limits.Get().Attributes()...),
 	)
 	if err != nil {
 		log.Fatalf("failed to create resource: %v", err)
 	}
 
 	// --- Create and set up the Tracer Provider ---
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(traceExporter),
+	// Route tags and how the span was sampled are added to spans as they
+	// start, before they are batched.
+	// New traces are sampled at the configured ratio; traces continued from
+	// upstream keep the caller's decision.
+	// The ratio can be changed at runtime with SetSampleRatio.
+	// The last finished spans are also kept for the /debug/traces viewer.
+	SetSampleRatio(telemetry.SampleRatio)
+	tpOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(rootSampler)),
+		sdktrace.WithSpanProcessor(routeTagsProcessor{}),
+		sdktrace.WithSpanProcessor(samplingProcessor{}),
+		sdktrace.WithSpanProcessor(spanProcessor),
 		sdktrace.WithResource(res),
-	)
-	otel.SetTracerProvider(tp)
+	}
+	recent.reset(telemetry.RecentSpans)
+	if telemetry.RecentSpans > 0 {
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(recent))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
+	// The global providers hand requests marked by the instrumentation A/B
+	// switch no-op spans and instruments, and can mirror spans as
+	// runtime/trace tasks; see noop.go.
+	instrumentation.SetNoopPercent(telemetry.NoopPercent)
+	SetRuntimeTraceTasks(telemetry.RuntimeTraceTasks)
+	otel.SetTracerProvider(switchTracerProvider{tp: tp})
 
 	// --- Create and set up the Meter Provider ---
+	// Metrics are pushed over OTLP (or kept in memory) and can also be
+	// scraped from /metrics. The view sets the attributes kept on HTTP server
+	// metrics.
 	mp := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithReader(metricReader),
+		sdkmetric.WithReader(promReader),
 		sdkmetric.WithResource(res),
+		sdkmetric.WithView(httpServerView()),
 	)
-	otel.SetMeterProvider(mp)
+	otel.SetMeterProvider(switchMeterProvider{mp})
+
+	// Set the global propagator, and the response propagator
+	setPropagators(telemetry.Propagators)
+	// The requests kept out of traces, for TraceFilter.
+	traceExclude.Store(telemetry.TraceExclude)
+	initialized.Store(true)
 
-	// Set the global propagator
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	// Continuous profiles, when a profiling backend is configured, carry the
+	// same resource attributes so they sit next to the traces and metrics.
+	stopProfiler := func(context.Context) {}
+	if telemetry.ProfilingEndpoint != "" {
+		stopProfiler = startProfiler(telemetry.ProfilingEndpoint, telemetry.ProfilingInterval, res)
+	}
 
-	// Return a shutdown function to be called on application exit.
+	// Return a shutdown function to be called on application exit, after the
+	// servers have stopped. The last profile is pushed, spans are flushed,
+	// then a final metric collection is exported, and only then are the
+	// providers shut down, so telemetry recorded while draining is not lost.
 	return func(ctx context.Context) {
-		if err := mp.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down meter provider: %v", err)
+		stopProfiler(ctx)
+		if err := tp.ForceFlush(ctx); err != nil {
+			log.Printf("Error flushing spans: %v", err)
+		}
+		if err := mp.ForceFlush(ctx); err != nil {
+			log.Printf("Error flushing metrics: %v", err)
 		}
+		initialized.Store(false)
 		if err := tp.Shutdown(ctx); err != nil {
 			log.Printf("Error shutting down tracer provider: %v", err)
 		}
+		if err := mp.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
 	}
 }
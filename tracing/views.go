@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// defaultHTTPMetricAttributes are the attributes kept on HTTP server metrics
+// unless HTTP_METRIC_ATTRIBUTES is set. Both the stable and the older otelhttp
+// attribute names are listed. Host names and ports are left out: they come
+// from the client's Host header and would let clients inflate cardinality.
+var defaultHTTPMetricAttributes = []string{
+	"http.request.method", "http.method",
+	"http.response.status_code", "http.status_code",
+	"url.scheme", "http.scheme",
+	"network.protocol.version", "net.protocol.version",
+	"http.route", "error.type",
+	// Route tags and the maintenance flag.
+	"team", "tier", "maintenance",
+	// The state on http.server.open_connections.
+	"http.connection.state",
+}
+
+// legacyHTTPServerMetrics are the metrics otelhttp records under the older
+// HTTP semantic conventions; the stable equivalents are recorded by
+// middleware.ServerMetrics.
+var legacyHTTPServerMetrics = map[string]bool{
+	"http.server.duration":      true,
+	"http.server.request.size":  true,
+	"http.server.response.size": true,
+}
+
+// httpServerView applies the configured attribute set to the http.server.*
+// metrics. With OTEL_SEMCONV_STABILITY_OPT_IN=http the legacy otelhttp metrics
+// are dropped, leaving only the stable ones; by default both are exported.
+//
+// HTTP_METRIC_ATTRIBUTES is a comma-separated list of attribute keys to keep
+// in place of the defaults, or "*" to keep them all.
+func httpServerView() sdkmetric.View {
+	var filter attribute.Filter
+	switch v := os.Getenv("HTTP_METRIC_ATTRIBUTES"); v {
+	case "*":
+	case "":
+		filter = allowKeys(defaultHTTPMetricAttributes)
+	default:
+		filter = allowKeys(strings.Split(v, ","))
+	}
+
+	stableOnly := false
+	for _, opt := range strings.Split(os.Getenv("OTEL_SEMCONV_STABILITY_OPT_IN"), ",") {
+		switch strings.TrimSpace(opt) {
+		case "http":
+			stableOnly = true
+		case "", "http/dup":
+		default:
+			log.Printf("[WARN] ignoring unknown OTEL_SEMCONV_STABILITY_OPT_IN value %q", opt)
+		}
+	}
+
+	return func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		if !strings.HasPrefix(inst.Name, "http.server.") {
+			return sdkmetric.Stream{}, false
+		}
+		stream := sdkmetric.Stream{
+			Name:            inst.Name,
+			Description:     inst.Description,
+			Unit:            inst.Unit,
+			AttributeFilter: filter,
+		}
+		if stableOnly && legacyHTTPServerMetrics[inst.Name] {
+			stream.Aggregation = sdkmetric.AggregationDrop{}
+		}
+		return stream, true
+	}
+}
+
+func allowKeys(keys []string) attribute.Filter {
+	allowed := make([]attribute.Key, 0, len(keys))
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			allowed = append(allowed, attribute.Key(k))
+		}
+	}
+	return attribute.NewAllowKeysFilter(allowed...)
+}